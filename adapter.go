@@ -12,12 +12,124 @@ type Adapter interface {
 	Del(context context.Context, keys ...string) error
 }
 
+// Clock tells the current time to the adapters, which makes the expiration controllable in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock telling the time of the system.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Statser is the optional interface for adapters exposing their internal statistics.
+type Statser interface {
+	Stats() Stats
+}
+
+// Stats records the internal statistics of the adapter.
+type Stats struct {
+	// Hits counts the keys found in the adapter.
+	Hits uint64
+	// Misses counts the keys not found in the adapter.
+	Misses uint64
+	// Sets counts the keys set into the adapter.
+	Sets uint64
+	// Evictions counts the keys removed from the adapter, including deletion and expiration.
+	Evictions uint64
+}
+
+// Sizer is the optional interface for adapters reporting their sizes, e.g. for the capacity planning of local caches.
+type Sizer interface {
+	// Size returns the number of the keys starting with the key prefix and the total length of their values.
+	// The empty key prefix counts all keys.
+	Size(keyPrefix string) (entries int, bytes int)
+}
+
+// KeyLister is the optional interface for adapters listing their keys, e.g. for inspecting the caches in tests.
+type KeyLister interface {
+	// Keys returns the keys starting with the key prefix in the sorted order, excluding the expired ones.
+	Keys(keyPrefix string) []string
+}
+
+// Toucher is the optional interface for adapters supporting to refresh the TTL of existing keys.
+type Toucher interface {
+	// Touch resets the TTL of the existing keys whose remaining TTL is less than the threshold.
+	Touch(context context.Context, keys []string, ttl time.Duration, threshold time.Duration) error
+}
+
+// Locker is the optional interface for adapters supporting the distributed lock.
+type Locker interface {
+	// Lock acquires the locks of the keys with the token and the TTL without blocking, and reports whether each key is locked.
+	Lock(context context.Context, keys []string, token string, ttl time.Duration) ([]bool, error)
+	// Unlock releases the locks of the keys only if they are still held by the token.
+	Unlock(context context.Context, keys []string, token string) error
+}
+
+// Clearer is the optional interface for adapters supporting to delete keys by the key prefix.
+type Clearer interface {
+	// Clear deletes all keys starting with the key prefix.
+	Clear(context context.Context, keyPrefix string) error
+}
+
+// PatternDeleter is the optional interface for adapters supporting to delete keys by the pattern.
+type PatternDeleter interface {
+	// DelPattern deletes all keys matching the glob-style pattern, and returns the deleted keys.
+	// The supported syntax is the same as the pattern of redis SCAN, i.e. *, ?, [...] and the escaping by \.
+	DelPattern(context context.Context, pattern string) ([]string, error)
+}
+
+// GetDeleter is the optional interface for adapters supporting to get and delete the key atomically.
+type GetDeleter interface {
+	// GetDel gets the key and deletes it atomically, the value is invalid if the key doesn't exist.
+	GetDel(context context.Context, key string) (Value, error)
+}
+
+// ListAdapter is the optional interface for adapters supporting the lists appended atomically.
+type ListAdapter interface {
+	// RPush appends the values to the tail of the list of the key, and keeps the latest maxLen values
+	// if maxLen is positive. The TTL of the list is reset as well. It returns ErrNotList if the key holds
+	// the value other than the list.
+	RPush(context context.Context, key string, values [][]byte, maxLen int, ttl time.Duration) error
+	// LRange returns the values of the list from start to stop inclusively, the negative indexes count from the end.
+	// The missing key returns the empty list.
+	LRange(context context.Context, key string, start, stop int) ([][]byte, error)
+}
+
+// ConditionalSetter is the optional interface for adapters supporting to set the key conditionally.
+type ConditionalSetter interface {
+	// SetNX sets the key only if it doesn't exist, and reports whether it's set.
+	SetNX(context context.Context, key string, b []byte, ttl time.Duration, options ...MSetOptions) (bool, error)
+	// SetXX sets the key only if it exists, and reports whether it's set.
+	SetXX(context context.Context, key string, b []byte, ttl time.Duration, options ...MSetOptions) (bool, error)
+}
+
+// HealthChecker is the optional interface for adapters supporting to probe their backends, e.g. for readiness probes.
+// The adapters not implementing it are treated as healthy.
+type HealthChecker interface {
+	// Ping returns the error if the backend is unreachable.
+	Ping(context context.Context) error
+}
+
+// MetaGetter is the optional interface for adapters supplying the metadata of values cheaply.
+type MetaGetter interface {
+	// MGetWithMeta is similar to MGet, but it fills in the remaining TTL of each value as well.
+	MGetWithMeta(context context.Context, keys []string) ([]Value, error)
+}
+
 // MSetOptions is an alias for functional argument.
 type MSetOptions func(opts *msetOptions)
 
 type msetOptions struct {
 	onCostAdd   func(key string, cost int)
 	onCostEvict func(key string, cost int)
+	costFunc    func(key string, b []byte) int
+	noOffset    bool
+	perKeyTTL   map[string]time.Duration
+	keepTTL     bool
+	expireAt    time.Time
 }
 
 // WithOnCostAddFunc sets up the callback when adding the cache with key and cost.
@@ -34,6 +146,54 @@ func WithOnCostEvictFunc(f func(key string, cost int)) MSetOptions {
 	}
 }
 
+// WithCostFunc sets up the function calculating the cost of the key, which overrides the default byte length.
+func WithCostFunc(f func(key string, b []byte) int) MSetOptions {
+	return func(opts *msetOptions) {
+		opts.costFunc = f
+	}
+}
+
+// WithNoOffset disables randomizing the TTL by the offset, so that the keys expire at the precise time.
+func WithNoOffset() MSetOptions {
+	return func(opts *msetOptions) {
+		opts.noOffset = true
+	}
+}
+
+// WithPerKeyTTL sets up the TTLs of the individual keys, the keys not in the map fall back to the TTL of MSet().
+func WithPerKeyTTL(ttls map[string]time.Duration) MSetOptions {
+	return func(opts *msetOptions) {
+		opts.perKeyTTL = ttls
+	}
+}
+
+// WithKeepTTL keeps the remaining TTLs of the existing keys when overwriting them, i.e. SET ... KEEPTTL of redis,
+// so that refreshing the values doesn't extend their expiration. The TTL of MSet() and WithPerKeyTTL() are ignored,
+// and the new keys never expire. It requires redis 6.0 or later, and it's a no-op for tinyLFU.
+func WithKeepTTL() MSetOptions {
+	return func(opts *msetOptions) {
+		opts.keepTTL = true
+	}
+}
+
+// WithExpireAt expires the keys at the absolute time instead of the TTL of MSet(), i.e. SET ... PXAT of redis.
+// It takes precedence over WithPerKeyTTL() and WithKeepTTL(), and no offset is added. It requires redis 6.2 or later,
+// and tinyLFU honors it as well.
+func WithExpireAt(t time.Time) MSetOptions {
+	return func(opts *msetOptions) {
+		opts.expireAt = t
+	}
+}
+
+// ttlOf returns the TTL of the key, which is the per-key TTL if specified, otherwise the given one.
+func (opts *msetOptions) ttlOf(key string, ttl time.Duration) time.Duration {
+	if keyTTL, ok := opts.perKeyTTL[key]; ok {
+		return keyTTL
+	}
+
+	return ttl
+}
+
 func loadMSetOptions(options ...MSetOptions) *msetOptions {
 	opts := &msetOptions{}
 	for _, option := range options {
@@ -49,4 +209,7 @@ type Value struct {
 	Valid bool
 	// Bytes stands for the return value in byte format.
 	Bytes []byte
+	// TTL stands for the remaining TTL, which is only filled in by MetaGetter.
+	// It's zero if the adapter doesn't support it or the value never expires.
+	TTL time.Duration
 }
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+// batcher implements Batcher by accumulating the latest operation of each key.
+type batcher struct {
+	ctx    context.Context
+	cache  *cache
+	cfg    *config
+	prefix string
+
+	mut sync.Mutex
+	// sets and dels are disjoint, the later operation of the key overrides the former one
+	sets map[string][]byte
+	dels map[string]struct{}
+}
+
+func (c *cache) Batch(ctx context.Context, prefix string) Batcher {
+	return &batcher{
+		ctx:    ctx,
+		cache:  c,
+		cfg:    c.configs[prefix],
+		prefix: prefix,
+		sets:   map[string][]byte{},
+		dels:   map[string]struct{}{},
+	}
+}
+
+func (b *batcher) Set(key string, value interface{}) error {
+	if b.cfg == nil {
+		return ErrPfxNotRegistered
+	}
+
+	bs, err := b.cfg.marshal(b.ctx, value)
+	if err != nil {
+		return err
+	}
+
+	cacheKey := getCacheKey(b.prefix, key)
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	delete(b.dels, cacheKey)
+	b.sets[cacheKey] = bs
+
+	return nil
+}
+
+func (b *batcher) Del(keys ...string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	for _, key := range keys {
+		cacheKey := getCacheKey(b.prefix, key)
+		delete(b.sets, cacheKey)
+		b.dels[cacheKey] = struct{}{}
+	}
+}
+
+func (b *batcher) Flush() error {
+	if b.cfg == nil {
+		return ErrPfxNotRegistered
+	}
+
+	b.mut.Lock()
+	sets, dels := b.sets, b.dels
+	b.sets, b.dels = map[string][]byte{}, map[string]struct{}{}
+	b.mut.Unlock()
+
+	evicting := []string{}
+	defer func() {
+		// broadcast the evictions of the applied operations at once
+		if len(evicting) != 0 {
+			b.cache.evictRemoteKeys(b.ctx, evicting...)
+		}
+	}()
+
+	if len(dels) != 0 {
+		keys := make([]string, 0, len(dels))
+		for k := range dels {
+			keys = append(keys, k)
+		}
+
+		evicted, err := b.cache.remove(b.ctx, b.cfg, keys...)
+		if err != nil {
+			return err
+		}
+		evicting = append(evicting, evicted...)
+	}
+
+	if len(sets) != 0 {
+		evicted, err := b.cache.store(b.ctx, b.cfg, sets)
+		// the keys are evicted even if it fails, e.g. refilling the local cache fails after the shared cache is written
+		evicting = append(evicting, evicted...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockBatchCTX = context.Background()
+)
+
+// countingPubsub records the published messages without delivering them.
+type countingPubsub struct {
+	mut      sync.Mutex
+	messages [][]byte
+	messChan chan Message
+}
+
+func (pb *countingPubsub) Pub(ctx context.Context, topic string, message []byte) error {
+	pb.mut.Lock()
+	defer pb.mut.Unlock()
+
+	pb.messages = append(pb.messages, message)
+	return nil
+}
+
+func (pb *countingPubsub) Sub(ctx context.Context, topic ...string) <-chan Message {
+	return pb.messChan
+}
+
+func (pb *countingPubsub) Close() {
+	close(pb.messChan)
+}
+
+func (pb *countingPubsub) published() [][]byte {
+	pb.mut.Lock()
+	defer pb.mut.Unlock()
+
+	return pb.messages
+}
+
+type batchSuite struct {
+	suite.Suite
+
+	sharedLog *RecordLog
+	localLog  *RecordLog
+	pubsub    *countingPubsub
+	factory   Factory
+	cache     Cache
+}
+
+func (s *batchSuite) SetupSuite() {}
+
+func (s *batchSuite) TearDownSuite() {}
+
+func (s *batchSuite) SetupTest() {
+	var shared, local Adapter
+	shared, s.sharedLog = NewRecordingAdapter(NewTinyLFU(10000))
+	local, s.localLog = NewRecordingAdapter(NewTinyLFU(10000))
+	s.pubsub = &countingPubsub{messChan: make(chan Message)}
+	s.factory = NewFactory(shared, local, WithPubSub(s.pubsub))
+	s.cache = s.factory.NewCache([]Setting{
+		{
+			Prefix: "batch",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+}
+
+func (s *batchSuite) TearDownTest() {
+	// prevent registering twice
+	s.factory.ClearPrefix()
+
+	s.factory.Close()
+}
+
+func TestBatchSuite(t *testing.T) {
+	suite.Run(t, new(batchSuite))
+}
+
+func (s *batchSuite) TestFlush() {
+	s.Require().NoError(s.cache.Set(mockBatchCTX, "batch", "key0", mockString))
+	s.sharedLog.Reset()
+	s.localLog.Reset()
+	published := len(s.pubsub.published())
+
+	b := s.cache.Batch(mockBatchCTX, "batch")
+	s.Require().NoError(b.Set("key1", "v1"))
+	s.Require().NoError(b.Set("key2", "v2"))
+	s.Require().NoError(b.Set("key1", "v1-latest"))
+	b.Del("key0", "key2")
+
+	// nothing applied before flushing
+	s.Require().Empty(s.sharedLog.Records())
+	s.Require().NoError(b.Flush())
+
+	key0, key1, key2 := getCacheKey("batch", "key0"), getCacheKey("batch", "key1"), getCacheKey("batch", "key2")
+	expRecords := func(ttl time.Duration) []Record {
+		return []Record{
+			{Op: RecordOpDel, Keys: []string{key0, key2}},
+			{Op: RecordOpMSet, Keys: []string{key1}, TTL: ttl},
+		}
+	}
+	s.Require().Equal(expRecords(time.Hour), sortDelKeys(s.sharedLog.Records()))
+	s.Require().Equal(expRecords(time.Minute), sortDelKeys(s.localLog.Records()))
+
+	// a single coalesced eviction
+	messages := s.pubsub.published()
+	s.Require().Len(messages, published+1)
+	var body eventBody
+	s.Require().NoError(json.Unmarshal(messages[len(messages)-1], &body))
+	s.Require().ElementsMatch([]string{key0, key1, key2}, body.Keys)
+
+	var ret string
+	s.Require().NoError(s.cache.Get(mockBatchCTX, "batch", "key1", &ret))
+	s.Require().Equal("v1-latest", ret)
+	s.Require().Equal(ErrCacheMiss, s.cache.Get(mockBatchCTX, "batch", "key0", &ret))
+	s.Require().Equal(ErrCacheMiss, s.cache.Get(mockBatchCTX, "batch", "key2", &ret))
+
+	// reusable, and nothing happens without operations
+	s.sharedLog.Reset()
+	published = len(s.pubsub.published())
+	s.Require().NoError(b.Flush())
+	s.Require().Empty(s.sharedLog.Records())
+	s.Require().Len(s.pubsub.published(), published)
+}
+
+func (s *batchSuite) TestNotRegistered() {
+	b := s.cache.Batch(mockBatchCTX, "not-registered")
+	s.Require().Equal(ErrPfxNotRegistered, b.Set("key", mockString))
+	b.Del("key")
+	s.Require().Equal(ErrPfxNotRegistered, b.Flush())
+}
+
+// sortDelKeys sorts the keys of Del records, which are collected from maps in random order.
+func sortDelKeys(records []Record) []Record {
+	for _, r := range records {
+		if r.Op == RecordOpDel {
+			sort.Strings(r.Keys)
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	// expireAtLen is the length of the expiration stamped before the value of each entry
+	expireAtLen = 8
+	// costLen is the length of the cost stamped after the expiration, which is reported when the entry is evicted
+	costLen = 8
+	// entryHeaderLen is the length of the stamps before the value of each entry
+	entryHeaderLen = expireAtLen + costLen
+)
+
+// NewBigCache generates Adapter with BigCache, which stores the entries in the byte arenas with the near-zero
+// GC impact, and suits the very large local caches.
+// BigCache expires all entries by the same LifeWindow of the config, so the TTL of each key is capped by it.
+// Each entry is stamped with its own expiration and cost, and treated as missing after expiring, but the space is reclaimed
+// only when the LifeWindow passes on the granularity of the CleanWindow, which is coarser than tinyLFU.
+// The OnRemove and OnRemoveWithReason callbacks of the config receive the values without the stamp, and
+// OnRemoveWithMetadata is not supported since it suppresses others.
+func NewBigCache(cfg bigcache.Config) Adapter {
+	if cfg.OnRemoveWithMetadata != nil {
+		panic(errors.New("OnRemoveWithMetadata not supported"))
+	}
+
+	adp := &bigCache{lifeWindow: cfg.LifeWindow}
+
+	onRemove, onRemoveWithReason := cfg.OnRemove, cfg.OnRemoveWithReason
+	cfg.OnRemove = nil
+	cfg.OnRemoveWithReason = func(key string, entry []byte, reason bigcache.RemoveReason) {
+		if len(entry) < entryHeaderLen {
+			return
+		}
+
+		b := entry[entryHeaderLen:]
+		adp.evicted(key, entry)
+		if onRemove != nil {
+			onRemove(key, b)
+		} else if onRemoveWithReason != nil {
+			onRemoveWithReason(key, b, reason)
+		}
+	}
+
+	bc, err := bigcache.New(context.Background(), cfg)
+	if err != nil {
+		panic(err)
+	}
+	adp.bc = bc
+
+	return adp
+}
+
+type bigCache struct {
+	bc         *bigcache.BigCache
+	lifeWindow time.Duration
+	// evictOpts holds the *msetOptions of the latest MSet(), BigCache shares the removal callback among all entries
+	evictOpts atomic.Value
+}
+
+// MSet sets the keys with the TTL capped by the LifeWindow. The cost callbacks are based on the value length
+// unless the cost function is specified. The cost is stamped on each entry and reported as it is when evicting,
+// but the latest eviction callback is used since BigCache doesn't keep the callbacks for each entry.
+func (adp *bigCache) MSet(
+	ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions,
+) error {
+	if len(keyVals) == 0 {
+		return nil
+	}
+
+	o := loadMSetOptions(options...)
+	adp.evictOpts.Store(o)
+
+	now := time.Now()
+	for key, b := range keyVals {
+		keyTTL := o.ttlOf(key, ttl)
+		if adp.lifeWindow > 0 && keyTTL > adp.lifeWindow {
+			keyTTL = adp.lifeWindow
+		}
+		expireAt := now.Add(keyTTL).UnixNano()
+
+		// the overwritten entry is not removed by BigCache, evict its cost here
+		if o.onCostEvict != nil {
+			if old, err := adp.bc.Get(key); err == nil && len(old) >= entryHeaderLen {
+				adp.evicted(key, old)
+			}
+		}
+
+		// the entries not counted by the cost callbacks are stamped with 0, so evicting them reports nothing
+		cost := 0
+		if o.onCostAdd != nil {
+			cost = entryCost(o, key, b)
+		}
+
+		entry := make([]byte, entryHeaderLen+len(b))
+		binary.BigEndian.PutUint64(entry, uint64(expireAt))
+		binary.BigEndian.PutUint64(entry[expireAtLen:], uint64(int64(cost)))
+		copy(entry[entryHeaderLen:], b)
+		if err := adp.bc.Set(key, entry); err != nil {
+			return err
+		}
+
+		if o.onCostAdd != nil {
+			o.onCostAdd(key, cost)
+		}
+	}
+
+	return nil
+}
+
+func (adp *bigCache) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	now := time.Now().UnixNano()
+
+	vals := make([]Value, len(keys))
+	for i, key := range keys {
+		entry, err := adp.bc.Get(key)
+		if errors.Is(err, bigcache.ErrEntryNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(entry) < entryHeaderLen {
+			continue
+		}
+
+		if int64(binary.BigEndian.Uint64(entry)) <= now {
+			// expired before the LifeWindow passes
+			adp.bc.Delete(key)
+			continue
+		}
+
+		vals[i] = Value{Valid: true, Bytes: entry[entryHeaderLen:]}
+	}
+
+	return vals, nil
+}
+
+func (adp *bigCache) Del(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := adp.bc.Delete(key); err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evicted invokes the cost eviction callback of the latest MSet() with the cost stamped on the entry if necessary.
+func (adp *bigCache) evicted(key string, entry []byte) {
+	o, ok := adp.evictOpts.Load().(*msetOptions)
+	if !ok || o.onCostEvict == nil {
+		return
+	}
+
+	cost := int(int64(binary.BigEndian.Uint64(entry[expireAtLen:entryHeaderLen])))
+	if cost == 0 {
+		return
+	}
+
+	o.onCostEvict(key, cost)
+}
+
+// entryCost returns the cost of the key by the cost function, or the byte length of the value.
+func entryCost(o *msetOptions, key string, b []byte) int {
+	if o.costFunc != nil {
+		return o.costFunc(key, b)
+	}
+
+	return len(b)
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockBigCacheCTX = context.Background()
+)
+
+func mockBigCacheConfig() bigcache.Config {
+	cfg := bigcache.DefaultConfig(time.Minute)
+	cfg.Shards = 16
+	cfg.MaxEntriesInWindow = 1000
+	cfg.MaxEntrySize = 64
+	cfg.CleanWindow = 0
+	return cfg
+}
+
+type bigCacheSuite struct {
+	suite.Suite
+
+	bc *bigCache
+}
+
+func (s *bigCacheSuite) SetupSuite() {}
+
+func (s *bigCacheSuite) TearDownSuite() {}
+
+func (s *bigCacheSuite) SetupTest() {
+	s.bc = NewBigCache(mockBigCacheConfig()).(*bigCache)
+}
+
+func (s *bigCacheSuite) TearDownTest() {
+	s.Require().NoError(s.bc.bc.Close())
+}
+
+func TestBigCacheSuite(t *testing.T) {
+	suite.Run(t, new(bigCacheSuite))
+}
+
+func (s *bigCacheSuite) TestMSetMGetDel() {
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{
+		"key1": []byte("v1"),
+		"key2": {},
+	}, time.Hour))
+
+	vals, err := s.bc.MGet(mockBigCacheCTX, []string{"key1", "key2", "not-existed"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{
+		{Valid: true, Bytes: []byte("v1")},
+		{Valid: true, Bytes: []byte{}},
+		{Valid: false, Bytes: nil},
+	}, vals)
+
+	s.Require().NoError(s.bc.Del(mockBigCacheCTX, "key1", "not-existed"))
+	vals, err = s.bc.MGet(mockBigCacheCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte{}}}, vals)
+}
+
+func (s *bigCacheSuite) TestMSetWithTTL() {
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{"key": []byte("v")}, 10*time.Millisecond))
+
+	time.Sleep(20 * time.Millisecond)
+	vals, err := s.bc.MGet(mockBigCacheCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+
+	// expired entries are removed
+	_, err = s.bc.bc.Get("key")
+	s.Require().ErrorIs(err, bigcache.ErrEntryNotFound)
+}
+
+func (s *bigCacheSuite) TestMSetWithTTLCappedByLifeWindow() {
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{"key": []byte("v")}, 24*time.Hour))
+
+	entry, err := s.bc.bc.Get("key")
+	s.Require().NoError(err)
+	vals, err := s.bc.MGet(mockBigCacheCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v")}}, vals)
+
+	expireAt := time.Unix(0, int64(binary.BigEndian.Uint64(entry)))
+	s.Require().WithinDuration(time.Now().Add(time.Minute), expireAt, time.Second)
+}
+
+func (s *bigCacheSuite) TestCostCallbacks() {
+	removed := []string{}
+	cfg := mockBigCacheConfig()
+	cfg.OnRemoveWithReason = func(key string, entry []byte, reason bigcache.RemoveReason) {
+		removed = append(removed, key+":"+string(entry))
+	}
+	s.Require().NoError(s.bc.bc.Close())
+	s.bc = NewBigCache(cfg).(*bigCache)
+
+	added, evicted := map[string]int{}, map[string]int{}
+	opts := []MSetOptions{
+		WithOnCostAddFunc(func(key string, cost int) { added[key] += cost }),
+		WithOnCostEvictFunc(func(key string, cost int) { evicted[key] += cost }),
+	}
+
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{"key1": []byte("v1"), "key2": []byte("v22")}, time.Hour, opts...))
+	s.Require().Equal(map[string]int{"key1": 2, "key2": 3}, added)
+	s.Require().Empty(evicted)
+
+	// overwritten
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{"key1": []byte("v111")}, time.Hour, opts...))
+	s.Require().Equal(map[string]int{"key1": 6, "key2": 3}, added)
+	s.Require().Equal(map[string]int{"key1": 2}, evicted)
+
+	// deleted
+	s.Require().NoError(s.bc.Del(mockBigCacheCTX, "key2"))
+	s.Require().Equal(map[string]int{"key1": 2, "key2": 3}, evicted)
+	s.Require().Equal([]string{"key2:v22"}, removed)
+
+	// by cost function
+	opts = append(opts, WithCostFunc(func(key string, b []byte) int { return 1 }))
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{"key3": []byte("v3")}, time.Hour, opts...))
+	s.Require().Equal(1, added["key3"])
+
+	// the cost stamped on the entry is evicted, even though the latest options differ
+	s.Require().NoError(s.bc.MSet(mockBigCacheCTX, map[string][]byte{"key4": []byte("v4")}, time.Hour, opts[:2]...))
+	s.Require().NoError(s.bc.Del(mockBigCacheCTX, "key3"))
+	s.Require().Equal(1, evicted["key3"])
+}
+
+func (s *bigCacheSuite) TestNewBigCacheWithInvalidConfig() {
+	cfg := mockBigCacheConfig()
+	cfg.Shards = 3
+	s.Require().Panics(func() { NewBigCache(cfg) })
+
+	cfg = mockBigCacheConfig()
+	cfg.OnRemoveWithMetadata = func(key string, entry []byte, keyMetadata bigcache.Metadata) {}
+	s.Require().Panics(func() { NewBigCache(cfg) })
+}
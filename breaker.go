@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// minBreakerSweep is the number of failures triggering the first sweep of the expired ones
+	minBreakerSweep = 64
+)
+
+// getterBreaker remembers the recent failures of the getter per key, so that the failing origin isn't retried
+// until the failures expire.
+type getterBreaker struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mut      sync.Mutex
+	failures map[string]getterFailure
+	// nextSweep is the number of failures triggering the next sweep of the expired ones
+	nextSweep int
+}
+
+// getterFailure is the error of the getter remembered until expiredAt.
+type getterFailure struct {
+	err       error
+	expiredAt time.Time
+}
+
+func newGetterBreaker(ttl time.Duration) *getterBreaker {
+	return &getterBreaker{
+		ttl:       ttl,
+		now:       time.Now,
+		failures:  map[string]getterFailure{},
+		nextSweep: minBreakerSweep,
+	}
+}
+
+// recentFailure returns the error of the key failed within the TTL, or nil otherwise.
+func (b *getterBreaker) recentFailure(key string) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	f, ok := b.failures[key]
+	if !ok {
+		return nil
+	}
+	if !b.now().Before(f.expiredAt) {
+		delete(b.failures, key)
+		return nil
+	}
+
+	return f.err
+}
+
+// record remembers the error of the key for the TTL.
+func (b *getterBreaker) record(key string, err error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	now := b.now()
+	b.failures[key] = getterFailure{err: err, expiredAt: now.Add(b.ttl)}
+
+	// the keys never requested again are removed by sweeping, which bounds the memory
+	if len(b.failures) < b.nextSweep {
+		return
+	}
+	for k, f := range b.failures {
+		if !now.Before(f.expiredAt) {
+			delete(b.failures, k)
+		}
+	}
+	b.nextSweep = 2 * len(b.failures)
+	if b.nextSweep < minBreakerSweep {
+		b.nextSweep = minBreakerSweep
+	}
+}
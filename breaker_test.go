@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type breakerSuite struct {
+	suite.Suite
+
+	now time.Time
+}
+
+func (s *breakerSuite) SetupSuite() {}
+
+func (s *breakerSuite) TearDownSuite() {}
+
+func (s *breakerSuite) SetupTest() {
+	s.now = time.Date(2022, 11, 23, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *breakerSuite) TearDownTest() {}
+
+func TestBreakerSuite(t *testing.T) {
+	suite.Run(t, new(breakerSuite))
+}
+
+func (s *breakerSuite) newBreaker(ttl time.Duration) *getterBreaker {
+	b := newGetterBreaker(ttl)
+	b.now = func() time.Time { return s.now }
+	return b
+}
+
+func (s *breakerSuite) TestRecentFailure() {
+	b := s.newBreaker(time.Second)
+	failure := errors.New("origin is down")
+
+	s.Require().NoError(b.recentFailure("key"))
+	b.record("key", failure)
+	s.Require().Equal(failure, b.recentFailure("key"))
+	s.Require().NoError(b.recentFailure("other"))
+
+	s.now = s.now.Add(999 * time.Millisecond)
+	s.Require().Equal(failure, b.recentFailure("key"))
+
+	// expired
+	s.now = s.now.Add(time.Millisecond)
+	s.Require().NoError(b.recentFailure("key"))
+	s.Require().Empty(b.failures)
+}
+
+func (s *breakerSuite) TestSweep() {
+	b := s.newBreaker(time.Second)
+	failure := errors.New("origin is down")
+
+	for i := 0; i < minBreakerSweep-1; i++ {
+		b.record("old-"+strconv.Itoa(i), failure)
+	}
+	s.now = s.now.Add(time.Second)
+
+	// the expired failures are swept once the threshold is reached
+	b.record("new", failure)
+	s.Require().Len(b.failures, 1)
+	s.Require().Equal(minBreakerSweep, b.nextSweep)
+	s.Require().Equal(failure, b.recentFailure("new"))
+}
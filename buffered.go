@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BufferedRedis is the Adapter buffering the writes locally, see NewBufferedRedis().
+type BufferedRedis interface {
+	Adapter
+	// Flush writes the buffered writes into the inner adapter immediately.
+	Flush(context context.Context) error
+	// Close stops flushing in the background after writing the remaining buffered writes.
+	Close()
+}
+
+// NewBufferedRedis generates Adapter absorbing the write bursts in front of the inner adapter, e.g. NewRedis().
+// The writes of MSet() are buffered locally and written into the inner adapter as one pipelined batch per TTL,
+// either every flushInterval or when maxBuffer keys are buffered. Only the latest value of each key is kept.
+// MGet() reads the buffered writes first, including the ones being flushed, and Del() discards the buffered writes
+// of the keys before deleting them. The buffered writes failed to flush are kept for the next round unless newer values
+// are written, and the ones beyond maxBuffer keys are dropped, which bounds the memory while the inner adapter is down.
+// The optional interfaces of the inner adapter are not exposed.
+func NewBufferedRedis(inner Adapter, flushInterval time.Duration, maxBuffer int) BufferedRedis {
+	if flushInterval <= 0 {
+		panic(errors.New("invalid flush interval"))
+	}
+	if maxBuffer <= 0 {
+		panic(errors.New("invalid max buffer"))
+	}
+
+	b := &bufferedRedis{
+		inner:     inner,
+		maxBuffer: maxBuffer,
+		pending:   map[string]bufferedWrite{},
+		flushChan: make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.run(flushInterval)
+
+	return b
+}
+
+// bufferedWrite is the buffered value of the key with the arguments of MSet().
+type bufferedWrite struct {
+	b       []byte
+	ttl     time.Duration
+	options []MSetOptions
+}
+
+type bufferedRedis struct {
+	inner     Adapter
+	maxBuffer int
+
+	mut     sync.Mutex
+	pending map[string]bufferedWrite
+	// flushing is the batch written into the inner adapter, which is readable until the writes complete
+	flushing map[string]bufferedWrite
+	// flushMut serializes flushing and deleting, which prevents the deleted keys written by the flushing in-flight
+	flushMut sync.Mutex
+
+	flushChan chan struct{}
+	closeChan chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (adp *bufferedRedis) run(interval time.Duration) {
+	defer adp.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-adp.closeChan:
+			// flush the remaining writes before leaving
+			adp.Flush(context.Background())
+			return
+		case <-ticker.C:
+		case <-adp.flushChan:
+		}
+
+		adp.Flush(context.Background())
+	}
+}
+
+func (adp *bufferedRedis) MSet(
+	ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions,
+) error {
+	if len(keyVals) == 0 {
+		return nil
+	}
+
+	// resolve the per-key TTLs here, since the writes are grouped by TTL when flushing
+	o := loadMSetOptions(options...)
+
+	adp.mut.Lock()
+	for k, b := range keyVals {
+		adp.pending[k] = bufferedWrite{b: b, ttl: o.ttlOf(k, ttl), options: options}
+	}
+	full := len(adp.pending) >= adp.maxBuffer
+	adp.mut.Unlock()
+
+	if full {
+		select {
+		case adp.flushChan <- struct{}{}:
+		default:
+			// flushing is triggered already
+		}
+	}
+
+	return nil
+}
+
+func (adp *bufferedRedis) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	vals := make([]Value, len(keys))
+	missed := []string{}
+	missedIdx := []int{}
+
+	adp.mut.Lock()
+	for i, k := range keys {
+		if w, ok := adp.pending[k]; ok {
+			vals[i] = Value{Valid: true, Bytes: w.b}
+			continue
+		}
+		if w, ok := adp.flushing[k]; ok {
+			vals[i] = Value{Valid: true, Bytes: w.b}
+			continue
+		}
+
+		missed = append(missed, k)
+		missedIdx = append(missedIdx, i)
+	}
+	adp.mut.Unlock()
+
+	if len(missed) == 0 {
+		return vals, nil
+	}
+
+	innerVals, err := adp.inner.MGet(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, idx := range missedIdx {
+		vals[idx] = innerVals[i]
+	}
+
+	return vals, nil
+}
+
+func (adp *bufferedRedis) Del(ctx context.Context, keys ...string) error {
+	adp.flushMut.Lock()
+	defer adp.flushMut.Unlock()
+
+	adp.mut.Lock()
+	for _, k := range keys {
+		delete(adp.pending, k)
+	}
+	adp.mut.Unlock()
+
+	return adp.inner.Del(ctx, keys...)
+}
+
+func (adp *bufferedRedis) Flush(ctx context.Context) error {
+	adp.flushMut.Lock()
+	defer adp.flushMut.Unlock()
+
+	adp.mut.Lock()
+	pending := adp.pending
+	adp.pending = map[string]bufferedWrite{}
+	adp.flushing = make(map[string]bufferedWrite, len(pending))
+	for k, w := range pending {
+		adp.flushing[k] = w
+	}
+	adp.mut.Unlock()
+
+	// group by TTL, since MSet() sets the same TTL to all keys.
+	// The options are taken from any write of the group, which are the same ones set by the factory in practice.
+	groups := map[time.Duration]map[string][]byte{}
+	options := map[time.Duration][]MSetOptions{}
+	for k, w := range pending {
+		if _, ok := groups[w.ttl]; !ok {
+			groups[w.ttl] = map[string][]byte{}
+		}
+		groups[w.ttl][k] = w.b
+		options[w.ttl] = w.options
+	}
+
+	var lastErr error
+	for ttl, keyVals := range groups {
+		// the per-key TTLs are resolved already, and the ones of the other writes don't apply to the group
+		opts := append(append([]MSetOptions{}, options[ttl]...), WithPerKeyTTL(nil))
+		err := adp.inner.MSet(ctx, keyVals, ttl, opts...)
+
+		adp.mut.Lock()
+		for k := range keyVals {
+			// put them back for the next round unless newer values are written or the buffer is full
+			if _, ok := adp.pending[k]; err != nil && !ok && len(adp.pending) < adp.maxBuffer {
+				adp.pending[k] = pending[k]
+			}
+
+			delete(adp.flushing, k)
+		}
+		adp.mut.Unlock()
+
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func (adp *bufferedRedis) Close() {
+	adp.closeOnce.Do(func() {
+		close(adp.closeChan)
+		adp.wg.Wait()
+	})
+}
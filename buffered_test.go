@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockBufferedCTX = context.Background()
+)
+
+// blockingAdapter blocks MSet() until the error is released, and writes the values if it's nil.
+type blockingAdapter struct {
+	Adapter
+	release chan error
+}
+
+func (adp *blockingAdapter) MSet(ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions) error {
+	if err := <-adp.release; err != nil {
+		return err
+	}
+
+	return adp.Adapter.MSet(ctx, keyVals, ttl, options...)
+}
+
+type bufferedSuite struct {
+	suite.Suite
+
+	inner    Adapter
+	innerLog *RecordLog
+}
+
+func (s *bufferedSuite) SetupSuite() {}
+
+func (s *bufferedSuite) TearDownSuite() {}
+
+func (s *bufferedSuite) SetupTest() {
+	s.inner, s.innerLog = NewRecordingAdapter(NewTinyLFU(10000))
+}
+
+func (s *bufferedSuite) TearDownTest() {}
+
+func TestBufferedSuite(t *testing.T) {
+	suite.Run(t, new(bufferedSuite))
+}
+
+func (s *bufferedSuite) TestNewBufferedRedisWithInvalidArgs() {
+	s.Require().PanicsWithError("invalid flush interval", func() {
+		NewBufferedRedis(s.inner, 0, 10)
+	})
+	s.Require().PanicsWithError("invalid max buffer", func() {
+		NewBufferedRedis(s.inner, time.Second, 0)
+	})
+}
+
+func (s *bufferedSuite) TestMSetAndMGet() {
+	adp := NewBufferedRedis(s.inner, time.Hour, 100)
+	defer adp.Close()
+
+	s.Require().NoError(s.inner.MSet(mockBufferedCTX, map[string][]byte{"flushed": []byte("v0")}, time.Hour))
+	s.innerLog.Reset()
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key": []byte("v1")}, time.Hour))
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key": []byte("v2")}, time.Hour))
+	s.Require().Empty(s.innerLog.Records())
+
+	// the buffered writes are read first, the others are read from the inner adapter
+	vals, err := adp.MGet(mockBufferedCTX, []string{"key", "flushed", "not-existed"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v2")}, {Valid: true, Bytes: []byte("v0")}, {}}, vals)
+	s.Require().Equal([]Record{{Op: RecordOpMGet, Keys: []string{"flushed", "not-existed"}}}, s.innerLog.Records())
+
+	// all keys are buffered
+	s.innerLog.Reset()
+	vals, err = adp.MGet(mockBufferedCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v2")}}, vals)
+	s.Require().Empty(s.innerLog.Records())
+}
+
+func (s *bufferedSuite) TestFlushByInterval() {
+	adp := NewBufferedRedis(s.inner, 50*time.Millisecond, 100)
+	defer adp.Close()
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key": []byte("v1")}, time.Hour))
+	s.Require().Eventually(func() bool {
+		return len(s.innerLog.Records()) > 0
+	}, time.Second, 10*time.Millisecond)
+	s.Require().Equal([]Record{{Op: RecordOpMSet, Keys: []string{"key"}, TTL: time.Hour}}, s.innerLog.Records())
+
+	vals, err := s.inner.MGet(mockBufferedCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v1")}}, vals)
+}
+
+func (s *bufferedSuite) TestFlushByMaxBuffer() {
+	adp := NewBufferedRedis(s.inner, time.Hour, 2)
+	defer adp.Close()
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1")}, time.Hour))
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key2": []byte("v2")}, time.Hour))
+	s.Require().Eventually(func() bool {
+		return len(s.innerLog.Records()) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	records := s.innerLog.Records()
+	s.Require().Len(records, 1)
+	s.Require().ElementsMatch([]string{"key1", "key2"}, records[0].Keys)
+}
+
+func (s *bufferedSuite) TestFlushGroupedByTTL() {
+	adp := NewBufferedRedis(s.inner, time.Hour, 100)
+	defer adp.Close()
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1"), "key2": []byte("v2")}, time.Hour))
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key3": []byte("v3")}, time.Minute))
+	s.Require().NoError(adp.Flush(mockBufferedCTX))
+
+	ttlKeys := map[time.Duration][]string{}
+	for _, r := range s.innerLog.Records() {
+		s.Require().Equal(RecordOpMSet, r.Op)
+		ttlKeys[r.TTL] = append(ttlKeys[r.TTL], r.Keys...)
+	}
+	s.Require().Len(ttlKeys, 2)
+	s.Require().ElementsMatch([]string{"key1", "key2"}, ttlKeys[time.Hour])
+	s.Require().Equal([]string{"key3"}, ttlKeys[time.Minute])
+}
+
+func (s *bufferedSuite) TestFlushWithPerKeyTTL() {
+	adp := NewBufferedRedis(s.inner, time.Hour, 100)
+	defer adp.Close()
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1"), "key2": []byte("v2")}, time.Hour,
+		WithPerKeyTTL(map[string]time.Duration{"key1": time.Minute})))
+	// key1 is overwritten with the batch TTL afterwards
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1")}, time.Hour))
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key3": []byte("v3")}, time.Hour,
+		WithPerKeyTTL(map[string]time.Duration{"key3": time.Minute})))
+	s.Require().NoError(adp.Flush(mockBufferedCTX))
+
+	ttlKeys := map[time.Duration][]string{}
+	for _, r := range s.innerLog.Records() {
+		ttlKeys[r.TTL] = append(ttlKeys[r.TTL], r.Keys...)
+	}
+	s.Require().ElementsMatch([]string{"key1", "key2"}, ttlKeys[time.Hour])
+	s.Require().Equal([]string{"key3"}, ttlKeys[time.Minute])
+}
+
+func (s *bufferedSuite) TestDel() {
+	adp := NewBufferedRedis(s.inner, time.Hour, 100)
+	defer adp.Close()
+
+	s.Require().NoError(s.inner.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v0")}, time.Hour))
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1"), "key2": []byte("v2")}, time.Hour))
+
+	// both of the buffered writes and the written ones are deleted
+	s.Require().NoError(adp.Del(mockBufferedCTX, "key1"))
+	vals, err := adp.MGet(mockBufferedCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte("v2")}}, vals)
+
+	// the deleted key is not written back by flushing
+	s.Require().NoError(adp.Flush(mockBufferedCTX))
+	vals, err = s.inner.MGet(mockBufferedCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte("v2")}}, vals)
+}
+
+func (s *bufferedSuite) TestFlushWithError() {
+	inner := &failingAdapter{Adapter: s.inner, fail: true}
+	adp := NewBufferedRedis(inner, time.Hour, 100)
+	defer adp.Close()
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1"), "key2": []byte("v1")}, time.Hour))
+	s.Require().Error(adp.Flush(mockBufferedCTX))
+
+	// kept for the next round unless newer values are written
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key2": []byte("v2")}, time.Hour))
+
+	inner.mut.Lock()
+	inner.fail = false
+	inner.mut.Unlock()
+	s.Require().NoError(adp.Flush(mockBufferedCTX))
+
+	vals, err := s.inner.MGet(mockBufferedCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v1")}, {Valid: true, Bytes: []byte("v2")}}, vals)
+}
+
+func (s *bufferedSuite) TestFlushInFlight() {
+	inner := &blockingAdapter{Adapter: s.inner, release: make(chan error)}
+	adp := NewBufferedRedis(inner, time.Hour, 2)
+	b := adp.(*bufferedRedis)
+	flushed := func() bool {
+		b.mut.Lock()
+		defer b.mut.Unlock()
+		return len(b.flushing) == 0
+	}
+
+	// reaching maxBuffer triggers the flushing blocked by the inner adapter
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key1": []byte("v1"), "key2": []byte("v1")}, time.Hour))
+	s.Require().Eventually(func() bool { return !flushed() }, time.Second, time.Millisecond)
+
+	// the writes in-flight are still readable
+	vals, err := adp.MGet(mockBufferedCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v1")}, {Valid: true, Bytes: []byte("v1")}}, vals)
+
+	// the failed writes are put back until maxBuffer keys are buffered, and the others are dropped
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key3": []byte("v1")}, time.Hour))
+	inner.release <- errors.New("failed to set")
+	s.Require().Eventually(flushed, time.Second, time.Millisecond)
+
+	b.mut.Lock()
+	s.Require().Len(b.pending, 2)
+	s.Require().Contains(b.pending, "key3")
+	b.mut.Unlock()
+
+	close(inner.release)
+	adp.Close()
+
+	vals, err = s.inner.MGet(mockBufferedCTX, []string{"key1", "key2", "key3"})
+	s.Require().NoError(err)
+	s.Require().Equal(1, countValid(vals[:2]))
+	s.Require().Equal(Value{Valid: true, Bytes: []byte("v1")}, vals[2])
+}
+
+func countValid(vals []Value) int {
+	n := 0
+	for _, v := range vals {
+		if v.Valid {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (s *bufferedSuite) TestFlushOnClose() {
+	adp := NewBufferedRedis(s.inner, time.Hour, 100)
+
+	s.Require().NoError(adp.MSet(mockBufferedCTX, map[string][]byte{"key": []byte("v1")}, time.Hour))
+	adp.Close()
+	s.Require().Equal([]Record{{Op: RecordOpMSet, Keys: []string{"key"}, TTL: time.Hour}}, s.innerLog.Records())
+
+	// closing twice is fine
+	adp.Close()
+}
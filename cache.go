@@ -1,91 +1,298 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/singleflight"
 )
 
+const (
+	// slidingTTLFraction means the TTL is refreshed when the remaining TTL is less than 1/slidingTTLFraction of it
+	slidingTTLFraction = 2
+	// defaultLockPollInterval is the interval of polling the shared cache when others hold the distributed lock
+	defaultLockPollInterval = 50 * time.Millisecond
+)
+
+var (
+	// tombstone is the value written into the shared cache by Del if the tombstone is enabled
+	tombstone = []byte("\x00go-cache:tombstone\x00")
+)
+
 type cache struct {
-	configs       map[string]*config
-	onCacheHit    func(prefix string, key string, count int)
-	onCacheMiss   func(prefix string, key string, count int)
-	onLCCostAdd   func(key string, cost int)
-	onLCCostEvict func(key string, cost int)
-	mb            *messageBroker
+	// localDisabled is accessed atomically, 1 means the local cache is bypassed
+	localDisabled int32
+
+	configs           map[string]*config
+	onCacheHit        func(prefix string, key string, count int)
+	onCacheMiss       func(prefix string, key string, count int)
+	onLCCostAdd       func(key string, cost int)
+	onLCCostEvict     func(key string, cost int)
+	mb                *messageBroker
+	opTimeout         time.Duration
+	timeoutPolicy     TimeoutPolicy
+	refillPolicy      RefillFailurePolicy
+	onRefillError     func(err error)
+	pooledResults     bool
+	onMGetterFallback func(prefix string, served int, err error)
+	// onStaleServe and onBackgroundRefill observe serving the stale values and revalidating them
+	onStaleServe       func(ctx context.Context, prefix, key string, age time.Duration)
+	onBackgroundRefill func(ctx context.Context, prefix string, keys []string, err error)
+	keyTransformer     func(ctx context.Context, cacheKey string) string
+	// localHitsOnError keeps the local hits and treats others as cache-miss if loading from the shared cache fails
+	localHitsOnError bool
+	// maxMGetKeys limits the number of the deduped keys per MGet, 0 means no limitation
+	maxMGetKeys     int
+	oversizedPolicy OversizedMGetPolicy
+	getterPolicy    GetterFailurePolicy
+	// unmarshalAsMiss removes the values failed to unmarshal and treats them as cache-miss
+	unmarshalAsMiss  bool
+	onUnmarshalError func(prefix string, key string, err error)
+	logger           Logger
+	// background tracks the goroutines outliving the calls, e.g. the revalidations, which the factory closes
+	background *backgroundTasks
 
 	singleflight singleflight.Group
 }
 
 type config struct {
+	prefix    string
 	shared    Adapter
 	local     Adapter
 	sharedTTL time.Duration
 	localTTL  time.Duration
-	mGetter   MGetterFunc
-	marshal   MarshalFunc
-	unmarshal UnmarshalFunc
+	// mGetter is guarded by mGetterMut, since it's replaceable by SetMGetter at runtime
+	mGetter    MGetterFunc
+	mGetterMut sync.RWMutex
+	// mGetterElemType is the type that elements responded by mGetter must be assignable to if it's not nil
+	mGetterElemType reflect.Type
+	// mGetterIgnoreExtra ignores the elements responded by mGetter beyond the keys
+	mGetterIgnoreExtra bool
+	// mGetterFallbacks are tried in order when mGetter fails
+	mGetterFallbacks []MGetterFunc
+	marshal          MarshalWithCtxFunc
+	unmarshal        UnmarshalWithCtxFunc
+	versioned        bool
+	version          uint32
+	localCost        func(key string, b []byte) int
+	lock             *DistributedLock
+
+	writeBehind *writeBehind
+
+	slidingTTL bool
+	// backfillShared writes the local hits through to the shared cache lacking them
+	backfillShared bool
+	// deterministicTTL disables randomizing the TTL of the local cache
+	deterministicTTL bool
+	// tombstoneTTL is the TTL of the tombstones written by Del, 0 means removing the keys immediately
+	tombstoneTTL time.Duration
+	// coalescer collapses the concurrent writes of the same key if it's not nil
+	coalescer *coalescer
+	// breaker caches the errors of the getter in GetByFunc if it's not nil
+	breaker *getterBreaker
+	// touches debounces the touches of the shared cache if SlidingTTL is enabled
+	touches *touchDebouncer
+	// softTTL stamps the soft expiry on the values if it's not zero, the stale values are revalidated in the background
+	softTTL time.Duration
+	// revalidating are the transformed keys being revalidated, guarded by revalidateMut
+	revalidating  map[string]bool
+	revalidateMut sync.Mutex
 }
 
-func (c *cache) GetByFunc(ctx context.Context, prefix, key string, container interface{}, getter OneTimeGetterFunc) error {
+func (c *cache) GetByFunc(
+	ctx context.Context, prefix, key string, container interface{}, getter OneTimeGetterFunc, options ...GetByFuncOptions,
+) error {
 	cfg, ok := c.configs[prefix]
 	if !ok {
 		return ErrPfxNotRegistered
 	}
 
-	intf, err, _ := c.singleflight.Do(getCacheKey(prefix, key), func() (interface{}, error) {
-		cacheKey := getCacheKey(prefix, key)
-		cacheVals, err := c.load(ctx, cfg, cacheKey)
+	o := loadGetByFuncOptions(options...)
+	err := c.getByFunc(ctx, cfg, prefix, key, container, getter, o)
+
+	var missErr *UnmarshalMissError
+	if !errors.As(err, &missErr) {
+		return err
+	}
+
+	// the value failed to unmarshal is removed, and reloaded by the getter once
+	return c.getByFunc(ctx, cfg, prefix, key, container, getter, o)
+}
+
+// flightValue is the value shared by the flight of getByFunc, cached reports whether it's loaded from the cache.
+type flightValue struct {
+	b      []byte
+	cached bool
+}
+
+func (c *cache) getByFunc(
+	ctx context.Context, cfg *config, prefix, key string, container interface{}, getter OneTimeGetterFunc,
+	o *getByFuncOptions,
+) error {
+	cacheKey := getCacheKey(prefix, key)
+	intf, err, _ := c.singleflight.Do(getByFuncFlightKey(c.adapterKey(ctx, cacheKey), container), func() (interface{}, error) {
+		cacheVals, err := c.load(ctx, cfg, false, true, cacheKey)
 		if err != nil {
 			return nil, err
 		}
 
 		// cache hit
-		if cacheVals[0].Valid {
+		if isHit(cfg, cacheVals[0]) {
 			c.onCacheHit(prefix, key, 1)
-			return cacheVals[0].Bytes, nil
+			if age, stale := isStale(cfg, cacheVals[0].Bytes); stale {
+				c.onStaleServe(ctx, prefix, key, age)
+				refill := c.refill
+				if o.refillLocalOnly {
+					refill = c.refillLocal
+				}
+				c.revalidate(ctx, cfg, []string{key}, func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+					intf, err := getter()
+					if err != nil {
+						return nil, err
+					}
+
+					return map[string]interface{}{key: intf}, nil
+				}, refill)
+			}
+			return flightValue{b: cacheVals[0].Bytes, cached: true}, nil
 		}
 
 		// cache missed once
 		c.onCacheMiss(prefix, key, 1)
 
+		// refilled by other nodes holding the lock
+		waited, _, unlock := c.lockOrWait(ctx, cfg, []string{cacheKey})
+		defer unlock()
+		if b, ok := waited[cacheKey]; ok {
+			return flightValue{b: b, cached: true}, nil
+		}
+
+		// the origin failed recently isn't retried until the failure expires
+		if cfg.breaker != nil {
+			if err := cfg.breaker.recentFailure(c.adapterKey(ctx, cacheKey)); err != nil {
+				return nil, &GetterFailedError{Err: err}
+			}
+		}
+
 		// using oneTimeGetter to implement Cache-Aside pattern
 		intf, err := getter()
 		if err != nil {
+			c.logger.Warn("cache: getter failed", "prefix", prefix, "key", key, "err", err)
+			if cfg.breaker != nil {
+				cfg.breaker.record(c.adapterKey(ctx, cacheKey), err)
+			}
 			return nil, err
 		}
 
-		b, err := cfg.marshal(intf)
+		b, err := cfg.marshal(ctx, intf)
 		if err != nil {
 			return nil, err
 		}
 
+		// not refilled until the tombstone expires
+		if isTombstone(cfg, cacheVals[0]) {
+			return flightValue{b: b}, nil
+		}
+
 		// refill cache
-		if err := c.refill(ctx, cfg, map[string][]byte{cacheKey: b}); err != nil {
+		refill := c.refill
+		if o.refillLocalOnly {
+			refill = c.refillLocal
+		}
+		if err := refill(ctx, cfg, map[string][]byte{cacheKey: b}); err != nil {
 			return nil, err
 		}
 
-		return b, nil
+		return flightValue{b: b}, nil
 	})
 
 	if err != nil {
 		return err
 	}
 
-	return cfg.unmarshal(intf.([]byte), container)
+	v := intf.(flightValue)
+	if err := cfg.unmarshal(ctx, v.b, container); err != nil {
+		if !v.cached {
+			return err
+		}
+		return c.unmarshalFailed(ctx, cfg, prefix, key, err)
+	}
+
+	return nil
 }
 
 func (c *cache) Get(ctx context.Context, prefix, key string, container interface{}) error {
-	intf, err, _ := c.singleflight.Do(getCacheKey(prefix, key), func() (interface{}, error) {
+	intf, err, _ := c.singleflight.Do(c.adapterKey(ctx, getCacheKey(prefix, key)), func() (interface{}, error) {
 		return c.MGet(ctx, prefix, key)
 	})
 	if err != nil {
 		return err
 	}
 
-	return intf.(Result).Get(ctx, 0, container)
+	err = intf.(Result).Get(ctx, 0, container)
+	var missErr *UnmarshalMissError
+	if !errors.As(err, &missErr) {
+		return err
+	}
+
+	// the value failed to unmarshal is removed, and reloaded by MGetter once
+	res, err := c.MGet(ctx, prefix, key)
+	if err != nil {
+		return err
+	}
+
+	return res.Get(ctx, 0, container)
+}
+
+func (c *cache) GetRaw(ctx context.Context, prefix, key string, container interface{}) ([]byte, error) {
+	// the flight is shared with Get, both of them take the same result
+	intf, err, _ := c.singleflight.Do(c.adapterKey(ctx, getCacheKey(prefix, key)), func() (interface{}, error) {
+		return c.MGet(ctx, prefix, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := intf.(*result)
+	err = res.Get(ctx, 0, container)
+	var missErr *UnmarshalMissError
+	if errors.As(err, &missErr) {
+		// the value failed to unmarshal is removed, and reloaded by MGetter once like Get
+		r, mgetErr := c.MGet(ctx, prefix, key)
+		if mgetErr != nil {
+			return nil, mgetErr
+		}
+
+		res = r.(*result)
+		err = res.Get(ctx, 0, container)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res.vals[res.index(0)], nil
+}
+
+func (c *cache) GetOrZero(ctx context.Context, prefix, key string, container interface{}) (bool, error) {
+	err := c.Get(ctx, prefix, key, container)
+	if errors.Is(err, ErrCacheMiss) {
+		// reset the container in case it's reused
+		resetValue(container)
+
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 func (c *cache) MGet(ctx context.Context, prefix string, keys ...string) (Result, error) {
@@ -94,298 +301,2256 @@ func (c *cache) MGet(ctx context.Context, prefix string, keys ...string) (Result
 		return nil, ErrPfxNotRegistered
 	}
 
-	if len(keys) == 0 {
-		return &result{unmarshal: cfg.unmarshal}, nil
+	var getter OneTimeMGetterFunc
+	if mGetter := cfg.loadMGetter(); mGetter != nil {
+		getter = c.byMGetter(cfg, mGetter)
 	}
 
-	// TODO: support singleflight in the future
+	return c.mget(ctx, cfg, prefix, keys, getter, false)
+}
 
-	// IdxM means internal index map
-	// dKeys means deduped keys
-	IdxM, dKeys := dedup(keys)
+func (c *cache) MGetInto(ctx context.Context, prefix string, buf Result, keys ...string) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
 
-	res := &result{
-		internalIdx: IdxM,
-		vals:        make([][]byte, len(dKeys)),
-		errs:        make([]error, len(dKeys)),
-		unmarshal:   cfg.unmarshal,
+	// the pooled results are owned by the pool
+	res, ok := buf.(*result)
+	if !ok || res.pooled {
+		return ErrResultBufferInvalid
 	}
 
-	// 1. get from cache
-	keyIdx := getKeyIndex(dKeys)
-	cacheKeys := getCacheKeys(prefix, dKeys)
+	var getter OneTimeMGetterFunc
+	if mGetter := cfg.loadMGetter(); mGetter != nil {
+		getter = c.byMGetter(cfg, mGetter)
+	}
 
-	cacheVals, err := c.load(ctx, cfg, cacheKeys...)
-	if err != nil {
-		return nil, err
+	res.Reset()
+	if err := c.mgetInto(ctx, cfg, prefix, keys, getter, false, res); err != nil {
+		res.Reset()
+		return err
 	}
 
-	missKeys := []string{}
-	for i, k := range dKeys {
-		if !cacheVals[i].Valid {
-			missKeys = append(missKeys, k)
-			res.errs[i] = ErrCacheMiss
-			c.onCacheMiss(prefix, k, 1)
-			continue
-		}
+	return nil
+}
 
-		res.vals[i] = cacheVals[i].Bytes
-		c.onCacheHit(prefix, k, 1)
+func (c *cache) MGetWithMeta(ctx context.Context, prefix string, keys ...string) (Result, []Meta, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return nil, nil, ErrPfxNotRegistered
 	}
 
-	// no cache missing
-	if len(missKeys) == 0 {
-		return res, nil
+	res, err := c.mget(ctx, cfg, prefix, keys, nil, true)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// no mGetter, simple Get & Set pattern, return it directly
-	if cfg.mGetter == nil {
-		return res, nil
+	r := res.(*result)
+	metas := make([]Meta, len(keys))
+	for i := range keys {
+		metas[i] = r.metas[r.index(i)]
 	}
 
-	// 2. using mGetter to implement Cache-Aside pattern
-	intfs, err := cfg.mGetter(missKeys...)
+	return res, metas, nil
+}
+
+func (c *cache) GetMap(
+	ctx context.Context, prefix string, keys []string, valueFactory func() interface{},
+) (map[string]interface{}, map[string]error, error) {
+	res, err := c.MGet(ctx, prefix, keys...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer res.Release()
 
-	vs := reflect.ValueOf(intfs)
-	if vs.Kind() != reflect.Slice {
-		return nil, ErrMGetterResponseNotSlice
-	}
-	if vs.Len() != len(missKeys) {
-		return nil, ErrMGetterResponseLengthInvalid
-	}
+	vals := map[string]interface{}{}
+	errs := map[string]error{}
+	for i, k := range keys {
+		if _, ok := vals[k]; ok {
+			continue
+		}
+		if _, ok := errs[k]; ok {
+			continue
+		}
 
-	m := map[string][]byte{}
-	for i, mk := range missKeys {
-		v := vs.Index(i).Interface()
-		b, err := cfg.marshal(v)
-		if err != nil {
-			res.errs[keyIdx[mk]] = err
+		container := valueFactory()
+		if err := res.Get(ctx, i, container); err != nil {
+			errs[k] = err
 			continue
 		}
 
-		m[getCacheKey(prefix, mk)] = b
-		res.vals[keyIdx[mk]] = b
-		res.errs[keyIdx[mk]] = nil
+		vals[k] = container
 	}
 
-	// 3. load the cache
-	c.refill(ctx, cfg, m)
+	return vals, errs, nil
+}
 
-	return res, nil
+func (c *cache) MGetByFunc(
+	ctx context.Context, prefix string, keys []string, getter OneTimeMGetterFunc,
+) (Result, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return nil, ErrPfxNotRegistered
+	}
+
+	return c.mget(ctx, cfg, prefix, keys, getter, false)
 }
 
-func (c *cache) Del(ctx context.Context, prefix string, keys ...string) error {
+func (c *cache) Refresh(ctx context.Context, prefix string, keys ...string) (Result, error) {
 	cfg, ok := c.configs[prefix]
 	if !ok {
-		return ErrPfxNotRegistered
+		return nil, ErrPfxNotRegistered
 	}
 
-	if len(keys) == 0 {
-		return nil
+	mGetter := cfg.loadMGetter()
+	if mGetter == nil {
+		return nil, ErrMGetterNotSpecified
 	}
 
-	return c.del(ctx, cfg, getCacheKeys(prefix, keys)...)
-}
+	res := c.newResult(cfg)
+	if len(keys) == 0 {
+		return res, nil
+	}
 
-func (c *cache) Set(ctx context.Context, prefix string, key string, value interface{}) error {
-	return c.MSet(ctx, prefix, map[string]interface{}{key: value})
-}
+	dKeys := keys
+	if unique(keys) {
+		res.identity = true
+	} else {
+		if res.internalIdx == nil {
+			res.internalIdx = map[int]int{}
+		}
+		dKeys = dedup(res.internalIdx, keys)
+	}
+	res.resize(len(dKeys))
 
-func (c *cache) MSet(ctx context.Context, prefix string, keyValues map[string]interface{}) error {
-	cfg, ok := c.configs[prefix]
-	if !ok {
-		return ErrPfxNotRegistered
+	intfM, err := c.byMGetter(cfg, mGetter)(ctx, dKeys...)
+	if err != nil {
+		res.Release()
+		return nil, err
 	}
 
 	m := map[string][]byte{}
-	for k, value := range keyValues {
-		b, err := cfg.marshal(value)
+	for i, k := range dKeys {
+		b, err := cfg.marshal(ctx, intfM[k])
 		if err != nil {
-			return err
+			res.errs[i] = fmt.Errorf("marshaling key %q at index %d: %w", k, indexOf(keys, k), err)
+			continue
 		}
 
 		m[getCacheKey(prefix, k)] = b
+		res.vals[i] = b
 	}
 
-	return c.refill(ctx, cfg, m)
-}
-
-func getKeyIndex(keys []string) map[string]int {
-	keyIdx := map[string]int{}
-	for i, k := range keys {
-		keyIdx[k] = i
+	if err := c.refill(ctx, cfg, m); err != nil {
+		res.Release()
+		return nil, err
 	}
 
-	return keyIdx
+	return res, nil
 }
 
-func dedup(params []string) (map[int]int, []string) {
-	if len(params) == 1 {
-		return map[int]int{0: 0}, params
+func (c *cache) MGetAcrossPrefixes(ctx context.Context, reqs []KeyReq) ([]Result, error) {
+	cfgs := make([]*config, len(reqs))
+	for i, req := range reqs {
+		cfg, ok := c.configs[req.Prefix]
+		if !ok {
+			return nil, ErrPfxNotRegistered
+		}
+		cfgs[i] = cfg
 	}
 
-	dedupedKeys := []string{}
-	// dedupedIdx is an indirect index that maps un-dedup idx to dedup idx
-	dedupedIdx := map[int]int{}
-	// m maps param to dedup idx
-	m := map[string]int{}
-	for i, param := range params {
-		if _, ok := m[param]; ok {
-			dedupedIdx[i] = m[param]
-			continue
+	// the values read ahead are taken by loading each prefix instead of reaching the adapters
+	pCtx := context.WithValue(ctx, prefetchedKey{}, c.prefetch(ctx, cfgs, reqs))
+
+	results := make([]Result, len(reqs))
+	for i, req := range reqs {
+		var getter OneTimeMGetterFunc
+		if mGetter := cfgs[i].loadMGetter(); mGetter != nil {
+			getter = withoutPrefetched(c.byMGetter(cfgs[i], mGetter))
 		}
 
-		dedupedIdx[i] = len(dedupedKeys)
-		m[param] = len(dedupedKeys)
-		dedupedKeys = append(dedupedKeys, param)
+		res, err := c.mget(pCtx, cfgs[i], req.Prefix, req.Keys, getter, false)
+		if err != nil {
+			for _, r := range results[:i] {
+				r.Release()
+			}
+			return nil, err
+		}
+		results[i] = res
 	}
 
-	return dedupedIdx, dedupedKeys
+	return results, nil
 }
 
-// load loads data from cache, and refill it if necessary
-func (c *cache) load(ctx context.Context, cfg *config, keys ...string) ([]Value, error) {
-	vals := make([]Value, len(keys))
-	missKeys := make([]string, len(keys))
-	copy(missKeys, keys)
-
-	keyIdx := getKeyIndex(keys)
+// prefetch reads the keys of the requests ahead by one MGet per adapter, the local caches first and then
+// the shared caches for the local misses. The failures are ignored, which leaves the keys to the adapters.
+func (c *cache) prefetch(ctx context.Context, cfgs []*config, reqs []KeyReq) *prefetched {
+	p := &prefetched{vals: map[Adapter]map[string]Value{}}
+
+	aKeys := make([][]string, len(reqs))
+	localKeys := map[Adapter][]string{}
+	for i, req := range reqs {
+		aKeys[i] = c.adapterKeys(ctx, getCacheKeys(req.Prefix, req.Keys))
+		if local := c.localOf(cfgs[i]); local != nil && isComparable(local) {
+			localKeys[local] = append(localKeys[local], aKeys[i]...)
+		}
+	}
+	c.fetchInto(ctx, p, localKeys)
 
-	// 1. load from local cache
-	if cfg.local != nil {
-		// allow the failure when getting local cache
-		vals, _ = cfg.local.MGet(ctx, keys)
+	sharedKeys := map[Adapter][]string{}
+	for i, cfg := range cfgs {
+		if cfg.shared == nil || !isComparable(cfg.shared) {
+			continue
+		}
 
-		missKeys = []string{}
-		for i, val := range vals {
-			if !val.Valid {
-				missKeys = append(missKeys, keys[i])
+		var localVals map[string]Value
+		if local := c.localOf(cfg); local != nil && isComparable(local) {
+			localVals = p.vals[local]
+		}
+		for _, ak := range aKeys[i] {
+			// the local hits are probed in the shared cache only if they're backfilled
+			if !cfg.backfillShared && localVals[ak].Valid {
+				continue
 			}
+			sharedKeys[cfg.shared] = append(sharedKeys[cfg.shared], ak)
 		}
 	}
+	c.fetchInto(ctx, p, sharedKeys)
 
-	// no cache missing
-	if len(missKeys) == 0 {
-		return vals, nil
-	}
+	return p
+}
 
-	// 2. load from shared cache
-	if cfg.shared != nil {
-		missVals, err := cfg.shared.MGet(ctx, missKeys)
-		if err != nil {
-			return nil, err
+// fetchInto reads the keys of each adapter into the prefetched values, in chunks if WithMaxMGetKeys() is specified.
+func (c *cache) fetchInto(ctx context.Context, p *prefetched, adpKeys map[Adapter][]string) {
+	for adp, keys := range adpKeys {
+		if !unique(keys) {
+			keys = dedup(map[int]int{}, keys)
 		}
 
-		// refill missing values into vals
-		for i, mVal := range missVals {
-			vals[keyIdx[missKeys[i]]] = mVal
+		chunkSize := len(keys)
+		if c.maxMGetKeys > 0 && chunkSize > c.maxMGetKeys {
+			chunkSize = c.maxMGetKeys
 		}
-	}
 
-	// 3. refill the local cache if possible
-	if cfg.local != nil {
-		m := map[string][]byte{}
-		for _, k := range keys {
-			val := vals[keyIdx[k]]
-			if val.Valid {
-				m[k] = val.Bytes
+		vals := make(map[string]Value, len(keys))
+		for start := 0; start < len(keys); start += chunkSize {
+			end := start + chunkSize
+			if end > len(keys) {
+				end = len(keys)
 			}
-		}
 
-		if len(m) != 0 {
-			cfg.local.MSet(ctx, m, cfg.localTTL,
-				WithOnCostAddFunc(c.onLCCostAdd),
-				WithOnCostEvictFunc(c.onLCCostEvict),
-			)
+			opCtx, cancel := c.withTimeout(ctx)
+			chunkVals, err := adp.MGet(opCtx, keys[start:end])
+			cancel()
+			if err != nil || len(chunkVals) != end-start {
+				break
+			}
 
-			c.evictRemoteKeyMap(ctx, m)
+			for i, val := range chunkVals {
+				vals[keys[start+i]] = val
+			}
 		}
+		p.vals[adp] = vals
 	}
+}
 
-	return vals, nil
+// prefetchedKey is the context key of the values read ahead by MGetAcrossPrefixes().
+type prefetchedKey struct{}
+
+// prefetched is the values read ahead from the adapters keyed by the adapter keys.
+type prefetched struct {
+	mut  sync.Mutex
+	vals map[Adapter]map[string]Value
 }
 
-// refill refills the cache with given keyBytes
-func (c *cache) refill(ctx context.Context, cfg *config, keyBytes map[string][]byte) error {
-	// set shared cache first if necessary
-	if cfg.shared != nil {
-		if err := cfg.shared.MSet(ctx, keyBytes, cfg.sharedTTL); err != nil {
-			return err
-		}
+// take returns the values of the keys read ahead from the adapter, and ok is false unless all of them are.
+// The values are taken only once, so that reloading the keys afterwards, e.g. waiting for the locks, reaches the adapter.
+func (p *prefetched) take(adp Adapter, keys []string) ([]Value, bool) {
+	if !isComparable(adp) {
+		return nil, false
 	}
 
-	// then, set local cache if necessary
-	if cfg.local != nil {
-		if err := cfg.local.MSet(ctx, keyBytes, cfg.localTTL,
-			WithOnCostAddFunc(c.onLCCostAdd),
-			WithOnCostEvictFunc(c.onLCCostEvict),
-		); err != nil {
-			return nil
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	m := p.vals[adp]
+	vals := make([]Value, len(keys))
+	for i, k := range keys {
+		val, ok := m[k]
+		if !ok {
+			return nil, false
 		}
+		vals[i] = val
+	}
 
-		c.evictRemoteKeyMap(ctx, keyBytes)
+	for _, k := range keys {
+		delete(m, k)
 	}
 
-	return nil
+	return vals, true
 }
 
-func (c *cache) del(ctx context.Context, cfg *config, keys ...string) error {
-	if cfg.shared != nil {
-		if err := cfg.shared.Del(ctx, keys...); err != nil {
-			return err
-		}
+// withoutPrefetched hides the values read ahead from the getter, which might get the keys again by the context.
+func withoutPrefetched(getter OneTimeMGetterFunc) OneTimeMGetterFunc {
+	return func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+		return getter(context.WithValue(ctx, prefetchedKey{}, nil), keys...)
 	}
+}
 
-	if cfg.local != nil {
-		if err := cfg.local.Del(ctx, keys...); err != nil {
-			return err
-		}
+// isComparable reports whether the adapter can be the map key, since the adapters are user-defined.
+func isComparable(adp Adapter) bool {
+	return reflect.TypeOf(adp).Comparable()
+}
 
-		c.evictRemoteKeys(ctx, keys...)
+// mget loads values from the cache, and reloads the missing ones by the getter if possible.
+// The metadata of the hits is kept in the result if withMeta is true.
+func (c *cache) mget(
+	ctx context.Context, cfg *config, prefix string, keys []string, getter OneTimeMGetterFunc, withMeta bool,
+) (Result, error) {
+	if len(keys) == 0 {
+		return &result{internalIdx: map[int]int{}, unmarshal: cfg.unmarshal}, nil
 	}
 
-	return nil
+	// TODO: support singleflight in the future
+
+	res := c.newResult(cfg)
+	if err := c.mgetInto(ctx, cfg, prefix, keys, getter, withMeta, res); err != nil {
+		res.Release()
+		return nil, err
+	}
+
+	return res, nil
 }
 
-func (c *cache) evictRemoteKeyMap(ctx context.Context, keyM map[string][]byte) error {
-	if !c.mb.registered() {
-		// no pubsub, do nothing
+// mgetInto is similar to mget, but it fills the values into the given empty result.
+func (c *cache) mgetInto(
+	ctx context.Context, cfg *config, prefix string, keys []string, getter OneTimeMGetterFunc, withMeta bool, res *result,
+) error {
+	res.unmarshal = cfg.unmarshal
+	if len(keys) == 0 {
 		return nil
 	}
 
-	keys := make([]string, len(keyM))
-	i := 0
-	for k := range keyM {
-		keys[i] = k
-		i++
+	// dKeys means deduped keys, the unique keys skip building the indirect index
+	dKeys := keys
+	if unique(keys) {
+		res.identity = true
+	} else {
+		if res.internalIdx == nil {
+			res.internalIdx = map[int]int{}
+		}
+		dKeys = dedup(res.internalIdx, keys)
 	}
+	res.resize(len(dKeys))
 
-	return c.evictRemoteKeys(ctx, keys...)
-}
-
-func (c *cache) evictRemoteKeys(ctx context.Context, keys ...string) error {
-	if !c.mb.registered() {
-		// no pubsub, do nothing
-		return nil
+	if c.unmarshalAsMiss || c.onUnmarshalError != nil {
+		res.unmarshalFailed = func(ctx context.Context, idx int, err error) error {
+			return c.unmarshalFailed(ctx, cfg, prefix, dKeys[idx], err)
+		}
 	}
 
-	return c.mb.send(ctx, event{
-		Type: EventTypeEvict,
-		Body: eventBody{Keys: keys},
-	})
-}
+	// split the keys into the sequential chunks if there are too many keys
+	chunkSize := len(dKeys)
+	if c.maxMGetKeys > 0 && len(dKeys) > c.maxMGetKeys {
+		if c.oversizedPolicy != OversizedMGetPolicyChunk {
+			return ErrTooManyKeys
+		}
+		chunkSize = c.maxMGetKeys
+	}
 
-type result struct {
-	internalIdx map[int]int
-	vals        [][]byte
-	errs        []error
-	unmarshal   UnmarshalFunc
-}
+	for start := 0; start < len(dKeys); start += chunkSize {
+		end := start + chunkSize
+		if end > len(dKeys) {
+			end = len(dKeys)
+		}
+
+		if err := c.mgetChunk(ctx, cfg, prefix, keys, dKeys[start:end], res, start, getter, withMeta); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mgetChunk loads the deduped keys from the cache into the result starting from the offset,
+// and reloads the missing ones by the getter if possible. The keys are the requested ones for the error messages.
+func (c *cache) mgetChunk(
+	ctx context.Context, cfg *config, prefix string, keys, dKeys []string, res *result, offset int,
+	getter OneTimeMGetterFunc, withMeta bool,
+) error {
+	vals := res.vals[offset : offset+len(dKeys)]
+	errs := res.errs[offset : offset+len(dKeys)]
+	metas := res.metas[offset : offset+len(dKeys)]
+	loaded := res.loaded[offset : offset+len(dKeys)]
+
+	// 1. get from cache
+	keyIdx := getKeyIndex(dKeys)
+	cacheKeys := getCacheKeys(prefix, dKeys)
+	cacheKeyIdx := getKeyIndex(cacheKeys)
+
+	cacheVals, err := c.load(ctx, cfg, withMeta, true, cacheKeys...)
+	if err != nil {
+		return err
+	}
+
+	missKeys := []string{}
+	staleKeys := []string{}
+	staleAges := []time.Duration{}
+	// tombstoned keys are reloaded by the getter but not refilled, and keep ErrNoValue if the getter misses them
+	tombstoned := map[string]bool{}
+	for i, k := range dKeys {
+		if !isHit(cfg, cacheVals[i]) {
+			errs[i] = ErrCacheMiss
+			if isTombstone(cfg, cacheVals[i]) {
+				tombstoned[k] = true
+				errs[i] = ErrNoValue
+			}
+			missKeys = append(missKeys, k)
+			c.onCacheMiss(prefix, k, 1)
+			continue
+		}
+
+		age, stale := isStale(cfg, cacheVals[i].Bytes)
+		if stale {
+			staleKeys = append(staleKeys, k)
+			staleAges = append(staleAges, age)
+		}
+
+		vals[i] = cacheVals[i].Bytes
+		metas[i] = Meta{TTL: cacheVals[i].TTL, Size: len(cacheVals[i].Bytes), Stale: stale}
+		c.onCacheHit(prefix, k, 1)
+	}
+
+	// the stale values are served, and revalidated in the background if possible
+	if getter != nil && len(staleKeys) != 0 {
+		for i, k := range staleKeys {
+			c.onStaleServe(ctx, prefix, k, staleAges[i])
+		}
+		c.revalidate(ctx, cfg, staleKeys, getter, c.refill)
+	}
+
+	// no cache missing
+	if len(missKeys) == 0 {
+		return nil
+	}
+
+	// no getter, simple Get & Set pattern, return it directly
+	if getter == nil {
+		return nil
+	}
+
+	// 2. wait for the keys refilled by other nodes holding the lock
+	waited, reloadKeys, unlock := c.lockOrWait(ctx, cfg, getCacheKeys(prefix, missKeys))
+	defer unlock()
+	if len(waited) != 0 {
+		missKeys = missKeys[:0]
+		for _, ck := range reloadKeys {
+			missKeys = append(missKeys, dKeys[cacheKeyIdx[ck]])
+		}
+
+		for ck, b := range waited {
+			vals[cacheKeyIdx[ck]] = b
+			errs[cacheKeyIdx[ck]] = nil
+		}
+
+		if len(missKeys) == 0 {
+			return nil
+		}
+	}
+
+	// 3. using getter to implement Cache-Aside pattern
+	intfM, err := getter(ctx, missKeys...)
+	if err != nil {
+		c.logger.Warn("cache: getter failed", "prefix", prefix, "keys", missKeys, "err", err)
+		if c.getterPolicy == GetterFailurePolicyFail {
+			return err
+		}
+
+		// the hits are kept, and only the missing keys fail
+		for _, mk := range missKeys {
+			errs[keyIdx[mk]] = err
+		}
+		return nil
+	}
+
+	m := map[string][]byte{}
+	for _, mk := range missKeys {
+		v, ok := intfM[mk]
+		if !ok {
+			// still missing
+			continue
+		}
+
+		b, err := cfg.marshal(ctx, v)
+		if err != nil {
+			errs[keyIdx[mk]] = fmt.Errorf("marshaling key %q at index %d: %w", mk, indexOf(keys, mk), err)
+			continue
+		}
+
+		if !tombstoned[mk] {
+			m[getCacheKey(prefix, mk)] = b
+		}
+		vals[keyIdx[mk]] = b
+		errs[keyIdx[mk]] = nil
+		loaded[keyIdx[mk]] = true
+	}
+
+	// 4. load the cache
+	c.refill(ctx, cfg, m)
+
+	return nil
+}
+
+// byMGetter converts MGetterFunc of the config into OneTimeMGetterFunc by mapping the response slice to the keys.
+// The elements are validated if the element type is specified.
+func (c *cache) byMGetter(cfg *config, mGetter MGetterFunc) OneTimeMGetterFunc {
+	elemType := cfg.mGetterElemType
+	return func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+		intfs, err := mGetter(keys...)
+		if err != nil && len(cfg.mGetterFallbacks) != 0 {
+			intfs, err = c.fallback(ctx, cfg, keys, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		vs := reflect.ValueOf(intfs)
+		if vs.Kind() != reflect.Slice {
+			return nil, ErrMGetterResponseNotSlice
+		}
+		if vs.Len() < len(keys) || (vs.Len() > len(keys) && !cfg.mGetterIgnoreExtra) {
+			return nil, &MGetterLengthError{Expected: len(keys), Actual: vs.Len()}
+		}
+
+		m := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			v := vs.Index(i)
+			if elemType != nil && !isAssignable(v, elemType) {
+				return nil, fmt.Errorf("%w: index %d, key %q: %s is not assignable to %s",
+					ErrMGetterElementTypeMismatch, i, k, typeName(v), elemType)
+			}
+
+			m[k] = v.Interface()
+		}
+
+		return m, nil
+	}
+}
+
+// fallback tries the fallbacks of mGetter in order until one of them succeeds, or returns the error of mGetter.
+// The fallbacks are not waited once the context is done, since MGetterFunc isn't cancellable.
+func (c *cache) fallback(ctx context.Context, cfg *config, keys []string, mGetterErr error) (interface{}, error) {
+	type response struct {
+		intfs interface{}
+		err   error
+	}
+
+	for i, mGetter := range cfg.mGetterFallbacks {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// buffered, so that the abandoned getter doesn't block forever
+		respChan := make(chan response, 1)
+		go func(mGetter MGetterFunc) {
+			intfs, err := mGetter(keys...)
+			respChan <- response{intfs: intfs, err: err}
+		}(mGetter)
+
+		select {
+		case resp := <-respChan:
+			if resp.err != nil {
+				continue
+			}
+
+			c.onMGetterFallback(cfg.prefix, i, mGetterErr)
+			return resp.intfs, nil
+		case <-ctx.Done():
+		}
+	}
+
+	c.onMGetterFallback(cfg.prefix, -1, mGetterErr)
+	return nil, mGetterErr
+}
+
+// isAssignable reports whether the element of the slice is assignable to the type.
+// The nil interfaces are skipped, which are treated as the zero values.
+func isAssignable(v reflect.Value, typ reflect.Type) bool {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+
+		v = v.Elem()
+	}
+
+	return v.Type().AssignableTo(typ)
+}
+
+// typeName returns the dynamic type name of the element of the slice.
+func typeName(v reflect.Value) string {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	return v.Type().String()
+}
+
+// indexOf returns the index of the first occurrence of the key, or -1 if it's absent.
+func indexOf(keys []string, key string) int {
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (c *cache) Del(ctx context.Context, prefix string, keys ...string) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return c.del(ctx, cfg, getCacheKeys(prefix, keys)...)
+}
+
+func (c *cache) DelPattern(ctx context.Context, prefix string, pattern string) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	// the pending writes are invisible to the shared cache, they can't be matched reliably
+	if cfg.writeBehind != nil {
+		return ErrPatternUnsupported
+	}
+
+	// the keys are matched by the shared cache if it's used
+	adp := cfg.shared
+	if adp == nil {
+		adp = cfg.local
+	}
+
+	deleter, ok := adp.(PatternDeleter)
+	if !ok {
+		return ErrPatternUnsupported
+	}
+
+	// the deleted keys are the transformed ones
+	keys, err := deleter.DelPattern(ctx, escapeGlob(c.adapterKey(ctx, getCacheKeyPrefix(prefix)))+pattern)
+	if err != nil {
+		return &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+	}
+
+	if cfg.local == nil || len(keys) == 0 {
+		return nil
+	}
+
+	if cfg.shared != nil {
+		opCtx, cancel := c.withTimeout(ctx)
+		err := cfg.local.Del(opCtx, keys...)
+		cancel()
+		if err != nil {
+			return &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+		}
+	}
+
+	return c.evictRemoteAdapterKeys(ctx, keys...)
+}
+
+func (c *cache) GetDel(ctx context.Context, prefix string, key string, container interface{}) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	// the pending writes are invisible to the shared cache, they can't be taken atomically
+	if cfg.writeBehind != nil {
+		return ErrGetDelNotSupported
+	}
+
+	// the value is taken from the shared cache if it's used
+	adp := cfg.shared
+	if adp == nil {
+		adp = cfg.local
+	}
+
+	deleter, ok := adp.(GetDeleter)
+	if !ok {
+		return ErrGetDelNotSupported
+	}
+
+	cacheKey := getCacheKey(prefix, key)
+	aKey := c.adapterKey(ctx, cacheKey)
+	opCtx, cancel := c.withTimeout(ctx)
+	val, err := deleter.GetDel(opCtx, aKey)
+	cancel()
+	if err != nil {
+		return &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+	}
+
+	if cfg.local != nil {
+		if cfg.shared != nil {
+			opCtx, cancel := c.withTimeout(ctx)
+			err := cfg.local.Del(opCtx, aKey)
+			cancel()
+			if err != nil {
+				return &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+			}
+		}
+
+		if err := c.evictRemoteKeys(ctx, cacheKey); err != nil {
+			return err
+		}
+	}
+
+	if !isHit(cfg, val) {
+		c.onCacheMiss(prefix, key, 1)
+		return ErrCacheMiss
+	}
+
+	c.onCacheHit(prefix, key, 1)
+	return cfg.unmarshal(ctx, val.Bytes, container)
+}
+
+func (c *cache) ListAppend(ctx context.Context, prefix string, key string, maxLen int, values ...interface{}) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	adp, ttl := c.listAdapter(cfg)
+	if adp == nil {
+		return ErrListNotSupported
+	}
+
+	bs := make([][]byte, 0, len(values))
+	for _, v := range values {
+		b, err := cfg.marshal(ctx, v)
+		if err != nil {
+			return err
+		}
+		bs = append(bs, b)
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if err := adp.RPush(opCtx, c.adapterKey(ctx, getCacheKey(prefix, key)), bs, maxLen, ttl); err != nil {
+		return &CacheError{Op: "set", Prefix: cfg.prefix, Err: err}
+	}
+
+	return nil
+}
+
+func (c *cache) ListRange(ctx context.Context, prefix string, key string, start, stop int) (Result, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return nil, ErrPfxNotRegistered
+	}
+
+	adp, _ := c.listAdapter(cfg)
+	if adp == nil {
+		return nil, ErrListNotSupported
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	bs, err := adp.LRange(opCtx, c.adapterKey(ctx, getCacheKey(prefix, key)), start, stop)
+	cancel()
+	if err != nil {
+		return nil, &CacheError{Op: "load", Prefix: cfg.prefix, Err: err}
+	}
+
+	res := c.newResult(cfg)
+	res.identity = true
+	res.resize(len(bs))
+	copy(res.vals, bs)
+
+	return res, nil
+}
+
+// listAdapter returns the adapter keeping the lists along with its TTL, i.e. the shared cache if it's used,
+// otherwise the local cache. It's nil if the adapter doesn't implement the ListAdapter interface.
+func (c *cache) listAdapter(cfg *config) (ListAdapter, time.Duration) {
+	adp, ttl := cfg.shared, cfg.sharedTTL
+	if adp == nil {
+		adp, ttl = cfg.local, cfg.localTTL
+	}
+
+	lister, ok := adp.(ListAdapter)
+	if !ok {
+		return nil, 0
+	}
+
+	return lister, ttl
+}
+
+func (c *cache) Set(ctx context.Context, prefix string, key string, value interface{}) error {
+	return c.MSet(ctx, prefix, map[string]interface{}{key: value})
+}
+
+func (c *cache) SetReturning(ctx context.Context, prefix string, key string, value interface{}) ([]byte, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return nil, ErrPfxNotRegistered
+	}
+
+	b, err := cfg.marshal(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.writeKey(ctx, cfg, getCacheKey(prefix, key), b)
+}
+
+func (c *cache) MSet(ctx context.Context, prefix string, keyValues map[string]interface{}) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	m := map[string][]byte{}
+	for k, value := range keyValues {
+		b, err := cfg.marshal(ctx, value)
+		if err != nil {
+			return err
+		}
+
+		m[getCacheKey(prefix, k)] = b
+	}
+
+	return c.write(ctx, cfg, m)
+}
+
+func (c *cache) SetNX(ctx context.Context, prefix string, key string, value interface{}) (bool, error) {
+	return c.setIf(ctx, prefix, key, value, false)
+}
+
+func (c *cache) SetXX(ctx context.Context, prefix string, key string, value interface{}) (bool, error) {
+	return c.setIf(ctx, prefix, key, value, true)
+}
+
+func (c *cache) SetIfChanged(ctx context.Context, prefix string, key string, value interface{}) (bool, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return false, ErrPfxNotRegistered
+	}
+
+	b, err := cfg.marshal(ctx, value)
+	if err != nil {
+		return false, err
+	}
+
+	cacheKey := getCacheKey(prefix, key)
+	cur, err := c.current(ctx, cfg, c.adapterKey(ctx, cacheKey))
+	if err != nil {
+		return false, err
+	}
+	if cur.Valid && equalIgnoringSoftExpiry(cur.Bytes, b) {
+		return false, nil
+	}
+
+	if err := c.write(ctx, cfg, map[string][]byte{cacheKey: b}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *cache) Put(ctx context.Context, prefix string, value interface{}) (string, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return "", ErrPfxNotRegistered
+	}
+
+	b, err := cfg.marshal(ctx, value)
+	if err != nil {
+		return "", err
+	}
+
+	key := hashIgnoringSoftExpiry(b)
+	if err := c.write(ctx, cfg, map[string][]byte{getCacheKey(prefix, key): b}); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// current returns the value of the transformed key in the cache deciding the value, i.e. the pending writes and
+// the shared cache if it's used, otherwise the local cache. The local cache of the multi-layer cache is skipped,
+// since it may be stale.
+func (c *cache) current(ctx context.Context, cfg *config, aKey string) (Value, error) {
+	if cfg.writeBehind != nil {
+		if val := cfg.writeBehind.get([]string{aKey})[0]; val.Valid {
+			return val, nil
+		}
+	}
+
+	adp := cfg.shared
+	if adp == nil {
+		adp = c.localOf(cfg)
+	}
+	if adp == nil {
+		return Value{}, nil
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	vals, err := adp.MGet(opCtx, []string{aKey})
+	if err != nil {
+		return Value{}, &CacheError{Op: "load", Prefix: cfg.prefix, Err: err}
+	}
+
+	return vals[0], nil
+}
+
+// setIf sets the key only if its existence equals to the expected one.
+func (c *cache) setIf(ctx context.Context, prefix string, key string, value interface{}, exist bool) (bool, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return false, ErrPfxNotRegistered
+	}
+
+	// the pending writes are invisible to the shared cache, the condition can't be checked reliably
+	if cfg.writeBehind != nil {
+		return false, ErrConditionalSetNotSupported
+	}
+
+	b, err := cfg.marshal(ctx, value)
+	if err != nil {
+		return false, err
+	}
+
+	cacheKey := getCacheKey(prefix, key)
+	aKey := c.adapterKey(ctx, cacheKey)
+
+	// the condition is decided by the shared cache if it's used
+	adp, ttl := cfg.shared, cfg.sharedTTL
+	options := []MSetOptions{}
+	if adp == nil {
+		adp, ttl = cfg.local, cfg.localTTL
+		options = c.localMSetOptions(cfg, c.keyNames([]string{cacheKey}, []string{aKey}))
+	}
+
+	setter, ok := adp.(ConditionalSetter)
+	if !ok {
+		return false, ErrConditionalSetNotSupported
+	}
+
+	setIf := setter.SetNX
+	if exist {
+		setIf = setter.SetXX
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	set, err := setIf(opCtx, aKey, b, ttl, options...)
+	cancel()
+	if err != nil {
+		return false, &CacheError{Op: "refill", Prefix: cfg.prefix, Err: err}
+	}
+	if !set {
+		return false, nil
+	}
+
+	if cfg.local != nil {
+		if cfg.shared != nil {
+			// the local value is stale, reload it from the shared cache next time
+			opCtx, cancel := c.withTimeout(ctx)
+			err := cfg.local.Del(opCtx, aKey)
+			cancel()
+			if err != nil {
+				return true, &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+			}
+		}
+
+		if err := c.evictRemoteKeys(ctx, cacheKey); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+func (c *cache) SetBytes(ctx context.Context, prefix string, key string, b []byte) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	return c.write(ctx, cfg, map[string][]byte{getCacheKey(prefix, key): b})
+}
+
+func (c *cache) GetBytes(ctx context.Context, prefix string, key string) ([]byte, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return nil, ErrPfxNotRegistered
+	}
+
+	cacheVals, err := c.load(ctx, cfg, false, false, getCacheKey(prefix, key))
+	if err != nil {
+		return nil, err
+	}
+
+	if !cacheVals[0].Valid || isTombstone(cfg, cacheVals[0]) {
+		c.onCacheMiss(prefix, key, 1)
+		return nil, ErrCacheMiss
+	}
+
+	c.onCacheHit(prefix, key, 1)
+	return cacheVals[0].Bytes, nil
+}
+
+func (c *cache) WarmLocal(ctx context.Context, prefix string, keys []string) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	if cfg.shared == nil || c.localOf(cfg) == nil || len(keys) == 0 {
+		return nil
+	}
+
+	cacheKeys := getCacheKeys(prefix, keys)
+	opCtx, cancel := c.withTimeout(ctx)
+	vals, err := cfg.shared.MGet(opCtx, c.adapterKeys(ctx, cacheKeys))
+	cancel()
+	if err != nil {
+		return &CacheError{Op: "load", Prefix: cfg.prefix, Err: err}
+	}
+
+	m := map[string][]byte{}
+	for i, val := range vals {
+		if isHit(cfg, val) {
+			m[cacheKeys[i]] = val.Bytes
+		}
+	}
+
+	if len(m) == 0 {
+		return nil
+	}
+
+	// the values are the same as the shared ones, no evictions are broadcasted
+	return c.refillLocal(ctx, cfg, m)
+}
+
+func (c *cache) EvictLocal(ctx context.Context, prefix string, keys ...string) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	// the local cache keeps the values even if it's disabled by SetLocalEnabled()
+	if cfg.local == nil || len(keys) == 0 {
+		return nil
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	if err := cfg.local.Del(opCtx, c.adapterKeys(ctx, getCacheKeys(prefix, keys))...); err != nil {
+		return &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+	}
+
+	return nil
+}
+
+func (c *cache) LocalStats(prefix string) (Stats, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return Stats{}, ErrPfxNotRegistered
+	}
+
+	statser, ok := cfg.local.(Statser)
+	if !ok {
+		return Stats{}, ErrStatsNotSupported
+	}
+
+	return statser.Stats(), nil
+}
+
+func (c *cache) LocalSize(ctx context.Context, prefix string) (int, int, error) {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return 0, 0, ErrPfxNotRegistered
+	}
+
+	sizer, ok := cfg.local.(Sizer)
+	if !ok {
+		return 0, 0, ErrSizeNotSupported
+	}
+
+	entries, bytes := sizer.Size(c.adapterKey(ctx, getCacheKeyPrefix(prefix)))
+	return entries, bytes, nil
+}
+
+func (c *cache) Flush(ctx context.Context) error {
+	prefixes := make([]string, 0, len(c.configs))
+	for pfx := range c.configs {
+		prefixes = append(prefixes, pfx)
+	}
+	sort.Strings(prefixes)
+
+	var errs MultiError
+	for _, pfx := range prefixes {
+		if err := c.clear(ctx, c.configs[pfx]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (c *cache) Prefixes() []PrefixInfo {
+	infos := make([]PrefixInfo, 0, len(c.configs))
+	for pfx, cfg := range c.configs {
+		infos = append(infos, PrefixInfo{
+			Prefix:     pfx,
+			SharedTTL:  cfg.sharedTTL,
+			LocalTTL:   cfg.localTTL,
+			HasShared:  cfg.shared != nil,
+			HasLocal:   cfg.local != nil,
+			HasMGetter: cfg.loadMGetter() != nil,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Prefix < infos[j].Prefix
+	})
+
+	return infos
+}
+
+func (c *cache) SetMGetter(prefix string, getter MGetterFunc) error {
+	cfg, ok := c.configs[prefix]
+	if !ok {
+		return ErrPfxNotRegistered
+	}
+
+	cfg.mGetterMut.Lock()
+	cfg.mGetter = getter
+	cfg.mGetterMut.Unlock()
+
+	return nil
+}
+
+// loadMGetter returns the current mGetter of the config, which is taken once per call
+// so that the call uses either the old or the new one consistently.
+func (cfg *config) loadMGetter() MGetterFunc {
+	cfg.mGetterMut.RLock()
+	defer cfg.mGetterMut.RUnlock()
+
+	return cfg.mGetter
+}
+
+func (c *cache) SetLocalEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&c.localDisabled, 0)
+		return
+	}
+
+	atomic.StoreInt32(&c.localDisabled, 1)
+}
+
+func (c *cache) Scoped(prefix string) (ScopedCache, error) {
+	if _, ok := c.configs[prefix]; !ok {
+		return nil, ErrPfxNotRegistered
+	}
+
+	return &scopedCache{cache: c, prefix: prefix}, nil
+}
+
+// scopedCache implements ScopedCache by passing the bound prefix to the cache.
+type scopedCache struct {
+	cache  *cache
+	prefix string
+}
+
+func (sc *scopedCache) GetByFunc(
+	ctx context.Context, key string, container interface{}, getter OneTimeGetterFunc, options ...GetByFuncOptions,
+) error {
+	return sc.cache.GetByFunc(ctx, sc.prefix, key, container, getter, options...)
+}
+
+func (sc *scopedCache) Get(ctx context.Context, key string, container interface{}) error {
+	return sc.cache.Get(ctx, sc.prefix, key, container)
+}
+
+func (sc *scopedCache) MGet(ctx context.Context, keys ...string) (Result, error) {
+	return sc.cache.MGet(ctx, sc.prefix, keys...)
+}
+
+func (sc *scopedCache) Del(ctx context.Context, keys ...string) error {
+	return sc.cache.Del(ctx, sc.prefix, keys...)
+}
+
+func (sc *scopedCache) Set(ctx context.Context, key string, value interface{}) error {
+	return sc.cache.Set(ctx, sc.prefix, key, value)
+}
+
+// localOf returns the local cache of the config, or nil if the local cache is disabled at runtime.
+func (c *cache) localOf(cfg *config) Adapter {
+	if atomic.LoadInt32(&c.localDisabled) == 1 {
+		return nil
+	}
+
+	return cfg.local
+}
+
+// isHit checks whether the cached value is valid and recognized by the config.
+func isHit(cfg *config, val Value) bool {
+	if !val.Valid || isTombstone(cfg, val) {
+		return false
+	}
+
+	// values with the different version are treated as cache-miss
+	if cfg.versioned && checkEnvelope(val.Bytes, cfg.version) != nil {
+		return false
+	}
+
+	return true
+}
+
+// isStale checks whether the soft expiry stamped on the value is passed. The stale values are still hits.
+// It returns the age of the value as well, i.e. the time since it's written.
+func isStale(cfg *config, b []byte) (time.Duration, bool) {
+	if cfg.softTTL == 0 || checkEnvelope(b, cfg.version) != nil {
+		return 0, false
+	}
+
+	softExpireAt, ok := softExpiry(b)
+	if !ok {
+		return 0, false
+	}
+
+	age := time.Since(softExpireAt.Add(-cfg.softTTL))
+	return age, age >= cfg.softTTL
+}
+
+// revalidate reloads the stale keys by the getter and refills them in the background, while the stale values
+// are served. The keys being revalidated already are skipped. The errors are logged only, since the stale values
+// are kept until the hard TTL expires and the keys are revalidated on the next loading.
+// The getter and the refilling are bounded by the operation timeout, and canceled when the factory is closed.
+func (c *cache) revalidate(
+	ctx context.Context, cfg *config, keys []string, getter OneTimeMGetterFunc,
+	refill func(ctx context.Context, cfg *config, m map[string][]byte) error,
+) {
+	reloadKeys := []string{}
+	aKeys := []string{}
+	cfg.revalidateMut.Lock()
+	for _, k := range keys {
+		aKey := c.adapterKey(ctx, getCacheKey(cfg.prefix, k))
+		if cfg.revalidating[aKey] {
+			continue
+		}
+		cfg.revalidating[aKey] = true
+		reloadKeys = append(reloadKeys, k)
+		aKeys = append(aKeys, aKey)
+	}
+	cfg.revalidateMut.Unlock()
+
+	if len(reloadKeys) == 0 {
+		return
+	}
+
+	release := func() {
+		cfg.revalidateMut.Lock()
+		for _, aKey := range aKeys {
+			delete(cfg.revalidating, aKey)
+		}
+		cfg.revalidateMut.Unlock()
+	}
+
+	started := c.background.start(func(bgCtx context.Context) {
+		defer release()
+
+		// outlive the call but keep the values of the context, e.g. the ones used by the key transformer
+		ctx := valuesContext{Context: bgCtx, values: ctx}
+
+		intfM, err := c.revalidateByGetter(ctx, reloadKeys, getter)
+		if err != nil {
+			c.logger.Warn("cache: revalidating failed", "prefix", cfg.prefix, "keys", reloadKeys, "err", err)
+			c.onBackgroundRefill(ctx, cfg.prefix, reloadKeys, err)
+			return
+		}
+
+		var lastErr error
+		m := map[string][]byte{}
+		for _, k := range reloadKeys {
+			v, ok := intfM[k]
+			if !ok {
+				continue
+			}
+
+			b, err := cfg.marshal(ctx, v)
+			if err != nil {
+				c.logger.Warn("cache: revalidating failed", "prefix", cfg.prefix, "key", k, "err", err)
+				lastErr = err
+				continue
+			}
+			m[getCacheKey(cfg.prefix, k)] = b
+		}
+
+		opCtx, cancel := c.withTimeout(ctx)
+		defer cancel()
+
+		if err := refill(opCtx, cfg, m); err != nil {
+			c.logger.Warn("cache: revalidating failed", "prefix", cfg.prefix, "keys", reloadKeys, "err", err)
+			lastErr = err
+		}
+		c.onBackgroundRefill(ctx, cfg.prefix, reloadKeys, lastErr)
+	})
+	if !started {
+		// the factory is closed
+		release()
+	}
+}
+
+// revalidateByGetter calls the getter bounded by the operation timeout. The getter is not waited once the context
+// is done, since the getters of GetByFunc aren't cancellable.
+func (c *cache) revalidateByGetter(
+	ctx context.Context, keys []string, getter OneTimeMGetterFunc,
+) (map[string]interface{}, error) {
+	type response struct {
+		intfM map[string]interface{}
+		err   error
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	// buffered, so that the abandoned getter doesn't block forever
+	respChan := make(chan response, 1)
+	go func() {
+		intfM, err := getter(opCtx, keys...)
+		respChan <- response{intfM: intfM, err: err}
+	}()
+
+	select {
+	case resp := <-respChan:
+		return resp.intfM, resp.err
+	case <-opCtx.Done():
+		return nil, opCtx.Err()
+	}
+}
+
+// valuesContext keeps the values of another context, while its deadline and cancellation are the embedded ones.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} { return c.values.Value(key) }
+
+// detachedContext keeps the values of the parent context without its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+// isTombstone checks whether the cached value is the tombstone written by Del.
+func isTombstone(cfg *config, val Value) bool {
+	return cfg.tombstoneTTL > 0 && val.Valid && bytes.Equal(val.Bytes, tombstone)
+}
+
+// getByFuncFlightKey returns the singleflight key of GetByFunc. The container type is included, since the callers
+// of different types bring their own getters, and the value reloaded for one type may not fit others.
+// It differs from the one of Get as well, whose flight returns Result instead of bytes.
+func getByFuncFlightKey(cacheKey string, container interface{}) string {
+	// the address of the type descriptor identifies the type uniquely, unlike its name
+	return fmt.Sprintf("%s\x00%p", cacheKey, reflect.TypeOf(container))
+}
+
+func getKeyIndex(keys []string) map[string]int {
+	keyIdx := map[string]int{}
+	for i, k := range keys {
+		keyIdx[k] = i
+	}
+
+	return keyIdx
+}
+
+// smallBatchSize is the number of keys compared pairwise by unique(), which is cheaper than building a set.
+const smallBatchSize = 16
+
+// unique reports whether the params have no duplicates.
+func unique(params []string) bool {
+	if len(params) <= smallBatchSize {
+		for i := 1; i < len(params); i++ {
+			for j := 0; j < i; j++ {
+				if params[i] == params[j] {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	seen := make(map[string]struct{}, len(params))
+	for _, param := range params {
+		if _, ok := seen[param]; ok {
+			return false
+		}
+		seen[param] = struct{}{}
+	}
+
+	return true
+}
+
+// dedup fills in dedupedIdx, which is an indirect index that maps un-dedup idx to dedup idx,
+// and returns the deduped params.
+func dedup(dedupedIdx map[int]int, params []string) []string {
+	if len(params) == 1 {
+		dedupedIdx[0] = 0
+		return params
+	}
+
+	dedupedKeys := make([]string, 0, len(params))
+	// m maps param to dedup idx
+	m := map[string]int{}
+	for i, param := range params {
+		if _, ok := m[param]; ok {
+			dedupedIdx[i] = m[param]
+			continue
+		}
+
+		dedupedIdx[i] = len(dedupedKeys)
+		m[param] = len(dedupedKeys)
+		dedupedKeys = append(dedupedKeys, param)
+	}
+
+	return dedupedKeys
+}
+
+// load loads data from cache, and refill it if necessary.
+// The values carry the metadata if withMeta is true and the adapters support it.
+func (c *cache) load(ctx context.Context, cfg *config, withMeta, touch bool, keys ...string) ([]Value, error) {
+	vals := make([]Value, len(keys))
+	missKeys := make([]string, len(keys))
+	copy(missKeys, keys)
+
+	keyIdx := getKeyIndex(keys)
+
+	// 1. load from local cache
+	local := c.localOf(cfg)
+	if local != nil {
+		// allow the failure when getting local cache
+		opCtx, cancel := c.withTimeout(ctx)
+		vals, _ = mgetFrom(opCtx, local, withMeta, c.adapterKeys(ctx, keys))
+		cancel()
+		if len(vals) != len(keys) {
+			vals = make([]Value, len(keys))
+		}
+
+		missKeys = []string{}
+		localHits := []string{}
+		for i, val := range vals {
+			if !val.Valid {
+				missKeys = append(missKeys, keys[i])
+			} else if touch && isHit(cfg, val) {
+				localHits = append(localHits, keys[i])
+			}
+		}
+		c.touchLocal(ctx, cfg, localHits...)
+	}
+
+	// the local hits are probed in the shared cache along with the missing keys
+	probeKeys := []string{}
+	if cfg.backfillShared && local != nil && cfg.shared != nil {
+		for i, val := range vals {
+			if val.Valid {
+				probeKeys = append(probeKeys, keys[i])
+			}
+		}
+	}
+
+	// no cache missing
+	if len(missKeys) == 0 && len(probeKeys) == 0 {
+		return vals, nil
+	}
+
+	// 2. load from the pending writes to read your writes before flushing
+	if cfg.writeBehind != nil {
+		pendingVals := cfg.writeBehind.get(c.adapterKeys(ctx, missKeys))
+
+		stillMissing := []string{}
+		for i, pVal := range pendingVals {
+			if !pVal.Valid {
+				stillMissing = append(stillMissing, missKeys[i])
+				continue
+			}
+
+			vals[keyIdx[missKeys[i]]] = pVal
+		}
+		missKeys = stillMissing
+	}
+
+	// 3. load from shared cache
+	if cfg.shared != nil && len(missKeys)+len(probeKeys) != 0 {
+		opCtx, cancel := c.withTimeout(ctx)
+		sharedVals, err := mgetFrom(opCtx, cfg.shared, withMeta, c.adapterKeys(ctx, append(missKeys, probeKeys...)))
+		// the local hits are kept unless the incoming context is done
+		degraded := err != nil && (c.degraded(ctx, opCtx) || (c.localHitsOnError && local != nil && ctx.Err() == nil))
+		cancel()
+		if err != nil && !degraded {
+			return nil, &CacheError{Op: "load", Prefix: cfg.prefix, Err: err}
+		}
+		if degraded {
+			// the values are discarded in case the adapter responds the partial ones along with the error
+			sharedVals = nil
+		}
+
+		// refill missing values into vals, they are treated as cache-miss if it's degraded
+		sharedHits := []string{}
+		for i, mVal := range sharedVals {
+			if i < len(missKeys) {
+				vals[keyIdx[missKeys[i]]] = mVal
+				if touch && isHit(cfg, mVal) {
+					sharedHits = append(sharedHits, missKeys[i])
+				}
+				continue
+			}
+
+			// backfill the shared cache only if it lacks the local hit
+			if k := probeKeys[i-len(missKeys)]; !mVal.Valid {
+				c.backfill(ctx, cfg, k, vals[keyIdx[k]].Bytes)
+			}
+		}
+		c.touchShared(ctx, cfg, sharedHits...)
+	}
+
+	// no cache missing, the local hits are not refilled again
+	if len(missKeys) == 0 {
+		return vals, nil
+	}
+
+	// 4. refill the local cache if possible
+	if local != nil {
+		m := map[string][]byte{}
+		for _, k := range keys {
+			val := vals[keyIdx[k]]
+			// the tombstones are kept in the shared cache only
+			if val.Valid && !isTombstone(cfg, val) {
+				m[k] = val.Bytes
+			}
+		}
+
+		if len(m) != 0 {
+			aKeyBytes, names := c.adapterKeyBytes(ctx, m)
+			if err := local.MSet(ctx, aKeyBytes, cfg.localTTL, c.localMSetOptions(cfg, names)...); err != nil {
+				c.logger.Warn("cache: refilling the local cache failed", "prefix", cfg.prefix, "err", err)
+			}
+
+			c.evictRemoteKeyMap(ctx, m)
+		}
+	}
+
+	return vals, nil
+}
+
+// mgetFrom gets the keys from the adapter, along with the metadata if withMeta is true and it's supported.
+func mgetFrom(ctx context.Context, adp Adapter, withMeta bool, keys []string) ([]Value, error) {
+	// the values read ahead by MGetAcrossPrefixes() don't carry the metadata
+	if p, ok := ctx.Value(prefetchedKey{}).(*prefetched); ok && !withMeta {
+		if vals, ok := p.take(adp, keys); ok {
+			return vals, nil
+		}
+	}
+
+	if metaGetter, ok := adp.(MetaGetter); withMeta && ok {
+		return metaGetter.MGetWithMeta(ctx, keys)
+	}
+
+	return adp.MGet(ctx, keys)
+}
+
+// backfill writes the local hit through to the shared cache, the failure is allowed since it's on the read path.
+// No evictions are broadcasted since the value is the same as the local one.
+func (c *cache) backfill(ctx context.Context, cfg *config, key string, b []byte) {
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	cfg.shared.MSet(opCtx, map[string][]byte{c.adapterKey(ctx, key): b}, cfg.sharedTTL)
+}
+
+// lockOrWait acquires the distributed locks of the missing cache keys if necessary.
+// The keys locked by other nodes are polled until they are refilled or the timeout.
+// It returns the values of the refilled keys, the keys needing to be reloaded by the getter,
+// and the function releasing the acquired locks. Failing to lock is allowed, the keys are reloaded without the lock.
+func (c *cache) lockOrWait(ctx context.Context, cfg *config, keys []string) (map[string][]byte, []string, func()) {
+	locker, ok := cfg.shared.(Locker)
+	if cfg.lock == nil || !ok {
+		return nil, keys, func() {}
+	}
+
+	lockKeys := make([]string, len(keys))
+	for i, k := range c.adapterKeys(ctx, keys) {
+		lockKeys[i] = getLockKey(k)
+	}
+
+	token := uuidString()
+	locked, err := locker.Lock(ctx, lockKeys, token, cfg.lock.TTL)
+	if err != nil {
+		return nil, keys, func() {}
+	}
+
+	reloadKeys := []string{}
+	acquired := []string{}
+	waiting := []string{}
+	for i, k := range keys {
+		if locked[i] {
+			reloadKeys = append(reloadKeys, k)
+			acquired = append(acquired, lockKeys[i])
+			continue
+		}
+
+		waiting = append(waiting, k)
+	}
+
+	unlock := func() {
+		if len(acquired) != 0 {
+			// the locks will be expired anyway
+			locker.Unlock(ctx, acquired, token)
+		}
+	}
+
+	waited := map[string][]byte{}
+	timeout := time.NewTimer(cfg.lock.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(cfg.lock.PollInterval)
+	defer ticker.Stop()
+
+poll:
+	for len(waiting) != 0 {
+		select {
+		case <-ctx.Done():
+			break poll
+		case <-timeout.C:
+			break poll
+		case <-ticker.C:
+		}
+
+		vals, err := c.load(ctx, cfg, false, false, waiting...)
+		if err != nil {
+			break
+		}
+
+		stillWaiting := waiting[:0]
+		for i, k := range waiting {
+			if isHit(cfg, vals[i]) {
+				waited[k] = vals[i].Bytes
+				continue
+			}
+
+			stillWaiting = append(stillWaiting, k)
+		}
+		waiting = stillWaiting
+	}
+
+	// proceed without the lock
+	reloadKeys = append(reloadKeys, waiting...)
+
+	return waited, reloadKeys, unlock
+}
+
+// touchLocal refreshes the TTL of the keys hit in the local cache for the sliding expiration.
+// The values are not changed, so no evictions are broadcasted.
+func (c *cache) touchLocal(ctx context.Context, cfg *config, keys ...string) {
+	if !cfg.slidingTTL || len(keys) == 0 {
+		return
+	}
+
+	// allow the failure when touching, it's not critical for reading
+	if t, ok := c.localOf(cfg).(Toucher); ok {
+		t.Touch(ctx, c.adapterKeys(ctx, keys), cfg.localTTL, cfg.localTTL/slidingTTLFraction)
+	}
+}
+
+// touchShared is similar to touchLocal, but for the keys hit in the shared cache. The local hits don't touch
+// the shared cache, and the keys touched recently are skipped, which saves the round trips on the read path.
+func (c *cache) touchShared(ctx context.Context, cfg *config, keys ...string) {
+	if !cfg.slidingTTL || cfg.touches == nil || len(keys) == 0 {
+		return
+	}
+
+	t, ok := cfg.shared.(Toucher)
+	if !ok {
+		return
+	}
+
+	keys = cfg.touches.due(c.adapterKeys(ctx, keys))
+	if len(keys) == 0 {
+		return
+	}
+
+	// allow the failure when touching, it's not critical for reading
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	t.Touch(opCtx, keys, cfg.sharedTTL, cfg.sharedTTL/slidingTTLFraction)
+}
+
+// refill refills the cache with given keyBytes
+func (c *cache) refill(ctx context.Context, cfg *config, keyBytes map[string][]byte) error {
+	evicting, err := c.store(ctx, cfg, keyBytes)
+	if len(evicting) != 0 {
+		c.evictRemoteKeys(ctx, evicting...)
+	}
+
+	return err
+}
+
+// write refills the cache with given keyBytes, and coalesces the concurrent writes of a single key if necessary.
+func (c *cache) write(ctx context.Context, cfg *config, keyBytes map[string][]byte) error {
+	if cfg.coalescer == nil || len(keyBytes) != 1 {
+		return c.refill(ctx, cfg, keyBytes)
+	}
+
+	for key, b := range keyBytes {
+		_, err := c.writeKey(ctx, cfg, key, b)
+		return err
+	}
+
+	return nil
+}
+
+// writeKey refills the cache with b of the key, and returns the bytes actually written, which are the latest ones
+// of the concurrent writes if they're coalesced.
+func (c *cache) writeKey(ctx context.Context, cfg *config, key string, b []byte) ([]byte, error) {
+	if cfg.coalescer == nil {
+		if err := c.refill(ctx, cfg, map[string][]byte{key: b}); err != nil {
+			return nil, err
+		}
+
+		return b, nil
+	}
+
+	// the same keys of different transformations are written separately
+	return cfg.coalescer.do(ctx, c.adapterKey(ctx, key), b, func(ctx context.Context, b []byte) error {
+		return c.refill(ctx, cfg, map[string][]byte{key: b})
+	})
+}
+
+// store sets keyBytes into the caches, and returns the keys needing to be evicted on other nodes.
+func (c *cache) store(ctx context.Context, cfg *config, keyBytes map[string][]byte) ([]string, error) {
+	aKeyBytes, names := c.adapterKeyBytes(ctx, keyBytes)
+
+	// set shared cache first if necessary
+	if cfg.writeBehind != nil {
+		// the evictions are broadcasted after flushing
+		cfg.writeBehind.add(aKeyBytes)
+	} else if cfg.shared != nil {
+		opCtx, cancel := c.withTimeout(ctx)
+		err := cfg.shared.MSet(opCtx, aKeyBytes, cfg.sharedTTL)
+		degraded := err != nil && c.degraded(ctx, opCtx)
+		cancel()
+		if err != nil && !degraded {
+			return nil, &CacheError{Op: "refill", Prefix: cfg.prefix, Err: err}
+		}
+	}
+
+	// then, set local cache if necessary
+	if cfg.local != nil {
+		keys := make([]string, 0, len(keyBytes))
+		for k := range keyBytes {
+			keys = append(keys, k)
+		}
+
+		if c.localOf(cfg) == nil {
+			// the local cache is disabled, drop the stale values instead of setting them,
+			// so that they won't be served after re-enabling.
+			opCtx, cancel := c.withTimeout(ctx)
+			cfg.local.Del(opCtx, c.adapterKeys(ctx, keys)...)
+			cancel()
+			if cfg.writeBehind == nil {
+				return keys, nil
+			}
+			return nil, nil
+		}
+
+		opCtx, cancel := c.withTimeout(ctx)
+		err := cfg.local.MSet(opCtx, aKeyBytes, cfg.localTTL, c.localMSetOptions(cfg, names)...)
+		cancel()
+		if err != nil {
+			return c.localRefillFailed(ctx, cfg, keys, err)
+		}
+
+		// the evictions of write-behind are broadcasted after flushing
+		if cfg.writeBehind == nil {
+			return keys, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// localRefillFailed handles the failure of the local cache after the shared cache is written by the RefillFailurePolicy.
+// It returns the keys to broadcast the evictions, since the shared cache is changed anyway.
+func (c *cache) localRefillFailed(ctx context.Context, cfg *config, keys []string, err error) ([]string, error) {
+	err = &CacheError{Op: "refill", Prefix: cfg.prefix, Err: err}
+	c.logger.Warn("cache: refilling the local cache failed", "prefix", cfg.prefix, "err", err)
+	if c.onRefillError != nil {
+		c.onRefillError(err)
+	}
+
+	aKeys := c.adapterKeys(ctx, keys)
+
+	// the local value is stale, drop it if possible
+	opCtx, cancel := c.withTimeout(ctx)
+	cfg.local.Del(opCtx, aKeys...)
+	cancel()
+
+	if cfg.writeBehind != nil {
+		// the pending writes are not written into the shared cache yet, the evictions are broadcasted after flushing
+		if c.refillPolicy == RefillPolicyIgnoreLocalFailure {
+			return nil, nil
+		}
+
+		if c.refillPolicy == RefillPolicyRollbackShared {
+			cfg.writeBehind.drop(aKeys...)
+		}
+		return nil, err
+	}
+
+	switch c.refillPolicy {
+	case RefillPolicyRollbackShared:
+		if cfg.shared != nil {
+			opCtx, cancel := c.withTimeout(ctx)
+			delErr := cfg.shared.Del(opCtx, aKeys...)
+			cancel()
+			if delErr != nil {
+				return keys, &CacheError{Op: "del", Prefix: cfg.prefix, Err: delErr}
+			}
+		}
+
+		return keys, err
+	case RefillPolicyFailOperation:
+		return keys, err
+	default:
+		return keys, nil
+	}
+}
+
+// refillLocal refills the local cache only with given keyBytes.
+// No evictions are broadcasted since the shared cache is not changed.
+func (c *cache) refillLocal(ctx context.Context, cfg *config, keyBytes map[string][]byte) error {
+	local := c.localOf(cfg)
+	if local == nil {
+		return nil
+	}
+
+	aKeyBytes, names := c.adapterKeyBytes(ctx, keyBytes)
+	if err := local.MSet(ctx, aKeyBytes, cfg.localTTL, c.localMSetOptions(cfg, names)...); err != nil {
+		return &CacheError{Op: "refill", Prefix: cfg.prefix, Err: err}
+	}
+
+	return nil
+}
+
+// localMSetOptions returns the options setting the local cache. The callbacks are given the original keys
+// by names, which maps the transformed keys to the original ones if the keys are transformed.
+func (c *cache) localMSetOptions(cfg *config, names map[string]string) []MSetOptions {
+	onCostAdd, onCostEvict, costFunc := c.onLCCostAdd, c.onLCCostEvict, cfg.localCost
+	if names != nil {
+		nameOf := func(key string) string {
+			if name, ok := names[key]; ok {
+				return name
+			}
+			return key
+		}
+
+		onCostAdd = func(key string, cost int) { c.onLCCostAdd(nameOf(key), cost) }
+		onCostEvict = func(key string, cost int) { c.onLCCostEvict(nameOf(key), cost) }
+		if cfg.localCost != nil {
+			costFunc = func(key string, b []byte) int { return cfg.localCost(nameOf(key), b) }
+		}
+	}
+
+	options := []MSetOptions{
+		WithOnCostAddFunc(onCostAdd),
+		WithOnCostEvictFunc(onCostEvict),
+	}
+	if costFunc != nil {
+		options = append(options, WithCostFunc(costFunc))
+	}
+	if cfg.deterministicTTL {
+		options = append(options, WithNoOffset())
+	}
+
+	return options
+}
+
+func (c *cache) del(ctx context.Context, cfg *config, keys ...string) error {
+	evicting, err := c.remove(ctx, cfg, keys...)
+	if len(evicting) != 0 {
+		c.evictRemoteKeys(ctx, evicting...)
+	}
+
+	return err
+}
+
+// remove deletes the keys from the caches, and returns the keys needing to be evicted on other nodes.
+func (c *cache) remove(ctx context.Context, cfg *config, keys ...string) ([]string, error) {
+	aKeys := c.adapterKeys(ctx, keys)
+
+	// discard the pending writes, otherwise they are written back after deleting
+	if cfg.writeBehind != nil {
+		cfg.writeBehind.drop(aKeys...)
+	}
+
+	if cfg.shared != nil {
+		opCtx, cancel := c.withTimeout(ctx)
+		err := c.removeShared(opCtx, cfg, aKeys...)
+		cancel()
+		if err != nil {
+			return nil, &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+		}
+	}
+
+	if cfg.local != nil {
+		opCtx, cancel := c.withTimeout(ctx)
+		err := cfg.local.Del(opCtx, aKeys...)
+		cancel()
+		if err != nil {
+			return nil, &CacheError{Op: "del", Prefix: cfg.prefix, Err: err}
+		}
+
+		return keys, nil
+	}
+
+	return nil, nil
+}
+
+// removeShared removes the transformed keys from the shared cache, or replaces them with the tombstones if necessary.
+func (c *cache) removeShared(ctx context.Context, cfg *config, keys ...string) error {
+	if cfg.tombstoneTTL == 0 {
+		return cfg.shared.Del(ctx, keys...)
+	}
+
+	m := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		m[k] = tombstone
+	}
+
+	return cfg.shared.MSet(ctx, m, cfg.tombstoneTTL)
+}
+
+// unmarshalFailed reports the value of the key failed to unmarshal, and removes it from the cache if
+// WithTreatUnmarshalErrorAsMiss() is specified, which returns UnmarshalMissError wrapping the error.
+func (c *cache) unmarshalFailed(ctx context.Context, cfg *config, prefix, key string, err error) error {
+	if c.onUnmarshalError != nil {
+		c.onUnmarshalError(prefix, key, err)
+	}
+
+	if !c.unmarshalAsMiss {
+		return err
+	}
+
+	c.discard(ctx, cfg, getCacheKey(prefix, key))
+	return &UnmarshalMissError{Err: err}
+}
+
+// discard removes the key from the caches without the tombstone since it's reloaded right away, and broadcasts
+// the eviction. The failure is allowed since it's on the read path.
+func (c *cache) discard(ctx context.Context, cfg *config, cacheKey string) {
+	aKey := c.adapterKey(ctx, cacheKey)
+	if cfg.writeBehind != nil {
+		cfg.writeBehind.drop(aKey)
+	}
+
+	opCtx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if cfg.shared != nil {
+		cfg.shared.Del(opCtx, aKey)
+	}
+
+	if cfg.local != nil {
+		cfg.local.Del(opCtx, aKey)
+		c.evictRemoteKeys(ctx, cacheKey)
+	}
+}
+
+// adapterKey returns the key stored in the adapters, which is transformed by WithKeyTransformer() if specified.
+func (c *cache) adapterKey(ctx context.Context, key string) string {
+	if c.keyTransformer == nil {
+		return key
+	}
+
+	return c.keyTransformer(ctx, key)
+}
+
+// adapterKeys returns the keys stored in the adapters like adapterKey().
+func (c *cache) adapterKeys(ctx context.Context, keys []string) []string {
+	if c.keyTransformer == nil {
+		return keys
+	}
+
+	aKeys := make([]string, len(keys))
+	for i, k := range keys {
+		aKeys[i] = c.keyTransformer(ctx, k)
+	}
+
+	return aKeys
+}
+
+// adapterKeyBytes returns keyBytes keyed by the keys stored in the adapters like adapterKey(),
+// along with the names mapping the transformed keys to the original ones.
+func (c *cache) adapterKeyBytes(ctx context.Context, keyBytes map[string][]byte) (map[string][]byte, map[string]string) {
+	if c.keyTransformer == nil {
+		return keyBytes, nil
+	}
+
+	aKeyBytes := make(map[string][]byte, len(keyBytes))
+	names := make(map[string]string, len(keyBytes))
+	for k, b := range keyBytes {
+		aKey := c.keyTransformer(ctx, k)
+		aKeyBytes[aKey] = b
+		names[aKey] = k
+	}
+
+	return aKeyBytes, names
+}
+
+// keyNames maps the transformed keys to the original ones, which is nil if the keys are not transformed.
+func (c *cache) keyNames(keys, aKeys []string) map[string]string {
+	if c.keyTransformer == nil {
+		return nil
+	}
+
+	names := make(map[string]string, len(keys))
+	for i, k := range keys {
+		names[aKeys[i]] = k
+	}
+
+	return names
+}
+
+// withTimeout bounds the adapter operation by the operation timeout if the context has no deadline.
+// The returned cancel function must be called after the operation to release the resources.
+func (c *cache) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opTimeout == 0 {
+		return ctx, func() {}
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, c.opTimeout)
+}
+
+// degraded reports whether the failure of the shared cache operation is caused by the operation timeout,
+// and it's allowed to proceed by the policy.
+// The adapters don't always return context errors on timeout, e.g. i/o timeout, so the contexts are checked instead.
+func (c *cache) degraded(ctx, opCtx context.Context) bool {
+	if c.timeoutPolicy != TimeoutPolicyDegrade {
+		return false
+	}
+
+	return ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded)
+}
+
+// clear deletes all keys under the prefix of the config.
+func (c *cache) clear(ctx context.Context, cfg *config) error {
+	keyPrefix := c.adapterKey(ctx, getCacheKeyPrefix(cfg.prefix))
+
+	if cfg.writeBehind != nil {
+		cfg.writeBehind.dropAll()
+	}
+
+	if cfg.shared != nil {
+		clearer, ok := cfg.shared.(Clearer)
+		if !ok {
+			return &CacheError{Op: "flush", Prefix: cfg.prefix, Err: ErrClearNotSupported}
+		}
+
+		if err := clearer.Clear(ctx, keyPrefix); err != nil {
+			return &CacheError{Op: "flush", Prefix: cfg.prefix, Err: err}
+		}
+	}
+
+	if cfg.local != nil {
+		clearer, ok := cfg.local.(Clearer)
+		if !ok {
+			return &CacheError{Op: "flush", Prefix: cfg.prefix, Err: ErrClearNotSupported}
+		}
+
+		if err := clearer.Clear(ctx, keyPrefix); err != nil {
+			return &CacheError{Op: "flush", Prefix: cfg.prefix, Err: err}
+		}
+
+		c.evictRemoteKeyPrefixes(ctx, keyPrefix)
+	}
+
+	return nil
+}
+
+func (c *cache) evictRemoteKeyMap(ctx context.Context, keyM map[string][]byte) error {
+	if !c.mb.registered() {
+		// no pubsub, do nothing
+		return nil
+	}
+
+	keys := make([]string, len(keyM))
+	i := 0
+	for k := range keyM {
+		keys[i] = k
+		i++
+	}
+
+	return c.evictRemoteKeys(ctx, keys...)
+}
+
+func (c *cache) evictRemoteKeys(ctx context.Context, keys ...string) error {
+	if c.keyTransformer == nil {
+		return c.evictRemoteAdapterKeys(ctx, keys...)
+	}
+
+	// carry the untransformed keys for OnEvict() of other nodes
+	return c.broadcastEvictions(ctx, c.adapterKeys(ctx, keys), keys)
+}
+
+// evictRemoteAdapterKeys broadcasts the evictions of the transformed keys, which are deleted by other nodes as they are.
+// Their untransformed keys are unknown, so OnEvict() of other nodes skips them if they're transformed.
+func (c *cache) evictRemoteAdapterKeys(ctx context.Context, keys ...string) error {
+	var names []string
+	if c.keyTransformer != nil {
+		names = make([]string, len(keys))
+	}
+
+	return c.broadcastEvictions(ctx, keys, names)
+}
+
+func (c *cache) broadcastEvictions(ctx context.Context, keys, names []string) error {
+	if !c.mb.registered() {
+		// no pubsub, do nothing
+		return nil
+	}
+
+	return c.mb.send(ctx, event{
+		Type: EventTypeEvict,
+		Body: eventBody{Keys: keys, Names: names},
+	})
+}
+
+func (c *cache) evictRemoteKeyPrefixes(ctx context.Context, keyPrefixes ...string) error {
+	if !c.mb.registered() {
+		// no pubsub, do nothing
+		return nil
+	}
+
+	return c.mb.send(ctx, event{
+		Type: EventTypeEvict,
+		Body: eventBody{KeyPrefixes: keyPrefixes},
+	})
+}
+
+// resultPool recycles the results if WithPooledResults() is specified.
+var resultPool = sync.Pool{
+	New: func() interface{} {
+		return &result{internalIdx: map[int]int{}}
+	},
+}
+
+type result struct {
+	internalIdx map[int]int
+	// identity is true if the keys are unique, then the index is the same as the original one and internalIdx is unused
+	identity bool
+	vals     [][]byte
+	errs     []error
+	metas    []Meta
+	// loaded reports whether the value of the deduped index is loaded by the getter instead of the cache
+	loaded    []bool
+	unmarshal UnmarshalWithCtxFunc
+	// unmarshalFailed handles the error of unmarshaling the cached value of the deduped index if it's not nil
+	unmarshalFailed func(ctx context.Context, idx int, err error) error
+	// pooled is true if the result is taken from the pool and not released yet
+	pooled bool
+}
+
+// newResult returns the empty result, which is taken from the pool if WithPooledResults() is specified.
+func (c *cache) newResult(cfg *config) *result {
+	if !c.pooledResults {
+		// internalIdx is allocated only if the keys are deduped
+		return &result{unmarshal: cfg.unmarshal}
+	}
+
+	r := resultPool.Get().(*result)
+	r.unmarshal = cfg.unmarshal
+	r.pooled = true
+
+	return r
+}
+
+// resize sets the length of the slices, the backing arrays are reused if they are large enough.
+func (r *result) resize(n int) {
+	if cap(r.vals) < n {
+		r.vals = make([][]byte, n)
+		r.errs = make([]error, n)
+		r.metas = make([]Meta, n)
+		r.loaded = make([]bool, n)
+		return
+	}
+
+	r.vals, r.errs, r.metas, r.loaded = r.vals[:n], r.errs[:n], r.metas[:n], r.loaded[:n]
+}
+
+// Release puts the result back to the pool if it's taken from the pool, otherwise it does nothing.
+func (r *result) Release() {
+	if !r.pooled {
+		return
+	}
+
+	r.Reset()
+	r.unmarshal = nil
+	r.pooled = false
+
+	resultPool.Put(r)
+}
+
+// Reset empties the result, and keeps the allocated slices and index for reusing.
+func (r *result) Reset() {
+	// drop the references, so that the values can be garbage collected
+	for k := range r.internalIdx {
+		delete(r.internalIdx, k)
+	}
+	for i := range r.vals {
+		r.vals[i], r.errs[i], r.metas[i], r.loaded[i] = nil, nil, Meta{}, false
+	}
+	r.resize(0)
+	r.identity = false
+	r.unmarshalFailed = nil
+}
+
+// index maps the original index to the deduped one.
+func (r *result) index(idx int) int {
+	if r.identity {
+		return idx
+	}
+
+	return r.internalIdx[idx]
+}
 
 func (r *result) Len() int {
+	if r.identity {
+		return len(r.vals)
+	}
+
 	return len(r.internalIdx)
 }
 
@@ -394,9 +2559,49 @@ func (r *result) Get(ctx context.Context, idx int, container interface{}) error
 		return ErrResultIndexInvalid
 	}
 
-	if r.errs[r.internalIdx[idx]] != nil {
-		return r.errs[r.internalIdx[idx]]
+	return r.get(ctx, r.index(idx), container)
+}
+
+// get unmarshals the value of the deduped index into the container.
+func (r *result) get(ctx context.Context, i int, container interface{}) error {
+	if r.errs[i] != nil {
+		return r.errs[i]
+	}
+
+	if err := r.unmarshal(ctx, r.vals[i], container); err != nil {
+		// only the cached values are discarded, the ones loaded by the getter are not stored as they are
+		if r.unmarshalFailed != nil && !r.loaded[i] {
+			return r.unmarshalFailed(ctx, i, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *result) OriginalIndexError(idx int) error {
+	if idx < 0 || idx >= r.Len() {
+		return ErrResultIndexInvalid
+	}
+
+	return r.errs[r.index(idx)]
+}
+
+func (r *result) ForEach(
+	ctx context.Context, f func(idx int, unmarshal func(container interface{}) error, err error) bool,
+) {
+	for idx := 0; idx < r.Len(); idx++ {
+		i := r.index(idx)
+		unmarshal := func(container interface{}) error {
+			return r.get(ctx, i, container)
+		}
+
+		if !f(idx, unmarshal, r.errs[i]) {
+			return
+		}
 	}
+}
 
-	return r.unmarshal(r.vals[r.internalIdx[idx]], container)
+func (r *result) IsMiss(idx int) bool {
+	return errors.Is(r.OriginalIndexError(idx), ErrCacheMiss)
 }
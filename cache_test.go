@@ -3,7 +3,14 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -950,15 +957,17 @@ func (s *cacheSuite) TestMGet() {
 	}
 }
 
-func (s *cacheSuite) TestGet() {
+func (s *cacheSuite) TestMGetByFunc() {
 	tests := []struct {
-		Desc      string
-		Settings  []Setting
-		Prefix    string
-		SetupTest map[string]func(string)
-		Key       string
-		ExpError  map[string]error
-		ExpResult map[string]interface{}
+		Desc           string
+		Settings       []Setting
+		Prefix         string
+		SetupTest      map[string]func(string)
+		Keys           []string
+		Getter         map[string]OneTimeMGetterFunc
+		ExpError       map[string]error
+		ExpResultValue map[string][]resultPair
+		CheckFunc      map[string]func(string)
 	}{
 		{
 			Desc: "prefix not registered",
@@ -971,7 +980,7 @@ func (s *cacheSuite) TestGet() {
 			},
 		},
 		{
-			Desc: "Get hit",
+			Desc: "MGet miss but refill by the one-time getter",
 			Settings: []Setting{
 				{
 					Prefix: "mixed",
@@ -979,6 +988,10 @@ func (s *cacheSuite) TestGet() {
 						SharedCacheType: {TTL: time.Hour},
 						LocalCacheType:  {TTL: time.Hour},
 					},
+					MGetter: func(keys ...string) (interface{}, error) {
+						s.Fail("mgetter should not be called")
+						return nil, nil
+					},
 				},
 			},
 			SetupTest: map[string]func(desc string){
@@ -991,99 +1004,47 @@ func (s *cacheSuite) TestGet() {
 						Value:    expB,
 						ExpireAt: time.Now().Add(time.Hour),
 					})
-					b, exist := s.lfu.lfu.Get(cacheKey)
-					s.Require().True(exist, desc, "mixed")
-					s.Require().Equal(expB, b, desc, "mixed")
-
-					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
-					s.Require().Equal(redis.Nil, err, desc, "mixed")
-				},
-			},
-			Key: "key",
-			ExpError: map[string]error{
-				"mixed": nil,
-			},
-			ExpResult: map[string]interface{}{
-				"mixed": mockString,
-			},
-		},
-		{
-			Desc: "Get miss",
-			Settings: []Setting{
-				{
-					Prefix: "mixed",
-					CacheAttributes: map[Type]Attribute{
-						SharedCacheType: {TTL: time.Hour},
-						LocalCacheType:  {TTL: time.Hour},
-					},
 				},
 			},
-			SetupTest: map[string]func(desc string){
-				"mixed": func(desc string) {
-					cacheKey := getCacheKey("mixed", "key")
-					expB, _ := json.Marshal(mockString)
-
-					s.lfu.lfu.Set(&tinylfu.Item{
-						Key:      cacheKey,
-						Value:    expB,
-						ExpireAt: time.Now().Add(time.Hour),
-					})
-					b, exist := s.lfu.lfu.Get(cacheKey)
-					s.Require().True(exist, desc, "mixed")
-					s.Require().Equal(expB, b, desc, "mixed")
-
-					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
-					s.Require().Equal(redis.Nil, err, desc, "mixed")
+			Keys: []string{"key", "not-existed", "not-found", "key"},
+			Getter: map[string]OneTimeMGetterFunc{
+				"mixed": func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+					s.Require().Equal([]string{"not-existed", "not-found"}, keys)
+					return map[string]interface{}{"not-existed": "getter-existed"}, nil
 				},
 			},
-			Key: "not-existed",
 			ExpError: map[string]error{
-				"mixed": ErrCacheMiss,
+				"mixed": nil,
 			},
-		},
-		{
-			Desc: "Get miss but refill again",
-			Settings: []Setting{
-				{
-					Prefix: "mixed",
-					CacheAttributes: map[Type]Attribute{
-						SharedCacheType: {TTL: time.Hour},
-						LocalCacheType:  {TTL: time.Hour},
-					},
-					MGetter: func(keys ...string) (interface{}, error) {
-						s.Require().Equal([]string{"not-existed"}, keys)
-						return []string{"mgetter-existed"}, nil
-					},
+			ExpResultValue: map[string][]resultPair{
+				"mixed": {
+					{value: mockString, err: nil},
+					{value: "getter-existed", err: nil},
+					{value: "", err: ErrCacheMiss},
+					{value: mockString, err: nil},
 				},
 			},
-			SetupTest: map[string]func(desc string){
+			CheckFunc: map[string]func(desc string){
 				"mixed": func(desc string) {
-					cacheKey := getCacheKey("mixed", "key")
-					expB, _ := json.Marshal(mockString)
+					// check refilled in cache
+					notExistKey := getCacheKey("mixed", "not-existed")
+					notExistB, _ := json.Marshal("getter-existed")
 
-					s.lfu.lfu.Set(&tinylfu.Item{
-						Key:      cacheKey,
-						Value:    expB,
-						ExpireAt: time.Now().Add(time.Hour),
-					})
-					b, exist := s.lfu.lfu.Get(cacheKey)
+					b, exist := s.lfu.lfu.Get(notExistKey)
 					s.Require().True(exist, desc, "mixed")
-					s.Require().Equal(expB, b, desc, "mixed")
+					s.Require().Equal(notExistB, b, desc, "mixed")
 
-					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+					b, err := s.ring.Get(mockCacheCTX, notExistKey).Bytes()
+					s.Require().NoError(err, desc, "mixed")
+					s.Require().Equal(notExistB, b, desc, "mixed")
+
+					_, err = s.ring.Get(mockCacheCTX, getCacheKey("mixed", "not-found")).Bytes()
 					s.Require().Equal(redis.Nil, err, desc, "mixed")
 				},
 			},
-			Key: "not-existed",
-			ExpError: map[string]error{
-				"mixed": nil,
-			},
-			ExpResult: map[string]interface{}{
-				"mixed": "mgetter-existed",
-			},
 		},
 		{
-			Desc: "Get miss but refill failed",
+			Desc: "MGet miss but getter failed",
 			Settings: []Setting{
 				{
 					Prefix: "mixed",
@@ -1091,33 +1052,18 @@ func (s *cacheSuite) TestGet() {
 						SharedCacheType: {TTL: time.Hour},
 						LocalCacheType:  {TTL: time.Hour},
 					},
-					MGetter: func(keys ...string) (interface{}, error) {
-						s.Require().Equal([]string{"XD"}, keys)
-						return nil, errors.New("XD")
-					},
 				},
 			},
-			SetupTest: map[string]func(desc string){
-				"mixed": func(desc string) {
-					cacheKey := getCacheKey("mixed", "key")
-					expB, _ := json.Marshal(mockString)
-
-					s.lfu.lfu.Set(&tinylfu.Item{
-						Key:      cacheKey,
-						Value:    expB,
-						ExpireAt: time.Now().Add(time.Hour),
-					})
-					b, exist := s.lfu.lfu.Get(cacheKey)
-					s.Require().True(exist, desc, "mixed")
-					s.Require().Equal(expB, b, desc, "mixed")
-
-					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
-					s.Require().Equal(redis.Nil, err, desc, "mixed")
+			Keys: []string{"XD"},
+			Getter: map[string]OneTimeMGetterFunc{
+				"mixed": func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+					return nil, errors.New("XD")
 				},
 			},
-			Key: "XD",
-			ExpError: map[string]error{
-				"mixed": errors.New("XD"),
+			ExpResultValue: map[string][]resultPair{
+				"mixed": {
+					{value: "", err: errors.New("XD")},
+				},
 			},
 		},
 	}
@@ -1135,11 +1081,23 @@ func (s *cacheSuite) TestGet() {
 				t.SetupTest[pfx](t.Desc)
 			}
 
-			result := ""
-			err := c.Get(mockCacheCTX, pfx, t.Key, &result)
+			r, err := c.MGetByFunc(mockCacheCTX, pfx, t.Keys, t.Getter[pfx])
 			s.Require().Equal(t.ExpError[pfx], err, t.Desc)
 			if err == nil {
-				s.Require().Equal(t.ExpResult[pfx], result, t.Desc)
+				s.Require().Equal(len(t.Keys), r.Len())
+
+				vs := make([]string, r.Len())
+				rs := make([]resultPair, r.Len())
+				for i := 0; i < r.Len(); i++ {
+					err := r.Get(mockCacheCTX, i, &vs[i])
+					rs[i].err = err
+					rs[i].value = vs[i]
+				}
+				s.Require().Equal(t.ExpResultValue[pfx], rs, t.Desc)
+			}
+
+			if t.CheckFunc[pfx] != nil {
+				t.CheckFunc[pfx](t.Desc)
 			}
 
 			s.TearDownTest()
@@ -1147,17 +1105,15 @@ func (s *cacheSuite) TestGet() {
 	}
 }
 
-func (s *cacheSuite) TestGetByFunc() {
+func (s *cacheSuite) TestGet() {
 	tests := []struct {
 		Desc      string
 		Settings  []Setting
 		Prefix    string
 		SetupTest map[string]func(string)
 		Key       string
-		Getter    map[string]func() (interface{}, error)
 		ExpError  map[string]error
 		ExpResult map[string]interface{}
-		CheckFunc map[string]func(string)
 	}{
 		{
 			Desc: "prefix not registered",
@@ -1207,7 +1163,7 @@ func (s *cacheSuite) TestGetByFunc() {
 			},
 		},
 		{
-			Desc: "Get miss but refill again",
+			Desc: "Get miss",
 			Settings: []Setting{
 				{
 					Prefix: "mixed",
@@ -1236,32 +1192,50 @@ func (s *cacheSuite) TestGetByFunc() {
 				},
 			},
 			Key: "not-existed",
-			Getter: map[string]func() (interface{}, error){
-				"mixed": func() (interface{}, error) {
-					return "one-time-getter-existed", nil
-				},
-			},
 			ExpError: map[string]error{
-				"mixed": nil,
+				"mixed": ErrCacheMiss,
 			},
-			ExpResult: map[string]interface{}{
-				"mixed": "one-time-getter-existed",
+		},
+		{
+			Desc: "Get miss but refill again",
+			Settings: []Setting{
+				{
+					Prefix: "mixed",
+					CacheAttributes: map[Type]Attribute{
+						SharedCacheType: {TTL: time.Hour},
+						LocalCacheType:  {TTL: time.Hour},
+					},
+					MGetter: func(keys ...string) (interface{}, error) {
+						s.Require().Equal([]string{"not-existed"}, keys)
+						return []string{"mgetter-existed"}, nil
+					},
+				},
 			},
-			CheckFunc: map[string]func(desc string){
+			SetupTest: map[string]func(desc string){
 				"mixed": func(desc string) {
-					// check refilled in cache
-					notExistKey := getCacheKey("mixed", "not-existed")
-					notExistB, _ := json.Marshal("one-time-getter-existed")
+					cacheKey := getCacheKey("mixed", "key")
+					expB, _ := json.Marshal(mockString)
 
-					b, exist := s.lfu.lfu.Get(notExistKey)
+					s.lfu.lfu.Set(&tinylfu.Item{
+						Key:      cacheKey,
+						Value:    expB,
+						ExpireAt: time.Now().Add(time.Hour),
+					})
+					b, exist := s.lfu.lfu.Get(cacheKey)
 					s.Require().True(exist, desc, "mixed")
-					s.Require().Equal(notExistB, b, desc, "mixed")
+					s.Require().Equal(expB, b, desc, "mixed")
 
-					b, err := s.ring.Get(mockCacheCTX, notExistKey).Bytes()
-					s.Require().NoError(err, desc, "mixed")
-					s.Require().Equal(notExistB, b, desc, "mixed")
+					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+					s.Require().Equal(redis.Nil, err, desc, "mixed")
 				},
 			},
+			Key: "not-existed",
+			ExpError: map[string]error{
+				"mixed": nil,
+			},
+			ExpResult: map[string]interface{}{
+				"mixed": "mgetter-existed",
+			},
 		},
 		{
 			Desc: "Get miss but refill failed",
@@ -1272,6 +1246,10 @@ func (s *cacheSuite) TestGetByFunc() {
 						SharedCacheType: {TTL: time.Hour},
 						LocalCacheType:  {TTL: time.Hour},
 					},
+					MGetter: func(keys ...string) (interface{}, error) {
+						s.Require().Equal([]string{"XD"}, keys)
+						return nil, errors.New("XD")
+					},
 				},
 			},
 			SetupTest: map[string]func(desc string){
@@ -1293,11 +1271,6 @@ func (s *cacheSuite) TestGetByFunc() {
 				},
 			},
 			Key: "XD",
-			Getter: map[string]func() (interface{}, error){
-				"mixed": func() (interface{}, error) {
-					return nil, errors.New("XD")
-				},
-			},
 			ExpError: map[string]error{
 				"mixed": errors.New("XD"),
 			},
@@ -1318,17 +1291,3504 @@ func (s *cacheSuite) TestGetByFunc() {
 			}
 
 			result := ""
-			err := c.GetByFunc(mockCacheCTX, pfx, t.Key, &result, t.Getter[pfx])
+			err := c.Get(mockCacheCTX, pfx, t.Key, &result)
 			s.Require().Equal(t.ExpError[pfx], err, t.Desc)
 			if err == nil {
 				s.Require().Equal(t.ExpResult[pfx], result, t.Desc)
 			}
 
-			if t.CheckFunc[pfx] != nil {
-				t.CheckFunc[pfx](t.Desc)
-			}
-
 			s.TearDownTest()
 		}
 	}
 }
+
+func (s *cacheSuite) TestGetRaw() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "raw",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return []mockStruct{{ID: 1, Key: keys[0]}}, nil
+			},
+			Version: 1,
+		},
+	})
+
+	// reloaded by MGetter
+	var st mockStruct
+	b, err := c.GetRaw(mockCacheCTX, "raw", "key1", &st)
+	s.Require().NoError(err)
+	s.Require().Equal(mockStruct{ID: 1, Key: "key1"}, st)
+
+	// the stored bytes including the envelope
+	stored, err := c.GetBytes(mockCacheCTX, "raw", "key1")
+	s.Require().NoError(err)
+	s.Require().Equal(stored, b)
+	s.Require().Equal(byte(envelopeMagic), b[0])
+
+	b2, err := c.GetRaw(mockCacheCTX, "raw", "key1", &st)
+	s.Require().NoError(err)
+	s.Require().Equal(stored, b2)
+
+	// the unmarshaling error is returned
+	var str int
+	_, err = c.GetRaw(mockCacheCTX, "raw", "key1", &str)
+	s.Require().Error(err)
+
+	_, err = c.GetRaw(mockCacheCTX, "not-registered", "key1", &st)
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestGetOrZero() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "zero",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(c.Set(mockCacheCTX, "zero", "key", mockString))
+
+	ret := ""
+	found, err := c.GetOrZero(mockCacheCTX, "zero", "key", &ret)
+	s.Require().NoError(err)
+	s.Require().True(found)
+	s.Require().Equal(mockString, ret)
+
+	// reset to the zero value on cache-miss
+	found, err = c.GetOrZero(mockCacheCTX, "zero", "missing", &ret)
+	s.Require().NoError(err)
+	s.Require().False(found)
+	s.Require().Equal("", ret)
+
+	// real failures are returned
+	found, err = c.GetOrZero(mockCacheCTX, "not-registered", "key", &ret)
+	s.Require().Equal(ErrPfxNotRegistered, err)
+	s.Require().False(found)
+
+	var num int
+	found, err = c.GetOrZero(mockCacheCTX, "zero", "key", &num)
+	s.Require().Error(err)
+	s.Require().False(found)
+}
+
+func (s *cacheSuite) TestScoped() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "scoped",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+
+	_, err := c.Scoped("not-registered")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+
+	sc, err := c.Scoped("scoped")
+	s.Require().NoError(err)
+
+	s.Require().NoError(sc.Set(mockCacheCTX, "key1", mockString))
+	var ret string
+	s.Require().NoError(c.Get(mockCacheCTX, "scoped", "key1", &ret))
+	s.Require().Equal(mockString, ret)
+
+	ret = ""
+	s.Require().NoError(sc.Get(mockCacheCTX, "key1", &ret))
+	s.Require().Equal(mockString, ret)
+
+	s.Require().NoError(sc.GetByFunc(mockCacheCTX, "key2", &ret, func() (interface{}, error) {
+		return "by-func", nil
+	}))
+	s.Require().Equal("by-func", ret)
+
+	res, err := sc.MGet(mockCacheCTX, "key1", "key2", "key3")
+	s.Require().NoError(err)
+	s.Require().False(res.IsMiss(0))
+	s.Require().False(res.IsMiss(1))
+	s.Require().True(res.IsMiss(2))
+
+	s.Require().NoError(sc.Del(mockCacheCTX, "key1", "key2"))
+	s.Require().Equal(ErrCacheMiss, sc.Get(mockCacheCTX, "key1", &ret))
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "scoped", "key2", &ret))
+}
+
+func (s *cacheSuite) TestPut() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "put",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "put-soft",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour, SoftTTL: time.Minute},
+			},
+		},
+	})
+
+	key, err := c.Put(mockCacheCTX, "put", &mockStruct{ID: 1, Key: "artifact"})
+	s.Require().NoError(err)
+	s.Require().Len(key, 64)
+	s.Require().Len(pubsub.published(), 1)
+
+	var ret mockStruct
+	s.Require().NoError(c.Get(mockCacheCTX, "put", key, &ret))
+	s.Require().Equal(mockStruct{ID: 1, Key: "artifact"}, ret)
+
+	// the identical values share the key
+	sameKey, err := c.Put(mockCacheCTX, "put", mockStruct{ID: 1, Key: "artifact"})
+	s.Require().NoError(err)
+	s.Require().Equal(key, sameKey)
+
+	otherKey, err := c.Put(mockCacheCTX, "put", mockStruct{ID: 2, Key: "other"})
+	s.Require().NoError(err)
+	s.Require().NotEqual(key, otherKey)
+
+	// the soft expiry stamped on the values is ignored
+	softKey, err := c.Put(mockCacheCTX, "put-soft", "value")
+	s.Require().NoError(err)
+	time.Sleep(time.Millisecond)
+	sameKey, err = c.Put(mockCacheCTX, "put-soft", "value")
+	s.Require().NoError(err)
+	s.Require().Equal(softKey, sameKey)
+	var str string
+	s.Require().NoError(c.Get(mockCacheCTX, "put-soft", softKey, &str))
+	s.Require().Equal("value", str)
+
+	_, err = c.Put(mockCacheCTX, "not-registered", "value")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestSetIfChanged() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "changed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "changed-local",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	changed, err := c.SetIfChanged(mockCacheCTX, "changed", "key", "v1")
+	s.Require().NoError(err)
+	s.Require().True(changed)
+	s.Require().Len(pubsub.published(), 1)
+
+	// neither written nor broadcasted
+	changed, err = c.SetIfChanged(mockCacheCTX, "changed", "key", "v1")
+	s.Require().NoError(err)
+	s.Require().False(changed)
+	s.Require().Len(pubsub.published(), 1)
+
+	changed, err = c.SetIfChanged(mockCacheCTX, "changed", "key", "v2")
+	s.Require().NoError(err)
+	s.Require().True(changed)
+	s.Require().Len(pubsub.published(), 2)
+
+	var str string
+	s.Require().NoError(c.Get(mockCacheCTX, "changed", "key", &str))
+	s.Require().Equal("v2", str)
+
+	// compared against the shared cache instead of the stale local one
+	s.Require().NoError(s.rds.Del(mockCacheCTX, getCacheKey("changed", "key")))
+	changed, err = c.SetIfChanged(mockCacheCTX, "changed", "key", "v2")
+	s.Require().NoError(err)
+	s.Require().True(changed)
+	vals, err := s.rds.MGet(mockCacheCTX, []string{getCacheKey("changed", "key")})
+	s.Require().NoError(err)
+	s.Require().True(vals[0].Valid)
+
+	// compared against the local cache without the shared cache
+	changed, err = c.SetIfChanged(mockCacheCTX, "changed-local", "key", "v1")
+	s.Require().NoError(err)
+	s.Require().True(changed)
+	changed, err = c.SetIfChanged(mockCacheCTX, "changed-local", "key", "v1")
+	s.Require().NoError(err)
+	s.Require().False(changed)
+
+	_, err = c.SetIfChanged(mockCacheCTX, "not-registered", "key", "v1")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestSetNXAndSetXX() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "mixed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+		{
+			Prefix: "local",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Minute},
+			},
+		},
+		{
+			Prefix: "behind",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			WriteBehind: &WriteBehind{Interval: time.Second},
+		},
+	})
+
+	for _, pfx := range []string{"mixed", "local"} {
+		set, err := c.SetXX(mockCacheCTX, pfx, "key", "v1")
+		s.Require().NoError(err, pfx)
+		s.Require().False(set, pfx)
+
+		set, err = c.SetNX(mockCacheCTX, pfx, "key", "v1")
+		s.Require().NoError(err, pfx)
+		s.Require().True(set, pfx)
+
+		set, err = c.SetNX(mockCacheCTX, pfx, "key", "v2")
+		s.Require().NoError(err, pfx)
+		s.Require().False(set, pfx)
+
+		var ret string
+		s.Require().NoError(c.Get(mockCacheCTX, pfx, "key", &ret), pfx)
+		s.Require().Equal("v1", ret, pfx)
+
+		// the local value is replaced
+		set, err = c.SetXX(mockCacheCTX, pfx, "key", "v2")
+		s.Require().NoError(err, pfx)
+		s.Require().True(set, pfx)
+		s.Require().NoError(c.Get(mockCacheCTX, pfx, "key", &ret), pfx)
+		s.Require().Equal("v2", ret, pfx)
+	}
+
+	_, err := c.SetNX(mockCacheCTX, "behind", "key", "v1")
+	s.Require().Equal(ErrConditionalSetNotSupported, err)
+	_, err = c.SetNX(mockCacheCTX, "not-registered", "key", "v1")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+// failingDelAdapter fails Del().
+type failingDelAdapter struct {
+	Adapter
+}
+
+func (adp *failingDelAdapter) Del(ctx context.Context, keys ...string) error {
+	return errors.New("failed to del")
+}
+
+func (s *cacheSuite) TestSetNXWithEvictionError() {
+	f := NewFactory(s.rds, &failingDelAdapter{Adapter: s.lfu})
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "setnx-evict",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+
+	// the value is set, but the stale local value remains
+	set, err := c.SetNX(mockCacheCTX, "setnx-evict", "key", "v1")
+	s.Require().True(set)
+	s.Require().EqualError(err, "cache: del setnx-evict: failed to del")
+}
+
+func (s *cacheSuite) TestSetReturning() {
+	f := NewFactory(s.rds, s.lfu)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "returning",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MarshalFunc:   Marshal,
+			UnmarshalFunc: Unmarshal,
+		},
+		{
+			Prefix: "returning-coalesced",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			CoalesceWindow: 50 * time.Millisecond,
+		},
+	})
+
+	// large enough to be compressed
+	value := mockStruct{Key: strings.Repeat("compressible-", 100)}
+	b, err := c.SetReturning(mockCacheCTX, "returning", "key", value)
+	s.Require().NoError(err)
+	expected, err := Marshal(value)
+	s.Require().NoError(err)
+	s.Require().Equal(expected, b)
+	s.Require().Less(len(b), len(value.Key))
+
+	// the returned bytes are the stored ones
+	vals, err := s.rds.MGet(mockCacheCTX, []string{getCacheKey("returning", "key")})
+	s.Require().NoError(err)
+	s.Require().Equal(b, vals[0].Bytes)
+
+	var ret mockStruct
+	s.Require().NoError(c.Get(mockCacheCTX, "returning", "key", &ret))
+	s.Require().Equal(value.Key, ret.Key)
+
+	// the coalesced writers get the bytes of the last writer
+	written := make(chan []byte, 2)
+	go func() {
+		b, err := c.SetReturning(mockCacheCTX, "returning-coalesced", "key", "v1")
+		s.NoError(err)
+		written <- b
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b, err = c.SetReturning(mockCacheCTX, "returning-coalesced", "key", "v2")
+	s.Require().NoError(err)
+	s.Require().Equal(b, <-written)
+	vals, err = s.rds.MGet(mockCacheCTX, []string{getCacheKey("returning-coalesced", "key")})
+	s.Require().NoError(err)
+	s.Require().Equal(b, vals[0].Bytes)
+
+	_, err = c.SetReturning(mockCacheCTX, "not-registered", "key", value)
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestGetMap() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "map",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(c.MSet(mockCacheCTX, "map", map[string]interface{}{
+		"key1": mockStruct{ID: 1},
+		"key2": mockStruct{ID: 2},
+		"bad":  "not a struct",
+	}))
+
+	vals, errs, err := c.GetMap(mockCacheCTX, "map", []string{"key1", "key2", "missing", "key1", "bad"},
+		func() interface{} { return &mockStruct{} },
+	)
+	s.Require().NoError(err)
+	s.Require().Equal(map[string]interface{}{
+		"key1": &mockStruct{ID: 1},
+		"key2": &mockStruct{ID: 2},
+	}, vals)
+	s.Require().Len(errs, 2)
+	s.Require().Equal(ErrCacheMiss, errs["missing"])
+	s.Require().Error(errs["bad"])
+
+	_, _, err = c.GetMap(mockCacheCTX, "not-registered", []string{"key1"}, func() interface{} { return &mockStruct{} })
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestMGetWithMeta() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "meta",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				s.Fail("MGetter is not involved")
+				return nil, nil
+			},
+		},
+	})
+
+	// only cached in the shared cache
+	b, err := json.Marshal(mockCodecStruct{ID: 1})
+	s.Require().NoError(err)
+	s.Require().NoError(s.ring.Set(mockCacheCTX, getCacheKey("meta", "key"), b, time.Hour).Err())
+
+	// loaded from the shared cache
+	res, metas, err := c.MGetWithMeta(mockCacheCTX, "meta", "key", "missing", "key")
+	s.Require().NoError(err)
+	s.Require().Equal(3, res.Len())
+	s.Require().Len(metas, 3)
+	s.Require().True(metas[0].TTL > 10*time.Minute && metas[0].TTL <= time.Hour)
+	s.Require().Equal(len(b), metas[0].Size)
+	s.Require().Equal(Meta{}, metas[1])
+	s.Require().Equal(metas[0], metas[2])
+	s.Require().True(res.IsMiss(1))
+
+	var ret mockCodecStruct
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &ret))
+	s.Require().Equal(mockCodecStruct{ID: 1}, ret)
+
+	// loaded from the local cache refilled just now, the TTL is randomized by the offset
+	_, metas, err = c.MGetWithMeta(mockCacheCTX, "meta", "key")
+	s.Require().NoError(err)
+	s.Require().True(metas[0].TTL > 0 && metas[0].TTL <= time.Minute+maxOffset)
+	s.Require().Equal(len(b), metas[0].Size)
+
+	_, _, err = c.MGetWithMeta(mockCacheCTX, "not-registered", "key")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestSetWithDeterministicTTL() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "precise",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+			DeterministicTTL: true,
+		},
+		{
+			Prefix: "jittered",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	keyVals := map[string]interface{}{}
+	for i := 0; i < 10; i++ {
+		keyVals[strconv.Itoa(i)] = i
+	}
+
+	before := time.Now()
+	s.Require().NoError(c.MSet(mockCacheCTX, "precise", keyVals))
+	s.Require().NoError(c.MSet(mockCacheCTX, "jittered", keyVals))
+	after := time.Now()
+
+	jittered := false
+	for k := range keyVals {
+		expireAt := s.lfu.entries[getCacheKey("precise", k)].expireAt
+		s.Require().False(expireAt.Before(before.Add(time.Hour)))
+		s.Require().False(expireAt.After(after.Add(time.Hour)))
+
+		if s.lfu.entries[getCacheKey("jittered", k)].expireAt.After(after.Add(time.Hour)) {
+			jittered = true
+		}
+	}
+	s.Require().True(jittered)
+}
+
+func (s *cacheSuite) TestWarmLocal() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "warm",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				s.Fail("MGetter is not involved")
+				return nil, nil
+			},
+		},
+		{
+			Prefix: "warm-shared",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(s.ring.Set(mockCacheCTX, getCacheKey("warm", "key1"), "1", time.Hour).Err())
+	s.Require().NoError(s.ring.Set(mockCacheCTX, getCacheKey("warm", "key2"), "2", time.Hour).Err())
+
+	s.Require().NoError(c.WarmLocal(mockCacheCTX, "warm", []string{"key1", "key2", "missing"}))
+	vals, err := s.lfu.MGet(mockCacheCTX, getCacheKeys("warm", []string{"key1", "key2", "missing"}))
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("1")}, {Valid: true, Bytes: []byte("2")}, {}}, vals)
+	s.Require().Empty(pubsub.published())
+
+	// nothing to warm without the local cache
+	s.Require().NoError(c.WarmLocal(mockCacheCTX, "warm-shared", []string{"key1"}))
+	s.Require().Equal(ErrPfxNotRegistered, c.WarmLocal(mockCacheCTX, "not-registered", []string{"key1"}))
+}
+
+func (s *cacheSuite) TestEvictLocal() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "evict-local",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "evict-shared",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(c.Set(mockCacheCTX, "evict-local", "key", "value"))
+	published := len(pubsub.published())
+
+	s.Require().NoError(c.EvictLocal(mockCacheCTX, "evict-local", "key"))
+	vals, err := s.lfu.MGet(mockCacheCTX, []string{getCacheKey("evict-local", "key")})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+	s.Require().Len(pubsub.published(), published) // no evictions are broadcasted
+
+	// the shared cache is kept
+	var v string
+	s.Require().NoError(c.Get(mockCacheCTX, "evict-local", "key", &v))
+	s.Require().Equal("value", v)
+
+	// nothing to evict without the local cache
+	s.Require().NoError(c.EvictLocal(mockCacheCTX, "evict-shared", "key"))
+	s.Require().Equal(ErrPfxNotRegistered, c.EvictLocal(mockCacheCTX, "not-registered", "key"))
+}
+
+func (s *cacheSuite) TestTreatUnmarshalErrorAsMiss() {
+	settings := []Setting{
+		{
+			Prefix: "corrupted",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return []string{"reloaded"}, nil
+			},
+		},
+		{
+			Prefix: "corrupted-no-getter",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	}
+	corrupt := func(prefix string) {
+		s.Require().NoError(s.ring.Set(mockCacheCTX, getCacheKey(prefix, "key"), "{corrupted", time.Hour).Err())
+	}
+
+	failed := []string{}
+	onUnmarshalError := OnUnmarshalErrorFunc(func(prefix string, key string, err error) {
+		s.Require().Error(err)
+		failed = append(failed, prefix+"/"+key)
+	})
+
+	// the error is returned as is by default
+	f := NewFactory(s.rds, NewTinyLFU(10000), onUnmarshalError)
+	c := f.NewCache(settings)
+	corrupt("corrupted")
+	var v string
+	err := c.Get(mockCacheCTX, "corrupted", "key", &v)
+	s.Require().Error(err)
+	s.Require().NotErrorIs(err, ErrCacheMiss)
+	s.Require().Equal([]string{"corrupted/key"}, failed)
+	f.Close()
+
+	failed = failed[:0]
+	f = NewFactory(s.rds, NewTinyLFU(10000), onUnmarshalError, WithTreatUnmarshalErrorAsMiss(true))
+	defer f.Close()
+	c = f.NewCache(settings)
+
+	// reloaded by MGetter
+	s.Require().NoError(c.Get(mockCacheCTX, "corrupted", "key", &v))
+	s.Require().Equal("reloaded", v)
+	b, err := s.ring.Get(mockCacheCTX, getCacheKey("corrupted", "key")).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(`"reloaded"`, string(b))
+
+	// reloaded by the getter
+	corrupt("corrupted")
+	s.Require().NoError(c.EvictLocal(mockCacheCTX, "corrupted", "key"))
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "corrupted", "key", &v, func() (interface{}, error) {
+		return "by-func", nil
+	}))
+	s.Require().Equal("by-func", v)
+
+	// reloaded by MGetter in GetRaw
+	corrupt("corrupted")
+	s.Require().NoError(c.EvictLocal(mockCacheCTX, "corrupted", "key"))
+	raw, err := c.GetRaw(mockCacheCTX, "corrupted", "key", &v)
+	s.Require().NoError(err)
+	s.Require().Equal("reloaded", v)
+	s.Require().Equal(`"reloaded"`, string(raw))
+
+	// treated as cache-miss without the getter
+	corrupt("corrupted-no-getter")
+	res, err := c.MGet(mockCacheCTX, "corrupted-no-getter", "key")
+	s.Require().NoError(err)
+	err = res.Get(mockCacheCTX, 0, &v)
+	s.Require().ErrorIs(err, ErrCacheMiss)
+	var missErr *UnmarshalMissError
+	s.Require().ErrorAs(err, &missErr)
+	s.Require().ErrorIs(s.ring.Get(mockCacheCTX, getCacheKey("corrupted-no-getter", "key")).Err(), redis.Nil)
+
+	// so does ForEach
+	corrupt("corrupted-no-getter")
+	res, err = c.MGet(mockCacheCTX, "corrupted-no-getter", "key")
+	s.Require().NoError(err)
+	res.ForEach(mockCacheCTX, func(idx int, unmarshal func(container interface{}) error, err error) bool {
+		s.Require().NoError(err)
+		s.Require().ErrorIs(unmarshal(&v), ErrCacheMiss)
+		return true
+	})
+	s.Require().ErrorIs(s.ring.Get(mockCacheCTX, getCacheKey("corrupted-no-getter", "key")).Err(), redis.Nil)
+
+	// the values loaded by the getter are not discarded
+	res, err = c.MGetByFunc(mockCacheCTX, "corrupted-no-getter", []string{"loaded"},
+		func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+			return map[string]interface{}{"loaded": "not-a-number"}, nil
+		})
+	s.Require().NoError(err)
+	var n int
+	err = res.Get(mockCacheCTX, 0, &n)
+	s.Require().Error(err)
+	s.Require().NotErrorIs(err, ErrCacheMiss)
+	s.Require().NoError(s.ring.Get(mockCacheCTX, getCacheKey("corrupted-no-getter", "loaded")).Err())
+
+	s.Require().Equal([]string{
+		"corrupted/key", "corrupted/key", "corrupted/key", "corrupted-no-getter/key", "corrupted-no-getter/key",
+	}, failed)
+}
+
+func (s *cacheSuite) TestKeyTransformer() {
+	tenantCTX := func(tenant string) context.Context {
+		return context.WithValue(mockCacheCTX, mockTenantKey{}, tenant)
+	}
+
+	costAdded := map[string]int{}
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu,
+		WithPubSub(pubsub),
+		WithKeyTransformer(func(ctx context.Context, cacheKey string) string {
+			tenant, _ := ctx.Value(mockTenantKey{}).(string)
+			return tenant + "#" + cacheKey
+		}),
+		OnLocalCacheCostAddFunc(func(prefix string, key string, cost int) {
+			costAdded[prefix+"/"+key] += cost
+		}),
+	)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "tenant",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+	})
+
+	// the tenants are isolated
+	s.Require().NoError(c.Set(tenantCTX("a"), "tenant", "key", "value-a"))
+	s.Require().NoError(c.Set(tenantCTX("b"), "tenant", "key", "value-b"))
+
+	var v string
+	s.Require().NoError(c.Get(tenantCTX("a"), "tenant", "key", &v))
+	s.Require().Equal("value-a", v)
+	s.Require().NoError(c.Get(tenantCTX("b"), "tenant", "key", &v))
+	s.Require().Equal("value-b", v)
+	s.Require().ErrorIs(c.Get(tenantCTX("c"), "tenant", "key", &v), ErrCacheMiss)
+
+	// the transformed keys are stored in the adapters
+	b, err := s.ring.Get(mockCacheCTX, "a#"+getCacheKey("tenant", "key")).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(`"value-a"`, string(b))
+	vals, err := s.lfu.MGet(mockCacheCTX, []string{"b#" + getCacheKey("tenant", "key"), getCacheKey("tenant", "key")})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte(`"value-b"`)}, {}}, vals)
+
+	// the callbacks are given the untransformed prefix and key
+	s.Require().Equal(map[string]int{"tenant/key": len(`"value-a"`) + len(`"value-b"`)}, costAdded)
+
+	// the evictions are broadcasted with the transformed keys
+	published := pubsub.published()
+	s.Require().NotEmpty(published)
+	s.Require().Contains(string(published[len(published)-1]), "b#"+getCacheKey("tenant", "key"))
+
+	// the evictions carry the untransformed keys for OnEvict() of other nodes
+	evicted := []string{}
+	f.OnEvict(func(ctx context.Context, keys []string) {
+		evicted = append(evicted, keys...)
+	})
+	var body eventBody
+	s.Require().NoError(json.Unmarshal(published[len(published)-1], &body))
+	s.Require().Equal([]string{getCacheKey("tenant", "key")}, body.Names)
+	f.(*factory).evicted(mockCacheCTX, body)
+	s.Require().Equal([]string{"key"}, evicted)
+
+	// the keys whose untransformed ones are unknown are skipped
+	evicted = evicted[:0]
+	f.(*factory).evicted(mockCacheCTX, eventBody{
+		Keys:  []string{"a#" + getCacheKey("tenant", "key"), "a#" + getCacheKey("tenant", "other")},
+		Names: []string{"", getCacheKey("tenant", "other")},
+	})
+	s.Require().Equal([]string{"other"}, evicted)
+
+	// deleting affects the tenant only
+	s.Require().NoError(c.Del(tenantCTX("a"), "tenant", "key"))
+	s.Require().ErrorIs(c.Get(tenantCTX("a"), "tenant", "key", &v), ErrCacheMiss)
+	s.Require().NoError(c.Get(tenantCTX("b"), "tenant", "key", &v))
+	s.Require().Equal("value-b", v)
+}
+
+func (s *cacheSuite) TestKeyVersion() {
+	s.Require().PanicsWithError("key version containing the delimiter", func() {
+		NewFactory(s.rds, s.lfu, WithKeyVersion("v"+cacheDelim+"2"))
+	})
+
+	costAdded := map[string]int{}
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu,
+		WithPubSub(pubsub),
+		WithKeyVersion("v2"),
+		OnLocalCacheCostAddFunc(func(prefix string, key string, cost int) {
+			costAdded[prefix+"/"+key] += cost
+		}),
+	)
+	defer f.Close()
+
+	setting := Setting{
+		Prefix: "versioned",
+		CacheAttributes: map[Type]Attribute{
+			SharedCacheType: {TTL: time.Hour},
+			LocalCacheType:  {TTL: time.Hour},
+		},
+	}
+	c := f.NewCache([]Setting{setting})
+	s.Require().NoError(c.Set(mockCacheCTX, "versioned", "key", "value"))
+
+	// the versioned keys are stored in the adapters
+	b, err := s.ring.Get(mockCacheCTX, packageKey+":v2:versioned:key").Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(`"value"`, string(b))
+	vals, err := s.lfu.MGet(mockCacheCTX, []string{packageKey + ":v2:versioned:key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte(`"value"`)}}, vals)
+
+	// the callbacks are given the unversioned prefix and key
+	s.Require().Equal(map[string]int{"versioned/key": len(`"value"`)}, costAdded)
+	evicted := []string{}
+	f.OnEvict(func(ctx context.Context, keys []string) {
+		evicted = append(evicted, keys...)
+	})
+	published := len(pubsub.published())
+	s.Require().NoError(c.Del(mockCacheCTX, "versioned", "key"))
+	var body eventBody
+	s.Require().NoError(json.Unmarshal(pubsub.published()[published], &body))
+	s.Require().Equal([]string{packageKey + ":v2:versioned:key"}, body.Keys)
+	f.(*factory).evicted(mockCacheCTX, body)
+	s.Require().Equal([]string{"key"}, evicted)
+	s.Require().NoError(c.Set(mockCacheCTX, "versioned", "key", "value"))
+
+	// the evictions from the nodes without the names are parsed from the keys
+	evicted = evicted[:0]
+	f.(*factory).evicted(mockCacheCTX, eventBody{Keys: []string{packageKey + ":v2:versioned:key"}})
+	s.Require().Equal([]string{"key"}, evicted)
+
+	// other versions don't see the values
+	other := NewFactory(s.rds, NewTinyLFU(10000), WithKeyVersion("v1"))
+	defer other.Close()
+	var v string
+	s.Require().ErrorIs(other.NewCache([]Setting{setting}).Get(mockCacheCTX, "versioned", "key", &v), ErrCacheMiss)
+	s.Require().NoError(c.Get(mockCacheCTX, "versioned", "key", &v))
+	s.Require().Equal("value", v)
+}
+
+func (s *cacheSuite) TestSetWithRefillFailurePolicy() {
+	tests := []struct {
+		Desc      string
+		Policy    RefillFailurePolicy
+		ExpError  bool
+		ExpShared int64
+	}{
+		{
+			Desc:      "ignore local failure",
+			Policy:    RefillPolicyIgnoreLocalFailure,
+			ExpError:  false,
+			ExpShared: 1,
+		},
+		{
+			Desc:      "rollback shared",
+			Policy:    RefillPolicyRollbackShared,
+			ExpError:  true,
+			ExpShared: 0,
+		},
+		{
+			Desc:      "fail operation",
+			Policy:    RefillPolicyFailOperation,
+			ExpError:  true,
+			ExpShared: 1,
+		},
+	}
+
+	for _, t := range tests {
+		local := &failingAdapter{Adapter: NewTinyLFU(10000)}
+		s.Require().NoError(local.MSet(mockCacheCTX, map[string][]byte{getCacheKey("refill", "key"): []byte("0")}, time.Hour))
+		local.fail = true
+
+		pubsub := &countingPubsub{messChan: make(chan Message)}
+		refillErrs := []error{}
+		f := NewFactory(s.rds, local, WithPubSub(pubsub), WithRefillFailurePolicy(t.Policy),
+			OnRefillFailureFunc(func(err error) {
+				refillErrs = append(refillErrs, err)
+			}),
+		)
+
+		c := f.NewCache([]Setting{
+			{
+				Prefix: "refill",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+					LocalCacheType:  {TTL: time.Hour},
+				},
+			},
+		})
+
+		err := c.Set(mockCacheCTX, "refill", "key", 1)
+		if t.ExpError {
+			var cacheErr *CacheError
+			s.Require().ErrorAs(err, &cacheErr, t.Desc)
+			s.Require().Equal("refill", cacheErr.Op, t.Desc)
+		} else {
+			s.Require().NoError(err, t.Desc)
+		}
+		s.Require().Len(refillErrs, 1, t.Desc)
+		s.Require().Equal(t.ExpShared, s.ring.Exists(mockCacheCTX, getCacheKey("refill", "key")).Val(), t.Desc)
+
+		// the stale local value is dropped, and other nodes are notified
+		vals, err := local.Adapter.MGet(mockCacheCTX, []string{getCacheKey("refill", "key")})
+		s.Require().NoError(err, t.Desc)
+		s.Require().Equal([]Value{{}}, vals, t.Desc)
+		s.Require().Len(pubsub.published(), 1, t.Desc)
+
+		f.Close()
+		s.TearDownTest()
+	}
+}
+
+func (s *cacheSuite) TestMGetWithPooledResults() {
+	f := NewFactory(s.rds, s.lfu, WithPooledResults())
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "pooled",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+	})
+	s.Require().NoError(c.MSet(mockCacheCTX, "pooled", map[string]interface{}{"key1": 1, "key2": 2}))
+
+	for i := 0; i < 10; i++ {
+		keys := []string{"key1", "missing", "key2", "key1"}
+		if i%2 == 1 {
+			keys = []string{"key2"}
+		}
+
+		res, err := c.MGet(mockCacheCTX, "pooled", keys...)
+		s.Require().NoError(err)
+		s.Require().Equal(len(keys), res.Len())
+
+		for idx, k := range keys {
+			var ret int
+			if k == "missing" {
+				s.Require().True(res.IsMiss(idx))
+				continue
+			}
+
+			s.Require().NoError(res.Get(mockCacheCTX, idx, &ret))
+			s.Require().Equal(int(k[len(k)-1]-'0'), ret)
+		}
+
+		res.Release()
+		// releasing twice is fine
+		res.Release()
+	}
+
+	// no-op without the option
+	c2 := s.factory.NewCache([]Setting{
+		{
+			Prefix: "not-pooled",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	s.Require().NoError(c2.Set(mockCacheCTX, "not-pooled", "key", 1))
+	res, err := c2.MGet(mockCacheCTX, "not-pooled", "key")
+	s.Require().NoError(err)
+	res.Release()
+
+	var ret int
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &ret))
+	s.Require().Equal(1, ret)
+}
+
+func (s *cacheSuite) TestMGetInto() {
+	f := NewFactory(s.rds, s.lfu, WithPooledResults())
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "buf-json",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MarshalFunc:   json.Marshal,
+			UnmarshalFunc: json.Unmarshal,
+		},
+		{
+			Prefix: "buf-xml",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MarshalFunc:   xml.Marshal,
+			UnmarshalFunc: xml.Unmarshal,
+			MGetter: func(keys ...string) (interface{}, error) {
+				return keys, nil
+			},
+		},
+	})
+	s.Require().NoError(c.MSet(mockCacheCTX, "buf-json", map[string]interface{}{"key1": "v1", "key2": "v2"}))
+
+	buf := f.NewResultBuffer()
+	s.Require().Equal(0, buf.Len())
+
+	var str string
+	s.Require().NoError(c.MGetInto(mockCacheCTX, "buf-json", buf, "key1", "missing", "key1"))
+	s.Require().Equal(3, buf.Len())
+	s.Require().NoError(buf.Get(mockCacheCTX, 2, &str))
+	s.Require().Equal("v1", str)
+	s.Require().True(buf.IsMiss(1))
+
+	// the values of the previous call are dropped, and the unmarshal function is rebound
+	s.Require().NoError(c.MGetInto(mockCacheCTX, "buf-xml", buf, "key3"))
+	s.Require().Equal(1, buf.Len())
+	s.Require().NoError(buf.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("key3", str)
+
+	s.Require().NoError(c.MGetInto(mockCacheCTX, "buf-json", buf, "key2"))
+	s.Require().NoError(buf.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("v2", str)
+
+	// the buffer is never put into the pool
+	buf.Release()
+	s.Require().NoError(buf.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("v2", str)
+
+	buf.Reset()
+	s.Require().Equal(0, buf.Len())
+	s.Require().Equal(ErrResultIndexInvalid, buf.Get(mockCacheCTX, 0, &str))
+
+	// the results of MGet are not accepted
+	res, err := c.MGet(mockCacheCTX, "buf-json", "key1")
+	s.Require().NoError(err)
+	s.Require().Equal(ErrResultBufferInvalid, c.MGetInto(mockCacheCTX, "buf-json", res, "key1"))
+	res.Release()
+
+	s.Require().Equal(ErrPfxNotRegistered, c.MGetInto(mockCacheCTX, "not-registered", buf, "key1"))
+}
+
+func (s *cacheSuite) TestGetWithUnmarshalFallbacks() {
+	// cached by the json codec before migrating
+	b, err := json.Marshal(mockCodecStruct{ID: 1})
+	s.Require().NoError(err)
+	s.Require().NoError(s.ring.Set(mockCacheCTX, getCacheKey("migrating", "key"), b, time.Hour).Err())
+
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "migrating",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MarshalFunc:        MsgpackMarshal,
+			UnmarshalFunc:      MsgpackUnmarshal,
+			UnmarshalFallbacks: []UnmarshalFunc{json.Unmarshal},
+		},
+	})
+
+	var ret mockCodecStruct
+	s.Require().NoError(c.Get(mockCacheCTX, "migrating", "key", &ret))
+	s.Require().Equal(mockCodecStruct{ID: 1}, ret)
+
+	// written by the new codec
+	s.Require().NoError(c.Set(mockCacheCTX, "migrating", "key", mockCodecStruct{ID: 2}))
+	b, err = s.ring.Get(mockCacheCTX, getCacheKey("migrating", "key")).Bytes()
+	s.Require().NoError(err)
+	var msgpackRet mockCodecStruct
+	s.Require().NoError(MsgpackUnmarshal(b, &msgpackRet))
+	s.Require().Equal(mockCodecStruct{ID: 2}, msgpackRet)
+}
+
+func (s *cacheSuite) TestGetWithBackfillShared() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "backfill",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+			BackfillShared: true,
+		},
+	})
+	cacheKey := getCacheKey("backfill", "key")
+
+	// only in the local cache
+	s.Require().NoError(s.lfu.MSet(mockCacheCTX, map[string][]byte{cacheKey: []byte(`"local"`)}, time.Minute))
+
+	var ret string
+	s.Require().NoError(c.Get(mockCacheCTX, "backfill", "key", &ret))
+	s.Require().Equal("local", ret)
+
+	b, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal([]byte(`"local"`), b)
+	s.Require().True(s.ring.TTL(mockCacheCTX, cacheKey).Val() > time.Minute)
+
+	// not overwritten if the shared cache has it
+	s.Require().NoError(s.ring.Set(mockCacheCTX, cacheKey, `"shared"`, time.Hour).Err())
+	s.Require().NoError(c.Get(mockCacheCTX, "backfill", "key", &ret))
+	s.Require().Equal("local", ret)
+	s.Require().Equal(`"shared"`, s.ring.Get(mockCacheCTX, cacheKey).Val())
+}
+
+func (s *cacheSuite) TestPrefixes() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "sharedOnly",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return keys, nil
+			},
+		},
+		{
+			Prefix: "multiLayer",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+
+	s.Require().Equal([]PrefixInfo{
+		{Prefix: "multiLayer", SharedTTL: time.Hour, LocalTTL: time.Minute, HasShared: true, HasLocal: true},
+		{Prefix: "sharedOnly", SharedTTL: time.Hour, HasShared: true, HasMGetter: true},
+	}, c.Prefixes())
+}
+
+func (s *cacheSuite) TestSetMGetter() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "swap",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return []string{"old"}, nil
+			},
+		},
+	})
+
+	var str string
+	s.Require().NoError(c.Get(mockCacheCTX, "swap", "key1", &str))
+	s.Require().Equal("old", str)
+
+	s.Require().NoError(c.SetMGetter("swap", func(keys ...string) (interface{}, error) {
+		return []string{"new"}, nil
+	}))
+	s.Require().NoError(c.Get(mockCacheCTX, "swap", "key2", &str))
+	s.Require().Equal("new", str)
+	// the cached value is untouched
+	s.Require().NoError(c.Get(mockCacheCTX, "swap", "key1", &str))
+	s.Require().Equal("old", str)
+
+	// nil disables reloading
+	s.Require().NoError(c.SetMGetter("swap", nil))
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "swap", "key3", &str))
+	s.Require().False(c.Prefixes()[0].HasMGetter)
+
+	s.Require().Equal(ErrPfxNotRegistered, c.SetMGetter("not-registered", nil))
+}
+
+func (s *cacheSuite) TestSetMGetterInFlight() {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "swap-in-flight",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				close(entered)
+				<-release
+				return []string{"old"}, nil
+			},
+		},
+	})
+
+	done := make(chan string)
+	go func() {
+		var str string
+		s.Require().NoError(c.Get(mockCacheCTX, "swap-in-flight", "key1", &str))
+		done <- str
+	}()
+
+	// the call in-flight keeps using the old one
+	<-entered
+	s.Require().NoError(c.SetMGetter("swap-in-flight", func(keys ...string) (interface{}, error) {
+		return []string{"new"}, nil
+	}))
+	close(release)
+	s.Require().Equal("old", <-done)
+
+	var str string
+	s.Require().NoError(c.Get(mockCacheCTX, "swap-in-flight", "key2", &str))
+	s.Require().Equal("new", str)
+}
+
+type mockTenantKey struct{}
+
+func (s *cacheSuite) TestGetWithCtxCodec() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "tenant",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return keys, nil
+			},
+			// ignored in favor of the context-aware ones
+			MarshalFunc:   xml.Marshal,
+			UnmarshalFunc: xml.Unmarshal,
+			MarshalWithCtx: func(ctx context.Context, value interface{}) ([]byte, error) {
+				return []byte(ctx.Value(mockTenantKey{}).(string) + ":" + value.(string)), nil
+			},
+			UnmarshalWithCtx: func(ctx context.Context, b []byte, value interface{}) error {
+				tenant := ctx.Value(mockTenantKey{}).(string) + ":"
+				if !strings.HasPrefix(string(b), tenant) {
+					return errors.New("tenant mismatch")
+				}
+
+				*value.(*string) = strings.TrimPrefix(string(b), tenant)
+				return nil
+			},
+			Version: 1,
+		},
+	})
+
+	ctx := context.WithValue(mockCacheCTX, mockTenantKey{}, "tenant1")
+	s.Require().NoError(c.Set(ctx, "tenant", "key1", "value1"))
+
+	var ret string
+	s.Require().NoError(c.Get(ctx, "tenant", "key1", &ret))
+	s.Require().Equal("value1", ret)
+	s.Require().NoError(c.GetByFunc(ctx, "tenant", "key2", &ret, func() (interface{}, error) {
+		return "value2", nil
+	}))
+	s.Require().Equal("value2", ret)
+
+	res, err := c.MGet(ctx, "tenant", "key3")
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(ctx, 0, &ret))
+	s.Require().Equal("key3", ret)
+
+	another := context.WithValue(mockCacheCTX, mockTenantKey{}, "tenant2")
+	s.Require().EqualError(c.Get(another, "tenant", "key1", &ret), "tenant mismatch")
+}
+
+func (s *cacheSuite) TestGetByFunc() {
+	tests := []struct {
+		Desc      string
+		Settings  []Setting
+		Prefix    string
+		SetupTest map[string]func(string)
+		Key       string
+		Getter    map[string]func() (interface{}, error)
+		ExpError  map[string]error
+		ExpResult map[string]interface{}
+		CheckFunc map[string]func(string)
+	}{
+		{
+			Desc: "prefix not registered",
+			Settings: []Setting{{
+				Prefix: "registered", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+			}},
+			Prefix: "not-registered",
+			ExpError: map[string]error{
+				"not-registered": ErrPfxNotRegistered,
+			},
+		},
+		{
+			Desc: "Get hit",
+			Settings: []Setting{
+				{
+					Prefix: "mixed",
+					CacheAttributes: map[Type]Attribute{
+						SharedCacheType: {TTL: time.Hour},
+						LocalCacheType:  {TTL: time.Hour},
+					},
+				},
+			},
+			SetupTest: map[string]func(desc string){
+				"mixed": func(desc string) {
+					cacheKey := getCacheKey("mixed", "key")
+					expB, _ := json.Marshal(mockString)
+
+					s.lfu.lfu.Set(&tinylfu.Item{
+						Key:      cacheKey,
+						Value:    expB,
+						ExpireAt: time.Now().Add(time.Hour),
+					})
+					b, exist := s.lfu.lfu.Get(cacheKey)
+					s.Require().True(exist, desc, "mixed")
+					s.Require().Equal(expB, b, desc, "mixed")
+
+					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+					s.Require().Equal(redis.Nil, err, desc, "mixed")
+				},
+			},
+			Key: "key",
+			ExpError: map[string]error{
+				"mixed": nil,
+			},
+			ExpResult: map[string]interface{}{
+				"mixed": mockString,
+			},
+		},
+		{
+			Desc: "Get miss but refill again",
+			Settings: []Setting{
+				{
+					Prefix: "mixed",
+					CacheAttributes: map[Type]Attribute{
+						SharedCacheType: {TTL: time.Hour},
+						LocalCacheType:  {TTL: time.Hour},
+					},
+				},
+			},
+			SetupTest: map[string]func(desc string){
+				"mixed": func(desc string) {
+					cacheKey := getCacheKey("mixed", "key")
+					expB, _ := json.Marshal(mockString)
+
+					s.lfu.lfu.Set(&tinylfu.Item{
+						Key:      cacheKey,
+						Value:    expB,
+						ExpireAt: time.Now().Add(time.Hour),
+					})
+					b, exist := s.lfu.lfu.Get(cacheKey)
+					s.Require().True(exist, desc, "mixed")
+					s.Require().Equal(expB, b, desc, "mixed")
+
+					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+					s.Require().Equal(redis.Nil, err, desc, "mixed")
+				},
+			},
+			Key: "not-existed",
+			Getter: map[string]func() (interface{}, error){
+				"mixed": func() (interface{}, error) {
+					return "one-time-getter-existed", nil
+				},
+			},
+			ExpError: map[string]error{
+				"mixed": nil,
+			},
+			ExpResult: map[string]interface{}{
+				"mixed": "one-time-getter-existed",
+			},
+			CheckFunc: map[string]func(desc string){
+				"mixed": func(desc string) {
+					// check refilled in cache
+					notExistKey := getCacheKey("mixed", "not-existed")
+					notExistB, _ := json.Marshal("one-time-getter-existed")
+
+					b, exist := s.lfu.lfu.Get(notExistKey)
+					s.Require().True(exist, desc, "mixed")
+					s.Require().Equal(notExistB, b, desc, "mixed")
+
+					b, err := s.ring.Get(mockCacheCTX, notExistKey).Bytes()
+					s.Require().NoError(err, desc, "mixed")
+					s.Require().Equal(notExistB, b, desc, "mixed")
+				},
+			},
+		},
+		{
+			Desc: "Get miss but refill failed",
+			Settings: []Setting{
+				{
+					Prefix: "mixed",
+					CacheAttributes: map[Type]Attribute{
+						SharedCacheType: {TTL: time.Hour},
+						LocalCacheType:  {TTL: time.Hour},
+					},
+				},
+			},
+			SetupTest: map[string]func(desc string){
+				"mixed": func(desc string) {
+					cacheKey := getCacheKey("mixed", "key")
+					expB, _ := json.Marshal(mockString)
+
+					s.lfu.lfu.Set(&tinylfu.Item{
+						Key:      cacheKey,
+						Value:    expB,
+						ExpireAt: time.Now().Add(time.Hour),
+					})
+					b, exist := s.lfu.lfu.Get(cacheKey)
+					s.Require().True(exist, desc, "mixed")
+					s.Require().Equal(expB, b, desc, "mixed")
+
+					_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+					s.Require().Equal(redis.Nil, err, desc, "mixed")
+				},
+			},
+			Key: "XD",
+			Getter: map[string]func() (interface{}, error){
+				"mixed": func() (interface{}, error) {
+					return nil, errors.New("XD")
+				},
+			},
+			ExpError: map[string]error{
+				"mixed": errors.New("XD"),
+			},
+		},
+	}
+
+	for _, t := range tests {
+		c := s.factory.NewCache(t.Settings).(*cache)
+
+		for _, sett := range t.Settings {
+			pfx := sett.Prefix
+			if t.Prefix != "" {
+				pfx = t.Prefix
+			}
+
+			if t.SetupTest[pfx] != nil {
+				t.SetupTest[pfx](t.Desc)
+			}
+
+			result := ""
+			err := c.GetByFunc(mockCacheCTX, pfx, t.Key, &result, t.Getter[pfx])
+			s.Require().Equal(t.ExpError[pfx], err, t.Desc)
+			if err == nil {
+				s.Require().Equal(t.ExpResult[pfx], result, t.Desc)
+			}
+
+			if t.CheckFunc[pfx] != nil {
+				t.CheckFunc[pfx](t.Desc)
+			}
+
+			s.TearDownTest()
+		}
+	}
+}
+
+func (s *cacheSuite) TestGetByFuncWithRefillLocalOnly() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "mixed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "redis",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	getter := func() (interface{}, error) { return mockString, nil }
+
+	var ret string
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "mixed", "key", &ret, getter, WithRefillLocalOnly()))
+	s.Require().Equal(mockString, ret)
+
+	// refilled into the local cache only
+	cacheKey := getCacheKey("mixed", "key")
+	expB, _ := json.Marshal(mockString)
+	b, exist := s.lfu.lfu.Get(cacheKey)
+	s.Require().True(exist)
+	s.Require().Equal(expB, b)
+	_, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+	s.Require().Equal(redis.Nil, err)
+
+	// nothing refilled without the local cache
+	ret = ""
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "redis", "key", &ret, getter, WithRefillLocalOnly()))
+	s.Require().Equal(mockString, ret)
+	_, err = s.ring.Get(mockCacheCTX, getCacheKey("redis", "key")).Bytes()
+	s.Require().Equal(redis.Nil, err)
+}
+
+func (s *cacheSuite) TestGetByFuncWithDistributedLock() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "locked",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			DistributedLock: &DistributedLock{
+				TTL:          time.Second,
+				Timeout:      300 * time.Millisecond,
+				PollInterval: 10 * time.Millisecond,
+			},
+		},
+	})
+	getterCalled := 0
+	getter := func() (interface{}, error) {
+		getterCalled++
+		return mockString, nil
+	}
+
+	// the lock is released after reloading
+	var ret string
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "locked", "key", &ret, getter))
+	s.Require().Equal(mockString, ret)
+	s.Require().Equal(1, getterCalled)
+	s.Require().Equal(int64(0), s.ring.Exists(mockCacheCTX, getLockKey(getCacheKey("locked", "key"))).Val())
+
+	// other node holds the lock and refills the value
+	cacheKey := getCacheKey("locked", "key2")
+	locked, err := s.rds.Lock(mockCacheCTX, []string{getLockKey(cacheKey)}, "other-node", time.Second)
+	s.Require().NoError(err)
+	s.Require().Equal([]bool{true}, locked)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.ring.Set(mockCacheCTX, cacheKey, `"refilled-by-other-node"`, time.Hour)
+	}()
+
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "locked", "key2", &ret, getter))
+	s.Require().Equal("refilled-by-other-node", ret)
+	s.Require().Equal(1, getterCalled)
+
+	// other node holds the lock without refilling, proceed without the lock after the timeout
+	cacheKey = getCacheKey("locked", "key3")
+	_, err = s.rds.Lock(mockCacheCTX, []string{getLockKey(cacheKey)}, "other-node", time.Second)
+	s.Require().NoError(err)
+
+	start := time.Now()
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "locked", "key3", &ret, getter))
+	s.Require().Equal(mockString, ret)
+	s.Require().Equal(2, getterCalled)
+	s.Require().GreaterOrEqual(time.Since(start), 300*time.Millisecond)
+}
+
+func (s *cacheSuite) TestMGetWithDistributedLock() {
+	reloaded := []string{}
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "locked",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				reloaded = append(reloaded, keys...)
+				return keys, nil
+			},
+			DistributedLock: &DistributedLock{
+				TTL:          time.Second,
+				Timeout:      time.Second,
+				PollInterval: 10 * time.Millisecond,
+			},
+		},
+	})
+
+	// other node holds the lock of key1 and refills it
+	cacheKey := getCacheKey("locked", "key1")
+	_, err := s.rds.Lock(mockCacheCTX, []string{getLockKey(cacheKey)}, "other-node", time.Second)
+	s.Require().NoError(err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.ring.Set(mockCacheCTX, cacheKey, `"refilled-by-other-node"`, time.Hour)
+	}()
+
+	res, err := c.MGet(mockCacheCTX, "locked", "key1", "key2")
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"key2"}, reloaded)
+
+	var ret string
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &ret))
+	s.Require().Equal("refilled-by-other-node", ret)
+	s.Require().NoError(res.Get(mockCacheCTX, 1, &ret))
+	s.Require().Equal("key2", ret)
+}
+
+func (s *cacheSuite) TestResultErrors() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "redis",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(c.Set(mockCacheCTX, "redis", "key1", mockString))
+	res, err := c.MGet(mockCacheCTX, "redis", "key1", "key2", "key1", "key2")
+	s.Require().NoError(err)
+	s.Require().Equal(4, res.Len())
+
+	for i, expMiss := range []bool{false, true, false, true} {
+		s.Require().Equal(expMiss, res.IsMiss(i), i)
+		if expMiss {
+			s.Require().Equal(ErrCacheMiss, res.OriginalIndexError(i), i)
+		} else {
+			s.Require().NoError(res.OriginalIndexError(i), i)
+		}
+	}
+
+	s.Require().Equal(ErrResultIndexInvalid, res.OriginalIndexError(-1))
+	s.Require().Equal(ErrResultIndexInvalid, res.OriginalIndexError(4))
+	s.Require().False(res.IsMiss(4))
+}
+
+func (s *cacheSuite) TestMGetWithMGetterElemType() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "typed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return []interface{}{"str", nil, 100}, nil
+			},
+			MGetterElemType: reflect.TypeOf(""),
+		},
+		{
+			Prefix: "marshal",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return []interface{}{"str", func() {}}, nil
+			},
+			MarshalFunc:   json.Marshal,
+			UnmarshalFunc: json.Unmarshal,
+		},
+	})
+
+	// all of the missing keys fail
+	res, err := c.MGet(mockCacheCTX, "typed", "key1", "key2", "key3")
+	s.Require().NoError(err)
+	err = res.OriginalIndexError(0)
+	s.Require().ErrorIs(err, ErrMGetterElementTypeMismatch)
+	s.Require().Contains(err.Error(), `index 2, key "key3": int is not assignable to string`)
+
+	// the per-element marshal error is wrapped with the index and key
+	res, err = c.MGet(mockCacheCTX, "marshal", "key1", "key2")
+	s.Require().NoError(err)
+	s.Require().NoError(res.OriginalIndexError(0))
+
+	var jsonErr *json.UnsupportedTypeError
+	s.Require().ErrorAs(res.OriginalIndexError(1), &jsonErr)
+	s.Require().Contains(res.OriginalIndexError(1).Error(), `marshaling key "key2" at index 1`)
+}
+
+// slowAdapter blocks the operations until the context is done.
+type slowAdapter struct {
+	Adapter
+}
+
+func (adp *slowAdapter) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (adp *slowAdapter) MSet(ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (adp *slowAdapter) Del(ctx context.Context, keys ...string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+var errMockMGet = errors.New("failed to mget")
+
+// failingGetAdapter fails MGet() once it's set to fail.
+type failingGetAdapter struct {
+	Adapter
+	fail int32
+}
+
+func (adp *failingGetAdapter) setFail(fail bool) {
+	if fail {
+		atomic.StoreInt32(&adp.fail, 1)
+		return
+	}
+
+	atomic.StoreInt32(&adp.fail, 0)
+}
+
+func (adp *failingGetAdapter) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	if atomic.LoadInt32(&adp.fail) == 1 {
+		return nil, errMockMGet
+	}
+
+	return adp.Adapter.MGet(ctx, keys)
+}
+
+func (s *cacheSuite) TestOperationTimeout() {
+	slow := &slowAdapter{Adapter: s.rds}
+	settings := []Setting{
+		{
+			Prefix: "slow",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+	}
+
+	// degrade by default
+	f := NewFactory(slow, s.lfu, WithOperationTimeout(50*time.Millisecond))
+	defer f.Close()
+	c := f.NewCache(settings)
+
+	var ret string
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "slow", "key", &ret, func() (interface{}, error) {
+		return mockString, nil
+	}))
+	s.Require().Equal(mockString, ret)
+
+	// served by the local cache
+	ret = ""
+	s.Require().NoError(c.Get(mockCacheCTX, "slow", "key", &ret))
+	s.Require().Equal(mockString, ret)
+
+	// deleting fails anyway
+	err := c.Del(mockCacheCTX, "slow", "key")
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+
+	// the deadline of the incoming context is respected
+	ctx, cancel := context.WithTimeout(mockCacheCTX, 10*time.Millisecond)
+	defer cancel()
+	s.Require().ErrorIs(c.Get(ctx, "slow", "missing", &ret), context.DeadlineExceeded)
+
+	// fail by the policy
+	f.ClearPrefix()
+	f2 := NewFactory(slow, s.lfu, WithOperationTimeout(50*time.Millisecond), WithTimeoutPolicy(TimeoutPolicyFail))
+	defer f2.Close()
+	c2 := f2.NewCache(settings)
+
+	var cacheErr *CacheError
+	err = c2.Get(mockCacheCTX, "slow", "missing", &ret)
+	s.Require().ErrorAs(err, &cacheErr)
+	s.Require().Equal("load", cacheErr.Op)
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+
+	err = c2.Set(mockCacheCTX, "slow", "key", mockString)
+	s.Require().ErrorAs(err, &cacheErr)
+	s.Require().Equal("refill", cacheErr.Op)
+}
+
+func (s *cacheSuite) TestLoadWithLocalHitsOnSharedError() {
+	shared := &failingGetAdapter{Adapter: s.rds}
+	settings := []Setting{
+		{
+			Prefix: "flaky",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "flaky-shared",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	}
+
+	// strict by default
+	f := NewFactory(shared, s.lfu)
+	c := f.NewCache(settings)
+	s.Require().NoError(c.Set(mockCacheCTX, "flaky", "hot", "local"))
+
+	shared.setFail(true)
+	res, err := c.MGet(mockCacheCTX, "flaky", "hot", "cold")
+	s.Require().ErrorIs(err, errMockMGet)
+	s.Require().Nil(res)
+	f.ClearPrefix()
+	f.Close()
+
+	f = NewFactory(shared, s.lfu, WithLocalHitsOnSharedError())
+	defer f.Close()
+	c = f.NewCache(settings)
+
+	// the local hits are kept, and others are treated as cache-miss
+	res, err = c.MGet(mockCacheCTX, "flaky", "hot", "cold")
+	s.Require().NoError(err)
+	var str string
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("local", str)
+	s.Require().True(res.IsMiss(1))
+
+	// filled by the getter
+	res, err = c.MGetByFunc(mockCacheCTX, "flaky", []string{"hot", "cold"},
+		func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+			s.Require().Equal([]string{"cold"}, keys)
+			return map[string]interface{}{"cold": "reloaded"}, nil
+		})
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(mockCacheCTX, 1, &str))
+	s.Require().Equal("reloaded", str)
+
+	// the prefix without the local cache still fails
+	_, err = c.MGet(mockCacheCTX, "flaky-shared", "key")
+	s.Require().ErrorIs(err, errMockMGet)
+
+	// the canceled context fails anyway
+	ctx, cancel := context.WithCancel(mockCacheCTX)
+	cancel()
+	_, err = c.MGet(ctx, "flaky", "other")
+	s.Require().Error(err)
+}
+
+func (s *cacheSuite) TestMGetWithMaxMGetKeys() {
+	settings := []Setting{
+		{
+			Prefix: "max-keys",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return keys, nil
+			},
+		},
+	}
+
+	// fail by default
+	f := NewFactory(s.rds, s.lfu, WithMaxMGetKeys(2))
+	c := f.NewCache(settings)
+
+	// the limit applies to the deduped keys
+	res, err := c.MGet(mockCacheCTX, "max-keys", "key1", "key2", "key1")
+	s.Require().NoError(err)
+	s.Require().Equal(3, res.Len())
+
+	res, err = c.MGet(mockCacheCTX, "max-keys", "key1", "key2", "key3")
+	s.Require().Equal(ErrTooManyKeys, err)
+	s.Require().Nil(res)
+	f.ClearPrefix()
+	f.Close()
+
+	// chunk by the policy
+	shared, sharedLog := NewRecordingAdapter(s.rds)
+	f = NewFactory(shared, nil, WithMaxMGetKeys(2), WithOversizedMGetPolicy(OversizedMGetPolicyChunk))
+	defer f.Close()
+	c = f.NewCache(settings)
+
+	keys := []string{"key1", "key2", "key3", "key2", "key4", "key5"}
+	res, err = c.MGet(mockCacheCTX, "max-keys", keys...)
+	s.Require().NoError(err)
+	s.Require().Equal(len(keys), res.Len())
+	for i, k := range keys {
+		var str string
+		s.Require().NoError(res.Get(mockCacheCTX, i, &str))
+		s.Require().Equal(k, str)
+	}
+
+	mgets := [][]string{}
+	for _, r := range sharedLog.Records() {
+		if r.Op == RecordOpMGet {
+			mgets = append(mgets, r.Keys)
+		}
+	}
+	s.Require().Equal([][]string{
+		getCacheKeys("max-keys", []string{"key1", "key2"}),
+		getCacheKeys("max-keys", []string{"key3", "key4"}),
+		getCacheKeys("max-keys", []string{"key5"}),
+	}, mgets)
+}
+
+func (s *cacheSuite) TestMGetWithMGetterLengthMismatch() {
+	mGetter := func(keys ...string) (interface{}, error) {
+		if keys[0] == "short" {
+			return []string{}, nil
+		}
+
+		return append(keys, "extra"), nil
+	}
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "strict",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: mGetter,
+		},
+		{
+			Prefix: "tolerant",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter:            mGetter,
+			MGetterIgnoreExtra: true,
+		},
+	})
+
+	var lenErr *MGetterLengthError
+	var ret string
+	err := c.Get(mockCacheCTX, "strict", "short", &ret)
+	s.Require().ErrorIs(err, ErrMGetterResponseTooShort)
+	s.Require().ErrorIs(err, ErrMGetterResponseLengthInvalid)
+	s.Require().ErrorAs(err, &lenErr)
+	s.Require().Equal(MGetterLengthError{Expected: 1, Actual: 0}, *lenErr)
+	s.Require().EqualError(err, "mgetter response too short: expected 1, got 0")
+
+	res, err := c.MGet(mockCacheCTX, "strict", "key1", "key2")
+	s.Require().NoError(err)
+	err = res.OriginalIndexError(1)
+	s.Require().ErrorIs(err, ErrMGetterResponseTooLong)
+	s.Require().ErrorIs(err, ErrMGetterResponseLengthInvalid)
+	s.Require().EqualError(err, "mgetter response too long: expected 2, got 3")
+
+	// over-fetching is tolerated, but not under-fetching
+	res, err = c.MGet(mockCacheCTX, "tolerant", "key1", "key2")
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(mockCacheCTX, 1, &ret))
+	s.Require().Equal("key2", ret)
+
+	s.Require().ErrorIs(c.Get(mockCacheCTX, "tolerant", "short", &ret), ErrMGetterResponseTooShort)
+}
+
+func (s *cacheSuite) TestMGetWithGetterFailurePolicy() {
+	getterErr := errors.New("origin is down")
+	settings := []Setting{
+		{
+			Prefix: "getter-failure",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return nil, getterErr
+			},
+		},
+	}
+
+	c := s.factory.NewCache(settings)
+	s.Require().NoError(c.Set(mockCacheCTX, "getter-failure", "cached", "v1"))
+
+	// the hits are kept, and only the missing keys fail
+	res, err := c.MGet(mockCacheCTX, "getter-failure", "cached", "missing")
+	s.Require().NoError(err)
+	var str string
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("v1", str)
+	s.Require().Equal(getterErr, res.Get(mockCacheCTX, 1, &str))
+
+	vals, errs, err := c.GetMap(mockCacheCTX, "getter-failure", []string{"cached", "missing"}, func() interface{} {
+		return new(string)
+	})
+	s.Require().NoError(err)
+	s.Require().Len(vals, 1)
+	s.Require().Equal(map[string]error{"missing": getterErr}, errs)
+
+	// all-or-nothing
+	ClearPrefix()
+	f := NewFactory(s.rds, nil, WithGetterFailurePolicy(GetterFailurePolicyFail))
+	defer f.Close()
+
+	c = f.NewCache(settings)
+	_, err = c.MGet(mockCacheCTX, "getter-failure", "cached", "missing")
+	s.Require().Equal(getterErr, err)
+	res, err = c.MGet(mockCacheCTX, "getter-failure", "cached")
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+}
+
+func (s *cacheSuite) TestMGetAcrossPrefixes() {
+	settings := func() []Setting {
+		return []Setting{
+			{
+				Prefix: "teacher",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+					LocalCacheType:  {TTL: time.Hour},
+				},
+				MGetter: func(keys ...string) (interface{}, error) {
+					s.Require().Equal([]string{"t2"}, keys)
+					return []string{"teacher-2"}, nil
+				},
+			},
+			{
+				Prefix: "student",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+					LocalCacheType:  {TTL: time.Hour},
+				},
+			},
+		}
+	}
+
+	c := s.factory.NewCache(settings())
+	s.Require().NoError(c.Set(mockCacheCTX, "teacher", "t1", "teacher-1"))
+	s.Require().NoError(c.Set(mockCacheCTX, "student", "s1", "student-1"))
+
+	// the local cache is empty for another node
+	shared, log := NewRecordingAdapter(s.rds)
+	f := NewFactory(shared, NewTinyLFU(10000))
+	defer f.Close()
+	c = f.NewCache(settings())
+
+	_, err := c.MGetAcrossPrefixes(mockCacheCTX, []KeyReq{{Prefix: "teacher"}, {Prefix: "not-registered"}})
+	s.Require().ErrorIs(err, ErrPfxNotRegistered)
+
+	reqs := []KeyReq{
+		{Prefix: "teacher", Keys: []string{"t1", "t2"}},
+		{Prefix: "student", Keys: []string{"s1", "s2"}},
+	}
+	check := func(results []Result) {
+		s.Require().Len(results, 2)
+
+		var v string
+		s.Require().NoError(results[0].Get(mockCacheCTX, 0, &v))
+		s.Require().Equal("teacher-1", v)
+		s.Require().NoError(results[0].Get(mockCacheCTX, 1, &v))
+		s.Require().Equal("teacher-2", v)
+		s.Require().NoError(results[1].Get(mockCacheCTX, 0, &v))
+		s.Require().Equal("student-1", v)
+		s.Require().ErrorIs(results[1].Get(mockCacheCTX, 1, &v), ErrCacheMiss)
+	}
+
+	// the shared cache is read once across the prefixes
+	results, err := c.MGetAcrossPrefixes(mockCacheCTX, reqs)
+	s.Require().NoError(err)
+	check(results)
+	mgets := []Record{}
+	for _, r := range log.Records() {
+		if r.Op == RecordOpMGet {
+			mgets = append(mgets, r)
+		}
+	}
+	s.Require().Len(mgets, 1)
+	s.Require().ElementsMatch(append(getCacheKeys("teacher", []string{"t1", "t2"}), getCacheKeys("student", []string{"s1", "s2"})...),
+		mgets[0].Keys)
+
+	// only the local misses are read from the shared cache
+	log.Reset()
+	results, err = c.MGetAcrossPrefixes(mockCacheCTX, reqs)
+	s.Require().NoError(err)
+	check(results)
+	s.Require().Equal([]Record{{Op: RecordOpMGet, Keys: []string{getCacheKey("student", "s2")}}}, log.Records())
+}
+
+func (s *cacheSuite) TestRefresh() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	loaded := [][]string{}
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "refresh",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				loaded = append(loaded, keys)
+				vals := make([]string, len(keys))
+				for i, k := range keys {
+					vals[i] = "new-" + k
+				}
+				return vals, nil
+			},
+		},
+		{
+			Prefix: "refresh-no-getter",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(c.MSet(mockCacheCTX, "refresh", map[string]interface{}{"key1": "old", "key2": "old"}))
+	published := len(pubsub.published())
+
+	// the getter runs regardless of the cached values
+	res, err := c.Refresh(mockCacheCTX, "refresh", "key1", "key2", "key1")
+	s.Require().NoError(err)
+	s.Require().Equal([][]string{{"key1", "key2"}}, loaded)
+	var v string
+	for i, exp := range []string{"new-key1", "new-key2", "new-key1"} {
+		s.Require().NoError(res.Get(mockCacheCTX, i, &v))
+		s.Require().Equal(exp, v)
+	}
+
+	// both of the caches are refilled, and the evictions are broadcasted
+	b, err := s.ring.Get(mockCacheCTX, getCacheKey("refresh", "key1")).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(`"new-key1"`, string(b))
+	vals, err := s.lfu.MGet(mockCacheCTX, getCacheKeys("refresh", []string{"key1", "key2"}))
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte(`"new-key1"`)}, {Valid: true, Bytes: []byte(`"new-key2"`)}}, vals)
+	s.Require().Len(pubsub.published(), published+1)
+
+	_, err = c.Refresh(mockCacheCTX, "refresh-no-getter", "key")
+	s.Require().Equal(ErrMGetterNotSpecified, err)
+	_, err = c.Refresh(mockCacheCTX, "not-registered", "key")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestFlush() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "mixed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "local",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	another := s.factory.NewCache([]Setting{
+		{
+			Prefix: "another",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+	})
+
+	s.Require().NoError(c.MSet(mockCacheCTX, "mixed", map[string]interface{}{"key1": 1, "key2": 2}))
+	s.Require().NoError(c.Set(mockCacheCTX, "local", "key1", 1))
+	s.Require().NoError(another.Set(mockCacheCTX, "another", "key1", 1))
+	s.Require().NoError(s.ring.Set(mockCacheCTX, "not-managed", 1, time.Hour).Err())
+
+	s.Require().NoError(c.Flush(mockCacheCTX))
+
+	var ret int
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "mixed", "key1", &ret))
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "mixed", "key2", &ret))
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "local", "key1", &ret))
+	s.Require().Equal(int64(0), s.ring.Exists(mockCacheCTX, getCacheKey("mixed", "key1"), getCacheKey("mixed", "key2")).Val())
+
+	// keys outside the cache are untouched
+	s.Require().NoError(another.Get(mockCacheCTX, "another", "key1", &ret))
+	s.Require().Equal(1, ret)
+	s.Require().Equal(int64(1), s.ring.Exists(mockCacheCTX, "not-managed").Val())
+}
+
+func (s *cacheSuite) TestDelPattern() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "mixed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "local",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	keyVals := map[string]interface{}{"shoes:1": 1, "shoes:2": 2, "hats:1": 3}
+	s.Require().NoError(c.MSet(mockCacheCTX, "mixed", keyVals))
+	s.Require().NoError(c.MSet(mockCacheCTX, "local", keyVals))
+
+	for _, pfx := range []string{"mixed", "local"} {
+		published := len(pubsub.published())
+		s.Require().NoError(c.DelPattern(mockCacheCTX, pfx, "shoes:*"))
+
+		// the matched keys are broadcasted
+		s.Require().Len(pubsub.published(), published+1)
+		var body eventBody
+		s.Require().NoError(json.Unmarshal(pubsub.published()[published], &body))
+		s.Require().ElementsMatch([]string{getCacheKey(pfx, "shoes:1"), getCacheKey(pfx, "shoes:2")}, body.Keys)
+
+		var ret int
+		s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, pfx, "shoes:1", &ret))
+		s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, pfx, "shoes:2", &ret))
+		s.Require().NoError(c.Get(mockCacheCTX, pfx, "hats:1", &ret))
+		s.Require().Equal(3, ret)
+	}
+	s.Require().Equal(int64(1), s.ring.Exists(mockCacheCTX,
+		getCacheKey("mixed", "shoes:1"), getCacheKey("mixed", "shoes:2"), getCacheKey("mixed", "hats:1"),
+	).Val())
+
+	// nothing matched, nothing broadcasted
+	published := len(pubsub.published())
+	s.Require().NoError(c.DelPattern(mockCacheCTX, "mixed", "not-existed:*"))
+	s.Require().Len(pubsub.published(), published)
+	s.Require().Equal(ErrPfxNotRegistered, c.DelPattern(mockCacheCTX, "not-registered", "*"))
+}
+
+func (s *cacheSuite) TestDelPatternWithUnsupportedAdapter() {
+	shared, _ := NewRecordingAdapter(s.rds)
+	f := NewFactory(shared, s.lfu)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "unsupported",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "write-behind",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			WriteBehind: &WriteBehind{Interval: time.Hour},
+		},
+	})
+
+	s.Require().Equal(ErrPatternUnsupported, c.DelPattern(mockCacheCTX, "unsupported", "*"))
+	s.Require().Equal(ErrPatternUnsupported, c.DelPattern(mockCacheCTX, "write-behind", "*"))
+}
+
+func (s *cacheSuite) TestFlushWithUnsupportedAdapter() {
+	f := NewFactory(NewEmpty(), s.lfu)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "unsupported",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "supported",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	s.Require().NoError(c.Set(mockCacheCTX, "supported", "key", 1))
+
+	// continue past the failed prefix
+	err := c.Flush(mockCacheCTX)
+	s.Require().Equal(MultiError{
+		&CacheError{Op: "flush", Prefix: "unsupported", Err: ErrClearNotSupported},
+	}, err)
+	s.Require().ErrorIs(err, ErrClearNotSupported)
+
+	var ret int
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "supported", "key", &ret))
+}
+
+func (s *cacheSuite) TestSetWithWriteBehind() {
+	f := NewFactory(s.rds, s.lfu)
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "behind",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			WriteBehind: &WriteBehind{Interval: 100 * time.Millisecond},
+		},
+	})
+	cacheKey := getCacheKey("behind", "key")
+
+	// set into the local cache immediately
+	s.Require().NoError(c.Set(mockCacheCTX, "behind", "key", mockString))
+	_, err := s.ring.Get(mockCacheCTX, cacheKey).Result()
+	s.Require().Equal(redis.Nil, err)
+
+	// read your writes even if the local cache evicts it
+	var ret string
+	s.Require().NoError(c.Get(mockCacheCTX, "behind", "key", &ret))
+	s.Require().Equal(mockString, ret)
+	s.Require().NoError(s.lfu.Del(mockCacheCTX, cacheKey))
+	s.Require().NoError(c.Get(mockCacheCTX, "behind", "key", &ret))
+	s.Require().Equal(mockString, ret)
+
+	// flushed in the background
+	s.Require().Eventually(func() bool {
+		return s.ring.Exists(mockCacheCTX, cacheKey).Val() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// deleted before flushing, never written
+	s.Require().NoError(c.Set(mockCacheCTX, "behind", "deleted", mockString))
+	s.Require().NoError(c.Del(mockCacheCTX, "behind", "deleted"))
+	time.Sleep(200 * time.Millisecond)
+	s.Require().Equal(int64(0), s.ring.Exists(mockCacheCTX, getCacheKey("behind", "deleted")).Val())
+
+	// flushed on closing
+	s.Require().NoError(c.Set(mockCacheCTX, "behind", "closing", mockString))
+	f.Close()
+	s.Require().Equal(int64(1), s.ring.Exists(mockCacheCTX, getCacheKey("behind", "closing")).Val())
+}
+
+func (s *cacheSuite) TestGetWithVersionMismatch() {
+	cacheKey := getCacheKey("versioned", "key")
+	calls := 0
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "versioned",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				calls++
+				return []string{"mgetter-v2"}, nil
+			},
+			Version: 2,
+		},
+	})
+
+	// simulate the value cached by the previous version
+	marshalV1, _ := NewVersionedMarshaler(1, json.Marshal, json.Unmarshal)
+	b, err := marshalV1("cached-v1")
+	s.Require().NoError(err)
+	s.Require().NoError(s.ring.Set(mockCacheCTX, cacheKey, b, time.Hour).Err())
+
+	// treated as cache-miss, and refilled by mgetter
+	var ret string
+	s.Require().NoError(c.Get(mockCacheCTX, "versioned", "key", &ret))
+	s.Require().Equal("mgetter-v2", ret)
+	s.Require().Equal(1, calls)
+
+	// hit the refilled value with the current version
+	s.Require().NoError(c.Get(mockCacheCTX, "versioned", "key", &ret))
+	s.Require().Equal("mgetter-v2", ret)
+	s.Require().Equal(1, calls)
+}
+
+func (s *cacheSuite) TestLocalStats() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix:          "local",
+			CacheAttributes: map[Type]Attribute{LocalCacheType: {TTL: time.Hour}},
+		},
+		{
+			Prefix:          "redis",
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+		},
+	})
+
+	_, err := c.LocalStats("not-registered")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+
+	_, err = c.LocalStats("redis")
+	s.Require().Equal(ErrStatsNotSupported, err)
+
+	var ret string
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "local", "key", &ret))
+	s.Require().NoError(c.Set(mockCacheCTX, "local", "key", mockString))
+	s.Require().NoError(c.Get(mockCacheCTX, "local", "key", &ret))
+
+	stats, err := c.LocalStats("local")
+	s.Require().NoError(err)
+	s.Require().Equal(Stats{Hits: 1, Misses: 1, Sets: 1}, stats)
+}
+
+func (s *cacheSuite) TestLocalSize() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix:          "local",
+			CacheAttributes: map[Type]Attribute{LocalCacheType: {TTL: time.Hour}},
+		},
+		{
+			Prefix:          "local-other",
+			CacheAttributes: map[Type]Attribute{LocalCacheType: {TTL: time.Hour}},
+		},
+		{
+			Prefix:          "redis",
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+		},
+	})
+
+	_, _, err := c.LocalSize(mockCacheCTX, "not-registered")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+
+	_, _, err = c.LocalSize(mockCacheCTX, "redis")
+	s.Require().Equal(ErrSizeNotSupported, err)
+
+	s.Require().NoError(c.MSet(mockCacheCTX, "local", map[string]interface{}{"key1": "1234", "key2": "12"}))
+	s.Require().NoError(c.Set(mockCacheCTX, "local-other", "key1", "123"))
+
+	// only the keys of the prefix are counted
+	entries, bytes, err := c.LocalSize(mockCacheCTX, "local")
+	s.Require().NoError(err)
+	s.Require().Equal(2, entries)
+	s.Require().Equal(len(`"1234"`)+len(`"12"`), bytes)
+}
+
+func (s *cacheSuite) TestSetAndGetBytes() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "raw",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MarshalFunc:   Marshal,
+			UnmarshalFunc: Unmarshal,
+		},
+	})
+
+	_, err := c.GetBytes(mockCacheCTX, "not-registered", "key")
+	s.Require().Equal(ErrPfxNotRegistered, err)
+	s.Require().Equal(ErrPfxNotRegistered, c.SetBytes(mockCacheCTX, "not-registered", "key", mockLfuBytes))
+
+	_, err = c.GetBytes(mockCacheCTX, "raw", "key")
+	s.Require().Equal(ErrCacheMiss, err)
+
+	s.Require().NoError(c.SetBytes(mockCacheCTX, "raw", "key", mockLfuBytes))
+
+	// stored without marshaling
+	b, err := s.ring.Get(mockCacheCTX, getCacheKey("raw", "key")).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(mockLfuBytes, b)
+
+	b, err = c.GetBytes(mockCacheCTX, "raw", "key")
+	s.Require().NoError(err)
+	s.Require().Equal(mockLfuBytes, b)
+
+	// interoperate with the raw-bytes-compatible codec
+	var ret []byte
+	s.Require().NoError(c.Get(mockCacheCTX, "raw", "key", &ret))
+	s.Require().Equal(mockLfuBytes, ret)
+}
+
+func (s *cacheSuite) TestSetLocalEnabled() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "mixed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+	})
+	cacheKey := getCacheKey("mixed", "key")
+
+	s.Require().NoError(c.Set(mockCacheCTX, "mixed", "key", mockString))
+	vals, err := s.lfu.MGet(mockCacheCTX, []string{cacheKey})
+	s.Require().NoError(err)
+	s.Require().True(vals[0].Valid)
+
+	c.SetLocalEnabled(false)
+
+	// the value in the local cache is dropped instead of being updated
+	s.Require().NoError(c.Set(mockCacheCTX, "mixed", "key", "new-value"))
+	vals, err = s.lfu.MGet(mockCacheCTX, []string{cacheKey})
+	s.Require().NoError(err)
+	s.Require().False(vals[0].Valid)
+
+	// served from the shared cache without promoting into the local cache
+	var ret string
+	s.Require().NoError(c.Get(mockCacheCTX, "mixed", "key", &ret))
+	s.Require().Equal("new-value", ret)
+	vals, err = s.lfu.MGet(mockCacheCTX, []string{cacheKey})
+	s.Require().NoError(err)
+	s.Require().False(vals[0].Valid)
+
+	// the local cache is bypassed even if it holds the value
+	s.Require().NoError(s.lfu.MSet(mockCacheCTX, map[string][]byte{cacheKey: []byte(`"stale-value"`)}, time.Hour))
+	s.Require().NoError(c.Get(mockCacheCTX, "mixed", "key", &ret))
+	s.Require().Equal("new-value", ret)
+	s.Require().NoError(s.lfu.Del(mockCacheCTX, cacheKey))
+
+	c.SetLocalEnabled(true)
+
+	// promoted into the local cache again
+	s.Require().NoError(c.Get(mockCacheCTX, "mixed", "key", &ret))
+	s.Require().Equal("new-value", ret)
+	vals, err = s.lfu.MGet(mockCacheCTX, []string{cacheKey})
+	s.Require().NoError(err)
+	s.Require().True(vals[0].Valid)
+}
+
+func (s *cacheSuite) TestGetWithSlidingTTL() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "sliding",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: 400 * time.Millisecond},
+				LocalCacheType:  {TTL: 400 * time.Millisecond},
+			},
+			SlidingTTL: true,
+		},
+	})
+
+	s.Require().NoError(c.Set(mockCacheCTX, "sliding", "key", mockString))
+
+	// keep reading before expiring
+	var ret string
+	for i := 0; i < 5; i++ {
+		time.Sleep(250 * time.Millisecond)
+		s.Require().NoError(c.Get(mockCacheCTX, "sliding", "key", &ret), i)
+		s.Require().Equal(mockString, ret)
+	}
+
+	// expired after a period of inactivity
+	time.Sleep(time.Second)
+	s.Require().Equal(ErrCacheMiss, c.Get(mockCacheCTX, "sliding", "key", &ret))
+}
+
+// touchingAdapter records the keys touched in the inner adapter.
+type touchingAdapter struct {
+	Adapter
+
+	mut     sync.Mutex
+	touched []string
+}
+
+func (adp *touchingAdapter) Touch(ctx context.Context, keys []string, ttl time.Duration, threshold time.Duration) error {
+	adp.mut.Lock()
+	adp.touched = append(adp.touched, keys...)
+	adp.mut.Unlock()
+
+	return adp.Adapter.(Toucher).Touch(ctx, keys, ttl, threshold)
+}
+
+func (adp *touchingAdapter) touches() []string {
+	adp.mut.Lock()
+	defer adp.mut.Unlock()
+
+	return append([]string{}, adp.touched...)
+}
+
+func (s *cacheSuite) TestGetWithSlidingTTLTouchingSharedHits() {
+	shared := &touchingAdapter{Adapter: s.rds}
+	f := NewFactory(shared, s.lfu)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "sliding-tiers",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			SlidingTTL: true,
+		},
+	})
+	s.Require().NoError(c.Set(mockCacheCTX, "sliding-tiers", "key", mockString))
+
+	// the local hits don't touch the shared cache
+	var ret string
+	s.Require().NoError(c.Get(mockCacheCTX, "sliding-tiers", "key", &ret))
+	s.Require().Empty(shared.touches())
+
+	// the shared hits do, but only once within half of the TTL
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(c.EvictLocal(mockCacheCTX, "sliding-tiers", "key"))
+		s.Require().NoError(c.Get(mockCacheCTX, "sliding-tiers", "key", &ret))
+		s.Require().Equal(mockString, ret)
+	}
+	s.Require().Equal([]string{getCacheKey("sliding-tiers", "key")}, shared.touches())
+}
+
+func (s *cacheSuite) TestCacheError() {
+	unreachableRing := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{
+			"server1": "127.0.0.1:1",
+		},
+		MaxRetries: -1,
+	})
+	defer unreachableRing.Close()
+
+	f := NewFactory(NewRedis(unreachableRing), s.lfu)
+	defer f.Close()
+	c := f.NewCache([]Setting{
+		{
+			Prefix:          "unreachable",
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+		},
+	})
+
+	var cacheErr *CacheError
+	var opErr *net.OpError
+	var ret string
+	err := c.Get(mockCacheCTX, "unreachable", "key", &ret)
+	s.Require().True(errors.As(err, &cacheErr))
+	s.Require().Equal("load", cacheErr.Op)
+	s.Require().Equal("unreachable", cacheErr.Prefix)
+	s.Require().True(errors.As(err, &opErr))
+
+	err = c.Set(mockCacheCTX, "unreachable", "key", mockString)
+	s.Require().True(errors.As(err, &cacheErr))
+	s.Require().Equal("refill", cacheErr.Op)
+	s.Require().True(errors.As(err, &opErr))
+
+	err = c.Del(mockCacheCTX, "unreachable", "key")
+	s.Require().True(errors.As(err, &cacheErr))
+	s.Require().Equal("del", cacheErr.Op)
+	s.Require().True(errors.As(err, &opErr))
+	s.Require().Equal("cache: del unreachable: "+opErr.Error(), err.Error())
+}
+
+func (s *cacheSuite) TestUnique() {
+	large := make([]string, 100)
+	for i := range large {
+		large[i] = "key-" + strconv.Itoa(i)
+	}
+
+	s.Require().True(unique(nil))
+	s.Require().True(unique([]string{"key"}))
+	s.Require().True(unique([]string{"key1", "key2"}))
+	s.Require().False(unique([]string{"key1", "key2", "key1"}))
+	s.Require().True(unique(large))
+	s.Require().False(unique(append(large, "key-50")))
+
+	// the unique keys share the same result as the deduped ones
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "unique",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	s.Require().NoError(c.MSet(mockCacheCTX, "unique", map[string]interface{}{"key-1": 1}))
+	for _, keys := range [][]string{large, append(large, "key-1")} {
+		res, err := c.MGet(mockCacheCTX, "unique", keys...)
+		s.Require().NoError(err)
+		s.Require().Equal(len(keys), res.Len())
+
+		var v int
+		s.Require().NoError(res.Get(mockCacheCTX, 1, &v))
+		s.Require().Equal(1, v)
+		s.Require().True(res.IsMiss(2))
+		if len(keys) > len(large) {
+			v = 0
+			s.Require().NoError(res.Get(mockCacheCTX, len(large), &v))
+			s.Require().Equal(1, v)
+		}
+	}
+}
+
+func BenchmarkMGet1000Unique(b *testing.B) {
+	keyVals := map[string]interface{}{}
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = "bench-" + strconv.Itoa(i)
+		keyVals[keys[i]] = i
+	}
+
+	f := NewFactory(nil, NewTinyLFU(10000))
+	defer f.Close()
+	defer f.ClearPrefix()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "bench-unique",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	if err := c.MSet(mockCacheCTX, "bench-unique", keyVals); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.MGet(mockCacheCTX, "bench-unique", keys...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMGet100(b *testing.B) {
+	keyVals := map[string]interface{}{}
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = "bench-" + strconv.Itoa(i)
+		keyVals[keys[i]] = i
+	}
+
+	benchmarks := []struct {
+		Name    string
+		Options []FactoryOptions
+	}{
+		{Name: "default"},
+		{Name: "pooled results", Options: []FactoryOptions{WithPooledResults()}},
+	}
+
+	for _, bm := range benchmarks {
+		f := NewFactory(nil, NewTinyLFU(10000), bm.Options...)
+		c := f.NewCache([]Setting{
+			{
+				Prefix: "bench",
+				CacheAttributes: map[Type]Attribute{
+					LocalCacheType: {TTL: time.Hour},
+				},
+			},
+		})
+		if err := c.MSet(mockCacheCTX, "bench", keyVals); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(bm.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				res, err := c.MGet(mockCacheCTX, "bench", keys...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				res.Release()
+			}
+		})
+
+		f.ClearPrefix()
+		f.Close()
+	}
+}
+
+func (s *cacheSuite) TestDelWithTombstone() {
+	getterCalls := 0
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "tombstone",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				getterCalls++
+				vals := make([]string, len(keys))
+				for i, k := range keys {
+					vals[i] = "stale-" + k
+				}
+				return vals, nil
+			},
+			DeleteTombstoneTTL: time.Minute,
+		},
+	})
+
+	cacheKey := getCacheKey("tombstone", "key")
+	s.Require().NoError(c.Set(mockCacheCTX, "tombstone", "key", "v1"))
+	s.Require().NoError(c.Del(mockCacheCTX, "tombstone", "key"))
+
+	// the tombstone is written into the shared cache instead of removing
+	b, err := s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(tombstone, b)
+	ttl, err := s.ring.PTTL(mockCacheCTX, cacheKey).Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl > 0 && ttl <= time.Minute)
+
+	var str string
+	_, err = c.GetBytes(mockCacheCTX, "tombstone", "key")
+	s.Require().Equal(ErrCacheMiss, err)
+
+	// reloaded by the getter but not refilled
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "tombstone", "key", &str, func() (interface{}, error) {
+		return "stale", nil
+	}))
+	s.Require().Equal("stale", str)
+	s.Require().NoError(c.Get(mockCacheCTX, "tombstone", "key", &str))
+	s.Require().Equal("stale-key", str)
+	s.Require().Equal(1, getterCalls)
+
+	b, err = s.ring.Get(mockCacheCTX, cacheKey).Bytes()
+	s.Require().NoError(err)
+	s.Require().Equal(tombstone, b)
+	vals, err := s.lfu.MGet(mockCacheCTX, []string{cacheKey})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+
+	// refilled after the tombstone expires
+	s.Require().NoError(s.ring.Del(mockCacheCTX, cacheKey).Err())
+	s.Require().NoError(c.Get(mockCacheCTX, "tombstone", "key", &str))
+	s.Require().Equal("stale-key", str)
+	s.Require().Equal(2, getterCalls)
+	s.Require().NoError(c.Get(mockCacheCTX, "tombstone", "key", &str))
+	s.Require().Equal(2, getterCalls)
+
+	// the tombstone is overwritten by setting
+	s.Require().NoError(c.Del(mockCacheCTX, "tombstone", "key"))
+	s.Require().NoError(c.Set(mockCacheCTX, "tombstone", "key", "v2"))
+	s.Require().NoError(c.Get(mockCacheCTX, "tombstone", "key", &str))
+	s.Require().Equal("v2", str)
+	s.Require().Equal(2, getterCalls)
+}
+
+func (s *cacheSuite) TestMGetWithNoValue() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "no-value",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			DeleteTombstoneTTL: time.Minute,
+		},
+	})
+
+	s.Require().NoError(c.MSet(mockCacheCTX, "no-value", map[string]interface{}{"key1": "v1", "key2": "v2"}))
+	s.Require().NoError(c.Del(mockCacheCTX, "no-value", "key2"))
+
+	// the tombstoned key is cached as absent, which is distinct from the missing key
+	res, err := c.MGet(mockCacheCTX, "no-value", "key1", "key2", "key3", "key2")
+	s.Require().NoError(err)
+	s.Require().NoError(res.OriginalIndexError(0))
+	s.Require().Equal(ErrNoValue, res.OriginalIndexError(1))
+	s.Require().Equal(ErrCacheMiss, res.OriginalIndexError(2))
+	s.Require().Equal(ErrNoValue, res.OriginalIndexError(3))
+	s.Require().True(res.IsMiss(1))
+	s.Require().True(res.IsMiss(2))
+
+	// it's a kind of cache-miss for compatibility
+	s.Require().ErrorIs(res.OriginalIndexError(1), ErrCacheMiss)
+	s.Require().NotErrorIs(res.OriginalIndexError(2), ErrNoValue)
+
+	var str string
+	s.Require().Equal(ErrNoValue, res.Get(mockCacheCTX, 1, &str))
+	s.Require().Equal(ErrNoValue, c.Get(mockCacheCTX, "no-value", "key2", &str))
+
+	str = "reused"
+	found, err := c.GetOrZero(mockCacheCTX, "no-value", "key2", &str)
+	s.Require().NoError(err)
+	s.Require().False(found)
+	s.Require().Empty(str)
+
+	// the getter reloading the tombstoned key overrides ErrNoValue
+	res, err = c.MGetByFunc(mockCacheCTX, "no-value", []string{"key2", "key3"},
+		func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+			return map[string]interface{}{"key2": "reloaded"}, nil
+		})
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("reloaded", str)
+	s.Require().Equal(ErrCacheMiss, res.OriginalIndexError(1))
+
+	// the getter missing the tombstoned key keeps ErrNoValue
+	res, err = c.MGetByFunc(mockCacheCTX, "no-value", []string{"key2"},
+		func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		})
+	s.Require().NoError(err)
+	s.Require().Equal(ErrNoValue, res.OriginalIndexError(0))
+}
+
+func (s *cacheSuite) TestGetByFuncWithGetterErrorTTL() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "breaker",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			GetterErrorTTL: 100 * time.Millisecond,
+		},
+		{
+			Prefix: "no-breaker",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	failure := errors.New("origin is down")
+	getterCalls := 0
+	var getterErr error
+	getter := func() (interface{}, error) {
+		getterCalls++
+		if getterErr != nil {
+			return nil, getterErr
+		}
+		return "value", nil
+	}
+
+	var str string
+	getterErr = failure
+	s.Require().Equal(failure, c.GetByFunc(mockCacheCTX, "breaker", "key", &str, getter))
+	s.Require().Equal(1, getterCalls)
+
+	// the cached failure is returned without invoking the getter
+	err := c.GetByFunc(mockCacheCTX, "breaker", "key", &str, getter)
+	s.Require().ErrorIs(err, ErrGetterRecentlyFailed)
+	s.Require().ErrorIs(err, failure)
+	s.Require().Equal(1, getterCalls)
+
+	// other keys are not affected
+	getterErr = nil
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "breaker", "other", &str, getter))
+	s.Require().Equal("value", str)
+	s.Require().Equal(2, getterCalls)
+
+	// retried after the window lapses
+	time.Sleep(100 * time.Millisecond)
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "breaker", "key", &str, getter))
+	s.Require().Equal("value", str)
+	s.Require().Equal(3, getterCalls)
+
+	// disabled by default
+	getterErr = failure
+	s.Require().Equal(failure, c.GetByFunc(mockCacheCTX, "no-breaker", "key", &str, getter))
+	s.Require().Equal(failure, c.GetByFunc(mockCacheCTX, "no-breaker", "key", &str, getter))
+	s.Require().Equal(5, getterCalls)
+}
+
+func (s *cacheSuite) TestNewCacheWithInvalidTombstone() {
+	s.Require().Panics(func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix: "tombstone-negative",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+				},
+				DeleteTombstoneTTL: -time.Second,
+			},
+		})
+	})
+
+	s.Require().Panics(func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix: "tombstone-local",
+				CacheAttributes: map[Type]Attribute{
+					LocalCacheType: {TTL: time.Hour},
+				},
+				DeleteTombstoneTTL: time.Second,
+			},
+		})
+	})
+}
+
+func (s *cacheSuite) TestSetWithCoalesceWindow() {
+	shared, sharedLog := NewRecordingAdapter(s.rds)
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(shared, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "coalesce",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			CoalesceWindow: 50 * time.Millisecond,
+		},
+	})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.NoError(c.Set(mockCacheCTX, "coalesce", "key", "value"))
+		}()
+	}
+	wg.Wait()
+
+	s.Require().Equal([]Record{
+		{Op: RecordOpMSet, Keys: []string{getCacheKey("coalesce", "key")}, TTL: time.Hour},
+	}, sharedLog.Records())
+	s.Require().Len(pubsub.published(), 1)
+
+	var str string
+	s.Require().NoError(c.Get(mockCacheCTX, "coalesce", "key", &str))
+	s.Require().Equal("value", str)
+
+	// multiple keys are not coalesced
+	s.Require().NoError(c.MSet(mockCacheCTX, "coalesce", map[string]interface{}{"key1": 1, "key2": 2}))
+	s.Require().Len(pubsub.published(), 2)
+
+	s.Require().Panics(func() {
+		f.NewCache([]Setting{
+			{
+				Prefix: "coalesce-negative",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+				},
+				CoalesceWindow: -time.Second,
+			},
+		})
+	})
+}
+
+func (s *cacheSuite) TestMGetWithMGetterFallbacks() {
+	type fallbackCall struct {
+		Prefix string
+		Served int
+		Err    error
+	}
+	var mut sync.Mutex
+	calls := []fallbackCall{}
+	f := NewFactory(s.rds, s.lfu, OnMGetterFallbackFunc(func(prefix string, served int, err error) {
+		mut.Lock()
+		defer mut.Unlock()
+		calls = append(calls, fallbackCall{Prefix: prefix, Served: served, Err: err})
+	}))
+	defer f.Close()
+
+	primaryErr := errors.New("primary failed over")
+	primaryFailing := true
+	replica := func(name string) MGetterFunc {
+		return func(keys ...string) (interface{}, error) {
+			vals := make([]string, len(keys))
+			for i, k := range keys {
+				vals[i] = name + "-" + k
+			}
+			return vals, nil
+		}
+	}
+	block := make(chan struct{})
+	defer close(block)
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "fallback",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				if primaryFailing {
+					return nil, primaryErr
+				}
+				return replica("primary")(keys...)
+			},
+			MGetterFallbacks: []MGetterFunc{
+				func(keys ...string) (interface{}, error) {
+					return nil, errors.New("replica1 failed")
+				},
+				replica("replica2"),
+			},
+		},
+		{
+			Prefix: "fallback-failed",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return nil, primaryErr
+			},
+			MGetterFallbacks: []MGetterFunc{
+				func(keys ...string) (interface{}, error) {
+					return nil, errors.New("replica failed")
+				},
+			},
+		},
+		{
+			Prefix: "fallback-blocked",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				return nil, primaryErr
+			},
+			MGetterFallbacks: []MGetterFunc{
+				func(keys ...string) (interface{}, error) {
+					<-block
+					return nil, nil
+				},
+				replica("replica2"),
+			},
+		},
+	})
+
+	// served by the second fallback
+	res, err := c.MGet(mockCacheCTX, "fallback", "key1")
+	s.Require().NoError(err)
+	var str string
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("replica2-key1", str)
+	s.Require().Equal([]fallbackCall{{Prefix: "fallback", Served: 1, Err: primaryErr}}, calls)
+
+	// the fallbacks are not involved if the primary works
+	primaryFailing = false
+	res, err = c.MGet(mockCacheCTX, "fallback", "key2")
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+	s.Require().Equal("primary-key2", str)
+	s.Require().Len(calls, 1)
+
+	// all of them fail
+	s.Require().Equal(primaryErr, c.Get(mockCacheCTX, "fallback-failed", "key1", &str))
+	s.Require().Equal(fallbackCall{Prefix: "fallback-failed", Served: -1, Err: primaryErr}, calls[1])
+
+	// abandoned after the deadline
+	ctx, cancel := context.WithTimeout(mockCacheCTX, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.Require().Equal(primaryErr, c.Get(ctx, "fallback-blocked", "key1", &str))
+	s.Require().Less(time.Since(start), time.Second)
+	s.Require().Equal(fallbackCall{Prefix: "fallback-blocked", Served: -1, Err: primaryErr}, calls[2])
+}
+
+func (s *cacheSuite) TestGetByFuncWithDifferentContainerTypes() {
+	type user struct {
+		Name string
+	}
+	type order struct {
+		ID int
+	}
+
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "flight",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	// both getters are in-flight at the same time
+	started := sync.WaitGroup{}
+	started.Add(2)
+	ready := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(ready)
+	}()
+	getter := func(v interface{}) OneTimeGetterFunc {
+		return func() (interface{}, error) {
+			started.Done()
+			select {
+			case <-ready:
+			case <-time.After(time.Second):
+			}
+			return v, nil
+		}
+	}
+
+	var u user
+	var o order
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.NoError(c.GetByFunc(mockCacheCTX, "flight", "key", &u, getter(user{Name: "mock-name"})))
+	}()
+	go func() {
+		defer wg.Done()
+		s.NoError(c.GetByFunc(mockCacheCTX, "flight", "key", &o, getter(order{ID: 100})))
+	}()
+	wg.Wait()
+
+	s.Require().Equal(user{Name: "mock-name"}, u)
+	s.Require().Equal(order{ID: 100}, o)
+}
+
+func (s *cacheSuite) TestGetDel() {
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub))
+	defer f.Close()
+
+	recording, _ := NewRecordingAdapter(s.lfu)
+	f2 := NewFactory(nil, recording)
+	defer f2.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "getdel",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "getdel-local",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "getdel-write-behind",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			WriteBehind: &WriteBehind{Interval: time.Hour},
+		},
+	})
+	c2 := f2.NewCache([]Setting{
+		{
+			Prefix: "getdel-unsupported",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	// taken from the shared cache, and the local copies are evicted
+	s.Require().NoError(c.Set(mockCacheCTX, "getdel", "token", "v1"))
+	published := len(pubsub.published())
+	var str string
+	s.Require().NoError(c.GetDel(mockCacheCTX, "getdel", "token", &str))
+	s.Require().Equal("v1", str)
+	s.Require().Len(pubsub.published(), published+1)
+	s.Require().Equal(int64(0), s.ring.Exists(mockCacheCTX, getCacheKey("getdel", "token")).Val())
+	vals, err := s.lfu.MGet(mockCacheCTX, []string{getCacheKey("getdel", "token")})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+	s.Require().Equal(ErrCacheMiss, c.GetDel(mockCacheCTX, "getdel", "token", &str))
+
+	// only one of the concurrent callers gets the value
+	for _, prefix := range []string{"getdel", "getdel-local"} {
+		s.Require().NoError(c.Set(mockCacheCTX, prefix, "job", "claimed"))
+
+		var taken int32
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var str string
+				err := c.GetDel(mockCacheCTX, prefix, "job", &str)
+				if err == nil {
+					atomic.AddInt32(&taken, 1)
+					return
+				}
+				s.Equal(ErrCacheMiss, err)
+			}()
+		}
+		wg.Wait()
+		s.Require().Equal(int32(1), taken, prefix)
+	}
+
+	s.Require().Equal(ErrGetDelNotSupported, c.GetDel(mockCacheCTX, "getdel-write-behind", "key", &str))
+	s.Require().Equal(ErrGetDelNotSupported, c2.GetDel(mockCacheCTX, "getdel-unsupported", "key", &str))
+	s.Require().Equal(ErrPfxNotRegistered, c.GetDel(mockCacheCTX, "not-registered", "key", &str))
+}
+
+func (s *cacheSuite) TestListAppendAndRange() {
+	recording, _ := NewRecordingAdapter(s.lfu)
+	f := NewFactory(nil, recording)
+	defer f.Close()
+
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "list",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "list-local",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	for _, pfx := range []string{"list", "list-local"} {
+		s.Require().NoError(c.ListAppend(mockCacheCTX, pfx, "activities", 3, "a", "b"))
+		s.Require().NoError(c.ListAppend(mockCacheCTX, pfx, "activities", 3, "c", "d"))
+
+		res, err := c.ListRange(mockCacheCTX, pfx, "activities", 0, -1)
+		s.Require().NoError(err)
+		strs := []string{}
+		for i := 0; i < res.Len(); i++ {
+			var str string
+			s.Require().NoError(res.Get(mockCacheCTX, i, &str))
+			strs = append(strs, str)
+		}
+		s.Require().Equal([]string{"b", "c", "d"}, strs)
+
+		res, err = c.ListRange(mockCacheCTX, pfx, "not-existed", 0, -1)
+		s.Require().NoError(err)
+		s.Require().Equal(0, res.Len())
+
+		// the keys set by Set aren't lists
+		s.Require().NoError(c.Set(mockCacheCTX, pfx, "value", "v"))
+		s.Require().True(errors.Is(c.ListAppend(mockCacheCTX, pfx, "value", 0, "v"), ErrNotList))
+	}
+
+	// the list is kept by the shared cache
+	s.Require().Equal(int64(1), s.ring.Exists(mockCacheCTX, getCacheKey("list", "activities")).Val())
+
+	// the adapter doesn't implement ListAdapter
+	c2 := f.NewCache([]Setting{
+		{
+			Prefix: "list-unsupported",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	s.Require().Equal(ErrListNotSupported, c2.ListAppend(mockCacheCTX, "list-unsupported", "key", 0, "v"))
+	_, err := c2.ListRange(mockCacheCTX, "list-unsupported", "key", 0, -1)
+	s.Require().Equal(ErrListNotSupported, err)
+
+	_, err = c.ListRange(mockCacheCTX, "not-registered", "key", 0, -1)
+	s.Require().Equal(ErrPfxNotRegistered, err)
+}
+
+func (s *cacheSuite) TestResultForEach() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "foreach",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+	s.Require().NoError(c.MSet(mockCacheCTX, "foreach", map[string]interface{}{"key1": 1, "key2": 2}))
+
+	res, err := c.MGet(mockCacheCTX, "foreach", "key2", "missing", "key1", "key2")
+	s.Require().NoError(err)
+
+	idxs := []int{}
+	vals := []int{}
+	errs := []error{}
+	res.ForEach(mockCacheCTX, func(idx int, unmarshal func(container interface{}) error, err error) bool {
+		idxs = append(idxs, idx)
+		errs = append(errs, err)
+
+		var v int
+		s.Require().Equal(err, unmarshal(&v))
+		vals = append(vals, v)
+		return true
+	})
+	s.Require().Equal([]int{0, 1, 2, 3}, idxs)
+	s.Require().Equal([]int{2, 0, 1, 2}, vals)
+	s.Require().Equal([]error{nil, ErrCacheMiss, nil, nil}, errs)
+
+	// stop early
+	idxs = []int{}
+	res.ForEach(mockCacheCTX, func(idx int, unmarshal func(container interface{}) error, err error) bool {
+		idxs = append(idxs, idx)
+		return idx < 1
+	})
+	s.Require().Equal([]int{0, 1}, idxs)
+}
+
+func (s *cacheSuite) TestMGetWithSoftTTL() {
+	calls := int32(0)
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "soft-ttl",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour, SoftTTL: 100 * time.Millisecond},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				n := atomic.AddInt32(&calls, 1)
+				vals := []int32{}
+				for range keys {
+					vals = append(vals, n)
+				}
+				return vals, nil
+			},
+		},
+	})
+
+	var v int32
+	s.Require().NoError(c.Get(mockCacheCTX, "soft-ttl", "key", &v))
+	s.Require().Equal(int32(1), v)
+	_, metas, err := c.MGetWithMeta(mockCacheCTX, "soft-ttl", "key")
+	s.Require().NoError(err)
+	s.Require().False(metas[0].Stale)
+
+	// the stale value is served, and revalidated in the background
+	time.Sleep(150 * time.Millisecond)
+	_, metas, err = c.MGetWithMeta(mockCacheCTX, "soft-ttl", "key")
+	s.Require().NoError(err)
+	s.Require().True(metas[0].Stale)
+	s.Require().NoError(c.Get(mockCacheCTX, "soft-ttl", "key", &v))
+	s.Require().Equal(int32(1), v)
+	s.Require().Eventually(func() bool {
+		return c.Get(mockCacheCTX, "soft-ttl", "key", &v) == nil && v == 2
+	}, time.Second, 10*time.Millisecond)
+	s.Require().Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// the value written by Set is fresh as well
+	time.Sleep(150 * time.Millisecond)
+	s.Require().NoError(c.Set(mockCacheCTX, "soft-ttl", "key", int32(10)))
+	s.Require().NoError(c.Get(mockCacheCTX, "soft-ttl", "key", &v))
+	s.Require().Equal(int32(10), v)
+	s.Require().Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func (s *cacheSuite) TestGetByFuncWithSoftTTL() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "soft-ttl-func",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour, SoftTTL: 100 * time.Millisecond},
+			},
+		},
+	})
+
+	reloaded := make(chan struct{}, 1)
+	getter := func(str string) OneTimeGetterFunc {
+		return func() (interface{}, error) {
+			reloaded <- struct{}{}
+			return str, nil
+		}
+	}
+
+	var str string
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "soft-ttl-func", "key", &str, getter("v1")))
+	s.Require().Equal("v1", str)
+	<-reloaded
+
+	time.Sleep(150 * time.Millisecond)
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "soft-ttl-func", "key", &str, getter("v2")))
+	s.Require().Equal("v1", str)
+	<-reloaded
+	s.Require().Eventually(func() bool {
+		return c.Get(mockCacheCTX, "soft-ttl-func", "key", &str) == nil && str == "v2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *cacheSuite) TestSoftTTLCallbacks() {
+	type staleServe struct {
+		key string
+		age time.Duration
+	}
+	type refill struct {
+		keys []string
+		err  error
+	}
+	served := make(chan staleServe, 10)
+	refilled := make(chan refill, 10)
+	f := NewFactory(s.rds, s.lfu,
+		OnStaleServeFunc(func(ctx context.Context, prefix, key string, age time.Duration) {
+			served <- staleServe{key: prefix + "/" + key, age: age}
+		}),
+		OnBackgroundRefillFunc(func(ctx context.Context, prefix string, keys []string, err error) {
+			refilled <- refill{keys: keys, err: err}
+		}),
+	)
+	defer f.Close()
+
+	errGetter := errors.New("getter failed")
+	fail := int32(0)
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "soft-ttl-callbacks",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour, SoftTTL: 50 * time.Millisecond},
+			},
+			MGetter: func(keys ...string) (interface{}, error) {
+				if atomic.LoadInt32(&fail) == 1 {
+					return nil, errGetter
+				}
+				return []string{"v"}, nil
+			},
+		},
+	})
+
+	var str string
+	s.Require().NoError(c.Get(mockCacheCTX, "soft-ttl-callbacks", "key", &str))
+	s.Require().Empty(served)
+
+	// the stale value is served, and refilled in the background
+	time.Sleep(100 * time.Millisecond)
+	res, err := c.MGet(mockCacheCTX, "soft-ttl-callbacks", "key")
+	s.Require().NoError(err)
+	s.Require().NoError(res.Get(mockCacheCTX, 0, &str))
+	serve := <-served
+	s.Require().Equal("soft-ttl-callbacks/key", serve.key)
+	s.Require().GreaterOrEqual(serve.age, 50*time.Millisecond)
+	s.Require().Less(serve.age, time.Second)
+	s.Require().Equal(refill{keys: []string{"key"}}, <-refilled)
+
+	// the failure of the background refill is reported
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(100 * time.Millisecond)
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "soft-ttl-callbacks", "key", &str, func() (interface{}, error) {
+		return nil, errGetter
+	}))
+	s.Require().Equal("soft-ttl-callbacks/key", (<-served).key)
+	s.Require().Equal(refill{keys: []string{"key"}, err: errGetter}, <-refilled)
+}
+
+func (s *cacheSuite) TestGetByFuncWithSoftTTLOnClose() {
+	f := NewFactory(s.rds, s.lfu)
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "soft-ttl-close",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour, SoftTTL: 50 * time.Millisecond},
+			},
+		},
+	})
+
+	var str string
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "soft-ttl-close", "key", &str, func() (interface{}, error) {
+		return "v1", nil
+	}))
+
+	// the revalidation hangs in the getter
+	hanging := make(chan struct{})
+	defer close(hanging)
+	started := make(chan struct{}, 1)
+	time.Sleep(100 * time.Millisecond)
+	s.Require().NoError(c.GetByFunc(mockCacheCTX, "soft-ttl-close", "key", &str, func() (interface{}, error) {
+		started <- struct{}{}
+		<-hanging
+		return "v2", nil
+	}))
+	s.Require().Equal("v1", str)
+	<-started
+
+	// closing cancels the revalidation instead of waiting for the getter
+	closed := make(chan struct{})
+	go func() {
+		f.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		s.Fail("revalidation not canceled")
+	}
+
+	// the key is released
+	cfg := c.(*cache).configs["soft-ttl-close"]
+	cfg.revalidateMut.Lock()
+	defer cfg.revalidateMut.Unlock()
+	s.Require().Empty(cfg.revalidating)
+}
@@ -0,0 +1,35 @@
+// Package cachetest provides the utilities for testing with go-cache.
+package cachetest
+
+import (
+	"sync"
+	"time"
+)
+
+// ManualClock is the clock advanced manually, which makes the expiration deterministic in tests without sleeping.
+// It implements the cache.Clock interface, and is safe for concurrent use.
+type ManualClock struct {
+	mut sync.RWMutex
+	now time.Time
+}
+
+// NewManualClock returns the ManualClock starting from the given time, e.g. time.Now().
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by the duration.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.now = c.now.Add(d)
+}
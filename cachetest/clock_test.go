@@ -0,0 +1,34 @@
+package cachetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type clockSuite struct {
+	suite.Suite
+}
+
+func (s *clockSuite) SetupSuite() {}
+
+func (s *clockSuite) TearDownSuite() {}
+
+func (s *clockSuite) SetupTest() {}
+
+func (s *clockSuite) TearDownTest() {}
+
+func TestClockSuite(t *testing.T) {
+	suite.Run(t, new(clockSuite))
+}
+
+func (s *clockSuite) TestManualClock() {
+	now := time.Date(2022, 11, 23, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(now)
+	s.Require().Equal(now, clock.Now())
+	s.Require().Equal(now, clock.Now())
+
+	clock.Advance(time.Hour)
+	s.Require().Equal(now.Add(time.Hour), clock.Now())
+}
@@ -0,0 +1,114 @@
+package cachetest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/viney-shih/go-cache"
+)
+
+const (
+	// testCacheSize is the number of keys kept by each in-memory adapter of NewTestFactory()
+	testCacheSize = 10000
+)
+
+// TestHarness inspects the adapters and the pubsub wired by NewTestFactory(), and controls the clock deciding
+// the expiration of the keys.
+type TestHarness struct {
+	clock  *ManualClock
+	shared cache.Adapter
+	local  cache.Adapter
+	pubsub *MemoryPubsub
+}
+
+// NewTestFactory generates the Factory requiring no external services for testing the code depending on the cache.
+// Both the shared and local caches are in-memory adapters expiring the keys exactly at their TTLs by the manual clock,
+// and the evictions are broadcasted by MemoryPubsub. The options are applied after them, so the pubsub can be replaced if needed.
+// Like other factories, call Close() and ClearPrefix() when finished.
+func NewTestFactory(options ...cache.FactoryOptions) (cache.Factory, *TestHarness) {
+	// tinylfu expires the keys by the system clock as well, so the manual clock must not lag behind it
+	clock := NewManualClock(time.Now())
+	h := &TestHarness{
+		clock:  clock,
+		shared: cache.NewTinyLFU(testCacheSize, cache.WithClock(clock), cache.WithOffset(0)),
+		local:  cache.NewTinyLFU(testCacheSize, cache.WithClock(clock), cache.WithOffset(0)),
+		pubsub: NewMemoryPubsub(),
+	}
+
+	opts := append([]cache.FactoryOptions{cache.WithPubSub(h.pubsub)}, options...)
+	return cache.NewFactory(h.shared, h.local, opts...), h
+}
+
+// Clock returns the manual clock deciding the expiration of the keys.
+func (h *TestHarness) Clock() *ManualClock {
+	return h.clock
+}
+
+// Advance moves the clock forward by the duration, which expires the keys whose TTL is reached.
+func (h *TestHarness) Advance(d time.Duration) {
+	h.clock.Advance(d)
+}
+
+// SharedKeys lists the unexpired keys under the prefix in the shared cache in the sorted order.
+func (h *TestHarness) SharedKeys(prefix string) []string {
+	return keysOf(h.shared, prefix)
+}
+
+// LocalKeys lists the unexpired keys under the prefix in the local cache in the sorted order.
+func (h *TestHarness) LocalKeys(prefix string) []string {
+	return keysOf(h.local, prefix)
+}
+
+// SharedValue returns the bytes of the key under the prefix stored in the shared cache,
+// which are marshaled by the codec of the cache.
+func (h *TestHarness) SharedValue(prefix, key string) ([]byte, bool) {
+	return valueOf(h.shared, prefix, key)
+}
+
+// LocalValue returns the bytes of the key under the prefix stored in the local cache,
+// which are marshaled by the codec of the cache.
+func (h *TestHarness) LocalValue(prefix, key string) ([]byte, bool) {
+	return valueOf(h.local, prefix, key)
+}
+
+// Pubsub returns the pubsub broadcasting the evictions.
+func (h *TestHarness) Pubsub() *MemoryPubsub {
+	return h.pubsub
+}
+
+// Evictions returns the eviction events broadcasted so far in order. The keys are the ones stored in the adapters,
+// see cache.CacheKey(). It requires the default event codec without compression, other messages are skipped.
+func (h *TestHarness) Evictions() []cache.EvictionEvent {
+	events := []cache.EvictionEvent{}
+	for _, mess := range h.pubsub.Published() {
+		var e cache.EvictionEvent
+		if err := json.Unmarshal(mess.Content(), &e); err != nil {
+			continue
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func keysOf(adp cache.Adapter, prefix string) []string {
+	keyPrefix := cache.CacheKey(prefix, "")
+	keys := adp.(cache.KeyLister).Keys(keyPrefix)
+	for i, k := range keys {
+		keys[i] = strings.TrimPrefix(k, keyPrefix)
+	}
+
+	return keys
+}
+
+func valueOf(adp cache.Adapter, prefix, key string) ([]byte, bool) {
+	vals, err := adp.MGet(context.Background(), []string{cache.CacheKey(prefix, key)})
+	if err != nil || len(vals) == 0 || !vals[0].Valid {
+		return nil, false
+	}
+
+	return vals[0].Bytes, true
+}
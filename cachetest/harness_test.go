@@ -0,0 +1,73 @@
+package cachetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/viney-shih/go-cache"
+)
+
+type harnessSuite struct {
+	suite.Suite
+
+	factory cache.Factory
+	harness *TestHarness
+}
+
+func (s *harnessSuite) SetupSuite() {}
+
+func (s *harnessSuite) TearDownSuite() {}
+
+func (s *harnessSuite) SetupTest() {
+	s.factory, s.harness = NewTestFactory()
+}
+
+func (s *harnessSuite) TearDownTest() {
+	s.factory.ClearPrefix()
+	s.factory.Close()
+}
+
+func TestHarnessSuite(t *testing.T) {
+	suite.Run(t, new(harnessSuite))
+}
+
+func (s *harnessSuite) TestNewTestFactory() {
+	ctx := context.Background()
+	s.Require().True(s.factory.PubSubEnabled())
+
+	c := s.factory.NewCache([]cache.Setting{
+		{
+			Prefix: "harness",
+			CacheAttributes: map[cache.Type]cache.Attribute{
+				cache.SharedCacheType: {TTL: time.Hour},
+				cache.LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+
+	s.Require().NoError(c.MSet(ctx, "harness", map[string]interface{}{"k2": 2, "k1": 1}))
+	s.Require().Equal([]string{"k1", "k2"}, s.harness.SharedKeys("harness"))
+	s.Require().Equal([]string{"k1", "k2"}, s.harness.LocalKeys("harness"))
+	b, ok := s.harness.SharedValue("harness", "k1")
+	s.Require().True(ok)
+	s.Require().Equal([]byte("1"), b)
+	_, ok = s.harness.LocalValue("harness", "not-existed")
+	s.Require().False(ok)
+
+	// the local cache expires first
+	s.harness.Advance(time.Minute)
+	s.Require().Empty(s.harness.LocalKeys("harness"))
+	s.Require().Equal([]string{"k1", "k2"}, s.harness.SharedKeys("harness"))
+
+	// the eviction is broadcasted
+	s.Require().NoError(c.Del(ctx, "harness", "k1"))
+	s.Require().Equal([]string{"k2"}, s.harness.SharedKeys("harness"))
+	evictions := s.harness.Evictions()
+	s.Require().NotEmpty(evictions)
+	s.Require().Equal([]string{cache.CacheKey("harness", "k1")}, evictions[len(evictions)-1].Keys)
+
+	s.harness.Clock().Advance(time.Hour)
+	s.Require().Empty(s.harness.SharedKeys("harness"))
+}
@@ -0,0 +1,113 @@
+package cachetest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/viney-shih/go-cache"
+)
+
+// MemoryPubsub is the in-memory cache.Pubsub delivering the published messages back to its own subscription,
+// which runs the broadcasting path of the factory without external services. It records all published messages
+// for the assertions, and is safe for concurrent use.
+type MemoryPubsub struct {
+	mut       sync.Mutex
+	topics    map[string]bool
+	published []cache.Message
+
+	subOnce   sync.Once
+	closeOnce sync.Once
+	messChan  chan cache.Message
+	closed    chan struct{}
+	// sendMut guards sending to messChan against closing it
+	sendMut sync.RWMutex
+}
+
+// NewMemoryPubsub generates the MemoryPubsub.
+func NewMemoryPubsub() *MemoryPubsub {
+	return &MemoryPubsub{
+		topics:   map[string]bool{},
+		messChan: make(chan cache.Message),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Pub records the message, and delivers it to the subscription if the topic is subscribed.
+// It blocks until the message is received, or the pubsub is closed.
+func (m *MemoryPubsub) Pub(ctx context.Context, topic string, message []byte) error {
+	mess := &memoryMessage{topic: topic, content: append([]byte(nil), message...)}
+
+	m.mut.Lock()
+	m.published = append(m.published, mess)
+	subscribed := m.topics[topic]
+	m.mut.Unlock()
+
+	if !subscribed {
+		return nil
+	}
+
+	m.sendMut.RLock()
+	defer m.sendMut.RUnlock()
+
+	select {
+	case <-m.closed:
+		// messChan is closed already
+		return nil
+	default:
+	}
+
+	select {
+	case <-m.closed:
+	case <-ctx.Done():
+		return ctx.Err()
+	case m.messChan <- mess:
+	}
+
+	return nil
+}
+
+// Sub subscribes the topics, and only the first call takes effect like other Pubsub implementations.
+func (m *MemoryPubsub) Sub(ctx context.Context, topic ...string) <-chan cache.Message {
+	m.subOnce.Do(func() {
+		m.mut.Lock()
+		defer m.mut.Unlock()
+
+		for _, t := range topic {
+			m.topics[t] = true
+		}
+	})
+
+	return m.messChan
+}
+
+// Close closes the subscription. The messages published afterwards are recorded but not delivered.
+func (m *MemoryPubsub) Close() {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+
+		m.sendMut.Lock()
+		close(m.messChan)
+		m.sendMut.Unlock()
+	})
+}
+
+// Published returns the messages published so far in order.
+func (m *MemoryPubsub) Published() []cache.Message {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	return append([]cache.Message(nil), m.published...)
+}
+
+type memoryMessage struct {
+	topic   string
+	content []byte
+}
+
+func (m *memoryMessage) Topic() string {
+	return m.topic
+}
+
+func (m *memoryMessage) Content() []byte {
+	return m.content
+}
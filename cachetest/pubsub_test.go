@@ -0,0 +1,65 @@
+package cachetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type pubsubSuite struct {
+	suite.Suite
+}
+
+func (s *pubsubSuite) SetupSuite() {}
+
+func (s *pubsubSuite) TearDownSuite() {}
+
+func (s *pubsubSuite) SetupTest() {}
+
+func (s *pubsubSuite) TearDownTest() {}
+
+func TestPubsubSuite(t *testing.T) {
+	suite.Run(t, new(pubsubSuite))
+}
+
+func (s *pubsubSuite) TestPubSub() {
+	ctx := context.Background()
+	pb := NewMemoryPubsub()
+	messChan := pb.Sub(ctx, "topic-a")
+
+	// not subscribed, recorded only
+	s.Require().NoError(pb.Pub(ctx, "topic-b", []byte("b")))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Require().NoError(pb.Pub(ctx, "topic-a", []byte("a")))
+	}()
+
+	mess := <-messChan
+	<-done
+	s.Require().Equal("topic-a", mess.Topic())
+	s.Require().Equal([]byte("a"), mess.Content())
+
+	published := pb.Published()
+	s.Require().Len(published, 2)
+	s.Require().Equal("topic-b", published[0].Topic())
+	s.Require().Equal("topic-a", published[1].Topic())
+
+	// closed, recorded but not delivered
+	pb.Close()
+	pb.Close()
+	_, ok := <-messChan
+	s.Require().False(ok)
+	s.Require().NoError(pb.Pub(ctx, "topic-a", []byte("a")))
+	s.Require().Len(pb.Published(), 3)
+}
+
+func (s *pubsubSuite) TestCloseWithoutSub() {
+	pb := NewMemoryPubsub()
+	pb.Close()
+
+	_, ok := <-pb.Sub(context.Background(), "topic")
+	s.Require().False(ok)
+}
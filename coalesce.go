@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// coalescer collapses the concurrent writes of the same key within the window into a single write.
+// The first write of a key waits for the window, and the later ones only replace the value to write,
+// so the latest value wins and all of them share the result of the single write.
+type coalescer struct {
+	window time.Duration
+
+	mut     sync.Mutex
+	pending map[string]*coalescedWrite
+}
+
+// coalescedWrite is the write shared by the concurrent callers of the same key.
+type coalescedWrite struct {
+	// values are the values of the waiting callers in the arrival order, the last one is written
+	values []*coalescedValue
+	// b is the written value
+	b    []byte
+	done chan struct{}
+	err  error
+}
+
+// coalescedValue is the value of a caller, which is dropped if the caller stops waiting before writing.
+type coalescedValue struct {
+	b []byte
+}
+
+// remove drops the value of the caller stopped waiting.
+func (w *coalescedWrite) remove(v *coalescedValue) {
+	for i, value := range w.values {
+		if value == v {
+			w.values = append(w.values[:i], w.values[i+1:]...)
+			return
+		}
+	}
+}
+
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{
+		window:  window,
+		pending: map[string]*coalescedWrite{},
+	}
+}
+
+// do writes b of the key by the write function, or joins the pending write of the same key, and returns the value
+// actually written, which is the latest one of the callers. The write is performed with the values of the first
+// caller's context but without its cancellation, so that the cancelled first caller doesn't fail the others,
+// and it's bounded by the operation timeout of the adapters instead. The others stop waiting once their contexts
+// are done, and their values are dropped unless the write has started already.
+func (co *coalescer) do(
+	ctx context.Context, key string, b []byte, write func(ctx context.Context, b []byte) error,
+) ([]byte, error) {
+	co.mut.Lock()
+	if w, ok := co.pending[key]; ok {
+		// the latest value wins
+		v := &coalescedValue{b: b}
+		w.values = append(w.values, v)
+		co.mut.Unlock()
+
+		select {
+		case <-w.done:
+			return w.b, w.err
+		case <-ctx.Done():
+			co.mut.Lock()
+			w.remove(v)
+			co.mut.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+
+	w := &coalescedWrite{values: []*coalescedValue{{b: b}}, done: make(chan struct{})}
+	co.pending[key] = w
+	co.mut.Unlock()
+
+	timer := time.NewTimer(co.window)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+
+	// the later writes start a new round after removing it from pending, the value of the first caller is never dropped
+	co.mut.Lock()
+	delete(co.pending, key)
+	w.b = w.values[len(w.values)-1].b
+	co.mut.Unlock()
+
+	w.err = write(detachedContext{ctx}, w.b)
+	close(w.done)
+
+	return w.b, w.err
+}
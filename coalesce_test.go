@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockCoalesceCTX = context.Background()
+)
+
+type coalescerSuite struct {
+	suite.Suite
+}
+
+func (s *coalescerSuite) SetupSuite() {}
+
+func (s *coalescerSuite) TearDownSuite() {}
+
+func (s *coalescerSuite) SetupTest() {}
+
+func (s *coalescerSuite) TearDownTest() {}
+
+func TestCoalescerSuite(t *testing.T) {
+	suite.Run(t, new(coalescerSuite))
+}
+
+func (s *coalescerSuite) TestDo() {
+	co := newCoalescer(50 * time.Millisecond)
+
+	var writes int32
+	var written []byte
+	write := func(ctx context.Context, b []byte) error {
+		atomic.AddInt32(&writes, 1)
+		written = b
+		return errors.New("failed to write")
+	}
+
+	results := make(chan coalescedWrite, 3)
+	do := func(b []byte) {
+		written, err := co.do(mockCoalesceCTX, "key", b, write)
+		results <- coalescedWrite{b: written, err: err}
+	}
+	go do([]byte("v1"))
+	time.Sleep(10 * time.Millisecond)
+	go do([]byte("v2"))
+	time.Sleep(10 * time.Millisecond)
+	go do([]byte("v3"))
+
+	// all of them share the result along with the written value
+	for i := 0; i < 3; i++ {
+		res := <-results
+		s.Require().EqualError(res.err, "failed to write")
+		s.Require().Equal([]byte("v3"), res.b)
+	}
+	s.Require().Equal(int32(1), atomic.LoadInt32(&writes))
+	s.Require().Equal([]byte("v3"), written)
+
+	// a new round after writing
+	_, err := co.do(mockCoalesceCTX, "key", []byte("v4"), write)
+	s.Require().Error(err)
+	s.Require().Equal(int32(2), atomic.LoadInt32(&writes))
+	s.Require().Equal([]byte("v4"), written)
+}
+
+func (s *coalescerSuite) TestDoWithDifferentKeys() {
+	co := newCoalescer(10 * time.Millisecond)
+
+	var mut sync.Mutex
+	written := map[string][]byte{}
+	wg := sync.WaitGroup{}
+	for _, key := range []string{"key1", "key2"} {
+		key := key
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := co.do(mockCoalesceCTX, key, []byte(key), func(ctx context.Context, b []byte) error {
+				mut.Lock()
+				defer mut.Unlock()
+				written[key] = b
+				return nil
+			})
+			s.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	s.Require().Equal(map[string][]byte{"key1": []byte("key1"), "key2": []byte("key2")}, written)
+}
+
+func (s *coalescerSuite) TestDoWithCanceledContext() {
+	co := newCoalescer(time.Hour)
+
+	ctx, cancel := context.WithCancel(mockCoalesceCTX)
+	cancel()
+
+	// written immediately without waiting for the window, and the write isn't cancelled
+	written, err := co.do(ctx, "key", []byte("v1"), func(ctx context.Context, b []byte) error {
+		return ctx.Err()
+	})
+	s.Require().NoError(err)
+	s.Require().Equal([]byte("v1"), written)
+}
+
+func (s *coalescerSuite) TestDoWithCanceledFirstCaller() {
+	co := newCoalescer(time.Hour)
+
+	ctx, cancel := context.WithCancel(mockCoalesceCTX)
+	write := func(ctx context.Context, b []byte) error {
+		return ctx.Err()
+	}
+	joined := func(n int) func() bool {
+		return func() bool {
+			co.mut.Lock()
+			defer co.mut.Unlock()
+			return co.pending["key"] != nil && len(co.pending["key"].values) == n
+		}
+	}
+
+	results := make(chan coalescedWrite, 1)
+	go func() {
+		written, err := co.do(ctx, "key", []byte("v1"), write)
+		results <- coalescedWrite{b: written, err: err}
+	}()
+	s.Require().Eventually(joined(1), time.Second, time.Millisecond)
+
+	go func() {
+		for !joined(2)() {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	// the first caller is cancelled, which neither cancels the write nor fails others
+	written, err := co.do(mockCoalesceCTX, "key", []byte("v2"), write)
+	s.Require().NoError(err)
+	s.Require().Equal([]byte("v2"), written)
+	res := <-results
+	s.Require().NoError(res.err)
+	s.Require().Equal([]byte("v2"), res.b)
+}
+
+func (s *coalescerSuite) TestDoWithCanceledFollower() {
+	co := newCoalescer(50 * time.Millisecond)
+
+	var written []byte
+	write := func(ctx context.Context, b []byte) error {
+		written = b
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(mockCoalesceCTX)
+	errs := make(chan error, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, err := co.do(ctx, "key", []byte("v2"), write)
+		errs <- err
+	}()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	// the value of the follower stopped waiting is dropped
+	b, err := co.do(mockCoalesceCTX, "key", []byte("v1"), write)
+	s.Require().NoError(err)
+	s.Require().Equal([]byte("v1"), b)
+	s.Require().Equal([]byte("v1"), written)
+	s.Require().Equal(context.Canceled, <-errs)
+}
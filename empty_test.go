@@ -43,8 +43,8 @@ func (s *emptySuite) TestEmptyAdapter() {
 		{
 			Prefix: mockEmptyPfx,
 			CacheAttributes: map[Type]Attribute{
-				SharedCacheType: {time.Hour},
-				LocalCacheType:  {10 * time.Second},
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
 			},
 		},
 	})
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	// envelopeMagic marks the bytes wrapped by the versioned envelope
+	envelopeMagic = 0xc5
+	// envelopeHeaderLen = magic (1 byte) + version (4 bytes)
+	envelopeHeaderLen = 5
+	// envelopeSoftMagic marks the bytes wrapped by the envelope carrying the soft expiry as well
+	envelopeSoftMagic = 0xc6
+	// envelopeSoftHeaderLen = magic (1 byte) + version (4 bytes) + soft expiry in unix nanoseconds (8 bytes)
+	envelopeSoftHeaderLen = 13
+)
+
+var (
+	// ErrVersionMismatch means the version stored in the envelope differs from the expected one
+	ErrVersionMismatch = errors.New("envelope version mismatch")
+)
+
+// NewVersionedMarshaler wraps the given marshal and unmarshal functions with a versioned envelope.
+// The version is prepended to the marshaled bytes, and the unmarshal function returns ErrVersionMismatch
+// when the stored version differs from the expected one (including the bytes without envelope).
+func NewVersionedMarshaler(version int, marshal MarshalFunc, unmarshal UnmarshalFunc) (MarshalFunc, UnmarshalFunc) {
+	if !isValidVersion(version) {
+		panic(errors.New("invalid version"))
+	}
+	if marshal == nil || unmarshal == nil {
+		panic(errors.New("both of Marshal and Unmarshal functions need to be specified"))
+	}
+
+	v := uint32(version)
+	return func(value interface{}) ([]byte, error) {
+			b, err := marshal(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return wrapEnvelope(b, v), nil
+		}, func(b []byte, value interface{}) error {
+			payload, err := unwrapEnvelope(b, v)
+			if err != nil {
+				return err
+			}
+
+			return unmarshal(payload, value)
+		}
+}
+
+// isValidVersion reports whether the version fits in the envelope. The comparison is done in uint64,
+// since math.MaxUint32 overflows int on 32-bit platforms.
+func isValidVersion(version int) bool {
+	return version >= 0 && uint64(version) <= math.MaxUint32
+}
+
+// versionedMarshaler is the context-aware NewVersionedMarshaler used by the configs.
+func versionedMarshaler(
+	version uint32, marshal MarshalWithCtxFunc, unmarshal UnmarshalWithCtxFunc,
+) (MarshalWithCtxFunc, UnmarshalWithCtxFunc) {
+	return func(ctx context.Context, value interface{}) ([]byte, error) {
+			b, err := marshal(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+
+			return wrapEnvelope(b, version), nil
+		}, func(ctx context.Context, b []byte, value interface{}) error {
+			payload, err := unwrapEnvelope(b, version)
+			if err != nil {
+				return err
+			}
+
+			return unmarshal(ctx, payload, value)
+		}
+}
+
+// softTTLMarshaler stamps the soft expiry on the values when they're marshaled, so that the stale values are
+// distinguished from the fresh ones when they're loaded. Both of the versioned and the unversioned configs share
+// the same header, the unversioned ones write the version 0 and pass the bytes without envelope through,
+// e.g. the ones written before the soft TTL was enabled, or by Cache.SetBytes().
+func softTTLMarshaler(
+	versioned bool, version uint32, softTTL time.Duration, marshal MarshalWithCtxFunc, unmarshal UnmarshalWithCtxFunc,
+) (MarshalWithCtxFunc, UnmarshalWithCtxFunc) {
+	return func(ctx context.Context, value interface{}) ([]byte, error) {
+			b, err := marshal(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+
+			return wrapSoftEnvelope(b, version, time.Now().Add(softTTL)), nil
+		}, func(ctx context.Context, b []byte, value interface{}) error {
+			if !versioned && checkEnvelope(b, 0) != nil {
+				return unmarshal(ctx, b, value)
+			}
+
+			payload, err := unwrapEnvelope(b, version)
+			if err != nil {
+				return err
+			}
+
+			return unmarshal(ctx, payload, value)
+		}
+}
+
+func wrapEnvelope(payload []byte, version uint32) []byte {
+	b := make([]byte, envelopeHeaderLen+len(payload))
+	b[0] = envelopeMagic
+	binary.BigEndian.PutUint32(b[1:envelopeHeaderLen], version)
+	copy(b[envelopeHeaderLen:], payload)
+
+	return b
+}
+
+func wrapSoftEnvelope(payload []byte, version uint32, softExpireAt time.Time) []byte {
+	b := make([]byte, envelopeSoftHeaderLen+len(payload))
+	b[0] = envelopeSoftMagic
+	binary.BigEndian.PutUint32(b[1:envelopeHeaderLen], version)
+	binary.BigEndian.PutUint64(b[envelopeHeaderLen:envelopeSoftHeaderLen], uint64(softExpireAt.UnixNano()))
+	copy(b[envelopeSoftHeaderLen:], payload)
+
+	return b
+}
+
+func unwrapEnvelope(b []byte, version uint32) ([]byte, error) {
+	if err := checkEnvelope(b, version); err != nil {
+		return nil, err
+	}
+
+	return b[envelopeHeaderLenOf(b):], nil
+}
+
+// checkEnvelope verifies the envelope header without touching the payload.
+func checkEnvelope(b []byte, version uint32) error {
+	if envelopeHeaderLenOf(b) == 0 {
+		return ErrVersionMismatch
+	}
+
+	if binary.BigEndian.Uint32(b[1:envelopeHeaderLen]) != version {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// envelopeHeaderLenOf returns the length of the envelope header, or 0 if the bytes aren't wrapped.
+func envelopeHeaderLenOf(b []byte) int {
+	switch {
+	case len(b) >= envelopeHeaderLen && b[0] == envelopeMagic:
+		return envelopeHeaderLen
+	case len(b) >= envelopeSoftHeaderLen && b[0] == envelopeSoftMagic:
+		return envelopeSoftHeaderLen
+	}
+
+	return 0
+}
+
+// softExpiry returns the soft expiry stamped in the envelope, and false if there is none.
+func softExpiry(b []byte) (time.Time, bool) {
+	if envelopeHeaderLenOf(b) != envelopeSoftHeaderLen {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[envelopeHeaderLen:envelopeSoftHeaderLen]))), true
+}
+
+// equalIgnoringSoftExpiry compares the bytes except for the soft expiry, which differs on every marshaling.
+func equalIgnoringSoftExpiry(a, b []byte) bool {
+	if envelopeHeaderLenOf(a) != envelopeSoftHeaderLen || envelopeHeaderLenOf(b) != envelopeSoftHeaderLen {
+		return bytes.Equal(a, b)
+	}
+
+	return bytes.Equal(a[:envelopeHeaderLen], b[:envelopeHeaderLen]) &&
+		bytes.Equal(a[envelopeSoftHeaderLen:], b[envelopeSoftHeaderLen:])
+}
+
+// hashIgnoringSoftExpiry returns the hex SHA-256 of the bytes, which ignores the soft expiry like
+// equalIgnoringSoftExpiry(), so that the identical values marshaled at different times share the hash.
+func hashIgnoringSoftExpiry(b []byte) string {
+	h := sha256.New()
+	if envelopeHeaderLenOf(b) == envelopeSoftHeaderLen {
+		h.Write(b[:envelopeHeaderLen])
+		h.Write(b[envelopeSoftHeaderLen:])
+	} else {
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
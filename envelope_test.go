@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type envelopeSuite struct {
+	suite.Suite
+}
+
+func (s *envelopeSuite) SetupSuite() {}
+
+func (s *envelopeSuite) TearDownSuite() {}
+
+func (s *envelopeSuite) SetupTest() {}
+
+func (s *envelopeSuite) TearDownTest() {}
+
+func TestEnvelopeSuite(t *testing.T) {
+	suite.Run(t, new(envelopeSuite))
+}
+
+func (s *envelopeSuite) TestNewVersionedMarshalerWithInvalidVersion() {
+	defer func() {
+		r := recover()
+		s.Require().NotNil(r)
+		s.Require().Equal(errors.New("invalid version"), r)
+	}()
+	NewVersionedMarshaler(-1, json.Marshal, json.Unmarshal)
+}
+
+func (s *envelopeSuite) TestVersionedMarshaler() {
+	marshalV1, unmarshalV1 := NewVersionedMarshaler(1, Marshal, Unmarshal)
+	_, unmarshalV2 := NewVersionedMarshaler(2, Marshal, Unmarshal)
+
+	st := mockStruct{
+		ID:        28825252,
+		Key:       "I am rich",
+		CreatedAt: mockTimeNow,
+	}
+	bs, err := marshalV1(st)
+	s.Require().NoError(err)
+	s.Require().Equal(byte(envelopeMagic), bs[0])
+
+	// same version
+	retSt := mockStruct{}
+	s.Require().NoError(unmarshalV1(bs, &retSt))
+	s.Require().Equal(st, retSt)
+
+	// different version
+	s.Require().Equal(ErrVersionMismatch, unmarshalV2(bs, &mockStruct{}))
+
+	// bytes without envelope
+	rawBs, err := Marshal(st)
+	s.Require().NoError(err)
+	s.Require().Equal(ErrVersionMismatch, unmarshalV1(rawBs, &mockStruct{}))
+	s.Require().Equal(ErrVersionMismatch, unmarshalV1(nil, &mockStruct{}))
+}
+
+func (s *envelopeSuite) TestSoftEnvelope() {
+	softExpireAt := time.Unix(0, mockTimeNow.UnixNano())
+	b := wrapSoftEnvelope([]byte("payload"), 1, softExpireAt)
+	s.Require().Equal(byte(envelopeSoftMagic), b[0])
+
+	// both headers carry the version at the same place
+	s.Require().NoError(checkEnvelope(b, 1))
+	s.Require().Equal(ErrVersionMismatch, checkEnvelope(b, 2))
+	payload, err := unwrapEnvelope(b, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]byte("payload"), payload)
+
+	exp, ok := softExpiry(b)
+	s.Require().True(ok)
+	s.Require().True(softExpireAt.Equal(exp))
+	_, ok = softExpiry(wrapEnvelope([]byte("payload"), 1))
+	s.Require().False(ok)
+
+	// only the soft expiry differs
+	s.Require().True(equalIgnoringSoftExpiry(b, wrapSoftEnvelope([]byte("payload"), 1, softExpireAt.Add(time.Hour))))
+	s.Require().False(equalIgnoringSoftExpiry(b, wrapSoftEnvelope([]byte("payload"), 2, softExpireAt)))
+	s.Require().False(equalIgnoringSoftExpiry(b, wrapSoftEnvelope([]byte("other"), 1, softExpireAt)))
+}
+
+func (s *envelopeSuite) TestSoftTTLMarshaler() {
+	ctx := context.Background()
+	marshal, unmarshal := softTTLMarshaler(false, 0, time.Minute, withCtxMarshal(Marshal), withCtxUnmarshal(Unmarshal))
+
+	b, err := marshal(ctx, "value")
+	s.Require().NoError(err)
+	exp, ok := softExpiry(b)
+	s.Require().True(ok)
+	s.Require().WithinDuration(time.Now().Add(time.Minute), exp, time.Second)
+
+	var str string
+	s.Require().NoError(unmarshal(ctx, b, &str))
+	s.Require().Equal("value", str)
+
+	// the unversioned ones pass the bytes without envelope through
+	rawBs, err := Marshal("raw")
+	s.Require().NoError(err)
+	s.Require().NoError(unmarshal(ctx, rawBs, &str))
+	s.Require().Equal("raw", str)
+
+	// the versioned ones don't
+	_, unmarshalV1 := softTTLMarshaler(true, 1, time.Minute, withCtxMarshal(Marshal), withCtxUnmarshal(Unmarshal))
+	s.Require().Equal(ErrVersionMismatch, unmarshalV1(ctx, rawBs, &str))
+	s.Require().Equal(ErrVersionMismatch, unmarshalV1(ctx, b, &str))
+}
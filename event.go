@@ -6,7 +6,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var (
@@ -25,23 +28,27 @@ Evict // Evict presents eviction event.
 */
 type eventType int32
 
-var regTopicEventMap map[string]eventType
+// Topic generates the topic for specified event in the namespace, and the empty namespace means the default one.
+func (x eventType) Topic(namespace string) string {
+	if namespace == "" {
+		return getTopic(x.String())
+	}
 
-func init() {
-	regTopicEventMap = map[string]eventType{}
+	return getTopic(customKey(topicDelim, namespace, x.String()))
+}
 
+// regTopicEventMap maps the topics in the namespace back to the event types.
+func regTopicEventMap(namespace string) map[string]eventType {
+	m := map[string]eventType{}
 	for typ := range _eventTypeMap {
 		if typ == EventTypeNone {
 			continue
 		}
 
-		regTopicEventMap[typ.Topic()] = typ
+		m[typ.Topic(namespace)] = typ
 	}
-}
 
-// Topic generates the topic for specified event.
-func (x eventType) Topic() string {
-	return getTopic(x.String())
+	return m
 }
 
 type event struct {
@@ -49,21 +56,173 @@ type event struct {
 	Body eventBody
 }
 
+const (
+	// eventBodyVersionCompressed compresses the keys into the payload with the common prefix factored out.
+	// The subscribers not recognizing the version see no keys, so enable it after all nodes are upgraded.
+	eventBodyVersionCompressed = 1
+)
+
 type eventBody struct {
 	FID  string
 	Keys []string
+	// KeyPrefixes evicts all keys starting with them
+	KeyPrefixes []string `json:",omitempty"`
+	// Names are the untransformed cache keys of Keys in order if WithKeyTransformer() is specified,
+	// where the empty ones are unknown.
+	Names []string `json:",omitempty"`
+	// Version decides the format of the Payload, zero means the keys are listed in Keys.
+	Version int `json:",omitempty"`
+	// Payload is the compressed eventKeys if the Version is eventBodyVersionCompressed.
+	Payload []byte `json:",omitempty"`
+}
+
+// EvictionEvent is the eviction broadcasted across the nodes, which is encoded by the codec specified by
+// WithEventCodec(). The codec must preserve all fields, especially FID, which tells the events sent by itself.
+type EvictionEvent struct {
+	// FID is the ID of the factory sending the event.
+	FID string
+	// Keys are the evicted keys.
+	Keys []string
+	// KeyPrefixes evicts all keys starting with them.
+	KeyPrefixes []string
+	// Names are the untransformed cache keys of Keys in order if the keys are transformed, where the empty ones
+	// are unknown. They're given to OnEvict() instead of Keys.
+	Names []string
+}
+
+// jsonMarshalEventBody is the default codec of the event bodies.
+func jsonMarshalEventBody(b eventBody) ([]byte, error) {
+	return json.Marshal(b)
+}
+
+func jsonUnmarshalEventBody(bs []byte, b *eventBody) error {
+	return json.Unmarshal(bs, b)
+}
+
+// eventCodec adapts the codec of EvictionEvent to the event bodies.
+func eventCodec(
+	marshal func(EvictionEvent) ([]byte, error), unmarshal func([]byte, *EvictionEvent) error,
+) (func(eventBody) ([]byte, error), func([]byte, *eventBody) error) {
+	return func(b eventBody) ([]byte, error) {
+			return marshal(EvictionEvent{FID: b.FID, Keys: b.Keys, KeyPrefixes: b.KeyPrefixes, Names: b.Names})
+		}, func(bs []byte, b *eventBody) error {
+			var e EvictionEvent
+			if err := unmarshal(bs, &e); err != nil {
+				return err
+			}
+
+			*b = eventBody{FID: e.FID, Keys: e.Keys, KeyPrefixes: e.KeyPrefixes, Names: e.Names}
+			return nil
+		}
+}
+
+// eventKeys lists the keys relative to their common prefix.
+type eventKeys struct {
+	Prefix string
+	Keys   []string
+}
+
+// compressKeys moves the keys into the compressed payload with the common prefix factored out.
+func (b *eventBody) compressKeys() error {
+	if len(b.Keys) == 0 {
+		return nil
+	}
+
+	prefix := commonPrefix(b.Keys)
+	ek := eventKeys{Prefix: prefix, Keys: make([]string, len(b.Keys))}
+	for i, k := range b.Keys {
+		ek.Keys[i] = k[len(prefix):]
+	}
+
+	bs, err := msgpack.Marshal(ek)
+	if err != nil {
+		return err
+	}
+
+	b.Version = eventBodyVersionCompressed
+	b.Payload = compress(bs)
+	b.Keys = nil
+
+	return nil
+}
+
+// decompressKeys reassembles the full keys from the payload according to the version.
+func (b *eventBody) decompressKeys() error {
+	switch b.Version {
+	case 0:
+		return nil
+	case eventBodyVersionCompressed:
+	default:
+		return fmt.Errorf("%w: unsupported event body version %d", ErrUnknownEvent, b.Version)
+	}
+
+	if len(b.Payload) == 0 {
+		return nil
+	}
+
+	bs, err := decompress(b.Payload)
+	if err != nil {
+		return err
+	}
+
+	var ek eventKeys
+	if err := msgpack.Unmarshal(bs, &ek); err != nil {
+		return err
+	}
+
+	b.Keys = make([]string, len(ek.Keys))
+	for i, k := range ek.Keys {
+		b.Keys[i] = ek.Prefix + k
+	}
+	b.Version, b.Payload = 0, nil
+
+	return nil
+}
+
+// commonPrefix returns the longest common prefix of the keys.
+func commonPrefix(keys []string) string {
+	prefix := keys[0]
+	for _, k := range keys[1:] {
+		i := 0
+		for i < len(prefix) && i < len(k) && prefix[i] == k[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+
+	return prefix
 }
 
 type messageBroker struct {
 	pubsub Pubsub
 	fid    string
-	wg     sync.WaitGroup
+	// namespace isolates the topics, e.g. of the environments sharing the same pubsub
+	namespace   string
+	topicEvents map[string]eventType
+	wg          sync.WaitGroup
+	// compressed sends the event bodies with eventBodyVersionCompressed
+	compressed bool
+	// marshal and unmarshal decide the wire format of the event bodies, the default is JSON
+	marshal   func(eventBody) ([]byte, error)
+	unmarshal func([]byte, *eventBody) error
+
+	// cancels stop the listening goroutines on closing, guarded by cancelMut
+	cancels   []context.CancelFunc
+	cancelMut sync.Mutex
+	// done stops draining the subscriptions whose listening is stopped
+	done chan struct{}
 }
 
-func newMessageBroker(fid string, pb Pubsub) *messageBroker {
+func newMessageBroker(fid string, pb Pubsub, compressed bool, namespace string) *messageBroker {
 	return &messageBroker{
-		fid:    fid,
-		pubsub: pb,
+		fid:         fid,
+		pubsub:      pb,
+		compressed:  compressed,
+		namespace:   namespace,
+		topicEvents: regTopicEventMap(namespace),
+		marshal:     jsonMarshalEventBody,
+		unmarshal:   jsonUnmarshalEventBody,
+		done:        make(chan struct{}),
 	}
 }
 
@@ -76,8 +235,16 @@ func (mb *messageBroker) close() {
 		return
 	}
 
-	// close s
+	// stop listening first, so closing never waits for the channel of the subscription to be closed
+	mb.cancelMut.Lock()
+	for _, cancel := range mb.cancels {
+		cancel()
+	}
+	mb.cancels = nil
+	mb.cancelMut.Unlock()
+
 	mb.pubsub.Close()
+	close(mb.done)
 	mb.wg.Wait()
 }
 
@@ -87,12 +254,18 @@ func (mb *messageBroker) send(ctx context.Context, e event) error {
 	}
 
 	e.Body.FID = mb.fid
-	bs, err := json.Marshal(e.Body)
+	if mb.compressed {
+		if err := e.Body.compressKeys(); err != nil {
+			return err
+		}
+	}
+
+	bs, err := mb.marshal(e.Body)
 	if err != nil {
 		return err
 	}
 
-	return mb.pubsub.Pub(ctx, e.Type.Topic(), bs)
+	return mb.pubsub.Pub(ctx, e.Type.Topic(mb.namespace), bs)
 }
 
 func (mb *messageBroker) listen(
@@ -108,34 +281,82 @@ func (mb *messageBroker) listen(
 
 	topics := make([]string, len(types))
 	for i := 0; i < len(types); i++ {
-		topics[i] = types[i].Topic()
+		topics[i] = types[i].Topic(mb.namespace)
 	}
 
+	// the listening stops when either the context is canceled or the broker is closed
+	ctx, cancel := context.WithCancel(ctx)
+	mb.cancelMut.Lock()
+	mb.cancels = append(mb.cancels, cancel)
+	mb.cancelMut.Unlock()
+
+	messages := mb.pubsub.Sub(ctx, topics...)
+
 	mb.wg.Add(1)
 	go func() {
 		defer mb.wg.Done()
 
-		for mess := range mb.pubsub.Sub(ctx, topics...) {
-			typ, ok := regTopicEventMap[mess.Topic()]
-			if !ok {
-				cb(ctx, nil, errors.New("no such topic registered"))
-				continue
-			}
-
-			e := event{Type: typ}
-			if err := json.Unmarshal(mess.Content(), &e.Body); err != nil {
-				cb(ctx, nil, err)
-				continue
-			}
+		for {
+			select {
+			case <-ctx.Done():
+				// the pubsub may block on sending until its channel is closed, keep receiving without handling
+				mb.drain(messages)
+				return
+			case mess, ok := <-messages:
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					// the message arrived along with the cancellation
+					mb.drain(messages)
+					return
+				}
 
-			if e.Body.FID == mb.fid {
-				cb(ctx, &e, errSelfEvent)
-				continue
+				mb.handle(ctx, mess, cb)
 			}
-
-			cb(ctx, &e, nil)
 		}
 	}()
 
 	return nil
 }
+
+// drain receives the messages without handling until the channel is closed or the broker is closed.
+func (mb *messageBroker) drain(messages <-chan Message) {
+	for {
+		select {
+		case <-mb.done:
+			return
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// handle decodes the message into the event, and passes it to the callback.
+func (mb *messageBroker) handle(ctx context.Context, mess Message, cb func(context.Context, *event, error)) {
+	typ, ok := mb.topicEvents[mess.Topic()]
+	if !ok {
+		cb(ctx, nil, fmt.Errorf("%w: no such topic registered: %s", ErrUnknownEvent, mess.Topic()))
+		return
+	}
+
+	e := event{Type: typ}
+	if err := mb.unmarshal(mess.Content(), &e.Body); err != nil {
+		cb(ctx, nil, err)
+		return
+	}
+
+	if err := e.Body.decompressKeys(); err != nil {
+		cb(ctx, nil, err)
+		return
+	}
+
+	if e.Body.FID == mb.fid {
+		cb(ctx, &e, errSelfEvent)
+		return
+	}
+
+	cb(ctx, &e, nil)
+}
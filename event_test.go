@@ -2,6 +2,9 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,7 +45,7 @@ func (s *eventSuite) TearDownSuite() {}
 func (s *eventSuite) SetupTest() {
 	s.rds = NewRedis(s.ring).(*rds)
 	s.lfu = NewTinyLFU(10000).(*tinyLFU)
-	s.mb = newMessageBroker(mockEventUUID, s.rds)
+	s.mb = newMessageBroker(mockEventUUID, s.rds, false, "")
 	s.factory = NewFactory(s.rds, s.lfu, WithPubSub(s.rds)).(*factory)
 }
 
@@ -67,8 +70,8 @@ func (s *eventSuite) TestSubscribedEventsHandlerWithSet() {
 		{
 			Prefix: mockEventPfx,
 			CacheAttributes: map[Type]Attribute{
-				SharedCacheType: {time.Hour},
-				LocalCacheType:  {10 * time.Second},
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
 			},
 		},
 	})
@@ -81,7 +84,6 @@ func (s *eventSuite) TestSubscribedEventsHandlerWithSet() {
 	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("100")}}, val) // make sure the local value existed without impacted
 
 	// trigger invalid event type, ignore it directly
-	// TODO: handling error messages forwarding in the future
 	s.Require().NoError(s.mb.send(mockEventCTX, event{Type: EventTypeNone}))
 	time.Sleep(time.Millisecond * 100)
 	val, err = s.lfu.MGet(mockEventCTX, []string{getCacheKey(mockEventPfx, mockEventKey)})
@@ -114,8 +116,8 @@ func (s *eventSuite) TestSubscribedEventsHandlerWithDel() {
 		{
 			Prefix: mockEventPfx,
 			CacheAttributes: map[Type]Attribute{
-				SharedCacheType: {time.Hour},
-				LocalCacheType:  {10 * time.Second},
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
 			},
 		},
 	})
@@ -135,13 +137,196 @@ func (s *eventSuite) TestSubscribedEventsHandlerWithDel() {
 	s.Require().Equal([]Value{{}}, val)
 }
 
+func (s *eventSuite) TestSubscribedEventsHandlerWithKeyPrefixes() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: mockEventPfx,
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
+			},
+		},
+	})
+	s.Require().NoError(c.Set(mockEventCTX, mockEventPfx, mockEventKey, 100))
+
+	// evicted by other machines flushing the prefix, keep sending until the subscription is ready
+	s.Require().Eventually(func() bool {
+		if err := s.mb.send(mockEventCTX, event{
+			Type: EventTypeEvict,
+			Body: eventBody{KeyPrefixes: []string{getCacheKeyPrefix(mockEventPfx)}},
+		}); err != nil {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		val, err := s.lfu.MGet(mockEventCTX, []string{getCacheKey(mockEventPfx, mockEventKey)})
+		return err == nil && !val[0].Valid
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *eventSuite) TestSubscribedEventsHandlerWithCompressedBody() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: mockEventPfx,
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
+			},
+		},
+	})
+	s.Require().NoError(c.Set(mockEventCTX, mockEventPfx, mockEventKey, 100))
+
+	// evicted by other machines sending the compressed body, keep sending until the subscription is ready
+	s.mb.compressed = true
+	s.Require().Eventually(func() bool {
+		s.Require().NoError(s.mb.send(mockEventCTX, event{
+			Type: EventTypeEvict,
+			Body: eventBody{Keys: []string{getCacheKey(mockEventPfx, mockEventKey), getCacheKey(mockEventPfx, "another")}},
+		}))
+		time.Sleep(10 * time.Millisecond)
+
+		val, err := s.lfu.MGet(mockEventCTX, []string{getCacheKey(mockEventPfx, mockEventKey)})
+		return err == nil && !val[0].Valid
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *eventSuite) TestSubscribedEventsHandlerWithOnEvict() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: mockEventPfx,
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
+			},
+		},
+	})
+	s.Require().NoError(c.Set(mockEventCTX, mockEventPfx, mockEventKey, 100))
+
+	evicted := make(chan []string, 100)
+	s.factory.OnEvict(func(ctx context.Context, keys []string) {
+		// the local cache is cleared before the callback
+		val, err := s.lfu.MGet(ctx, []string{getCacheKey(mockEventPfx, mockEventKey)})
+		s.NoError(err)
+		s.False(val[0].Valid)
+
+		evicted <- keys
+	})
+
+	// evicted by other machines, keep sending until the subscription is ready
+	s.Require().Eventually(func() bool {
+		s.Require().NoError(s.mb.send(mockEventCTX, event{
+			Type: EventTypeEvict,
+			Body: eventBody{Keys: []string{getCacheKey(mockEventPfx, mockEventKey), getCacheKey(mockEventPfx, "another")}},
+		}))
+
+		select {
+		case keys := <-evicted:
+			s.Require().Equal([]string{mockEventKey, "another"}, keys)
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	// evicting by itself is not notified
+	s.Require().NoError(c.Del(mockEventCTX, mockEventPfx, mockEventKey))
+	time.Sleep(100 * time.Millisecond)
+	for len(evicted) > 0 {
+		s.Require().Equal([]string{mockEventKey, "another"}, <-evicted)
+	}
+}
+
+func (s *eventSuite) TestEventBodyCompression() {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = getCacheKey(mockEventPfx, fmt.Sprintf("key-%d", i))
+	}
+
+	plain, err := json.Marshal(eventBody{FID: mockEventUUID, Keys: keys})
+	s.Require().NoError(err)
+
+	body := eventBody{FID: mockEventUUID, Keys: keys}
+	s.Require().NoError(body.compressKeys())
+	s.Require().Equal(eventBodyVersionCompressed, body.Version)
+	s.Require().Nil(body.Keys)
+
+	compressed, err := json.Marshal(body)
+	s.Require().NoError(err)
+	s.Require().Less(len(compressed), len(plain)/2)
+
+	var decoded eventBody
+	s.Require().NoError(json.Unmarshal(compressed, &decoded))
+	s.Require().NoError(decoded.decompressKeys())
+	s.Require().Equal(eventBody{FID: mockEventUUID, Keys: keys}, decoded)
+
+	// nothing to compress
+	empty := eventBody{KeyPrefixes: []string{"ca:pfx:"}}
+	s.Require().NoError(empty.compressKeys())
+	s.Require().Equal(eventBody{KeyPrefixes: []string{"ca:pfx:"}}, empty)
+	s.Require().NoError(empty.decompressKeys())
+
+	// unknown versions
+	s.Require().ErrorIs((&eventBody{Version: 100}).decompressKeys(), ErrUnknownEvent)
+}
+
+func (s *eventSuite) TestCommonPrefix() {
+	s.Require().Equal("ca:pfx:", commonPrefix([]string{"ca:pfx:key1", "ca:pfx:key2", "ca:pfx:"}))
+	s.Require().Equal("ca:pfx:key", commonPrefix([]string{"ca:pfx:key"}))
+	s.Require().Equal("", commonPrefix([]string{"ca:pfx:key", "another"}))
+}
+
+func (s *eventSuite) TestTopicNamespace() {
+	s.Require().Equal("ca#tp#Evict", EventTypeEvict.Topic(""))
+	s.Require().Equal("ca#tp#staging#Evict", EventTypeEvict.Topic("staging"))
+
+	listen := func(namespace string) (*messageBroker, chan []string) {
+		received := make(chan []string, 100)
+		mb := newMessageBroker(namespace+"-listener", NewRedis(s.ring), false, namespace)
+		s.Require().NoError(mb.listen(mockEventCTX, []eventType{EventTypeEvict}, func(ctx context.Context, e *event, err error) {
+			s.NoError(err)
+			received <- e.Body.Keys
+		}))
+		return mb, received
+	}
+	prod, prodReceived := listen("production")
+	defer prod.close()
+	staging, stagingReceived := listen("staging")
+	defer staging.close()
+
+	// keep sending until the subscriptions are ready
+	sendUntilReceived := func(namespace string, received chan []string) {
+		mb := newMessageBroker(namespace+"-sender", NewRedis(s.ring), false, namespace)
+		defer mb.close()
+
+		s.Require().Eventually(func() bool {
+			s.Require().NoError(mb.send(mockEventCTX, event{Type: EventTypeEvict, Body: eventBody{Keys: []string{namespace}}}))
+
+			select {
+			case keys := <-received:
+				s.Require().Equal([]string{namespace}, keys)
+				return true
+			case <-time.After(10 * time.Millisecond):
+				return false
+			}
+		}, time.Second, time.Millisecond)
+	}
+	sendUntilReceived("staging", stagingReceived)
+	sendUntilReceived("production", prodReceived)
+
+	// the events of production never reach staging
+	time.Sleep(50 * time.Millisecond)
+	for len(stagingReceived) != 0 {
+		s.Require().Equal([]string{"staging"}, <-stagingReceived)
+	}
+}
+
 func (s *eventSuite) TestUnnormalEvent() {
 	c := s.factory.NewCache([]Setting{
 		{
 			Prefix: mockEventPfx,
 			CacheAttributes: map[Type]Attribute{
-				SharedCacheType: {time.Hour},
-				LocalCacheType:  {10 * time.Second},
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
 			},
 		},
 	})
@@ -156,9 +341,171 @@ func (s *eventSuite) TestUnnormalEvent() {
 	// nothing happened due to no handling on such event
 	s.Require().NoError(s.rds.Pub(mockEventCTX, "not-existed", nil))
 
-	// TODO: handle this error in the future
 	// invalid json format.
-	s.Require().NoError(s.rds.Pub(mockEventCTX, EventTypeEvict.Topic(), []byte("")))
+	s.Require().NoError(s.rds.Pub(mockEventCTX, EventTypeEvict.Topic(""), []byte("")))
+}
+
+func (s *eventSuite) TestUnnormalEventWithOnEventError() {
+	errChan := make(chan error, 100)
+	rds := NewRedis(s.ring)
+	f := NewFactory(rds, NewTinyLFU(10000), WithPubSub(rds), OnEventErrorFunc(func(err error) {
+		errChan <- err
+	})).(*factory)
+	defer f.Close()
+
+	// invalid json format, keep sending until the subscription is ready
+	var err error
+	s.Require().Eventually(func() bool {
+		s.Require().NoError(s.rds.Pub(mockEventCTX, EventTypeEvict.Topic(""), []byte("")))
+
+		select {
+		case err = <-errChan:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	s.Require().Error(err)
+	s.Require().NotErrorIs(err, ErrUnknownEvent)
+
+	// the unknown events are forwarded instead of being dropped silently
+	f.subscribedEventsHandler()(mockEventCTX, &event{Type: EventTypeNone}, nil)
+	f.subscribedEventsHandler()(mockEventCTX, &event{Type: eventType(100)}, nil)
+	s.Require().ErrorIs(<-errChan, ErrUnknownEvent)
+	s.Require().ErrorIs(<-errChan, ErrUnknownEvent)
+
+	// the events sent by itself are not errors
+	f.subscribedEventsHandler()(mockEventCTX, &event{Type: EventTypeEvict}, errSelfEvent)
+	select {
+	case err := <-errChan:
+		s.Failf("unexpected error", "%v", err)
+	default:
+	}
+}
+
+func (s *eventSuite) TestEventCodec() {
+	// the keys are separated by the newlines after the FID
+	marshal := func(e EvictionEvent) ([]byte, error) {
+		return []byte(strings.Join(append([]string{e.FID}, e.Keys...), "\n")), nil
+	}
+	unmarshal := func(b []byte, e *EvictionEvent) error {
+		lines := strings.Split(string(b), "\n")
+		e.FID, e.Keys = lines[0], lines[1:]
+		return nil
+	}
+
+	pubsub := &countingPubsub{messChan: make(chan Message)}
+	f := NewFactory(s.rds, s.lfu, WithPubSub(pubsub), WithEventCodec(marshal, unmarshal)).(*factory)
+	defer f.Close()
+
+	s.Require().NoError(f.mb.send(mockEventCTX, event{Type: EventTypeEvict, Body: eventBody{Keys: []string{"k1", "k2"}}}))
+	s.Require().Equal([][]byte{[]byte(f.id + "\nk1\nk2")}, pubsub.published())
+
+	received := make(chan *event, 1)
+	errs := make(chan error, 1)
+	other := &countingPubsub{messChan: make(chan Message)}
+	mb := newMessageBroker(mockEventUUID, other, false, "")
+	mb.marshal, mb.unmarshal = eventCodec(marshal, unmarshal)
+	defer mb.close()
+	s.Require().NoError(mb.listen(mockEventCTX, []eventType{EventTypeEvict}, func(ctx context.Context, e *event, err error) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		received <- e
+	}))
+
+	// the events from others are decoded by the codec
+	other.messChan <- &rdsMessage{topic: EventTypeEvict.Topic(""), content: f.id + "\nk1\nk2"}
+	e := <-received
+	s.Require().Equal(f.id, e.Body.FID)
+	s.Require().Equal([]string{"k1", "k2"}, e.Body.Keys)
+
+	// the events sent by itself are still detected
+	other.messChan <- &rdsMessage{topic: EventTypeEvict.Topic(""), content: mockEventUUID + "\nk1"}
+	s.Require().Equal(errSelfEvent, <-errs)
+}
+
+func (s *eventSuite) TestEventCodecWithInvalidArgs() {
+	marshal := func(e EvictionEvent) ([]byte, error) { return nil, nil }
+	s.Require().PanicsWithError("both of event marshal and unmarshal functions need to be specified", func() {
+		NewFactory(s.rds, s.lfu, WithEventCodec(marshal, nil))
+	})
+	s.Require().PanicsWithError("compressed events require the default event codec", func() {
+		NewFactory(s.rds, s.lfu, WithEventCodec(marshal, func(b []byte, e *EvictionEvent) error { return nil }),
+			WithCompressedEvents())
+	})
+}
+
+// stuckPubsub never closes the channel of the subscription.
+type stuckPubsub struct {
+	messChan chan Message
+}
+
+func (pb *stuckPubsub) Pub(ctx context.Context, topic string, message []byte) error {
+	pb.messChan <- &rdsMessage{topic: topic, content: string(message)}
+	return nil
+}
+
+func (pb *stuckPubsub) Sub(ctx context.Context, topic ...string) <-chan Message {
+	return pb.messChan
+}
+
+func (pb *stuckPubsub) Close() {}
+
+func (s *eventSuite) TestListenStoppedByClose() {
+	pubsub := &stuckPubsub{messChan: make(chan Message)}
+	mb := newMessageBroker(mockEventUUID, pubsub, false, "")
+
+	received := make(chan error, 1)
+	s.Require().NoError(mb.listen(mockEventCTX, []eventType{EventTypeEvict}, func(ctx context.Context, e *event, err error) {
+		received <- err
+	}))
+	s.Require().NoError(pubsub.Pub(mockEventCTX, EventTypeEvict.Topic(""), []byte("{}")))
+	s.Require().NoError(<-received)
+
+	// the listening goroutine exits even though the channel is never closed
+	closed := make(chan struct{})
+	go func() {
+		mb.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		s.Fail("listening goroutine not stopped")
+	}
+	s.Require().Empty(received)
+}
+
+func (s *eventSuite) TestListenStoppedByContext() {
+	pubsub := &stuckPubsub{messChan: make(chan Message)}
+	mb := newMessageBroker(mockEventUUID, pubsub, false, "")
+
+	ctx, cancel := context.WithCancel(mockEventCTX)
+	received := make(chan error, 1)
+	s.Require().NoError(mb.listen(ctx, []eventType{EventTypeEvict}, func(ctx context.Context, e *event, err error) {
+		received <- err
+	}))
+	cancel()
+
+	// the messages are drained without handling, so the pubsub sending isn't blocked
+	for i := 0; i < 3; i++ {
+		s.Require().NoError(pubsub.Pub(mockEventCTX, EventTypeEvict.Topic(""), []byte("{}")))
+	}
+	s.Require().Empty(received)
+
+	// draining stops on closing even though the channel is never closed
+	stopped := make(chan struct{})
+	go func() {
+		mb.close()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		s.Fail("draining goroutine not stopped")
+	}
 }
 
 // not stable sometimes, skip it now
@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 var (
-	// usedPrefixs records the prefixes registered before
-	usedPrefixs = map[string]struct{}{}
+	// activeRegistries records the registries having the registered prefixes, which are cleared by ClearPrefix().
+	// The registries are removed once their prefixes are released, so nothing is retained after the factories are closed.
+	activeRegistries    = map[*PrefixRegistry]struct{}{}
+	activeRegistriesMut sync.Mutex
 
 	// decoupling
 	uuidString = uuid.New().String
@@ -27,6 +32,10 @@ func newFactory(sharedCache Adapter, localCache Adapter, options ...FactoryOptio
 		panic(errors.New("both of Marshal and Unmarshal functions need to be specified"))
 	}
 
+	if o.opTimeout < 0 {
+		panic(errors.New("invalid operation timeout"))
+	}
+
 	var marshalFunc MarshalFunc
 	var unmarshalFunc UnmarshalFunc
 	marshalFunc = json.Marshal
@@ -39,22 +48,80 @@ func newFactory(sharedCache Adapter, localCache Adapter, options ...FactoryOptio
 		unmarshalFunc = o.unmarshalFunc
 	}
 
+	if (o.eventMarshal == nil) != (o.eventUnmarshal == nil) {
+		panic(errors.New("both of event marshal and unmarshal functions need to be specified"))
+	}
+	if o.eventMarshal != nil && o.compressEvent {
+		panic(errors.New("compressed events require the default event codec"))
+	}
+
+	if strings.Contains(o.keyVersion, regCacheDelim) {
+		panic(errors.New("key version containing the delimiter"))
+	}
+
+	keyTransformer := o.keyTransformer
+	if o.keyVersion != "" {
+		version, transform := o.keyVersion, o.keyTransformer
+		keyTransformer = func(ctx context.Context, cacheKey string) string {
+			vKey := versionCacheKey(cacheKey, version)
+			if transform == nil {
+				return vKey
+			}
+			return transform(ctx, vKey)
+		}
+	}
+
+	registry := o.prefixRegistry
+	if registry == nil {
+		registry = NewPrefixRegistry()
+	}
+
 	id := uuidString()
+	if o.factoryID != nil {
+		if *o.factoryID == "" {
+			panic(errors.New("empty factory id"))
+		}
+		id = *o.factoryID
+	}
 	f := &factory{
-		id:            id,
-		sharedCache:   sharedCache,
-		localCache:    localCache,
-		mb:            newMessageBroker(id, o.pubsub),
-		marshal:       marshalFunc,
-		unmarshal:     unmarshalFunc,
-		onCacheHit:    o.onCacheHit,
-		onCacheMiss:   o.onCacheMiss,
-		onLCCostAdd:   o.onLCCostAdd,
-		onLCCostEvict: o.onLCCostEvict,
+		id:                 id,
+		registry:           registry,
+		sharedCache:        sharedCache,
+		localCache:         localCache,
+		mb:                 newMessageBroker(id, o.pubsub, o.compressEvent, o.topicNamespace),
+		marshal:            marshalFunc,
+		unmarshal:          unmarshalFunc,
+		onCacheHit:         o.onCacheHit,
+		onCacheMiss:        o.onCacheMiss,
+		onLCCostAdd:        o.onLCCostAdd,
+		onLCCostEvict:      o.onLCCostEvict,
+		onEventError:       o.onEventError,
+		onMGetterFallback:  o.onMGetterFallback,
+		onStaleServe:       o.onStaleServe,
+		onBackgroundRefill: o.onBackgroundRefill,
+		pubsubRequired:     o.pubsubRequired,
+		opTimeout:          o.opTimeout,
+		timeoutPolicy:      o.timeoutPolicy,
+		refillPolicy:       o.refillPolicy,
+		onRefillError:      o.onRefillError,
+		pooledResults:      o.pooledResults,
+		localHitsOnError:   o.localHitsOnError,
+		maxMGetKeys:        o.maxMGetKeys,
+		oversizedPolicy:    o.oversizedPolicy,
+		getterPolicy:       o.getterPolicy,
+		unmarshalAsMiss:    o.unmarshalAsMiss,
+		onUnmarshalError:   o.onUnmarshalError,
+		logger:             loggerOrNop(o.logger),
+		keyTransformer:     keyTransformer,
+		keyVersion:         o.keyVersion,
+		background:         newBackgroundTasks(),
+	}
+	if o.eventMarshal != nil {
+		f.mb.marshal, f.mb.unmarshal = eventCodec(o.eventMarshal, o.eventUnmarshal)
 	}
 
 	// subscribing events
-	f.mb.listen(context.TODO(), []eventType{EventTypeEvict}, f.subscribedEventsHandler())
+	f.mb.listen(context.Background(), []eventType{EventTypeEvict}, f.subscribedEventsHandler())
 
 	return f
 }
@@ -64,70 +131,206 @@ type factory struct {
 	localCache  Adapter
 	mb          *messageBroker
 
-	marshal       MarshalFunc
-	unmarshal     UnmarshalFunc
-	onCacheHit    func(prefix string, key string, count int)
-	onCacheMiss   func(prefix string, key string, count int)
-	onLCCostAdd   func(prefix string, key string, cost int)
-	onLCCostEvict func(prefix string, key string, cost int)
+	marshal            MarshalFunc
+	unmarshal          UnmarshalFunc
+	onCacheHit         func(prefix string, key string, count int)
+	onCacheMiss        func(prefix string, key string, count int)
+	onLCCostAdd        func(prefix string, key string, cost int)
+	onLCCostEvict      func(prefix string, key string, cost int)
+	onEventError       func(err error)
+	onMGetterFallback  func(prefix string, served int, err error)
+	onStaleServe       func(ctx context.Context, prefix, key string, age time.Duration)
+	onBackgroundRefill func(ctx context.Context, prefix string, keys []string, err error)
+	pubsubRequired     bool
+	opTimeout          time.Duration
+	timeoutPolicy      TimeoutPolicy
+	refillPolicy       RefillFailurePolicy
+	onRefillError      func(err error)
+	pooledResults      bool
+	keyTransformer     func(ctx context.Context, cacheKey string) string
+	localHitsOnError   bool
+	maxMGetKeys        int
+	oversizedPolicy    OversizedMGetPolicy
+	getterPolicy       GetterFailurePolicy
+	unmarshalAsMiss    bool
+	onUnmarshalError   func(prefix string, key string, err error)
+	logger             Logger
+	keyVersion         string
 
 	id        string
+	registry  *PrefixRegistry
 	closeOnce sync.Once
+
+	writeBehinds []*writeBehind
+	wbMut        sync.Mutex
+	// background tracks the goroutines of the caches outliving the calls
+	background *backgroundTasks
+
+	onEvict    func(ctx context.Context, keys []string)
+	onEvictMut sync.RWMutex
+
+	// localAdapters are the local adapters overridden by the settings, which evict the keys broadcasted as well
+	localAdapters []Adapter
+	localMut      sync.RWMutex
 }
 
 func (f *factory) NewCache(settings []Setting) Cache {
 	m := map[string]*config{}
 	for _, setting := range settings {
-		// check prefix
-		if setting.Prefix == "" {
-			panic(errors.New("not allowed empty prefix"))
+		if err := validateSetting(setting); err != nil {
+			panic(err)
 		}
-		if _, ok := usedPrefixs[setting.Prefix]; ok {
+		if !f.registerPrefix(setting.Prefix) {
 			panic(errors.New("duplicated prefix"))
 		}
-		usedPrefixs[setting.Prefix] = struct{}{}
 
 		cfg := &config{
-			mGetter:   setting.MGetter,
-			marshal:   f.marshal,
-			unmarshal: f.unmarshal,
-		}
-
-		// need to specify marshalFunc and unmarshalFunc at the same time
-		if setting.MarshalFunc == nil && setting.UnmarshalFunc != nil {
-			panic(errors.New("both of Marshal and Unmarshal functions need to be specified"))
-		} else if setting.MarshalFunc != nil && setting.UnmarshalFunc == nil {
-			panic(errors.New("both of Marshal and Unmarshal functions need to be specified"))
+			prefix:             setting.Prefix,
+			mGetter:            setting.MGetter,
+			mGetterElemType:    setting.MGetterElemType,
+			mGetterIgnoreExtra: setting.MGetterIgnoreExtra,
+			mGetterFallbacks:   setting.MGetterFallbacks,
+			slidingTTL:         setting.SlidingTTL,
+			backfillShared:     setting.BackfillShared,
+			deterministicTTL:   setting.DeterministicTTL,
 		}
 
+		marshal, unmarshal := f.marshal, f.unmarshal
 		if setting.MarshalFunc != nil {
-			cfg.marshal = setting.MarshalFunc
+			marshal = setting.MarshalFunc
 		}
 		if setting.UnmarshalFunc != nil {
-			cfg.unmarshal = setting.UnmarshalFunc
+			unmarshal = setting.UnmarshalFunc
+		}
+
+		// the context-aware ones are preferred
+		cfg.marshal, cfg.unmarshal = withCtxMarshal(marshal), withCtxUnmarshal(unmarshal)
+		if setting.MarshalWithCtx != nil {
+			cfg.marshal, cfg.unmarshal = setting.MarshalWithCtx, setting.UnmarshalWithCtx
+		}
+		if len(setting.UnmarshalFallbacks) != 0 {
+			cfg.unmarshal = chainUnmarshal(cfg.unmarshal, setting.UnmarshalFallbacks...)
+		}
+
+		// the soft TTL is decided by the shared cache if it's used
+		softTTL := setting.CacheAttributes[LocalCacheType].SoftTTL
+		if attr, ok := setting.CacheAttributes[SharedCacheType]; ok {
+			softTTL = attr.SoftTTL
+		}
+
+		// wrap the values with the envelope if necessary, the version and the soft expiry share the same header
+		if setting.Version != 0 {
+			cfg.versioned = true
+			cfg.version = uint32(setting.Version)
+		}
+		if softTTL > 0 {
+			cfg.softTTL = softTTL
+			cfg.revalidating = map[string]bool{}
+			cfg.marshal, cfg.unmarshal = softTTLMarshaler(cfg.versioned, cfg.version, softTTL, cfg.marshal, cfg.unmarshal)
+		} else if cfg.versioned {
+			cfg.marshal, cfg.unmarshal = versionedMarshaler(cfg.version, cfg.marshal, cfg.unmarshal)
+		}
+
+		if setting.DistributedLock != nil {
+			lock := *setting.DistributedLock
+			if lock.PollInterval == 0 {
+				lock.PollInterval = defaultLockPollInterval
+			}
+			cfg.lock = &lock
+		}
+
+		if setting.CostFunc != nil {
+			costFunc := setting.CostFunc
+			cfg.localCost = func(cKey string, b []byte) int {
+				pfx, key := getPrefixAndKey(cKey)
+				return costFunc(pfx, key, b)
+			}
+		}
+
+		// the adapters of the setting override the ones of the factory
+		shared, local := f.sharedCache, f.localCache
+		if setting.SharedAdapter != nil {
+			shared = setting.SharedAdapter
+		}
+		if setting.LocalAdapter != nil {
+			local = setting.LocalAdapter
 		}
 
 		for typ, attr := range setting.CacheAttributes {
 			if typ == SharedCacheType {
-				cfg.shared = f.sharedCache
+				cfg.shared = shared
 				cfg.sharedTTL = attr.TTL
 			} else if typ == LocalCacheType {
-				cfg.local = f.localCache
+				cfg.local = local
 				cfg.localTTL = attr.TTL
 			}
 		}
 
-		// need to indicate at least one cache type
+		// need to indicate at least one cache type, the adapters of the factory may be nil
 		if cfg.shared == nil && cfg.local == nil {
 			panic(errors.New("no cache type indicated"))
 		}
 
+		cfg.tombstoneTTL = setting.DeleteTombstoneTTL
+		if setting.CoalesceWindow > 0 {
+			cfg.coalescer = newCoalescer(setting.CoalesceWindow)
+		}
+		if setting.GetterErrorTTL > 0 {
+			cfg.breaker = newGetterBreaker(setting.GetterErrorTTL)
+		}
+		if setting.SlidingTTL && cfg.shared != nil {
+			cfg.touches = newTouchDebouncer(cfg.sharedTTL / slidingTTLFraction)
+		}
+
+		if f.pubsubRequired && cfg.shared != nil && cfg.local != nil && !f.mb.registered() {
+			panic(errors.New("pubsub required by multi-layer cache"))
+		}
+		// the overriding local adapter relies on the evictions broadcasted by the pubsub of the factory
+		if setting.LocalAdapter != nil && cfg.shared != nil {
+			if !f.mb.registered() {
+				panic(errors.New("pubsub required by local adapter override"))
+			}
+			f.addLocalAdapter(setting.LocalAdapter)
+		}
+
 		m[setting.Prefix] = cfg
 	}
 
-	return &cache{
-		configs: m,
-		mb:      f.mb,
+	c := &cache{
+		configs:          m,
+		mb:               f.mb,
+		opTimeout:        f.opTimeout,
+		timeoutPolicy:    f.timeoutPolicy,
+		refillPolicy:     f.refillPolicy,
+		onRefillError:    f.onRefillError,
+		pooledResults:    f.pooledResults,
+		localHitsOnError: f.localHitsOnError,
+		maxMGetKeys:      f.maxMGetKeys,
+		oversizedPolicy:  f.oversizedPolicy,
+		getterPolicy:     f.getterPolicy,
+		unmarshalAsMiss:  f.unmarshalAsMiss,
+		onUnmarshalError: f.onUnmarshalError,
+		logger:           f.logger,
+		keyTransformer:   f.keyTransformer,
+		background:       f.background,
+		onMGetterFallback: func(prefix string, served int, err error) {
+			// trigger the callback on falling back to MGetterFallbacks if necessary
+			if f.onMGetterFallback != nil {
+				f.onMGetterFallback(prefix, served, err)
+			}
+		},
+		onStaleServe: func(ctx context.Context, prefix, key string, age time.Duration) {
+			// trigger the callback on serving the stale value if necessary
+			if f.onStaleServe != nil {
+				f.onStaleServe(ctx, prefix, key, age)
+			}
+		},
+		onBackgroundRefill: func(ctx context.Context, prefix string, keys []string, err error) {
+			// trigger the callback on revalidating the stale values if necessary
+			if f.onBackgroundRefill != nil {
+				f.onBackgroundRefill(ctx, prefix, keys, err)
+			}
+		},
 		onCacheHit: func(prefix string, key string, count int) {
 			// trigger the callback on cache hitted if necessary
 			if f.onCacheHit != nil {
@@ -155,11 +358,278 @@ func (f *factory) NewCache(settings []Setting) Cache {
 			}
 		},
 	}
+
+	// start the write-behind flushers, which are closed along with the factory
+	for _, setting := range settings {
+		if setting.WriteBehind == nil {
+			continue
+		}
+
+		size := setting.WriteBehind.BufferSize
+		if size == 0 {
+			size = defaultWriteBehindBufferSize
+		}
+
+		timeout := f.opTimeout
+		if timeout == 0 {
+			timeout = defaultWriteBehindTimeout
+		}
+
+		cfg := m[setting.Prefix]
+		cfg.writeBehind = newWriteBehind(cfg.shared, cfg.sharedTTL, setting.WriteBehind.Interval, timeout, size,
+			func(ctx context.Context, keys []string) {
+				// other nodes are able to load the new values after flushing
+				if cfg.local != nil {
+					// the pending writes are keyed by the transformed keys already
+					c.evictRemoteAdapterKeys(ctx, keys...)
+				}
+			},
+			func(ctx context.Context, err error, dropped int) {
+				c.logger.Warn("cache: flushing the write-behind writes failed",
+					"prefix", cfg.prefix, "dropped", dropped, "err", err)
+			},
+		)
+
+		f.wbMut.Lock()
+		f.writeBehinds = append(f.writeBehinds, cfg.writeBehind)
+		f.wbMut.Unlock()
+	}
+
+	return c
+}
+
+// ValidateSettings checks the settings as Factory.NewCache() does, and returns the first error instead of panicking.
+// It has no side effects, i.e. no prefixes are registered, so it suits validating the configurations in CI.
+// The prefixes are checked for duplicates within the settings only, since no factory is involved.
+func ValidateSettings(settings []Setting) error {
+	prefixes := map[string]bool{}
+	for _, setting := range settings {
+		if err := validateSetting(setting); err != nil {
+			return err
+		}
+
+		if prefixes[setting.Prefix] {
+			return errors.New("duplicated prefix")
+		}
+		prefixes[setting.Prefix] = true
+	}
+
+	return nil
+}
+
+// validateSetting checks the setting regardless of the factory.
+func validateSetting(setting Setting) error {
+	// check prefix
+	if setting.Prefix == "" {
+		return errors.New("not allowed empty prefix")
+	}
+
+	// need to specify marshalFunc and unmarshalFunc at the same time
+	if (setting.MarshalFunc == nil) != (setting.UnmarshalFunc == nil) {
+		return errors.New("both of Marshal and Unmarshal functions need to be specified")
+	}
+	if (setting.MarshalWithCtx == nil) != (setting.UnmarshalWithCtx == nil) {
+		return errors.New("both of Marshal and Unmarshal functions need to be specified")
+	}
+
+	if !isValidVersion(setting.Version) {
+		return errors.New("invalid version")
+	}
+
+	if lock := setting.DistributedLock; lock != nil {
+		if lock.TTL <= 0 || lock.Timeout <= 0 || lock.PollInterval < 0 {
+			return errors.New("invalid distributed lock")
+		}
+	}
+
+	_, shared := setting.CacheAttributes[SharedCacheType]
+	_, local := setting.CacheAttributes[LocalCacheType]
+	// need to indicate at least one cache type
+	if !shared && !local {
+		return errors.New("no cache type indicated")
+	}
+
+	for typ, attr := range setting.CacheAttributes {
+		if attr.SoftTTL < 0 || (attr.SoftTTL > attr.TTL && attr.TTL > 0) {
+			return errors.New("invalid soft ttl")
+		}
+		// the soft expiry is stamped once for both caches
+		if typ == LocalCacheType && attr.SoftTTL > 0 && shared {
+			return errors.New("soft ttl of multi-layer cache decided by shared cache")
+		}
+	}
+
+	if setting.WriteBehind != nil {
+		if setting.WriteBehind.Interval <= 0 || setting.WriteBehind.BufferSize < 0 {
+			return errors.New("invalid write-behind")
+		}
+		if !shared {
+			return errors.New("write-behind requires shared cache")
+		}
+	}
+
+	if setting.DeleteTombstoneTTL < 0 {
+		return errors.New("invalid delete tombstone ttl")
+	}
+	if setting.DeleteTombstoneTTL > 0 && !shared {
+		return errors.New("delete tombstone requires shared cache")
+	}
+
+	if setting.CoalesceWindow < 0 {
+		return errors.New("invalid coalesce window")
+	}
+
+	if setting.SharedAdapter != nil && !shared {
+		return errors.New("shared adapter requires shared cache type")
+	}
+	if setting.LocalAdapter != nil && !local {
+		return errors.New("local adapter requires local cache type")
+	}
+
+	if setting.GetterErrorTTL < 0 {
+		return errors.New("invalid getter error ttl")
+	}
+
+	return nil
+}
+
+func (f *factory) NewResultBuffer() Result {
+	return &result{}
+}
+
+func (f *factory) ClearPrefix() {
+	f.registry.release(f)
+}
+
+func (f *factory) OnEvict(fn func(ctx context.Context, keys []string)) {
+	f.onEvictMut.Lock()
+	defer f.onEvictMut.Unlock()
+
+	f.onEvict = fn
+}
+
+func (f *factory) PubSubEnabled() bool {
+	return f.mb.registered()
+}
+
+func (f *factory) Ping(ctx context.Context) error {
+	tiers := []struct {
+		typ Type
+		adp Adapter
+	}{
+		{typ: SharedCacheType, adp: f.sharedCache},
+		{typ: LocalCacheType, adp: f.localCache},
+	}
+
+	var errs MultiError
+	for _, tier := range tiers {
+		checker, ok := tier.adp.(HealthChecker)
+		if !ok {
+			continue
+		}
+
+		if err := checker.Ping(ctx); err != nil {
+			errs = append(errs, &PingError{Tier: tier.typ, Err: err})
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// registerPrefix records the prefix owned by the factory in its registry, and reports false if it's registered
+// before by any factory sharing the registry.
+func (f *factory) registerPrefix(prefix string) bool {
+	return f.registry.register(prefix, f)
+}
+
+// PrefixRegistry is the scope where the prefixes are unique, which is given to the factories by WithPrefixRegistry().
+// The factories sharing the registry agree that a prefix is taken by one of them, e.g. the plugins sharing
+// the same backends, and the ones with distinct registries are independent. The prefixes are released when
+// the factory owning them is closed.
+type PrefixRegistry struct {
+	mut sync.Mutex
+	// owners maps the registered prefixes to the factories owning them
+	owners map[string]*factory
+}
+
+// NewPrefixRegistry generates the empty PrefixRegistry.
+func NewPrefixRegistry() *PrefixRegistry {
+	return &PrefixRegistry{}
+}
+
+// register records the prefix owned by the factory, and reports false if it's registered before.
+func (r *PrefixRegistry) register(prefix string, f *factory) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, ok := r.owners[prefix]; ok {
+		return false
+	}
+
+	if len(r.owners) == 0 {
+		r.owners = map[string]*factory{}
+		activeRegistriesMut.Lock()
+		activeRegistries[r] = struct{}{}
+		activeRegistriesMut.Unlock()
+	}
+	r.owners[prefix] = f
+
+	return true
+}
+
+// release unregisters the prefixes owned by the factory.
+func (r *PrefixRegistry) release(f *factory) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for prefix, owner := range r.owners {
+		if owner == f {
+			delete(r.owners, prefix)
+		}
+	}
+	r.deactivate()
+}
+
+// clear unregisters all prefixes.
+func (r *PrefixRegistry) clear() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.owners = nil
+	r.deactivate()
+}
+
+// deactivate stops tracking the registry without the registered prefixes. It must be called with the lock held.
+func (r *PrefixRegistry) deactivate() {
+	if len(r.owners) != 0 {
+		return
+	}
+
+	activeRegistriesMut.Lock()
+	delete(activeRegistries, r)
+	activeRegistriesMut.Unlock()
 }
 
 func (f *factory) Close() {
 	f.closeOnce.Do(func() {
+		// stop the revalidations first, which write the caches and broadcast the evictions
+		f.background.close()
+
+		// flush the pending writes before closing the pubsub, which broadcasts the evictions
+		f.wbMut.Lock()
+		for _, wb := range f.writeBehinds {
+			wb.close()
+		}
+		f.wbMut.Unlock()
+
 		f.mb.close()
+
+		// the prefixes are available for other factories sharing the registry
+		f.ClearPrefix()
 	})
 }
 
@@ -169,17 +639,146 @@ func (f *factory) subscribedEventsHandler() func(ctx context.Context, e *event,
 			// do nothing
 			return
 		} else if err != nil {
-			// TODO: forward error messages outside
+			f.eventError(err)
 			return
 		}
 
 		switch e.Type {
 		case EventTypeEvict:
 			keys := e.Body.Keys
-			if f.localCache != nil && len(keys) > 0 {
-				// evict local caches
-				f.localCache.Del(ctx, keys...)
+			for _, local := range f.locals() {
+				if len(keys) > 0 {
+					// evict local caches
+					local.Del(ctx, keys...)
+				}
+
+				if clearer, ok := local.(Clearer); ok {
+					for _, keyPrefix := range e.Body.KeyPrefixes {
+						clearer.Clear(ctx, keyPrefix)
+					}
+				}
 			}
+
+			f.evicted(ctx, e.Body)
+		default:
+			f.eventError(fmt.Errorf("%w: %s", ErrUnknownEvent, e.Type))
+		}
+	}
+}
+
+// addLocalAdapter records the local adapter overridden by the setting unless it's recorded already.
+func (f *factory) addLocalAdapter(adp Adapter) {
+	f.localMut.Lock()
+	defer f.localMut.Unlock()
+
+	if adp == f.localCache {
+		return
+	}
+	for _, local := range f.localAdapters {
+		if local == adp {
+			return
 		}
 	}
+
+	f.localAdapters = append(f.localAdapters, adp)
+}
+
+// locals returns the local adapters evicting the keys broadcasted, i.e. the one of the factory and the overridden ones.
+func (f *factory) locals() []Adapter {
+	f.localMut.RLock()
+	defer f.localMut.RUnlock()
+
+	locals := make([]Adapter, 0, len(f.localAdapters)+1)
+	if f.localCache != nil {
+		locals = append(locals, f.localCache)
+	}
+
+	return append(locals, f.localAdapters...)
+}
+
+// evicted notifies the callback registered by OnEvict() of the evicted keys if necessary.
+// The transformed keys are given by their untransformed ones, and skipped if they're unknown.
+func (f *factory) evicted(ctx context.Context, body eventBody) {
+	f.onEvictMut.RLock()
+	onEvict := f.onEvict
+	f.onEvictMut.RUnlock()
+
+	if onEvict == nil || len(body.Keys) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(body.Keys))
+	if len(body.Names) == len(body.Keys) {
+		for _, name := range body.Names {
+			if name == "" {
+				continue
+			}
+
+			_, key := getPrefixAndKey(name)
+			keys = append(keys, key)
+		}
+	} else {
+		for _, ck := range body.Keys {
+			_, key := getPrefixAndKey(unversionCacheKey(ck, f.keyVersion))
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	onEvict(ctx, keys)
+}
+
+// eventError forwards the error of handling the subscribed events if necessary.
+func (f *factory) eventError(err error) {
+	f.logger.Error("cache: handling the subscribed event failed", "err", err)
+	if f.onEventError != nil {
+		f.onEventError(err)
+	}
+}
+
+// backgroundTasks tracks the goroutines outliving the calls, which are canceled and waited on closing.
+type backgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mut    sync.Mutex
+	closed bool
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundTasks{ctx: ctx, cancel: cancel}
+}
+
+// start runs the function in the goroutine with the context canceled on closing, and reports whether it's started.
+// Nothing is started once it's closed.
+func (b *backgroundTasks) start(f func(ctx context.Context)) bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		f(b.ctx)
+	}()
+
+	return true
+}
+
+// close cancels the running goroutines, and waits for them.
+func (b *backgroundTasks) close() {
+	b.mut.Lock()
+	b.closed = true
+	b.mut.Unlock()
+
+	b.cancel()
+	b.wg.Wait()
 }
@@ -6,6 +6,8 @@ import (
 	"encoding/xml"
 	"errors"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -80,6 +82,111 @@ func (s *factorySuite) TestNewFactoryWithOnlyUnmarshal() {
 	NewFactory(s.rds, s.lfu, WithUnmarshalFunc(json.Unmarshal))
 }
 
+func (s *factorySuite) TestNewFactoryWithInvalidOperationTimeout() {
+	s.Require().PanicsWithError("invalid operation timeout", func() {
+		NewFactory(s.rds, s.lfu, WithOperationTimeout(-time.Second))
+	})
+}
+
+func (s *factorySuite) TestNewFactoryWithFactoryID() {
+	f := NewFactory(s.rds, s.lfu, WithFactoryID("node-1")).(*factory)
+	defer f.Close()
+	s.Require().Equal("node-1", f.id)
+	s.Require().Equal("node-1", f.mb.fid)
+
+	s.Require().PanicsWithError("empty factory id", func() {
+		NewFactory(s.rds, s.lfu, WithFactoryID(""))
+	})
+}
+
+func (s *factorySuite) TestPubSubEnabled() {
+	f := NewFactory(s.rds, s.lfu, WithPubSubRequired())
+	defer f.Close()
+	s.Require().False(f.PubSubEnabled())
+
+	// single layer is fine
+	f.NewCache([]Setting{
+		{
+			Prefix:          "sharedOnly",
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+		},
+	})
+	s.Require().PanicsWithError("pubsub required by multi-layer cache", func() {
+		f.NewCache([]Setting{
+			{
+				Prefix: "multiLayer",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+					LocalCacheType:  {TTL: time.Minute},
+				},
+			},
+		})
+	})
+	f.ClearPrefix()
+
+	f2 := NewFactory(s.rds, s.lfu, WithPubSub(s.rds), WithPubSubRequired())
+	defer f2.Close()
+	s.Require().True(f2.PubSubEnabled())
+	f2.NewCache([]Setting{
+		{
+			Prefix: "multiLayer",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+	f2.ClearPrefix()
+}
+
+type unhealthyAdapter struct {
+	Adapter
+}
+
+func (adp *unhealthyAdapter) Ping(ctx context.Context) error {
+	return errors.New("unreachable")
+}
+
+func (s *factorySuite) TestPing() {
+	s.Require().NoError(s.factory.Ping(mockFactoryCTX))
+
+	f := NewFactory(&unhealthyAdapter{Adapter: s.rds}, &unhealthyAdapter{Adapter: s.lfu})
+	defer f.Close()
+
+	err := f.Ping(mockFactoryCTX)
+	s.Require().EqualError(err, "cache: ping shared cache: unreachable; cache: ping local cache: unreachable")
+	var errs MultiError
+	s.Require().True(errors.As(err, &errs))
+	s.Require().Len(errs, 2)
+	var pingErr *PingError
+	s.Require().True(errors.As(errs[1], &pingErr))
+	s.Require().Equal(LocalCacheType, pingErr.Tier)
+
+	// the collected errors are inspected directly
+	s.Require().True(errors.As(err, &pingErr))
+	s.Require().Equal(SharedCacheType, pingErr.Tier)
+	s.Require().True(errors.Is(err, errs[1]))
+
+	// the local-only factory
+	f2 := NewFactory(nil, s.lfu)
+	defer f2.Close()
+	s.Require().NoError(f2.Ping(mockFactoryCTX))
+}
+
+func (s *factorySuite) TestNewCacheWithOnlyMarshalWithCtx() {
+	s.Require().PanicsWithError("both of Marshal and Unmarshal functions need to be specified", func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix:          "onlyMarshalWithCtx",
+				CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+				MarshalWithCtx: func(ctx context.Context, value interface{}) ([]byte, error) {
+					return nil, nil
+				},
+			},
+		})
+	})
+}
+
 func (s *factorySuite) TestNewFactoryWithBoth() {
 	f := NewFactory(s.rds, s.lfu, WithMarshalFunc(xml.Marshal), WithUnmarshalFunc(xml.Unmarshal)).(*factory)
 	s.Require().True(reflect.ValueOf(xml.Marshal).Pointer() == reflect.ValueOf(f.marshal).Pointer())
@@ -109,7 +216,7 @@ func (s *factorySuite) TestNewFactoryWithCacheHitAndMiss() {
 	c := f.NewCache([]Setting{
 		{
 			Prefix:          mockFactPfx,
-			CacheAttributes: map[Type]Attribute{SharedCacheType: {time.Hour}},
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
 		},
 	})
 
@@ -156,8 +263,8 @@ func (s *factorySuite) TestNewFactoryWithCostAddAndEvict() {
 		{
 			Prefix: mockFactPfx,
 			CacheAttributes: map[Type]Attribute{
-				SharedCacheType: {time.Hour},
-				LocalCacheType:  {10 * time.Second},
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
 			},
 			MarshalFunc:   json.Marshal,
 			UnmarshalFunc: json.Unmarshal,
@@ -181,6 +288,39 @@ func (s *factorySuite) TestNewFactoryWithCostAddAndEvict() {
 	s.Require().Equal(len(bs), costEvict, stage)
 }
 
+func (s *factorySuite) TestNewCacheWithCostFunc() {
+	costAdd := 0
+	costEvict := 0
+
+	f := NewFactory(s.rds, s.lfu,
+		OnLocalCacheCostAddFunc(func(prefix, key string, cost int) { costAdd += cost }),
+		OnLocalCacheCostEvictFunc(func(prefix, key string, cost int) { costEvict += cost }),
+	)
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: mockFactPfx,
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: 10 * time.Second},
+			},
+			CostFunc: func(prefix, key string, value []byte) int {
+				s.Require().Equal(mockFactPfx, prefix)
+				s.Require().Equal(mockFactKey, key)
+				return 1000
+			},
+		},
+	})
+
+	s.Require().NoError(c.Set(mockFactoryCTX, mockFactPfx, mockFactKey, 100))
+	s.Require().Equal(1000, costAdd)
+	s.Require().Equal(0, costEvict)
+
+	s.Require().NoError(c.Del(mockFactoryCTX, mockFactPfx, mockFactKey))
+	s.Require().Equal(1000, costAdd)
+	s.Require().Equal(1000, costEvict)
+}
+
 func (s *factorySuite) TestNewCacheWithoutCacheType() {
 	defer func() {
 		r := recover()
@@ -190,6 +330,42 @@ func (s *factorySuite) TestNewCacheWithoutCacheType() {
 	s.factory.NewCache([]Setting{{Prefix: "noCacheType"}})
 }
 
+func (s *factorySuite) TestNewCacheWithInvalidDistributedLock() {
+	defer func() {
+		r := recover()
+		s.Require().NotNil(r)
+		s.Require().Equal(errors.New("invalid distributed lock"), r)
+	}()
+	s.factory.NewCache([]Setting{
+		{
+			Prefix:          "invalidLock",
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+			DistributedLock: &DistributedLock{TTL: time.Second},
+		},
+	})
+}
+
+func (s *factorySuite) TestNewCacheWithInvalidWriteBehind() {
+	s.Require().PanicsWithError("invalid write-behind", func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix:          "invalidWriteBehind",
+				CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
+				WriteBehind:     &WriteBehind{},
+			},
+		})
+	})
+	s.Require().PanicsWithError("write-behind requires shared cache", func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix:          "localWriteBehind",
+				CacheAttributes: map[Type]Attribute{LocalCacheType: {TTL: time.Hour}},
+				WriteBehind:     &WriteBehind{Interval: time.Second},
+			},
+		})
+	})
+}
+
 func (s *factorySuite) TestNewCacheWithEmptyPrefix() {
 	defer func() {
 		r := recover()
@@ -208,15 +384,352 @@ func (s *factorySuite) TestNewCacheWithDuplicatedPrefix() {
 	s.factory.NewCache([]Setting{
 		{
 			Prefix:          "exist",
-			CacheAttributes: map[Type]Attribute{SharedCacheType: {time.Hour}},
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
 		},
 		{
 			Prefix:          "exist",
-			CacheAttributes: map[Type]Attribute{SharedCacheType: {time.Second}},
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Second}},
 		},
 	})
 }
 
+func (s *factorySuite) TestClearPrefix() {
+	registry := NewPrefixRegistry()
+	mine := NewFactory(s.rds, s.lfu, WithPrefixRegistry(registry))
+	defer mine.Close()
+	another := NewFactory(s.rds, s.lfu, WithPrefixRegistry(registry))
+	defer another.Close()
+
+	mine.NewCache([]Setting{{Prefix: "mine", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+	another.NewCache([]Setting{{Prefix: "others", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+
+	// only the prefixes registered by the factory are cleared
+	mine.ClearPrefix()
+	s.Require().NotPanics(func() {
+		mine.NewCache([]Setting{{Prefix: "mine", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+	})
+	s.Require().PanicsWithError("duplicated prefix", func() {
+		mine.NewCache([]Setting{{Prefix: "others", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+	})
+
+	// safe for concurrent use
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			f := NewFactory(s.rds, s.lfu)
+			defer f.Close()
+
+			f.NewCache([]Setting{{Prefix: "concurrent-" + strconv.Itoa(i), CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+			f.ClearPrefix()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (s *factorySuite) TestClearPrefixOnClose() {
+	registry := NewPrefixRegistry()
+	closed := NewFactory(s.rds, s.lfu, WithPrefixRegistry(registry))
+	closed.NewCache([]Setting{{Prefix: "closed", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+	closed.Close()
+
+	// the prefixes of the closed factory are released, and the registry isn't retained
+	activeRegistriesMut.Lock()
+	s.Require().NotContains(activeRegistries, registry)
+	activeRegistriesMut.Unlock()
+
+	f := NewFactory(s.rds, s.lfu, WithPrefixRegistry(registry))
+	defer f.Close()
+	s.Require().NotPanics(func() {
+		f.NewCache([]Setting{{Prefix: "closed", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}})
+	})
+}
+
+func (s *factorySuite) TestPrefixRegistry() {
+	registry := NewPrefixRegistry()
+	f1 := NewFactory(s.rds, s.lfu, WithPrefixRegistry(registry))
+	defer f1.Close()
+	f2 := NewFactory(s.rds, s.lfu, WithPrefixRegistry(registry))
+	defer f2.Close()
+	independent := NewFactory(s.rds, s.lfu)
+	defer independent.Close()
+
+	settings := []Setting{{Prefix: "plugin", CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}}}
+	f1.NewCache(settings)
+
+	// the factories sharing the registry agree that the prefix is taken
+	s.Require().PanicsWithError("duplicated prefix", func() {
+		f2.NewCache(settings)
+	})
+
+	// the ones with distinct registries are independent, including the default ones
+	s.Require().NotPanics(func() {
+		independent.NewCache(settings)
+		s.factory.NewCache(settings)
+	})
+	f3 := NewFactory(s.rds, s.lfu, WithPrefixRegistry(NewPrefixRegistry()))
+	defer f3.Close()
+	s.Require().NotPanics(func() {
+		f3.NewCache(settings)
+	})
+}
+
+func (s *factorySuite) TestValidateSettings() {
+	shared := map[Type]Attribute{SharedCacheType: {TTL: time.Hour}}
+	local := map[Type]Attribute{LocalCacheType: {TTL: time.Hour}}
+
+	tests := []struct {
+		Desc     string
+		Settings []Setting
+		ExpErr   string
+	}{
+		{
+			Desc:     "valid",
+			Settings: []Setting{{Prefix: "valid", CacheAttributes: shared}, {Prefix: "valid-local", CacheAttributes: local}},
+		},
+		{
+			Desc:     "empty prefix",
+			Settings: []Setting{{Prefix: "", CacheAttributes: shared}},
+			ExpErr:   "not allowed empty prefix",
+		},
+		{
+			Desc:     "duplicated prefix",
+			Settings: []Setting{{Prefix: "dup", CacheAttributes: shared}, {Prefix: "dup", CacheAttributes: local}},
+			ExpErr:   "duplicated prefix",
+		},
+		{
+			Desc:     "only marshal",
+			Settings: []Setting{{Prefix: "marshal", CacheAttributes: shared, MarshalFunc: json.Marshal}},
+			ExpErr:   "both of Marshal and Unmarshal functions need to be specified",
+		},
+		{
+			Desc:     "invalid version",
+			Settings: []Setting{{Prefix: "version", CacheAttributes: shared, Version: -1}},
+			ExpErr:   "invalid version",
+		},
+		{
+			Desc:     "invalid distributed lock",
+			Settings: []Setting{{Prefix: "lock", CacheAttributes: shared, DistributedLock: &DistributedLock{TTL: time.Second}}},
+			ExpErr:   "invalid distributed lock",
+		},
+		{
+			Desc:     "no cache type",
+			Settings: []Setting{{Prefix: "noType"}},
+			ExpErr:   "no cache type indicated",
+		},
+		{
+			Desc:     "write-behind without shared cache",
+			Settings: []Setting{{Prefix: "wb", CacheAttributes: local, WriteBehind: &WriteBehind{Interval: time.Second}}},
+			ExpErr:   "write-behind requires shared cache",
+		},
+		{
+			Desc:     "tombstone without shared cache",
+			Settings: []Setting{{Prefix: "tombstone", CacheAttributes: local, DeleteTombstoneTTL: time.Second}},
+			ExpErr:   "delete tombstone requires shared cache",
+		},
+		{
+			Desc:     "invalid coalesce window",
+			Settings: []Setting{{Prefix: "coalesce", CacheAttributes: shared, CoalesceWindow: -time.Second}},
+			ExpErr:   "invalid coalesce window",
+		},
+		{
+			Desc:     "shared adapter without shared cache",
+			Settings: []Setting{{Prefix: "shared-adapter", CacheAttributes: local, SharedAdapter: NewTinyLFU(10)}},
+			ExpErr:   "shared adapter requires shared cache type",
+		},
+		{
+			Desc:     "local adapter without local cache",
+			Settings: []Setting{{Prefix: "local-adapter", CacheAttributes: shared, LocalAdapter: NewTinyLFU(10)}},
+			ExpErr:   "local adapter requires local cache type",
+		},
+		{
+			Desc:     "invalid getter error ttl",
+			Settings: []Setting{{Prefix: "breaker", CacheAttributes: shared, GetterErrorTTL: -time.Second}},
+			ExpErr:   "invalid getter error ttl",
+		},
+		{
+			Desc: "invalid soft ttl",
+			Settings: []Setting{{Prefix: "soft-ttl", CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Minute, SoftTTL: time.Hour},
+			}}},
+			ExpErr: "invalid soft ttl",
+		},
+		{
+			Desc: "soft ttl on local of multi-layer cache",
+			Settings: []Setting{{Prefix: "soft-ttl", CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour, SoftTTL: time.Minute},
+			}}},
+			ExpErr: "soft ttl of multi-layer cache decided by shared cache",
+		},
+		{
+			Desc:     "first error returned",
+			Settings: []Setting{{Prefix: "first", CacheAttributes: shared, Version: -1}, {Prefix: ""}},
+			ExpErr:   "invalid version",
+		},
+	}
+
+	for _, t := range tests {
+		err := ValidateSettings(t.Settings)
+		if t.ExpErr == "" {
+			s.Require().NoError(err, t.Desc)
+			continue
+		}
+		s.Require().Equal(errors.New(t.ExpErr), err, t.Desc)
+	}
+
+	// no prefixes registered
+	s.Require().NotPanics(func() {
+		s.factory.NewCache([]Setting{{Prefix: "valid", CacheAttributes: shared}})
+	})
+	// registered prefixes are not involved
+	s.Require().NoError(ValidateSettings([]Setting{{Prefix: "valid", CacheAttributes: shared}}))
+}
+
+func (s *factorySuite) TestSettingGroup() {
+	mGetter := func(keys ...string) (interface{}, error) {
+		return keys, nil
+	}
+	group := SettingGroup{
+		Base: Setting{
+			Prefix: "ignored",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+			MarshalFunc:   json.Marshal,
+			UnmarshalFunc: json.Unmarshal,
+			MGetter:       mGetter,
+			SlidingTTL:    true,
+		},
+		Children: []Setting{
+			{Prefix: "group-a"},
+			{
+				Prefix:          "group-b",
+				CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Second}},
+				MarshalFunc:     xml.Marshal,
+			},
+		},
+	}
+
+	settings := group.Settings()
+	s.Require().Len(settings, 2)
+
+	// inherited from Base
+	s.Require().Equal("group-a", settings[0].Prefix)
+	s.Require().Equal(group.Base.CacheAttributes, settings[0].CacheAttributes)
+	s.Require().Equal(reflect.ValueOf(json.Marshal).Pointer(), reflect.ValueOf(settings[0].MarshalFunc).Pointer())
+	s.Require().Equal(reflect.ValueOf(json.Unmarshal).Pointer(), reflect.ValueOf(settings[0].UnmarshalFunc).Pointer())
+	s.Require().NotNil(settings[0].MGetter)
+	s.Require().True(settings[0].SlidingTTL)
+
+	// overridden by the child, and the codec is taken in pairs
+	s.Require().Equal("group-b", settings[1].Prefix)
+	s.Require().Equal(map[Type]Attribute{SharedCacheType: {TTL: time.Second}}, settings[1].CacheAttributes)
+	s.Require().Equal(reflect.ValueOf(xml.Marshal).Pointer(), reflect.ValueOf(settings[1].MarshalFunc).Pointer())
+	s.Require().Nil(settings[1].UnmarshalFunc)
+	s.Require().NotNil(settings[1].MGetter)
+	s.Require().EqualError(ValidateSettings(settings), "both of Marshal and Unmarshal functions need to be specified")
+
+	// the expanded settings work with NewCache
+	group.Children[1].UnmarshalFunc = xml.Unmarshal
+	c := s.factory.NewCache(group.Settings())
+	s.Require().Len(c.Prefixes(), 2)
+
+	var str string
+	s.Require().NoError(c.Get(mockFactoryCTX, "group-a", "key", &str))
+	s.Require().Equal("key", str)
+	s.Require().NoError(c.Get(mockFactoryCTX, "group-b", "key", &str))
+	s.Require().Equal("key", str)
+}
+
+func (s *factorySuite) TestNewCacheWithAdapterOverrides() {
+	f := NewFactory(s.rds, s.lfu, WithPubSub(&countingPubsub{messChan: make(chan Message)})).(*factory)
+	defer f.Close()
+
+	shared, local := NewTinyLFU(10000), NewTinyLFU(10000)
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "default-adapters",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+		{
+			Prefix: "override-adapters",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+			SharedAdapter: shared,
+			LocalAdapter:  local,
+		},
+	})
+
+	s.Require().NoError(c.Set(mockFactoryCTX, "default-adapters", "key", "v1"))
+	s.Require().NoError(c.Set(mockFactoryCTX, "override-adapters", "key", "v2"))
+
+	defaultKey, overrideKey := getCacheKey("default-adapters", "key"), getCacheKey("override-adapters", "key")
+	for _, adp := range []Adapter{s.rds, s.lfu} {
+		vals, err := adp.MGet(mockFactoryCTX, []string{defaultKey, overrideKey})
+		s.Require().NoError(err)
+		s.Require().True(vals[0].Valid)
+		s.Require().False(vals[1].Valid)
+	}
+	for _, adp := range []Adapter{shared, local} {
+		vals, err := adp.MGet(mockFactoryCTX, []string{defaultKey, overrideKey})
+		s.Require().NoError(err)
+		s.Require().False(vals[0].Valid)
+		s.Require().True(vals[1].Valid)
+	}
+
+	// the evictions broadcasted by other nodes apply to the overriding local adapter as well
+	f.subscribedEventsHandler()(mockFactoryCTX, &event{
+		Type: EventTypeEvict,
+		Body: eventBody{Keys: []string{defaultKey, overrideKey}},
+	}, nil)
+	for _, adp := range []Adapter{s.lfu, local} {
+		vals, err := adp.MGet(mockFactoryCTX, []string{defaultKey, overrideKey})
+		s.Require().NoError(err)
+		s.Require().Equal([]Value{{}, {}}, vals)
+	}
+
+	var str string
+	s.Require().NoError(c.Get(mockFactoryCTX, "override-adapters", "key", &str))
+	s.Require().Equal("v2", str)
+}
+
+func (s *factorySuite) TestNewCacheWithLocalAdapterOverrideWithoutPubSub() {
+	s.Require().PanicsWithError("pubsub required by local adapter override", func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix: "override-without-pubsub",
+				CacheAttributes: map[Type]Attribute{
+					SharedCacheType: {TTL: time.Hour},
+					LocalCacheType:  {TTL: time.Hour},
+				},
+				LocalAdapter: NewTinyLFU(10000),
+			},
+		})
+	})
+
+	// no evictions are broadcasted without the shared cache
+	s.Require().NotPanics(func() {
+		s.factory.NewCache([]Setting{
+			{
+				Prefix: "override-local-only",
+				CacheAttributes: map[Type]Attribute{
+					LocalCacheType: {TTL: time.Hour},
+				},
+				LocalAdapter: NewTinyLFU(10000),
+			},
+		})
+	})
+}
+
 func (s *factorySuite) TestNewCacheWithOnlyMarshal() {
 	defer func() {
 		r := recover()
@@ -227,7 +740,7 @@ func (s *factorySuite) TestNewCacheWithOnlyMarshal() {
 	s.factory.NewCache([]Setting{
 		{
 			Prefix:          "OnlyMarshal",
-			CacheAttributes: map[Type]Attribute{SharedCacheType: {time.Hour}},
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
 			MarshalFunc:     json.Marshal,
 		},
 	})
@@ -243,7 +756,7 @@ func (s *factorySuite) TestNewCacheWithOnlyUnmarshal() {
 	s.factory.NewCache([]Setting{
 		{
 			Prefix:          "OnlyMarshal",
-			CacheAttributes: map[Type]Attribute{SharedCacheType: {time.Hour}},
+			CacheAttributes: map[Type]Attribute{SharedCacheType: {TTL: time.Hour}},
 			UnmarshalFunc:   json.Unmarshal,
 		},
 	})
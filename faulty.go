@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/rand"
+)
+
+const (
+	// maxGarbageLen is the maximum length of the garbage bytes returned by the faulty adapter
+	maxGarbageLen = 16
+)
+
+// NewFaultyAdapter generates Adapter injecting faults for the chaos testing, which stores nothing like NewEmpty.
+// It helps verify how the service behaves when the cache is slow, failing or returning the corrupt data.
+func NewFaultyAdapter(options ...FaultyOptions) Adapter {
+	o := loadFaultyOptions(options...)
+	if o.latency < 0 {
+		panic(errors.New("invalid fault latency"))
+	}
+	if o.errorRate < 0 || o.errorRate > 1 {
+		panic(errors.New("invalid fault error rate"))
+	}
+
+	seed := uint64(time.Now().UnixNano())
+	if o.seed != nil {
+		seed = *o.seed
+	}
+
+	return &faulty{
+		latency:   o.latency,
+		errorRate: o.errorRate,
+		garbage:   o.garbage,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// FaultyOptions is an alias for functional argument.
+type FaultyOptions func(opts *faultyOptions)
+
+// faultyOptions contains all options which will be applied when calling NewFaultyAdapter().
+type faultyOptions struct {
+	latency   time.Duration
+	errorRate float64
+	garbage   bool
+	// seed is nil if it's not specified, which distinguishes from the zero seed
+	seed *uint64
+}
+
+// WithFaultLatency delays each operation by the latency, the operation returns the context error
+// if the context is done before that.
+func WithFaultLatency(latency time.Duration) FaultyOptions {
+	return func(opts *faultyOptions) {
+		opts.latency = latency
+	}
+}
+
+// WithFaultErrorRate fails the operations with ErrInjectedFault by the rate from 0 to 1.
+func WithFaultErrorRate(rate float64) FaultyOptions {
+	return func(opts *faultyOptions) {
+		opts.errorRate = rate
+	}
+}
+
+// WithFaultGarbage makes MGet() return the random bytes as the valid values, which simulates the corrupt data.
+func WithFaultGarbage() FaultyOptions {
+	return func(opts *faultyOptions) {
+		opts.garbage = true
+	}
+}
+
+// WithFaultSeed sets up the seed of the randomness, which makes the injected faults reproducible.
+// The default is the current time.
+func WithFaultSeed(seed uint64) FaultyOptions {
+	return func(opts *faultyOptions) {
+		opts.seed = &seed
+	}
+}
+
+func loadFaultyOptions(options ...FaultyOptions) *faultyOptions {
+	opts := &faultyOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+type faulty struct {
+	latency   time.Duration
+	errorRate float64
+	garbage   bool
+
+	// rand is not thread-safe, it needs a lock
+	mut  sync.Mutex
+	rand *rand.Rand
+}
+
+func (adp *faulty) MSet(ctx context.Context, keyItems map[string][]byte, ttl time.Duration, options ...MSetOptions) error {
+	return adp.inject(ctx)
+}
+
+func (adp *faulty) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	if err := adp.inject(ctx); err != nil {
+		return nil, err
+	}
+
+	vals := make([]Value, len(keys))
+	if !adp.garbage {
+		return vals, nil
+	}
+
+	adp.mut.Lock()
+	defer adp.mut.Unlock()
+
+	for i := range vals {
+		b := make([]byte, 1+adp.rand.Intn(maxGarbageLen))
+		adp.rand.Read(b)
+		vals[i] = Value{Valid: true, Bytes: b}
+	}
+
+	return vals, nil
+}
+
+func (adp *faulty) Del(ctx context.Context, keys ...string) error {
+	return adp.inject(ctx)
+}
+
+// inject waits for the latency, then fails the operation by the error rate.
+func (adp *faulty) inject(ctx context.Context) error {
+	if adp.latency > 0 {
+		timer := time.NewTimer(adp.latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if adp.errorRate == 0 {
+		return nil
+	}
+
+	adp.mut.Lock()
+	defer adp.mut.Unlock()
+
+	if adp.rand.Float64() < adp.errorRate {
+		return ErrInjectedFault
+	}
+
+	return nil
+}
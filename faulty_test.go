@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockFaultyCTX = context.Background()
+)
+
+type faultySuite struct {
+	suite.Suite
+}
+
+func (s *faultySuite) SetupSuite() {}
+
+func (s *faultySuite) TearDownSuite() {}
+
+func (s *faultySuite) SetupTest() {}
+
+func (s *faultySuite) TearDownTest() {
+	// prevent registering twice
+	ClearPrefix()
+}
+
+func TestFaultySuite(t *testing.T) {
+	suite.Run(t, new(faultySuite))
+}
+
+func (s *faultySuite) TestNoFault() {
+	adp := NewFaultyAdapter()
+
+	s.Require().NoError(adp.MSet(mockFaultyCTX, map[string][]byte{"key": []byte("v")}, time.Hour))
+	vals, err := adp.MGet(mockFaultyCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+	s.Require().NoError(adp.Del(mockFaultyCTX, "key"))
+}
+
+func (s *faultySuite) TestLatency() {
+	adp := NewFaultyAdapter(WithFaultLatency(20 * time.Millisecond))
+
+	start := time.Now()
+	s.Require().NoError(adp.Del(mockFaultyCTX, "key"))
+	s.Require().GreaterOrEqual(time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(mockFaultyCTX, time.Millisecond)
+	defer cancel()
+	_, err := adp.MGet(ctx, []string{"key"})
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (s *faultySuite) TestErrorRate() {
+	adp := NewFaultyAdapter(WithFaultErrorRate(1))
+	s.Require().Equal(ErrInjectedFault, adp.Del(mockFaultyCTX, "key"))
+
+	// reproducible by the seed
+	faults := func(seed uint64) []bool {
+		adp := NewFaultyAdapter(WithFaultErrorRate(0.5), WithFaultSeed(seed))
+
+		ret := make([]bool, 100)
+		for i := range ret {
+			ret[i] = errors.Is(adp.Del(mockFaultyCTX, "key"), ErrInjectedFault)
+		}
+		return ret
+	}
+	s.Require().Equal(faults(1), faults(1))
+	s.Require().Contains(faults(1), true)
+	s.Require().Contains(faults(1), false)
+}
+
+func (s *faultySuite) TestGarbage() {
+	adp := NewFaultyAdapter(WithFaultGarbage(), WithFaultSeed(1))
+
+	vals, err := adp.MGet(mockFaultyCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Len(vals, 2)
+	for _, val := range vals {
+		s.Require().True(val.Valid)
+		s.Require().NotEmpty(val.Bytes)
+		s.Require().LessOrEqual(len(val.Bytes), maxGarbageLen)
+	}
+
+	again, err := NewFaultyAdapter(WithFaultGarbage(), WithFaultSeed(1)).MGet(mockFaultyCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal(vals, again)
+}
+
+func (s *faultySuite) TestFaultsInCache() {
+	f := NewFactory(NewFaultyAdapter(WithFaultErrorRate(1)), nil)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "faulty",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+		},
+	})
+
+	var ret int
+	err := c.Get(mockFaultyCTX, "faulty", "key", &ret)
+	var cacheErr *CacheError
+	s.Require().ErrorAs(err, &cacheErr)
+	s.Require().Equal("load", cacheErr.Op)
+	s.Require().ErrorIs(err, ErrInjectedFault)
+	s.Require().ErrorIs(c.Set(mockFaultyCTX, "faulty", "key", 1), ErrInjectedFault)
+
+	// the corrupt data fails unmarshaling
+	f2 := NewFactory(NewFaultyAdapter(WithFaultGarbage(), WithFaultSeed(1)), nil)
+	defer f2.Close()
+
+	c2 := f2.NewCache([]Setting{
+		{
+			Prefix: "garbage",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+			},
+			MarshalFunc:   Marshal,
+			UnmarshalFunc: Unmarshal,
+		},
+	})
+
+	var st mockCodecStruct
+	s.Require().Error(c2.Get(mockFaultyCTX, "garbage", "key", &st))
+}
+
+func (s *faultySuite) TestNewFaultyAdapterWithInvalidOptions() {
+	s.Require().PanicsWithError("invalid fault latency", func() {
+		NewFaultyAdapter(WithFaultLatency(-time.Second))
+	})
+	s.Require().PanicsWithError("invalid fault error rate", func() {
+		NewFaultyAdapter(WithFaultErrorRate(1.5))
+	})
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/groupcache"
+)
+
+const (
+	// the flags stored before the value of each entry, since groupcache keeps whatever the getter loads
+	groupCacheMissing byte = 0
+	groupCacheFound   byte = 1
+)
+
+// GroupCacheGetter loads the bytes of the cache key on the peer owning it, e.g. marshaling the value from the origin
+// by Marshal(). The found is false if the key doesn't exist.
+type GroupCacheGetter func(ctx context.Context, key string) (b []byte, found bool, err error)
+
+// NewGroupCache generates Adapter with groupcache, which shards the local cache across the peers.
+// Each peer owns a slice of the keyspace and loads its keys by the getter, and others fetch the keys from the owner
+// on missing, so that the memory and the origin load are shared by the peers. The peers are set up by groupcache,
+// e.g. groupcache.NewHTTPPool(). The name of the group is registered globally in the process, so it panics if the name
+// is registered already, e.g. by another NewGroupCache() or groupcache.NewGroup().
+//
+// Groupcache never updates or invalidates the loaded entries, they are kept until evicted by the cacheBytes,
+// so it suits the immutable datasets only. MSet() and Del() are no-ops, which means the refills and the evictions
+// broadcasted by the pubsub have no effect, and the TTLs are ignored. The missing keys are kept as well,
+// so the keys created afterwards are still missing until evicted. The errors of the getter are not kept.
+func NewGroupCache(name string, cacheBytes int64, getter GroupCacheGetter) Adapter {
+	if getter == nil {
+		panic(errors.New("nil group cache getter"))
+	}
+	if groupcache.GetGroup(name) != nil {
+		panic(errors.New("duplicated group cache name"))
+	}
+
+	group := groupcache.NewGroup(name, cacheBytes, groupcache.GetterFunc(
+		func(ctx context.Context, key string, dest groupcache.Sink) error {
+			b, found, err := getter(ctx, key)
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				return dest.SetBytes([]byte{groupCacheMissing})
+			}
+
+			entry := make([]byte, 1+len(b))
+			entry[0] = groupCacheFound
+			copy(entry[1:], b)
+			return dest.SetBytes(entry)
+		},
+	))
+
+	return &groupCache{group: group}
+}
+
+type groupCache struct {
+	group *groupcache.Group
+}
+
+// MGet gets the keys from the owning peers one by one, since groupcache doesn't support the batches.
+func (adp *groupCache) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	vals := make([]Value, len(keys))
+	for i, key := range keys {
+		var entry []byte
+		if err := adp.group.Get(ctx, key, groupcache.AllocatingByteSliceSink(&entry)); err != nil {
+			return nil, err
+		}
+
+		if len(entry) == 0 || entry[0] != groupCacheFound {
+			continue
+		}
+
+		vals[i] = Value{Valid: true, Bytes: entry[1:]}
+	}
+
+	return vals, nil
+}
+
+// MSet does nothing, the values are loaded by the getter on the owning peer instead.
+func (adp *groupCache) MSet(
+	ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions,
+) error {
+	return nil
+}
+
+// Del does nothing, groupcache doesn't support invalidating the entries.
+func (adp *groupCache) Del(ctx context.Context, keys ...string) error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockGroupCacheCTX = context.Background()
+	// groupCacheSeq makes the group names unique across the runs, since groupcache registers them globally
+	groupCacheSeq uint64
+)
+
+type groupCacheSuite struct {
+	suite.Suite
+
+	loaded []string
+	fail   bool
+}
+
+func (s *groupCacheSuite) SetupSuite() {}
+
+func (s *groupCacheSuite) TearDownSuite() {}
+
+func (s *groupCacheSuite) SetupTest() {
+	s.loaded = []string{}
+	s.fail = false
+}
+
+func (s *groupCacheSuite) TearDownTest() {}
+
+func TestGroupCacheSuite(t *testing.T) {
+	suite.Run(t, new(groupCacheSuite))
+}
+
+// newGroupCache generates the adapter of the unique group, which loads the keys except the ones prefixed by "missing".
+func (s *groupCacheSuite) newGroupCache() Adapter {
+	return NewGroupCache(s.groupName(), 1<<20, func(ctx context.Context, key string) ([]byte, bool, error) {
+		s.loaded = append(s.loaded, key)
+		if s.fail {
+			return nil, false, errors.New("origin is down")
+		}
+		if len(key) >= len("missing") && key[:len("missing")] == "missing" {
+			return nil, false, nil
+		}
+
+		return []byte("v-" + key), true, nil
+	})
+}
+
+// groupName returns the unique name of the group in the process.
+func (s *groupCacheSuite) groupName() string {
+	return s.T().Name() + "-" + strconv.FormatUint(atomic.AddUint64(&groupCacheSeq, 1), 10)
+}
+
+func (s *groupCacheSuite) TestNewGroupCacheWithInvalidArgs() {
+	name := s.groupName()
+	s.Require().PanicsWithError("nil group cache getter", func() {
+		NewGroupCache(name, 1<<20, nil)
+	})
+
+	getter := func(ctx context.Context, key string) ([]byte, bool, error) { return nil, false, nil }
+	NewGroupCache(name, 1<<20, getter)
+	s.Require().PanicsWithError("duplicated group cache name", func() {
+		NewGroupCache(name, 1<<20, getter)
+	})
+}
+
+func (s *groupCacheSuite) TestMGet() {
+	adp := s.newGroupCache()
+
+	vals, err := adp.MGet(mockGroupCacheCTX, []string{"key1", "missing1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v-key1")}, {}, {Valid: true, Bytes: []byte("v-key2")}}, vals)
+	s.Require().Equal([]string{"key1", "missing1", "key2"}, s.loaded)
+
+	// the loaded entries are kept, including the missing ones
+	vals, err = adp.MGet(mockGroupCacheCTX, []string{"missing1", "key1"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte("v-key1")}}, vals)
+	s.Require().Equal([]string{"key1", "missing1", "key2"}, s.loaded)
+}
+
+func (s *groupCacheSuite) TestMGetWithError() {
+	adp := s.newGroupCache()
+
+	s.fail = true
+	_, err := adp.MGet(mockGroupCacheCTX, []string{"key"})
+	s.Require().Error(err)
+
+	// the errors are not kept
+	s.fail = false
+	vals, err := adp.MGet(mockGroupCacheCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v-key")}}, vals)
+	s.Require().Equal([]string{"key", "key"}, s.loaded)
+}
+
+func (s *groupCacheSuite) TestMSetAndDel() {
+	adp := s.newGroupCache()
+
+	// the values are loaded by the getter only
+	s.Require().NoError(adp.MSet(mockGroupCacheCTX, map[string][]byte{"key": []byte("set")}, time.Hour))
+	vals, err := adp.MGet(mockGroupCacheCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v-key")}}, vals)
+
+	// never invalidated
+	s.Require().NoError(adp.Del(mockGroupCacheCTX, "key"))
+	vals, err = adp.MGet(mockGroupCacheCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v-key")}}, vals)
+	s.Require().Equal([]string{"key"}, s.loaded)
+}
+
+func (s *groupCacheSuite) TestWithCache() {
+	adp := NewGroupCache(s.groupName(), 1<<20, func(ctx context.Context, key string) ([]byte, bool, error) {
+		pfx, k := getPrefixAndKey(key)
+		s.Require().Equal("group", pfx)
+
+		b, err := Marshal("value-of-" + k)
+		return b, true, err
+	})
+
+	f := NewFactory(nil, adp)
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "group",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+			MarshalFunc:   Marshal,
+			UnmarshalFunc: Unmarshal,
+		},
+	})
+
+	var v string
+	s.Require().NoError(c.Get(mockGroupCacheCTX, "group", "key", &v))
+	s.Require().Equal("value-of-key", v)
+}
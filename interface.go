@@ -3,26 +3,240 @@ package cache
 import (
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 )
 
 var (
-	// ErrCacheMiss indicates the key is missing
+	// ErrCacheMiss indicates the key is missing, i.e. not cached. The value may exist in the origin, so try again.
 	ErrCacheMiss = errors.New("cache key is missing")
+	// ErrNoValue indicates the key is cached as absent, e.g. tombstoned by Del with Setting.DeleteTombstoneTTL,
+	// and the getter doesn't reload it either. It's a kind of cache-miss, so errors.Is(ErrNoValue, ErrCacheMiss) is true.
+	ErrNoValue error = &noValueError{}
 	// ErrPfxNotRegistered means the prefix is not registered
 	ErrPfxNotRegistered = errors.New("prefix not registered")
 	// ErrMGetterResponseLengthInvalid means mgetter return a slice with wrong length,
 	// the response length should be equal to the getterParams length
 	ErrMGetterResponseLengthInvalid = errors.New("wrong mgetter response length")
+	// ErrMGetterResponseTooShort means mgetter return a slice shorter than the getterParams,
+	// errors.Is() also reports it's ErrMGetterResponseLengthInvalid
+	ErrMGetterResponseTooShort = errors.New("mgetter response too short")
+	// ErrMGetterResponseTooLong means mgetter return a slice longer than the getterParams,
+	// errors.Is() also reports it's ErrMGetterResponseLengthInvalid
+	ErrMGetterResponseTooLong = errors.New("mgetter response too long")
 	// ErrMGetterResponseNotSlice means mgetter's response type is not slice
 	ErrMGetterResponseNotSlice = errors.New("mgetter response not a slice")
+	// ErrMGetterElementTypeMismatch means the element of mgetter's response isn't assignable to Setting.MGetterElemType
+	ErrMGetterElementTypeMismatch = errors.New("mgetter response element type mismatch")
 	// ErrResultIndexInvalid means the index for Result.Get is out of range
 	ErrResultIndexInvalid = errors.New("index out of range")
+	// ErrStatsNotSupported means the adapter doesn't implement the Statser interface
+	ErrStatsNotSupported = errors.New("stats not supported")
+	// ErrSizeNotSupported means the adapter doesn't implement the Sizer interface
+	ErrSizeNotSupported = errors.New("size not supported")
+	// ErrClearNotSupported means the adapter doesn't implement the Clearer interface
+	ErrClearNotSupported = errors.New("clear not supported")
+	// ErrConditionalSetNotSupported means the adapter doesn't implement the ConditionalSetter interface,
+	// or the prefix writes the shared cache asynchronously by WriteBehind
+	ErrConditionalSetNotSupported = errors.New("conditional set not supported")
+	// ErrPatternUnsupported means the adapter doesn't implement the PatternDeleter interface,
+	// or the prefix writes the shared cache asynchronously by WriteBehind
+	ErrPatternUnsupported = errors.New("pattern deletion not supported")
+	// ErrGetDelNotSupported means the adapter doesn't implement the GetDeleter interface,
+	// or the prefix writes the shared cache asynchronously by WriteBehind
+	ErrGetDelNotSupported = errors.New("get and delete not supported")
+	// ErrListNotSupported means the adapter doesn't implement the ListAdapter interface
+	ErrListNotSupported = errors.New("list not supported")
+	// ErrNotList means the key holds the value other than the list, e.g. the one set by Set()
+	ErrNotList = errors.New("value is not a list")
+	// ErrInjectedFault is the error injected by the adapter generated by NewFaultyAdapter
+	ErrInjectedFault = errors.New("injected fault")
+	// ErrUnknownEvent means the received event is not recognized, e.g. a misconfigured publisher
+	ErrUnknownEvent = errors.New("unknown event")
+	// ErrSubscriptionClosed means the subscription is closed unexpectedly, and it's going to resubscribe
+	ErrSubscriptionClosed = errors.New("subscription closed unexpectedly")
+	// ErrGetterRecentlyFailed means the getter of the key failed within Setting.GetterErrorTTL, and it's not invoked again
+	ErrGetterRecentlyFailed = errors.New("getter recently failed")
+	// ErrResultBufferInvalid means the buffer for Cache.MGetInto isn't generated by Factory.NewResultBuffer
+	ErrResultBufferInvalid = errors.New("invalid result buffer")
+	// ErrTooManyKeys means the number of the deduped keys of MGet exceeds the limit specified by WithMaxMGetKeys()
+	ErrTooManyKeys = errors.New("too many keys")
+	// ErrValueTooLarge means the value exceeds the limit specified by WithMaxValueBytes()
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrMGetterNotSpecified means the prefix has no MGetter, which is required by Cache.Refresh
+	ErrMGetterNotSpecified = errors.New("mgetter not specified")
 )
 
+// CacheError wraps the error returned by the adapter with the operation and the prefix triggering it.
+// Use errors.As() to get the details, and errors.Is() still works with the underlying error.
+type CacheError struct {
+	// Op is the operation triggering the error, e.g. load, refill and del.
+	Op string
+	// Prefix is the prefix triggering the error.
+	Prefix string
+	// Err is the underlying error returned by the adapter.
+	Err error
+}
+
+func (e *CacheError) Error() string {
+	return fmt.Sprintf("cache: %s %s: %v", e.Op, e.Prefix, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// PingError reports the cache tier failing the health check of Factory.Ping().
+type PingError struct {
+	// Tier is the failing cache tier, i.e. SharedCacheType or LocalCacheType.
+	Tier Type
+	// Err is the underlying error returned by the adapter.
+	Err error
+}
+
+func (e *PingError) Error() string {
+	tier := "shared"
+	if e.Tier == LocalCacheType {
+		tier = "local"
+	}
+
+	return fmt.Sprintf("cache: ping %s cache: %v", tier, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
+
+// GetterFailedError reports the getter of the key failed recently, which is returned without invoking the getter
+// until Setting.GetterErrorTTL lapses. errors.Is() reports it's ErrGetterRecentlyFailed and the original error.
+type GetterFailedError struct {
+	// Err is the original error returned by the getter.
+	Err error
+}
+
+func (e *GetterFailedError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrGetterRecentlyFailed, e.Err)
+}
+
+// Unwrap returns the original error.
+func (e *GetterFailedError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is() report it's ErrGetterRecentlyFailed.
+func (e *GetterFailedError) Is(target error) bool {
+	return target == ErrGetterRecentlyFailed
+}
+
+// UnmarshalMissError reports the value failed to unmarshal is removed and treated as cache-miss,
+// which is enabled by WithTreatUnmarshalErrorAsMiss().
+type UnmarshalMissError struct {
+	// Err is the original error returned by the unmarshal function.
+	Err error
+}
+
+func (e *UnmarshalMissError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrCacheMiss, e.Err)
+}
+
+// Unwrap returns the original error.
+func (e *UnmarshalMissError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is() report it's ErrCacheMiss.
+func (e *UnmarshalMissError) Is(target error) bool {
+	return target == ErrCacheMiss
+}
+
+// noValueError is the type of ErrNoValue.
+type noValueError struct{}
+
+func (e *noValueError) Error() string {
+	return "cache key has no value"
+}
+
+// Is makes errors.Is() report it's ErrCacheMiss for compatibility.
+func (e *noValueError) Is(target error) bool {
+	return target == ErrCacheMiss
+}
+
+// MGetterLengthError reports the mgetter response length mismatching the getterParams length.
+type MGetterLengthError struct {
+	// Expected is the number of the getterParams.
+	Expected int
+	// Actual is the length of the response.
+	Actual int
+}
+
+func (e *MGetterLengthError) Error() string {
+	return fmt.Sprintf("%v: expected %d, got %d", e.Unwrap(), e.Expected, e.Actual)
+}
+
+// Unwrap returns ErrMGetterResponseTooShort or ErrMGetterResponseTooLong.
+func (e *MGetterLengthError) Unwrap() error {
+	if e.Actual < e.Expected {
+		return ErrMGetterResponseTooShort
+	}
+
+	return ErrMGetterResponseTooLong
+}
+
+// Is makes errors.Is() report it's ErrMGetterResponseLengthInvalid for compatibility.
+func (e *MGetterLengthError) Is(target error) bool {
+	return target == ErrMGetterResponseLengthInvalid
+}
+
+// MultiError collects the errors occurred across prefixes, e.g. Flush().
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the collected errors, which makes errors.Is() and errors.As() inspect them since Go 1.20.
+func (e MultiError) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any of the collected errors matches the target, which works before Go 1.20 as well.
+func (e MultiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first collected error matching the target, which works before Go 1.20 as well.
+func (e MultiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // OneTimeGetterFunc should be provided as a parameter in GetByFunc()
 type OneTimeGetterFunc func() (interface{}, error)
 
+// OneTimeMGetterFunc should be provided as a parameter in MGetByFunc().
+// It responses a map from the missing keys to their values, and the keys absent from the map are treated as cache-miss.
+type OneTimeMGetterFunc func(ctx context.Context, keys ...string) (map[string]interface{}, error)
+
 // MGetterFunc should response a slice of elements which has 1-1 mapping with the provided keys
 type MGetterFunc func(keys ...string) (interface{}, error)
 
@@ -47,6 +261,25 @@ const (
 type Factory interface {
 	NewCache(settings []Setting) Cache
 	Close()
+	// ClearPrefix unregisters the prefixes registered by the factory, so that they can be used by NewCache() again.
+	// It's mostly used by unit tests, and safe for concurrent use. Close() releases the prefixes as well.
+	ClearPrefix()
+	// PubSubEnabled reports whether the pubsub is registered, which broadcasts the evictions of local caches across nodes.
+	PubSubEnabled() bool
+	// OnEvict sets up the callback invoked with the keys evicted by other nodes after the local cache is cleared,
+	// e.g. to invalidate the derived in-process data. The keys are the original ones without the prefix, and
+	// the keys whose untransformed ones are unknown are skipped, i.e. the ones deleted by DelPattern() or flushed
+	// by the write-behind under WithKeyTransformer(). The prefix-wide evictions, e.g. Flush() and DelPattern()
+	// with local caches clearing the prefix, aren't reported either.
+	// It runs in the goroutine subscribing the events, so don't block it. Setting it again replaces the previous one.
+	OnEvict(f func(ctx context.Context, keys []string))
+	// Ping probes the shared and local caches implementing the HealthChecker interface, e.g. for readiness probes.
+	// It returns MultiError of PingError indicating the failing tiers, or nil if all of them are healthy.
+	Ping(ctx context.Context) error
+	// NewResultBuffer returns the empty Result reused across the calls of Cache.MGetInto(), e.g. in a hot loop,
+	// which gives the caller explicit control over its lifetime instead of WithPooledResults().
+	// It's not safe for concurrent use, and it's never put into the pool.
+	NewResultBuffer() Result
 }
 
 // NewFactory returns the Factory initialized in the main.go.
@@ -59,21 +292,192 @@ func NewFactory(sharedCache Adapter, localCache Adapter, options ...FactoryOptio
 type Cache interface {
 	// GetByFunc returns a value in the cache. It also follows up the Cache-Aside pattern.
 	// When cache-miss happened, it relaods the value by the getter, and fill in the cache again.
-	GetByFunc(context context.Context, prefix, key string, container interface{}, getter OneTimeGetterFunc) error
+	// The concurrent calls of the same key share a single reload only if their containers are of the same type.
+	GetByFunc(context context.Context, prefix, key string, container interface{}, getter OneTimeGetterFunc, options ...GetByFuncOptions) error
 	// Get returns a value in the cache.
 	// When cache-miss happened, it relaods the value by MGetter specified in the setting if possible.
 	// Or returns the error of ErrCacheMiss.
 	Get(context context.Context, prefix, key string, container interface{}) error
+	// GetOrZero is similar to Get, but it resets the container to its zero value and returns found=false
+	// without the error when cache-miss happened or the key has no value, the error is reserved for the real failures.
+	GetOrZero(context context.Context, prefix, key string, container interface{}) (found bool, err error)
+	// GetRaw is similar to Get, but it returns the raw bytes along with unmarshaling them into the container,
+	// e.g. for the audit logs or debugging the codecs. The bytes are the stored ones including the envelope
+	// if any, or the marshaled ones if the value is reloaded by MGetter. They must not be modified.
+	GetRaw(context context.Context, prefix, key string, container interface{}) ([]byte, error)
 	// MGet returns values in the cache with the interface Result.
 	// When cache-miss happened, it relaods values by MGetter specified in the setting if possible.
-	// Or returns the error of ErrCacheMiss.
+	// Or returns the error of ErrCacheMiss, or ErrNoValue for the tombstoned keys not reloaded.
+	// The error of MGetter is returned by Result.Get() of the missing keys along with the values loaded from
+	// the cache, unless GetterFailurePolicyFail is specified by WithGetterFailurePolicy().
 	MGet(context context.Context, prefix string, keys ...string) (Result, error)
-	// Del remove keys in the cache
+	// MGetInto is similar to MGet, but it fills the values into the buffer generated by Factory.NewResultBuffer()
+	// instead of allocating a new Result. The buffer is reset first, and the values of the previous call are dropped,
+	// so the buffer must not be read by others meanwhile. It returns the error of ErrResultBufferInvalid for
+	// other Results, and the buffer is left empty on error.
+	MGetInto(context context.Context, prefix string, buf Result, keys ...string) error
+	// MGetWithMeta is similar to MGet without reloading by MGetter, but it returns the metadata of each key as well.
+	// The metadata is zero for the missing keys. It's designed for introspection, e.g. monitoring the age of values.
+	MGetWithMeta(context context.Context, prefix string, keys ...string) (Result, []Meta, error)
+	// GetMap is similar to MGet, but it returns the values keyed by the requested keys.
+	// Each value is unmarshaled into a fresh container produced by the valueFactory, e.g. func() interface{} { return &Person{} }.
+	// The keys failed to get are absent from the values, and their errors are in the per-key error map,
+	// e.g. ErrCacheMiss. The error is reserved for failing the whole operation.
+	GetMap(context context.Context, prefix string, keys []string, valueFactory func() interface{}) (map[string]interface{}, map[string]error, error)
+	// MGetByFunc returns values in the cache with the interface Result. It also follows up the Cache-Aside pattern.
+	// When cache-miss happened, it relaods values by the getter instead of MGetter specified in the setting,
+	// and fill in the cache again.
+	MGetByFunc(context context.Context, prefix string, keys []string, getter OneTimeMGetterFunc) (Result, error)
+	// MGetAcrossPrefixes is similar to MGet, but it gets the keys of several prefixes in a single call,
+	// e.g. a teacher and a student. The keys are read ahead by one MGet per adapter across the prefixes,
+	// so the round trips don't grow with the number of prefixes. The Results are in the order of the requests,
+	// and each of them follows MGet, including reloading by MGetter. It returns the error of ErrPfxNotRegistered
+	// if any prefix isn't registered.
+	MGetAcrossPrefixes(context context.Context, reqs []KeyReq) ([]Result, error)
+	// Refresh reloads the keys by MGetter regardless of the cached values, e.g. the "refresh now" buttons,
+	// then refills both of the caches and broadcasts the evictions. Unlike Del followed by Get, the stale values
+	// are overwritten directly without the window of reloading them by others.
+	// It returns the error of ErrMGetterNotSpecified if the prefix has no MGetter, and the error of MGetter as is.
+	Refresh(context context.Context, prefix string, keys ...string) (Result, error)
+	// Del remove keys in the cache, or tombstones them in the shared cache if Setting.DeleteTombstoneTTL is specified
 	Del(context context.Context, prefix string, keys ...string) error
+	// DelPattern removes the keys matching the glob-style pattern in the cache, e.g. "category:shoes:*",
+	// and broadcasts the evictions of the matched keys. The keys are matched in the shared cache if it's used,
+	// otherwise the local cache. It works with the adapters implementing the PatternDeleter interface,
+	// or returns the error of ErrPatternUnsupported. Notice that it scans all keys of the adapter, e.g. SCAN of redis,
+	// so the cost is proportional to the size of the whole keyspace instead of the matched keys.
+	DelPattern(context context.Context, prefix string, pattern string) error
+	// GetDel gets the value and deletes it atomically, so that concurrent callers never get the same value,
+	// e.g. one-time tokens. It's decided by the shared cache if it's used, otherwise the local cache.
+	// It returns the error of ErrCacheMiss if the key doesn't exist, and ErrGetDelNotSupported if the adapter
+	// doesn't implement the GetDeleter interface. The getter is never involved.
+	GetDel(context context.Context, prefix string, key string, container interface{}) error
+	// ListAppend appends the values to the list of the key atomically, so that the concurrent appends across nodes
+	// are never lost, e.g. the recent activities. Only the latest maxLen values are kept if maxLen is positive,
+	// and the TTL of the list is reset by each append. The list is kept by the shared cache if it's used,
+	// otherwise the local cache, since the lists aren't synchronized between the layers. It returns the error of
+	// ErrListNotSupported if the adapter doesn't implement the ListAdapter interface, and ErrNotList if the key
+	// holds the value set by Set().
+	ListAppend(context context.Context, prefix string, key string, maxLen int, values ...interface{}) error
+	// ListRange returns the values of the list of the key from start to stop inclusively, and the negative indexes
+	// count from the end, e.g. ListRange(ctx, prefix, key, 0, -1) returns the whole list. The missing key returns
+	// the empty result. The getter is never involved.
+	ListRange(context context.Context, prefix string, key string, start, stop int) (Result, error)
 	// Set sets up a value into the cache.
 	Set(context context.Context, prefix string, key string, value interface{}) error
+	// SetNX sets up a value into the cache only if the key doesn't exist, and reports whether it's set.
+	// The condition is checked against the shared cache if it's used, otherwise the local cache.
+	// On success, the value in the local cache is evicted for the shared cache, and the evictions are broadcasted.
+	// If evicting fails after the value is set, it reports true along with the error, since other nodes may keep
+	// the stale values. It works with the adapters implementing the ConditionalSetter interface.
+	SetNX(context context.Context, prefix string, key string, value interface{}) (bool, error)
+	// SetXX is similar to SetNX, but it sets up the value only if the key exists.
+	SetXX(context context.Context, prefix string, key string, value interface{}) (bool, error)
+	// SetReturning is similar to Set, but it returns the marshaled bytes stored in the cache as well,
+	// e.g. for logging their size without marshaling again. The bytes include the compression applied by the codec.
+	// With Setting.CoalesceWindow, they're the bytes of the last writer in the window, which may be another caller's.
+	SetReturning(context context.Context, prefix string, key string, value interface{}) ([]byte, error)
+	// SetIfChanged sets up a value into the cache only if the marshaled bytes differ from the cached ones,
+	// and reports whether it's written. The unchanged value neither writes nor broadcasts the evictions,
+	// which suits the values refreshed on a schedule but rarely changed. The bytes are compared against
+	// the shared cache if it's used, otherwise the local cache. Notice that the TTL isn't extended if it's unchanged.
+	SetIfChanged(context context.Context, prefix string, key string, value interface{}) (changed bool, err error)
+	// Put sets up the value into the cache by the key derived from the hash of the marshaled bytes, and returns
+	// the key for Get(), which deduplicates the identical values, e.g. the computed artifacts. The key is the hex
+	// SHA-256 of the bytes ignoring the soft expiry, so it changes with the codec, e.g. the version of WithVersion().
+	Put(context context.Context, prefix string, value interface{}) (key string, err error)
 	// MSet sets up values into the cache.
 	MSet(context context.Context, prefix string, keyValues map[string]interface{}) error
+	// SetBytes sets up the raw bytes into the cache without marshaling.
+	// Get() is able to read it only if the prefix uses the raw-bytes-compatible codec, e.g. Marshal and Unmarshal.
+	SetBytes(context context.Context, prefix string, key string, b []byte) error
+	// GetBytes returns the raw bytes in the cache without unmarshaling. MGetter is not involved.
+	// Or returns the error of ErrCacheMiss.
+	GetBytes(context context.Context, prefix string, key string) ([]byte, error)
+	// WarmLocal promotes the values of the keys in the shared cache into the local cache by a single MGet,
+	// e.g. warming up the local cache on startup. The missing keys are skipped without invoking the getter,
+	// and no evictions are broadcasted since the values are the same as the shared ones.
+	// It does nothing if the prefix doesn't use both of the shared and local caches.
+	WarmLocal(context context.Context, prefix string, keys []string) error
+	// EvictLocal removes the keys from the local cache of this node only, e.g. dropping the corrupted local copy
+	// after an unmarshal error. Unlike Del, the shared cache is kept and no evictions are broadcasted, so the healthy
+	// copies on other nodes stay. It does nothing if the prefix doesn't use the local cache.
+	EvictLocal(context context.Context, prefix string, keys ...string) error
+	// LocalStats returns the statistics of the local cache used by the prefix.
+	// Notice that the statistics are shared with other prefixes using the same local cache.
+	LocalStats(prefix string) (Stats, error)
+	// LocalSize returns the number of the keys of the prefix in the local cache and the total length of their values,
+	// which tells the prefixes monopolizing the local cache. It returns the error of ErrSizeNotSupported
+	// if the local cache doesn't implement the Sizer interface, e.g. the prefix not using the local cache.
+	LocalSize(context context.Context, prefix string) (entries int, bytes int, err error)
+	// Flush deletes all keys under the prefixes of the cache in both shared and local caches, and broadcasts
+	// the evictions. Keys outside the package key and prefixes are untouched. It continues past the failed prefixes,
+	// and returns MultiError collecting their errors. It works with the adapters implementing the Clearer interface.
+	Flush(context context.Context) error
+	// SetLocalEnabled turns the local cache on or off at runtime for all prefixes, it's safe for concurrent use.
+	// When disabled, reads are served from the shared cache directly, and writes drop the values in the local cache
+	// instead of setting them. Re-enabling resumes filling the local cache.
+	SetLocalEnabled(enabled bool)
+	// SetMGetter replaces MGetter of the prefix atomically at runtime, e.g. failing over to another data source,
+	// and nil disables reloading. The calls in-flight keep using the old one, and the later calls use the new one.
+	// Or returns the error of ErrPfxNotRegistered.
+	SetMGetter(prefix string, getter MGetterFunc) error
+	// Prefixes returns the information of the prefixes managed by the cache, sorted by the prefix.
+	Prefixes() []PrefixInfo
+	// Batch returns the Batcher accumulating the writes of the prefix, which are applied in bulk on Flush().
+	Batch(context context.Context, prefix string) Batcher
+	// Scoped returns the handle bound to the prefix, so that the prefix argument can be omitted.
+	// Or returns the error of ErrPfxNotRegistered.
+	Scoped(prefix string) (ScopedCache, error)
+}
+
+// KeyReq is the keys of a prefix requested by MGetAcrossPrefixes().
+type KeyReq struct {
+	Prefix string
+	Keys   []string
+}
+
+// PrefixInfo describes the configuration of a prefix, see Setting for details.
+type PrefixInfo struct {
+	Prefix    string
+	SharedTTL time.Duration
+	LocalTTL  time.Duration
+	HasShared bool
+	HasLocal  bool
+	// HasMGetter reports whether the MGetter is specified in the Setting.
+	HasMGetter bool
+}
+
+// Meta is the metadata of a value returned by MGetWithMeta.
+type Meta struct {
+	// TTL is the remaining TTL reported by the cache layer where the value is found, e.g. the local cache.
+	// It's zero if the adapter doesn't implement the MetaGetter interface or the value never expires.
+	TTL time.Duration
+	// Size is the length of the stored bytes.
+	Size int
+	// Stale reports whether the soft TTL of the value is passed, see Attribute.SoftTTL.
+	Stale bool
+}
+
+// Batcher accumulates Set() and Del() of a prefix, and applies them by a single MSet() and Del() of each cache
+// along with a single eviction broadcast on Flush(). Only the latest operation of each key is applied.
+// The accumulated operations are discarded after flushing, even if it fails. It's safe for concurrent use.
+type Batcher interface {
+	// Set marshals the value and accumulates it, or returns the error of ErrPfxNotRegistered.
+	Set(key string, value interface{}) error
+	// Del accumulates the deletion of keys.
+	Del(keys ...string)
+	// Flush applies the accumulated operations, and the Batcher can be reused afterwards.
+	Flush() error
+}
+
+// ScopedCache is the Cache bound to a registered prefix, see Cache for details of each method.
+type ScopedCache interface {
+	GetByFunc(context context.Context, key string, container interface{}, getter OneTimeGetterFunc, options ...GetByFuncOptions) error
+	Get(context context.Context, key string, container interface{}) error
+	MGet(context context.Context, keys ...string) (Result, error)
+	Del(context context.Context, keys ...string) error
+	Set(context context.Context, key string, value interface{}) error
 }
 
 // Setting provides a relation between Prefix and detailed Attributes.
@@ -84,34 +488,214 @@ type Setting struct {
 	Prefix string
 	// CacheAttributes includes all detail attributes.
 	CacheAttributes map[Type]Attribute
+	// SharedAdapter overrides the shared cache of the factory for the prefix if it's specified,
+	// e.g. using another backend for some prefixes. It requires SharedCacheType in CacheAttributes.
+	SharedAdapter Adapter
+	// LocalAdapter overrides the local cache of the factory for the prefix if it's specified.
+	// It requires LocalCacheType in CacheAttributes. If the prefix uses the shared cache as well,
+	// the pubsub of the factory is required, which evicts the keys in it on other nodes.
+	LocalAdapter Adapter
 	// MGetter should be provided when using Cache-Aside pattern
 	MGetter MGetterFunc
+	// MGetterElemType optionally specifies the type of the containers passed to Result.Get.
+	// When it's specified, each element responded by MGetter must be assignable to it, otherwise
+	// MGet returns ErrMGetterElementTypeMismatch with the offending index and key.
+	MGetterElemType reflect.Type
+	// MGetterIgnoreExtra tolerates MGetter over-fetching, the elements beyond the keys are ignored
+	// instead of returning ErrMGetterResponseTooLong.
+	MGetterIgnoreExtra bool
+	// MGetterFallbacks are tried in order when MGetter returns the error, e.g. reading from the replicas
+	// while the primary database fails over. The error of MGetter is returned if all of them fail.
+	// They are not invoked once the context is done, and the one exceeding the deadline is abandoned without waiting,
+	// since MGetterFunc isn't cancellable. The serving one is reported by OnMGetterFallbackFunc.
+	MGetterFallbacks []MGetterFunc
 	// MarshalFunc specified the marshal function
 	// Needs to consider with unmarshal function at the same time.
 	MarshalFunc MarshalFunc
 	// UnmarshalFunc specified the unmarshal function
 	// Needs to consider with marshal function at the same time.
 	UnmarshalFunc UnmarshalFunc
+	// MarshalWithCtx is the context-aware marshal function, which is preferred over MarshalFunc if it's specified.
+	// Needs to consider with UnmarshalWithCtx at the same time.
+	MarshalWithCtx MarshalWithCtxFunc
+	// UnmarshalWithCtx is the context-aware unmarshal function, which is preferred over UnmarshalFunc if it's specified.
+	// Needs to consider with MarshalWithCtx at the same time.
+	UnmarshalWithCtx UnmarshalWithCtxFunc
+	// UnmarshalFallbacks are tried in order when the unmarshal function fails, which enables migrating the codec
+	// without downtime, e.g. reading the values cached by json.Marshal after switching to msgpack.
+	// The values are always written by the marshal function.
+	UnmarshalFallbacks []UnmarshalFunc
+	// Version wraps the values with a versioned envelope if it's not zero.
+	// The cached values with different versions are treated as cache-miss, and reloaded by the getter if possible.
+	// Bump it when the shape of the cached value changes.
+	Version int
+	// SlidingTTL refreshes the TTL of keys when they are hit, so keys expire only after a period of inactivity.
+	// To avoid writing on every read, the TTL is refreshed only when the remaining TTL is less than half of it.
+	// Only the tier serving the hit is refreshed, so the shared cache isn't touched by the local hits,
+	// and each key is touched in the shared cache at most once per half of its TTL by this cache.
+	// It works with the adapters implementing the Toucher interface.
+	SlidingTTL bool
+	// BackfillShared writes the values hit in the local cache through to the shared cache if it lacks them,
+	// which suits the setups that the local cache holds the recently-written data and the shared cache is a warm tier.
+	// The local hits are probed in the shared cache along with the missing keys by a single MGet,
+	// and only the keys detected missing are written, so it costs a shared read instead of a write on every read.
+	BackfillShared bool
+	// DeterministicTTL makes the keys in the local cache expire at the precise time by disabling the offset
+	// randomizing the TTL, e.g. aligning the expiration to the scheduled refresh.
+	// Notice that the keys set at the same time expire at the same time as well.
+	DeterministicTTL bool
+	// DeleteTombstoneTTL makes Del write a tombstone living for the duration into the shared cache instead of removing
+	// the keys. The tombstones are treated as cache-miss, and the values reloaded by the getter are not refilled until
+	// the tombstones expire, which prevents re-caching the stale values read from the lagging replicas right after deleting.
+	// The tombstoned keys not reloaded by the getter get ErrNoValue instead of ErrCacheMiss from MGet. It requires the shared cache, and 0 removes the keys immediately.
+	DeleteTombstoneTTL time.Duration
+	// CoalesceWindow collapses the concurrent Set of the same key within the window into a single write and eviction broadcast.
+	// The first Set of a key waits for the window before writing, and the ones arriving in the meantime replace the value,
+	// so the last writer in the window wins and all of them return the result of the single write.
+	// The write isn't cancelled along with the first Set, and the value of the Set cancelled before writing is dropped.
+	// Notice that it delays every Set by the window, and only the Set and MSet of a single key are coalesced.
+	// 0 disables it.
+	CoalesceWindow time.Duration
+	// GetterErrorTTL caches the error of the getter in GetByFunc per key for the duration, which stops retrying
+	// the failing origin on every cache-miss. The later calls of the key return GetterFailedError wrapping the error
+	// without invoking the getter until it lapses. The errors are cached in the memory of this cache only.
+	// Notice that it changes the failure semantics, the getter recovered in the meantime isn't noticed. 0 disables it.
+	GetterErrorTTL time.Duration
+	// CostFunc calculates the cost of the key stored in the local cache, and the default cost is the byte length of the value.
+	// The cost is passed to the callbacks specified by OnLocalCacheCostAddFunc and OnLocalCacheCostEvictFunc.
+	// Notice that tinyLFU admits keys by their frequency only, the cost doesn't affect the retention.
+	CostFunc func(prefix, key string, value []byte) int
+	// DistributedLock serializes the getter across nodes when the cache missed if it's specified.
+	// It works with the shared cache implementing the Locker interface.
+	DistributedLock *DistributedLock
+	// WriteBehind writes values into the shared cache asynchronously if it's specified, see WriteBehind for details.
+	WriteBehind *WriteBehind
+}
+
+// SettingGroup declares a family of prefixes sharing the same settings, e.g. the TTLs, codec and MGetter.
+// Pass the expanded settings to Factory.NewCache(), e.g. f.NewCache(group.Settings()).
+type SettingGroup struct {
+	// Base is the setting inherited by the children, and its Prefix is ignored.
+	Base Setting
+	// Children are the settings of the prefixes, whose fields left zero inherit the ones of Base.
+	// Notice that the inherited booleans can't be turned off, since false is the zero value.
+	Children []Setting
+}
+
+// Settings expands the group into the individual settings in the order of the children.
+// MarshalFunc and UnmarshalFunc are inherited in pairs, so are MarshalWithCtx and UnmarshalWithCtx,
+// which prevents mixing the codecs of the child and Base.
+func (g SettingGroup) Settings() []Setting {
+	base := reflect.ValueOf(g.Base)
+
+	settings := make([]Setting, 0, len(g.Children))
+	for _, child := range g.Children {
+		setting := child
+		v := reflect.ValueOf(&setting).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).IsZero() {
+				v.Field(i).Set(base.Field(i))
+			}
+		}
+
+		setting.Prefix = child.Prefix
+		if child.MarshalFunc != nil || child.UnmarshalFunc != nil {
+			setting.MarshalFunc, setting.UnmarshalFunc = child.MarshalFunc, child.UnmarshalFunc
+		}
+		if child.MarshalWithCtx != nil || child.UnmarshalWithCtx != nil {
+			setting.MarshalWithCtx, setting.UnmarshalWithCtx = child.MarshalWithCtx, child.UnmarshalWithCtx
+		}
+
+		settings = append(settings, setting)
+	}
+
+	return settings
 }
 
 // Attribute specified details. For example, you need to indicate the TTL for each key to expire.
 type Attribute struct {
 	TTL time.Duration
+	// SoftTTL is the optional duration after which the value is stale, it's not greater than TTL. The stale values
+	// are still served until TTL expires, meanwhile they're reloaded by the getter and refilled in the background.
+	// The soft expiry is stamped in the envelope of the value, so the multi-layer cache specifies it on the shared
+	// cache only. It's zero by default, i.e. the values are fresh until they expire.
+	// See OnStaleServeFunc() and OnBackgroundRefillFunc() for observing them.
+	SoftTTL time.Duration
+}
+
+// DistributedLock specifies the lock acquired before reloading the missing keys by the getter.
+// Only one node holding the lock executes the getter, others poll the shared cache until the value is refilled.
+// When the value isn't refilled within the Timeout, the node proceeds to execute the getter without the lock.
+type DistributedLock struct {
+	// TTL is the expiration of the lock, it should be longer than the getter takes.
+	TTL time.Duration
+	// Timeout is the maximum duration waiting for other nodes refilling the value.
+	Timeout time.Duration
+	// PollInterval is the interval of polling the shared cache. The default is 50 milliseconds.
+	PollInterval time.Duration
+}
+
+// WriteBehind specifies the write-behind mode. The values are set into the local cache immediately,
+// and the writes to the shared cache are buffered and flushed in batches by the background goroutine.
+// Only the latest value of each key is flushed. The pending writes are flushed when the Factory is closed.
+//
+// It trades durability for latency, the buffered writes are lost if the process crashes before flushing.
+// Reads on the same node always see their own writes, even before flushing, but other nodes see them only after
+// flushing, which is also the moment that the evictions are broadcasted. The writes failed to flush are logged and
+// retried in the next round, but the ones beyond BufferSize keys are dropped. Each flushing is bounded by the
+// operation timeout of the factory, or 10 seconds if it's not specified.
+type WriteBehind struct {
+	// Interval is the interval of flushing the pending writes.
+	Interval time.Duration
+	// BufferSize triggers flushing immediately when the number of pending keys reaches it. The default is 1000.
+	BufferSize int
 }
 
 // Result is the return values from MGet(). You need a for loop to parse whole values.
 type Result interface {
 	Len() int
 	Get(ctx context.Context, index int, container interface{}) error
+	// OriginalIndexError returns the error of the value at the index of the requested keys without unmarshaling,
+	// e.g. ErrCacheMiss, or ErrNoValue if the key is cached as absent. Duplicated keys share the same error.
+	OriginalIndexError(index int) error
+	// IsMiss reports whether the value at the index of the requested keys is missing, i.e. ErrCacheMiss.
+	// It's true for ErrNoValue as well, check OriginalIndexError(index) to tell them apart.
+	IsMiss(index int) bool
+	// ForEach calls the function with each value in the order of the requested keys, and stops if it returns false.
+	// The unmarshal function fills the value into the container, and the err is the same as OriginalIndexError(idx).
+	ForEach(ctx context.Context, f func(idx int, unmarshal func(container interface{}) error, err error) bool)
+	// Reset empties the result and keeps the allocated memory, see Factory.NewResultBuffer().
+	Reset()
+	// Release puts the result back to the pool for reusing if WithPooledResults() is specified,
+	// and the result must not be used afterwards. It does nothing otherwise.
+	Release()
 }
 
 // ClearPrefix is only used by unit tests that clean up registered prefix, otherwise
 // duplicated prefix registration panic might occur due to multiple tests.
+//
+// Deprecated: it clears the prefixes registered by all factories in all registries, use Factory.ClearPrefix() instead.
 func ClearPrefix() {
-	usedPrefixs = map[string]struct{}{}
+	activeRegistriesMut.Lock()
+	registries := make([]*PrefixRegistry, 0, len(activeRegistries))
+	for r := range activeRegistries {
+		registries = append(registries, r)
+	}
+	activeRegistriesMut.Unlock()
+
+	for _, r := range registries {
+		r.clear()
+	}
 }
 
 // Register registers customized parameters in the package.
 func Register(packageKey string) {
 	registerKey(packageKey)
 }
+
+// RegisterWithDelimiter registers customized parameters in the package with the specified delimiter,
+// which joins the package key, prefix and key together. Consider it when keys contain the default delimiter ":".
+// Only the first registration takes effect, including Register().
+func RegisterWithDelimiter(packageKey, delimiter string) {
+	registerKeyWithDelimiter(packageKey, delimiter)
+}
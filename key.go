@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"errors"
 	"strings"
 	"sync"
 )
@@ -8,21 +9,33 @@ import (
 const (
 	packageKey = "ca"
 	topicKey   = "tp"
+	lockKey    = "lk"
 
 	// delimiters
 	cacheDelim = ":"
 	topicDelim = "#"
+	lockDelim  = "#"
 )
 
 var (
-	regPkgKey = packageKey
+	regPkgKey     = packageKey
+	regCacheDelim = cacheDelim
 	// regKeyOnce limits key registeration happening once
 	regKeyOnce = sync.Once{}
 )
 
 func registerKey(pkgKey string) {
+	registerKeyWithDelimiter(pkgKey, cacheDelim)
+}
+
+func registerKeyWithDelimiter(pkgKey, delim string) {
+	if delim == "" {
+		panic(errors.New("not allowed empty delimiter"))
+	}
+
 	regKeyOnce.Do(func() {
 		regPkgKey = pkgKey
+		regCacheDelim = delim
 	})
 }
 
@@ -34,12 +47,27 @@ func getTopic(topic string) string {
 	return customKey(topicDelim, regPkgKey, topicKey, topic)
 }
 
+func getLockKey(cacheKey string) string {
+	return customKey(lockDelim, regPkgKey, lockKey, cacheKey)
+}
+
 func getCacheKey(pfx, key string) string {
 	if regPkgKey == "" {
-		return customKey(cacheDelim, pfx, key)
+		return customKey(regCacheDelim, pfx, key)
 	}
 
-	return customKey(cacheDelim, regPkgKey, pfx, key)
+	return customKey(regCacheDelim, regPkgKey, pfx, key)
+}
+
+// CacheKey returns the key stored in the adapters for the key under the prefix, e.g. for inspecting the adapters
+// in tests. The transformer and the version set by WithKeyTransformer() and WithKeyVersion() are not applied.
+func CacheKey(prefix, key string) string {
+	return getCacheKey(prefix, key)
+}
+
+// getCacheKeyPrefix returns the common prefix of all cache keys under the prefix.
+func getCacheKeyPrefix(pfx string) string {
+	return getCacheKey(pfx, "")
 }
 
 func getCacheKeys(pfx string, keys []string) []string {
@@ -51,24 +79,60 @@ func getCacheKeys(pfx string, keys []string) []string {
 	return cacheKeys
 }
 
+// versionCacheKey inserts the version right after the package key, e.g. ca:v2:prefix:key.
+func versionCacheKey(cacheKey, version string) string {
+	pkg := ""
+	if regPkgKey != "" {
+		pkg = regPkgKey + regCacheDelim
+	}
+	if !strings.HasPrefix(cacheKey, pkg) {
+		return customKey(regCacheDelim, version, cacheKey) // should not happen
+	}
+
+	return pkg + version + regCacheDelim + cacheKey[len(pkg):]
+}
+
+// unversionCacheKey removes the version inserted by versionCacheKey(). The keys of other versions are returned as is.
+func unversionCacheKey(cacheKey, version string) string {
+	if version == "" {
+		return cacheKey
+	}
+
+	pkg := ""
+	if regPkgKey != "" {
+		pkg = regPkgKey + regCacheDelim
+	}
+	vPkg := pkg + version + regCacheDelim
+	if !strings.HasPrefix(cacheKey, vPkg) {
+		return cacheKey
+	}
+
+	return pkg + cacheKey[len(vPkg):]
+}
+
 func getPrefixAndKey(cacheKey string) (string, string) {
 	// 1) cacheKey = regPkgKey + prefix + key (normal case)
 	// 2) cacheKey = prefix + key (if customized package key is empty)
-	idx := strings.Index(cacheKey, cacheDelim)
+	idx := strings.Index(cacheKey, regCacheDelim)
 	if idx < 0 {
 		return cacheKey, "" // should not happen
 	}
 
 	if regPkgKey == "" {
-		return cacheKey[:idx], cacheKey[idx+len(cacheDelim):]
+		return cacheKey[:idx], cacheKey[idx+len(regCacheDelim):]
 	}
 
 	// mixedKey = prefix + key
-	mixedKey := cacheKey[idx+len(cacheDelim):]
-	idx = strings.Index(mixedKey, cacheDelim)
+	mixedKey := cacheKey[idx+len(regCacheDelim):]
+	if strings.HasPrefix(cacheKey, regPkgKey+regCacheDelim) {
+		// the package key might contain the delimiter as well
+		mixedKey = cacheKey[len(regPkgKey)+len(regCacheDelim):]
+	}
+
+	idx = strings.Index(mixedKey, regCacheDelim)
 	if idx < 0 {
 		return mixedKey, ""
 	}
 
-	return mixedKey[:idx], mixedKey[idx+len(cacheDelim):]
+	return mixedKey[:idx], mixedKey[idx+len(regCacheDelim):]
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -28,6 +29,7 @@ func TestKeySuite(t *testing.T) {
 
 func clearRegisteredKey() {
 	regPkgKey = packageKey
+	regCacheDelim = cacheDelim
 	regKeyOnce = sync.Once{}
 }
 
@@ -91,6 +93,7 @@ func (s *keySuite) TestRegisterAndGetCacheKey() {
 	Register("my")
 	cKey = getCacheKey("pfx", "key")
 	s.Require().Equal("my:pfx:key", cKey)
+	s.Require().Equal(cKey, CacheKey("pfx", "key"))
 	pfx, key = getPrefixAndKey(cKey)
 	s.Require().Equal(pfx, "pfx")
 	s.Require().Equal(key, "key")
@@ -105,3 +108,60 @@ func (s *keySuite) TestRegisterAndGetCacheKey() {
 	s.Require().Equal(pfx, "pfx")
 	s.Require().Equal(key, "key")
 }
+
+func (s *keySuite) TestRegisterWithDelimiter() {
+	defer func() {
+		r := recover()
+		s.Require().NotNil(r)
+		s.Require().Equal(errors.New("not allowed empty delimiter"), r)
+	}()
+
+	RegisterWithDelimiter("my", "")
+}
+
+func (s *keySuite) TestVersionCacheKey() {
+	cKey := versionCacheKey(getCacheKey("pfx", "a:b"), "v2")
+	s.Require().Equal(fmt.Sprintf("%s:v2:pfx:a:b", packageKey), cKey)
+	s.Require().Equal(getCacheKey("pfx", "a:b"), unversionCacheKey(cKey, "v2"))
+	s.Require().Equal(cKey, unversionCacheKey(cKey, "v1")) // other versions are kept
+	s.Require().Equal(cKey, unversionCacheKey(cKey, ""))
+
+	Register("") // empty package key
+	cKey = versionCacheKey(getCacheKey("pfx", "key"), "v2")
+	s.Require().Equal("v2:pfx:key", cKey)
+	pfx, key := getPrefixAndKey(unversionCacheKey(cKey, "v2"))
+	s.Require().Equal("pfx", pfx)
+	s.Require().Equal("key", key)
+}
+
+func (s *keySuite) TestGetPrefixAndKeyWithColon() {
+	var cKey, pfx, key string
+
+	// default delimiter, the colons in key are kept
+	cKey = getCacheKey("pfx", "a:b:c")
+	s.Require().Equal(fmt.Sprintf("%s:pfx:a:b:c", packageKey), cKey)
+	pfx, key = getPrefixAndKey(cKey)
+	s.Require().Equal("pfx", pfx)
+	s.Require().Equal("a:b:c", key)
+
+	// customized delimiter
+	RegisterWithDelimiter("my:pkg", "|")
+	cKey = getCacheKey("pfx:colon", "a:b:c")
+	s.Require().Equal("my:pkg|pfx:colon|a:b:c", cKey)
+	pfx, key = getPrefixAndKey(cKey)
+	s.Require().Equal("pfx:colon", pfx)
+	s.Require().Equal("a:b:c", key)
+
+	// no change
+	Register("another")
+	s.Require().Equal("my:pkg", regPkgKey)
+	s.Require().Equal("|", regCacheDelim)
+
+	clearRegisteredKey()
+	RegisterWithDelimiter("", "|")
+	cKey = getCacheKey("pfx:colon", "a:b:c")
+	s.Require().Equal("pfx:colon|a:b:c", cKey)
+	pfx, key = getPrefixAndKey(cKey)
+	s.Require().Equal("pfx:colon", pfx)
+	s.Require().Equal("a:b:c", key)
+}
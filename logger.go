@@ -0,0 +1,28 @@
+package cache
+
+// Logger is the minimal structured logger receiving the internal failures, which is the seam for wiring
+// the logging libraries, e.g. zap and logrus. The keyvals are the alternating keys and values,
+// e.g. Warn("getter failed", "prefix", "user", "err", err).
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// nopLogger discards all logs, which is the default Logger.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+func (nopLogger) Warn(msg string, keyvals ...interface{}) {}
+
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+
+// loggerOrNop returns the logger, or the one discarding all logs if it's nil.
+func loggerOrNop(l Logger) Logger {
+	if l == nil {
+		return nopLogger{}
+	}
+
+	return l
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockLoggerCTX = context.Background()
+)
+
+// mockLogger records the messages by the levels.
+type mockLogger struct {
+	mut  sync.Mutex
+	logs map[string][]string
+}
+
+func newMockLogger() *mockLogger {
+	return &mockLogger{logs: map[string][]string{}}
+}
+
+func (l *mockLogger) log(level, msg string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.logs[level] = append(l.logs[level], msg)
+}
+
+func (l *mockLogger) messages(level string) []string {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	return append([]string{}, l.logs[level]...)
+}
+
+func (l *mockLogger) Debug(msg string, keyvals ...interface{}) { l.log("debug", msg) }
+
+func (l *mockLogger) Warn(msg string, keyvals ...interface{}) { l.log("warn", msg) }
+
+func (l *mockLogger) Error(msg string, keyvals ...interface{}) { l.log("error", msg) }
+
+type loggerSuite struct {
+	suite.Suite
+
+	logger *mockLogger
+}
+
+func (s *loggerSuite) SetupSuite() {}
+
+func (s *loggerSuite) TearDownSuite() {}
+
+func (s *loggerSuite) SetupTest() {
+	s.logger = newMockLogger()
+}
+
+func (s *loggerSuite) TearDownTest() {}
+
+func TestLoggerSuite(t *testing.T) {
+	suite.Run(t, new(loggerSuite))
+}
+
+func (s *loggerSuite) TestNopLogger() {
+	s.Require().Equal(nopLogger{}, loggerOrNop(nil))
+	s.Require().Equal(s.logger, loggerOrNop(s.logger))
+}
+
+func (s *loggerSuite) TestWithLogger() {
+	local := &failingAdapter{Adapter: NewTinyLFU(10000), fail: true}
+	f := NewFactory(NewTinyLFU(10000), local, WithLogger(s.logger))
+	defer f.Close()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "logged",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Hour},
+			},
+		},
+	})
+
+	// the getter errors
+	var v string
+	s.Require().Error(c.GetByFunc(mockLoggerCTX, "logged", "key", &v, func() (interface{}, error) {
+		return nil, errors.New("origin is down")
+	}))
+	res, err := c.MGetByFunc(mockLoggerCTX, "logged", []string{"key"}, func(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+		return nil, errors.New("origin is down")
+	})
+	s.Require().NoError(err)
+	s.Require().Error(res.Get(mockLoggerCTX, 0, &v))
+	s.Require().Equal([]string{"cache: getter failed", "cache: getter failed"}, s.logger.messages("warn"))
+
+	// the failures of refilling the local cache are ignored by default
+	s.Require().NoError(c.Set(mockLoggerCTX, "logged", "key", "value"))
+	s.Require().Contains(s.logger.messages("warn"), "cache: refilling the local cache failed")
+
+	// the malformed events
+	f.(*factory).subscribedEventsHandler()(mockLoggerCTX, nil, errors.New("malformed event"))
+	s.Require().Equal([]string{"cache: handling the subscribed event failed"}, s.logger.messages("error"))
+}
@@ -1,7 +1,12 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strconv"
 
 	"github.com/klauspost/compress/s2"
 	"github.com/vmihailenco/msgpack/v5"
@@ -20,14 +25,13 @@ const (
 )
 
 // Marshal marshals value by msgpack + compress
+//
+// It holds no memory across calls: s2 compresses each value independently without a shared dictionary,
+// and the output buffer is allocated per call. The only pooling is the sync.Pool of encoders inside msgpack
+// (and the one of decoders for Unmarshal), which is released by the garbage collector and not configurable here.
 func Marshal(value interface{}) ([]byte, error) {
-	switch value := value.(type) {
-	case nil:
-		return nil, nil
-	case []byte:
-		return value, nil
-	case string:
-		return []byte(value), nil
+	if b, ok := marshalRaw(value); ok {
+		return b, nil
 	}
 
 	b, err := msgpack.Marshal(value)
@@ -38,6 +42,62 @@ func Marshal(value interface{}) ([]byte, error) {
 	return compress(b), nil
 }
 
+// MarshalerOptions is an alias for functional argument.
+type MarshalerOptions func(opts *marshalerOptions)
+
+// marshalerOptions contains all options which will be applied when calling NewMarshaler().
+type marshalerOptions struct {
+	onCompressionStats func(original, compressed int)
+}
+
+// WithCompressionStats reports the sizes before and after compressing on each marshal that compresses,
+// i.e. the msgpack-encoded values not shorter than the compression threshold, which measures whether
+// the compression is net-positive for the values.
+func WithCompressionStats(f func(original, compressed int)) MarshalerOptions {
+	return func(opts *marshalerOptions) {
+		opts.onCompressionStats = f
+	}
+}
+
+func loadMarshalerOptions(options ...MarshalerOptions) *marshalerOptions {
+	opts := &marshalerOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+// NewMarshaler returns Marshal and Unmarshal customized by the options, e.g. WithCompressionStats().
+// The marshaled bytes are the same as the ones of Marshal.
+func NewMarshaler(options ...MarshalerOptions) (MarshalFunc, UnmarshalFunc) {
+	o := loadMarshalerOptions(options...)
+	if o.onCompressionStats == nil {
+		return Marshal, Unmarshal
+	}
+
+	marshal := func(value interface{}) ([]byte, error) {
+		if b, ok := marshalRaw(value); ok {
+			return b, nil
+		}
+
+		b, err := msgpack.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		cb := compress(b)
+		if cb[len(cb)-1] == s2Compression {
+			// excluding the trailing byte of the compression method
+			o.onCompressionStats(len(b), len(cb)-1)
+		}
+
+		return cb, nil
+	}
+
+	return marshal, Unmarshal
+}
+
 func compress(data []byte) []byte {
 	if len(data) < compressionThreshold {
 		n := len(data) + 1
@@ -56,37 +116,228 @@ func compress(data []byte) []byte {
 
 // Unmarshal unmarshals binary with the compress + msgpack
 func Unmarshal(b []byte, value interface{}) error {
-	if len(b) == 0 {
+	if unmarshalRaw(b, value) {
 		return nil
 	}
 
-	switch value := value.(type) {
-	case nil:
-		return nil
-	case *[]byte:
-		clone := make([]byte, len(b))
-		copy(clone, b)
-		*value = clone
-		return nil
-	case *string:
-		*value = string(b)
-		return nil
+	b, err := decompress(b)
+	if err != nil {
+		return err
 	}
 
+	return msgpack.Unmarshal(b, value)
+}
+
+// chainUnmarshal tries the fallbacks in order when the primary unmarshal function fails.
+// The container is reset before each fallback, and the error of the primary one is returned if all of them fail.
+func chainUnmarshal(primary UnmarshalWithCtxFunc, fallbacks ...UnmarshalFunc) UnmarshalWithCtxFunc {
+	return func(ctx context.Context, b []byte, value interface{}) error {
+		err := primary(ctx, b, value)
+		if err == nil {
+			return nil
+		}
+
+		for _, fallback := range fallbacks {
+			resetValue(value)
+			if fallback(b, value) == nil {
+				return nil
+			}
+		}
+
+		return err
+	}
+}
+
+// resetValue sets the value pointed by the pointer to its zero value, which discards the partially unmarshaled fields.
+func resetValue(value interface{}) {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
+func decompress(b []byte) ([]byte, error) {
 	switch c := b[len(b)-1]; c {
 	case noCompression:
-		b = b[:len(b)-1]
+		return b[:len(b)-1], nil
 	case s2Compression:
-		b = b[:len(b)-1]
+		return s2.Decode(nil, b[:len(b)-1])
+	default:
+		return nil, fmt.Errorf("unknown compression method: %x", c)
+	}
+}
+
+// MsgpackMarshal marshals value by msgpack without compression.
+// Like Marshal, nil, bytes and strings are stored as they are.
+func MsgpackMarshal(value interface{}) ([]byte, error) {
+	if b, ok := marshalRaw(value); ok {
+		return b, nil
+	}
+
+	return msgpack.Marshal(value)
+}
+
+// MsgpackUnmarshal unmarshals binary marshaled by MsgpackMarshal.
+func MsgpackUnmarshal(b []byte, value interface{}) error {
+	if unmarshalRaw(b, value) {
+		return nil
+	}
 
-		var err error
-		b, err = s2.Decode(nil, b)
+	return msgpack.Unmarshal(b, value)
+}
+
+// NewCanonicalJSONMarshaler returns the JSON codec producing the identical bytes for the logically identical values,
+// which suits the byte-equality assertions and the content-addressed keys. The map keys are sorted,
+// the HTML characters are not escaped, and no trailing newline is appended.
+// Notice that Marshal and MsgpackMarshal don't sort the map keys.
+func NewCanonicalJSONMarshaler() (MarshalFunc, UnmarshalFunc) {
+	marshal := func(value interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		// encoding/json sorts the map keys already
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(value); err != nil {
+			return nil, err
+		}
+
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+
+	return marshal, json.Unmarshal
+}
+
+// PlainMarshal stores the strings and bytes as they are, the numbers and booleans as their text, e.g. 100 as "100",
+// and marshals the other values by JSON. The values are readable as the raw strings by other services and redis tools.
+// The primitives are detected by their kinds, so the custom marshalers of the named primitive types are ignored.
+// The pointers are dereferenced first, and the nil pointers are stored as nil like the nil values.
+func PlainMarshal(value interface{}) ([]byte, error) {
+	if b, ok := marshalRaw(value); ok {
+		return b, nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+
+		if b, ok := marshalRaw(v.Interface()); ok {
+			return b, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.AppendUint(nil, v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.AppendBool(nil, v.Bool()), nil
+	}
+
+	return json.Marshal(value)
+}
+
+// PlainUnmarshal unmarshals binary marshaled by PlainMarshal by the kind of the container,
+// the strings, bytes, numbers and booleans are parsed from the text, and the others are unmarshaled by JSON.
+// The containers of pointers are filled through, allocating the nil ones, e.g. a **string receives the string.
+// Notice that the containers of interface{} are always unmarshaled by JSON, since the kind is unknown.
+func PlainUnmarshal(b []byte, value interface{}) error {
+	if unmarshalRaw(b, value) {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return json.Unmarshal(b, value)
+	}
+
+	elem := v.Elem()
+	if elem.Kind() == reflect.Ptr {
+		for elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				elem.Set(reflect.New(elem.Type().Elem()))
+			}
+			elem = elem.Elem()
+		}
+
+		if unmarshalRaw(b, elem.Addr().Interface()) {
+			return nil
+		}
+	}
+
+	switch elem.Kind() {
+	case reflect.String:
+		elem.SetString(string(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(b), 10, elem.Type().Bits())
 		if err != nil {
 			return err
 		}
+		elem.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(string(b), 10, elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(b), elem.Type().Bits())
+		if err != nil {
+			return err
+		}
+		elem.SetFloat(f)
+	case reflect.Bool:
+		t, err := strconv.ParseBool(string(b))
+		if err != nil {
+			return err
+		}
+		elem.SetBool(t)
 	default:
-		return fmt.Errorf("unknown compression method: %x", c)
+		return json.Unmarshal(b, value)
 	}
 
-	return msgpack.Unmarshal(b, value)
+	return nil
+}
+
+// marshalRaw returns the value as it is if it's nil, bytes or a string.
+func marshalRaw(value interface{}) ([]byte, bool) {
+	switch value := value.(type) {
+	case nil:
+		return nil, true
+	case []byte:
+		return value, true
+	case string:
+		return []byte(value), true
+	}
+
+	return nil, false
+}
+
+// unmarshalRaw fills the value as it is if the binary is empty or the value is nil, bytes or a string.
+func unmarshalRaw(b []byte, value interface{}) bool {
+	if len(b) == 0 {
+		return true
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return true
+	case *[]byte:
+		clone := make([]byte, len(b))
+		copy(clone, b)
+		*value = clone
+		return true
+	case *string:
+		*value = string(b)
+		return true
+	}
+
+	return false
 }
@@ -1,10 +1,17 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/suite"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var (
@@ -34,11 +41,151 @@ type mockStruct struct {
 	child     *mockStruct
 }
 
+// mockCodecStruct has no time fields, whose locations differ between codecs.
+type mockCodecStruct struct {
+	ID  int64
+	Key string
+}
+
 func (s *marshalerSuite) TestMarshaler() {
+	s.testMarshaler(Marshal, Unmarshal)
+}
+
+func (s *marshalerSuite) TestMarshalerWithCompressionStats() {
+	type stats struct{ original, compressed int }
+	reported := []stats{}
+	marshal, unmarshal := NewMarshaler(WithCompressionStats(func(original, compressed int) {
+		reported = append(reported, stats{original, compressed})
+	}))
+	s.testMarshaler(marshal, unmarshal)
+	reported = reported[:0]
+
+	// not compressed below the threshold
+	_, err := marshal(mockCodecStruct{ID: 1, Key: "short"})
+	s.Require().NoError(err)
+	s.Require().Empty(reported)
+
+	// the same bytes as Marshal
+	st := mockCodecStruct{ID: 2, Key: strings.Repeat("long", 100)}
+	bs, err := marshal(st)
+	s.Require().NoError(err)
+	expected, err := Marshal(st)
+	s.Require().NoError(err)
+	s.Require().Equal(expected, bs)
+
+	raw, err := msgpack.Marshal(st)
+	s.Require().NoError(err)
+	s.Require().Equal([]stats{{original: len(raw), compressed: len(bs) - 1}}, reported)
+	s.Require().Less(reported[0].compressed, reported[0].original)
+
+	var ret mockCodecStruct
+	s.Require().NoError(unmarshal(bs, &ret))
+	s.Require().Equal(st, ret)
+}
+
+func (s *marshalerSuite) TestMsgpackMarshaler() {
+	s.testMarshaler(MsgpackMarshal, MsgpackUnmarshal)
+
+	// a plain string round-trips
+	bs, err := MsgpackMarshal("this is a string")
+	s.Require().NoError(err)
+	s.Require().Equal([]byte("this is a string"), bs)
+
+	// without compression
+	num := 100
+	bs, err = MsgpackMarshal(num)
+	s.Require().NoError(err)
+
+	var retNum int
+	s.Require().NoError(msgpack.Unmarshal(bs, &retNum))
+	s.Require().Equal(num, retNum)
+}
+
+func (s *marshalerSuite) TestCanonicalJSONMarshaler() {
+	marshal, unmarshal := NewCanonicalJSONMarshaler()
+	s.testMarshaler(marshal, unmarshal)
+
+	type mapStruct struct {
+		Tags   map[string]int
+		Nested map[string]map[string]string
+	}
+	st := mapStruct{Tags: map[string]int{}, Nested: map[string]map[string]string{}}
+	for i := 0; i < 100; i++ {
+		st.Tags[strconv.Itoa(i)] = i
+		st.Nested[strconv.Itoa(i)] = map[string]string{"<b>": "&", strconv.Itoa(i): "v"}
+	}
+
+	expected, err := marshal(st)
+	s.Require().NoError(err)
+	s.Require().False(bytes.HasSuffix(expected, []byte("\n")))
+	s.Require().Contains(string(expected), `{"0":"v","<b>":"&"}`)
+	for i := 0; i < 10; i++ {
+		bs, err := marshal(st)
+		s.Require().NoError(err)
+		s.Require().Equal(expected, bs)
+	}
+
+	var ret mapStruct
+	s.Require().NoError(unmarshal(expected, &ret))
+	s.Require().Equal(st, ret)
+}
+
+func (s *marshalerSuite) TestPlainMarshaler() {
+	s.testMarshaler(PlainMarshal, PlainUnmarshal)
+
+	type status string
+	str, bs, n := "mock-string", []byte("mock-bytes"), 100
+	tests := []struct {
+		Desc      string
+		Value     interface{}
+		Container interface{}
+		ExpBytes  []byte
+	}{
+		{Desc: "string", Value: "mock-string", Container: new(string), ExpBytes: []byte("mock-string")},
+		{Desc: "named string", Value: status("ok"), Container: new(status), ExpBytes: []byte("ok")},
+		{Desc: "int", Value: 100, Container: new(int), ExpBytes: []byte("100")},
+		{Desc: "negative int8", Value: int8(-8), Container: new(int8), ExpBytes: []byte("-8")},
+		{Desc: "uint64", Value: uint64(18446744073709551615), Container: new(uint64), ExpBytes: []byte("18446744073709551615")},
+		{Desc: "float64", Value: 3.14, Container: new(float64), ExpBytes: []byte("3.14")},
+		{Desc: "float32", Value: float32(0.1), Container: new(float32), ExpBytes: []byte("0.1")},
+		{Desc: "bool", Value: true, Container: new(bool), ExpBytes: []byte("true")},
+		{Desc: "slice", Value: []int{1, 2}, Container: new([]int), ExpBytes: []byte("[1,2]")},
+		{Desc: "map", Value: map[string]string{"k": "v"}, Container: new(map[string]string), ExpBytes: []byte(`{"k":"v"}`)},
+		{Desc: "pointer to string", Value: &str, Container: new(*string), ExpBytes: []byte("mock-string")},
+		{Desc: "pointer to bytes", Value: &bs, Container: new(*[]byte), ExpBytes: []byte("mock-bytes")},
+		{Desc: "pointer to int", Value: &n, Container: new(*int), ExpBytes: []byte("100")},
+	}
+
+	for _, t := range tests {
+		b, err := PlainMarshal(t.Value)
+		s.Require().NoError(err, t.Desc)
+		s.Require().Equal(t.ExpBytes, b, t.Desc)
+
+		s.Require().NoError(PlainUnmarshal(b, t.Container), t.Desc)
+		s.Require().Equal(t.Value, reflect.ValueOf(t.Container).Elem().Interface(), t.Desc)
+	}
+
+	// the pointers are marshaled as their values
+	b, err := PlainMarshal(&str)
+	s.Require().NoError(err)
+	var ret string
+	s.Require().NoError(PlainUnmarshal(b, &ret))
+	s.Require().Equal(str, ret)
+
+	b, err = PlainMarshal((*string)(nil))
+	s.Require().NoError(err)
+	s.Require().Nil(b)
+
+	// overflow
+	s.Require().Error(PlainUnmarshal([]byte("300"), new(int8)))
+	s.Require().Error(PlainUnmarshal([]byte("not-a-number"), new(int)))
+}
+
+// testMarshaler verifies the codec round-trips the values. The times are compared in the local location,
+// since the codecs decode the location differently, e.g. JSON keeps the offset only.
+func (s *marshalerSuite) testMarshaler(marshal MarshalFunc, unmarshal UnmarshalFunc) {
 	var bs []byte
 	var err error
-	marshal := Marshal
-	unmarshal := Unmarshal
 
 	// nil
 	var null error
@@ -88,6 +235,7 @@ func (s *marshalerSuite) TestMarshaler() {
 
 	retSt := mockStruct{}
 	s.Require().NoError(unmarshal(bs, &retSt))
+	retSt.CreatedAt = retSt.CreatedAt.In(time.Local)
 	s.Require().Equal(st, retSt)
 
 	// struct without nil pointer
@@ -104,6 +252,7 @@ func (s *marshalerSuite) TestMarshaler() {
 
 	var retSt2 mockStruct
 	s.Require().NoError(unmarshal(bs, &retSt2))
+	retSt2.CreatedAt = retSt2.CreatedAt.In(time.Local)
 	s.Require().Equal(st, retSt2)
 
 	// compress
@@ -117,5 +266,29 @@ func (s *marshalerSuite) TestMarshaler() {
 
 	var retSt3 mockStruct
 	s.Require().NoError(unmarshal(bs, &retSt3))
+	retSt3.CreatedAt = retSt3.CreatedAt.In(time.Local)
 	s.Require().Equal(st3, retSt3)
 }
+
+func (s *marshalerSuite) TestChainUnmarshal() {
+	unmarshal := func(b []byte, value interface{}) error {
+		return chainUnmarshal(withCtxUnmarshal(MsgpackUnmarshal), json.Unmarshal)(context.Background(), b, value)
+	}
+
+	// the primary one
+	bs, err := MsgpackMarshal(mockCodecStruct{ID: 1, Key: "msgpack"})
+	s.Require().NoError(err)
+	var ret mockCodecStruct
+	s.Require().NoError(unmarshal(bs, &ret))
+	s.Require().Equal(mockCodecStruct{ID: 1, Key: "msgpack"}, ret)
+
+	// the fallback one
+	bs, err = json.Marshal(mockCodecStruct{ID: 2, Key: "json"})
+	s.Require().NoError(err)
+	ret = mockCodecStruct{}
+	s.Require().NoError(unmarshal(bs, &ret))
+	s.Require().Equal(mockCodecStruct{ID: 2, Key: "json"}, ret)
+
+	// the error of the primary one is returned
+	s.Require().Error(unmarshal([]byte{0xc1}, &ret))
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// natsDrainTimeout limits the duration waiting for the subscriptions drained
+	natsDrainTimeout = 5 * time.Second
+	// natsDrainPollInterval is the interval checking whether the subscriptions are drained
+	natsDrainPollInterval = 10 * time.Millisecond
+)
+
+// NewNATSPubsub generates Pubsub with nats, which is able to be used by WithPubSub() independent of the adapters.
+func NewNATSPubsub(nc *nats.Conn) Pubsub {
+	return &natsPubsub{
+		nc:       nc,
+		messChan: make(chan Message),
+		closed:   make(chan struct{}),
+	}
+}
+
+type natsPubsub struct {
+	nc   *nats.Conn
+	subs []*nats.Subscription
+
+	subOnce   sync.Once
+	closeOnce sync.Once
+	stopOnce  sync.Once
+	messChan  chan Message
+	closed    chan struct{}
+	// sendMut prevents sending messages into the closed channel
+	sendMut sync.RWMutex
+	subMut  sync.Mutex
+}
+
+func (n *natsPubsub) Pub(ctx context.Context, topic string, message []byte) error {
+	return n.nc.Publish(topic, message)
+}
+
+// Sub subscribes the topics, and closes the returned channel if it fails to subscribe.
+func (n *natsPubsub) Sub(ctx context.Context, topic ...string) <-chan Message {
+	n.subOnce.Do(func() {
+		n.subMut.Lock()
+		defer n.subMut.Unlock()
+
+		for _, t := range topic {
+			sub, err := n.nc.Subscribe(t, n.forward)
+			if err != nil {
+				n.unsubscribe()
+				n.closeMessChan()
+				return
+			}
+
+			n.subs = append(n.subs, sub)
+		}
+	})
+
+	return n.messChan
+}
+
+// forward sends the message into the channel unless Close() was called.
+func (n *natsPubsub) forward(msg *nats.Msg) {
+	n.sendMut.RLock()
+	defer n.sendMut.RUnlock()
+
+	select {
+	case <-n.closed:
+	case n.messChan <- &natsMessage{topic: msg.Subject, content: msg.Data}:
+	}
+}
+
+func (n *natsPubsub) Close() {
+	n.closeOnce.Do(func() {
+		n.subMut.Lock()
+		subs := n.subs
+		n.subs = nil
+		n.subMut.Unlock()
+
+		// drain the subscriptions to deliver the pending messages
+		for _, sub := range subs {
+			sub.Drain()
+		}
+
+		deadline := time.Now().Add(natsDrainTimeout)
+		for _, sub := range subs {
+			for sub.IsValid() && time.Now().Before(deadline) {
+				time.Sleep(natsDrainPollInterval)
+			}
+		}
+
+		n.closeMessChan()
+	})
+}
+
+func (n *natsPubsub) unsubscribe() {
+	for _, sub := range n.subs {
+		sub.Unsubscribe()
+	}
+	n.subs = nil
+}
+
+func (n *natsPubsub) closeMessChan() {
+	n.stopOnce.Do(func() {
+		close(n.closed)
+
+		// wait for the messages being sent
+		n.sendMut.Lock()
+		close(n.messChan)
+		n.sendMut.Unlock()
+	})
+}
+
+type natsMessage struct {
+	topic   string
+	content []byte
+}
+
+func (m *natsMessage) Topic() string {
+	return m.topic
+}
+
+func (m *natsMessage) Content() []byte {
+	return m.content
+}
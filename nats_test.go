@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	mockNATSPayload = "mock-nats-payload"
+)
+
+var (
+	mockNATSCTX = context.Background()
+)
+
+type natsSuite struct {
+	suite.Suite
+
+	nc     *nats.Conn
+	pubsub *natsPubsub
+}
+
+func (s *natsSuite) SetupSuite() {
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		s.T().Skip("nats server is not available:", err)
+	}
+
+	s.nc = nc
+}
+
+func (s *natsSuite) TearDownSuite() {
+	if s.nc != nil {
+		s.nc.Close()
+	}
+}
+
+func (s *natsSuite) SetupTest() {
+	s.pubsub = NewNATSPubsub(s.nc).(*natsPubsub)
+}
+
+func (s *natsSuite) TearDownTest() {
+	s.pubsub.Close()
+}
+
+func TestNATSSuite(t *testing.T) {
+	suite.Run(t, new(natsSuite))
+}
+
+func (s *natsSuite) TestPubSub() {
+	messChan := s.pubsub.Sub(mockNATSCTX, mockEvictTopic, "another-topic")
+	// subscribed only once
+	s.Require().Equal(messChan, s.pubsub.Sub(mockNATSCTX, "ignored-topic"))
+	s.Require().NoError(s.nc.Flush())
+
+	s.Require().NoError(s.pubsub.Pub(mockNATSCTX, mockEvictTopic, []byte(mockNATSPayload)))
+	mess := <-messChan
+	s.Require().Equal(mockEvictTopic, mess.Topic())
+	s.Require().Equal([]byte(mockNATSPayload), mess.Content())
+
+	s.Require().NoError(s.pubsub.Pub(mockNATSCTX, "another-topic", []byte(mockNATSPayload)))
+	mess = <-messChan
+	s.Require().Equal("another-topic", mess.Topic())
+	s.Require().Equal([]byte(mockNATSPayload), mess.Content())
+}
+
+func (s *natsSuite) TestClose() {
+	messChan := s.pubsub.Sub(mockNATSCTX, mockEvictTopic)
+	s.Require().NoError(s.nc.Flush())
+
+	received := make(chan []byte, 1)
+	go func() {
+		for mess := range messChan {
+			received <- mess.Content()
+		}
+		close(received)
+	}()
+
+	// pending messages are delivered before closing
+	s.Require().NoError(s.pubsub.Pub(mockNATSCTX, mockEvictTopic, []byte(mockNATSPayload)))
+	s.Require().NoError(s.nc.Flush())
+	s.pubsub.Close()
+
+	s.Require().Equal([]byte(mockNATSPayload), <-received)
+	select {
+	case _, ok := <-received:
+		s.Require().False(ok)
+	case <-time.After(time.Second):
+		s.Fail("channel not closed")
+	}
+
+	// closing twice is fine
+	s.pubsub.Close()
+}
+
+func (s *natsSuite) TestCloseWithoutSub() {
+	s.pubsub.Close()
+}
@@ -1,5 +1,10 @@
 package cache
 
+import (
+	"context"
+	"time"
+)
+
 // MarshalFunc specifies the algorithm during marshaling the value to bytes.
 // The default is json.Marshal.
 type MarshalFunc func(interface{}) ([]byte, error)
@@ -8,20 +13,115 @@ type MarshalFunc func(interface{}) ([]byte, error)
 // The default is json.Unmarshal
 type UnmarshalFunc func([]byte, interface{}) error
 
+// MarshalWithCtxFunc is the context-aware MarshalFunc, which is able to use the per-request values, e.g. tenant ID.
+type MarshalWithCtxFunc func(ctx context.Context, value interface{}) ([]byte, error)
+
+// UnmarshalWithCtxFunc is the context-aware UnmarshalFunc.
+type UnmarshalWithCtxFunc func(ctx context.Context, b []byte, value interface{}) error
+
+// withCtxMarshal converts MarshalFunc into MarshalWithCtxFunc ignoring the context.
+func withCtxMarshal(marshal MarshalFunc) MarshalWithCtxFunc {
+	return func(ctx context.Context, value interface{}) ([]byte, error) {
+		return marshal(value)
+	}
+}
+
+// withCtxUnmarshal converts UnmarshalFunc into UnmarshalWithCtxFunc ignoring the context.
+func withCtxUnmarshal(unmarshal UnmarshalFunc) UnmarshalWithCtxFunc {
+	return func(ctx context.Context, b []byte, value interface{}) error {
+		return unmarshal(b, value)
+	}
+}
+
 // FactoryOptions is an alias for functional argument.
 type FactoryOptions func(opts *factoryOptions)
 
 // factoryOptions contains all options which will be applied when calling NewFactory().
 type factoryOptions struct {
-	marshalFunc   MarshalFunc
-	unmarshalFunc UnmarshalFunc
-	onCacheHit    func(prefix string, key string, count int)
-	onCacheMiss   func(prefix string, key string, count int)
-	onLCCostAdd   func(prefix string, key string, cost int)
-	onLCCostEvict func(prefix string, key string, cost int)
-	pubsub        Pubsub
+	marshalFunc        MarshalFunc
+	unmarshalFunc      UnmarshalFunc
+	onCacheHit         func(prefix string, key string, count int)
+	onCacheMiss        func(prefix string, key string, count int)
+	onLCCostAdd        func(prefix string, key string, cost int)
+	onLCCostEvict      func(prefix string, key string, cost int)
+	onEventError       func(err error)
+	onMGetterFallback  func(prefix string, served int, err error)
+	onStaleServe       func(ctx context.Context, prefix, key string, age time.Duration)
+	onBackgroundRefill func(ctx context.Context, prefix string, keys []string, err error)
+	pubsub             Pubsub
+	compressEvent      bool
+	eventMarshal       func(EvictionEvent) ([]byte, error)
+	eventUnmarshal     func([]byte, *EvictionEvent) error
+	topicNamespace     string
+	pubsubRequired     bool
+	opTimeout          time.Duration
+	timeoutPolicy      TimeoutPolicy
+	refillPolicy       RefillFailurePolicy
+	onRefillError      func(err error)
+	pooledResults      bool
+	keyTransformer     func(ctx context.Context, cacheKey string) string
+	localHitsOnError   bool
+	maxMGetKeys        int
+	oversizedPolicy    OversizedMGetPolicy
+	getterPolicy       GetterFailurePolicy
+	unmarshalAsMiss    bool
+	onUnmarshalError   func(prefix string, key string, err error)
+	logger             Logger
+	prefixRegistry     *PrefixRegistry
+	keyVersion         string
+	// factoryID is nil if it's not specified, which distinguishes from the invalid empty one
+	factoryID *string
 }
 
+// TimeoutPolicy decides how to handle the shared cache operations exceeding the timeout specified by WithOperationTimeout().
+type TimeoutPolicy int32
+
+const (
+	// TimeoutPolicyDegrade treats the keys as cache-miss when loading, and skips the shared cache when refilling.
+	// It's the default policy.
+	TimeoutPolicyDegrade TimeoutPolicy = iota
+	// TimeoutPolicyFail returns the timeout error to the caller.
+	TimeoutPolicyFail
+)
+
+// RefillFailurePolicy decides how to handle the failure of the local cache after the shared cache is written.
+type RefillFailurePolicy int32
+
+const (
+	// RefillPolicyIgnoreLocalFailure keeps the write succeeded, which favors the availability. The stale local value
+	// is dropped if possible, and other nodes are still notified to evict theirs. It's the default policy.
+	RefillPolicyIgnoreLocalFailure RefillFailurePolicy = iota
+	// RefillPolicyRollbackShared deletes the keys written into the shared cache and returns the error,
+	// which favors the consistency between the tiers at the cost of losing the cached values.
+	// For the prefixes using WriteBehind, the pending writes are dropped instead.
+	RefillPolicyRollbackShared
+	// RefillPolicyFailOperation returns the error but keeps the values in the shared cache,
+	// so the caller is aware of the divergence and able to retry.
+	RefillPolicyFailOperation
+)
+
+// OversizedMGetPolicy decides how to handle MGet() with more deduped keys than the limit specified by WithMaxMGetKeys().
+type OversizedMGetPolicy int32
+
+const (
+	// OversizedMGetPolicyFail returns the error of ErrTooManyKeys to the caller. It's the default policy.
+	OversizedMGetPolicyFail OversizedMGetPolicy = iota
+	// OversizedMGetPolicyChunk splits the keys into the sequential sub-batches no larger than the limit,
+	// which bounds the size of each round trip instead of the whole result.
+	OversizedMGetPolicyChunk
+)
+
+// GetterFailurePolicy decides how MGet() handles the error of the getter reloading the missing keys.
+type GetterFailurePolicy int32
+
+const (
+	// GetterFailurePolicyPartial keeps the values loaded from the cache, and the missing keys carry the error
+	// of the getter returned by Result.Get(). MGet() itself returns no error. It's the default policy.
+	GetterFailurePolicyPartial GetterFailurePolicy = iota
+	// GetterFailurePolicyFail discards the whole result and returns the error of the getter, i.e. all-or-nothing.
+	GetterFailurePolicyFail
+)
+
 // WithMarshalFunc sets up the specified marshal function.
 // Needs to consider with unmarshal function at the same time.
 func WithMarshalFunc(f MarshalFunc) FactoryOptions {
@@ -45,6 +145,80 @@ func WithPubSub(pb Pubsub) FactoryOptions {
 	}
 }
 
+// WithOperationTimeout bounds each adapter operation by the timeout when the incoming context has no deadline,
+// which prevents a slow cache from hanging the request. The timeouts of the shared cache are handled by the
+// TimeoutPolicy specified by WithTimeoutPolicy(). Notice that deleting always returns the error,
+// otherwise the stale values are left in the cache.
+func WithOperationTimeout(d time.Duration) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.opTimeout = d
+	}
+}
+
+// WithTimeoutPolicy sets up the policy handling the timeouts specified by WithOperationTimeout().
+func WithTimeoutPolicy(p TimeoutPolicy) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.timeoutPolicy = p
+	}
+}
+
+// WithFactoryID overrides the generated UUID identifying the factory, which is attached to the broadcasted events
+// to ignore the ones sent by itself. It makes the evictions traceable with a stable and readable node identity.
+// Notice that the ID must be unique across the nodes, otherwise the evictions from others are ignored.
+func WithFactoryID(id string) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.factoryID = &id
+	}
+}
+
+// WithPrefixRegistry sets up the registry where the prefixes of NewCache() are unique, which is shared by
+// the factories intentionally, so that they don't both serve the same prefix. By default, each factory has
+// its own registry, i.e. the factories are independent of each other.
+func WithPrefixRegistry(r *PrefixRegistry) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.prefixRegistry = r
+	}
+}
+
+// WithTopicNamespace isolates the topics of the broadcasted events by the namespace, e.g. the environment name,
+// so that the environments sharing the same pubsub, like staging and production on a redis, don't evict each other.
+// The factories exchange the events only if they are in the same namespace.
+func WithTopicNamespace(namespace string) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.topicNamespace = namespace
+	}
+}
+
+// WithPubSubRequired makes NewCache() panic when a prefix uses both shared and local caches without the pubsub,
+// since the local caches on other nodes are never invalidated in such case.
+func WithPubSubRequired() FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.pubsubRequired = true
+	}
+}
+
+// WithEventCodec sets up the wire format of the broadcasted evictions, e.g. protobuf, which makes them exchangeable
+// with the services in other languages. The default is JSON. The codec must preserve FID of the events, otherwise
+// the nodes evict their local caches by their own events as well. It doesn't work with WithCompressedEvents(),
+// since the compression is a part of the default format.
+func WithEventCodec(
+	marshal func(e EvictionEvent) ([]byte, error), unmarshal func(b []byte, e *EvictionEvent) error,
+) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.eventMarshal = marshal
+		opts.eventUnmarshal = unmarshal
+	}
+}
+
+// WithCompressedEvents compresses the keys of the broadcasted evictions with their common prefix factored out,
+// which reduces the bandwidth of evicting a large number of keys. The subscribers understand both formats,
+// but the old versions of this package don't, so enable it only after all nodes are upgraded.
+func WithCompressedEvents() FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.compressEvent = true
+	}
+}
+
 // OnCacheHitFunc sets up the callback function on cache hitted
 func OnCacheHitFunc(f func(prefix string, key string, count int)) FactoryOptions {
 	return func(opts *factoryOptions) {
@@ -73,6 +247,150 @@ func OnLocalCacheCostEvictFunc(f func(prefix string, key string, cost int)) Fact
 	}
 }
 
+// OnEventErrorFunc sets up the callback function on failing to handle the subscribed events,
+// e.g. the malformed messages and the unknown events wrapping ErrUnknownEvent.
+// Counting them helps detect the misconfigured publishers.
+func OnEventErrorFunc(f func(err error)) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.onEventError = f
+	}
+}
+
+// OnMGetterFallbackFunc sets up the callback function on falling back to Setting.MGetterFallbacks when MGetter fails.
+// The served is the index of the fallback serving the keys, or -1 if all of them fail, and the err is the error of MGetter.
+func OnMGetterFallbackFunc(f func(prefix string, served int, err error)) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.onMGetterFallback = f
+	}
+}
+
+// OnStaleServeFunc sets up the callback function on serving the value whose Attribute.SoftTTL is passed,
+// which schedules the revalidation in the background. The age is the time since the value is written.
+// It's triggered by GetByFunc(), and by Get() and MGet() with the MGetter only, since nothing revalidates otherwise.
+func OnStaleServeFunc(f func(ctx context.Context, prefix, key string, age time.Duration)) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.onStaleServe = f
+	}
+}
+
+// OnBackgroundRefillFunc sets up the callback function on finishing the revalidation of the stale values in the background,
+// see OnStaleServeFunc(). The err is nil if the keys are reloaded and refilled, the keys missing in the getter are
+// skipped without errors. The keys being revalidated already are not revalidated again, so they're reported once.
+func OnBackgroundRefillFunc(f func(ctx context.Context, prefix string, keys []string, err error)) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.onBackgroundRefill = f
+	}
+}
+
+// OnUnmarshalErrorFunc sets up the callback function on failing to unmarshal the value of the key,
+// e.g. the corrupted values or the ones of the old schema. Counting them helps monitor the corruption rates.
+func OnUnmarshalErrorFunc(f func(prefix string, key string, err error)) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.onUnmarshalError = f
+	}
+}
+
+// WithLogger sets up the logger receiving the internal failures, which are swallowed or handled in the background
+// otherwise, e.g. the malformed events, the failures of refilling the local cache and the getter errors.
+// The default discards all logs.
+func WithLogger(l Logger) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.logger = l
+	}
+}
+
+// WithRefillFailurePolicy sets up the policy handling the failure of the local cache after the shared cache
+// is written, e.g. by the custom adapters. See RefillFailurePolicy for the tradeoffs.
+func WithRefillFailurePolicy(p RefillFailurePolicy) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.refillPolicy = p
+	}
+}
+
+// OnRefillFailureFunc sets up the callback function on failing to refill the local cache, which is invoked
+// regardless of the RefillFailurePolicy. The error is CacheError wrapping the error of the local cache.
+func OnRefillFailureFunc(f func(err error)) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.onRefillError = f
+	}
+}
+
+// WithPooledResults recycles the results of MGet() by the pool to reduce the allocations, which suits the high-QPS
+// services. Each result needs to be released by Result.Release() after use, otherwise it's garbage collected as usual.
+func WithPooledResults() FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.pooledResults = true
+	}
+}
+
+// WithLocalHitsOnSharedError keeps the hits of the local cache when loading from the shared cache fails,
+// and treats the keys depending on the shared cache as cache-miss, so that the getter is able to fill them.
+// It favors the availability when the shared cache is flaky but the local cache holds the hot keys.
+// It applies to the prefixes using the local cache only, others still return the error.
+// Without it, the error of the shared cache fails the whole operation, which favors the consistency.
+func WithLocalHitsOnSharedError() FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.localHitsOnError = true
+	}
+}
+
+// WithMaxMGetKeys limits the number of the deduped keys per MGet(), including MGetByFunc(), MGetWithMeta() and GetMap(),
+// which guards against the pathological calls building the huge pipelines. The oversized calls are handled by
+// the policy specified by WithOversizedMGetPolicy(). The default is zero, which means no limitation.
+func WithMaxMGetKeys(n int) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.maxMGetKeys = n
+	}
+}
+
+// WithOversizedMGetPolicy sets up the policy handling MGet() exceeding the limit of WithMaxMGetKeys().
+// The default is OversizedMGetPolicyFail.
+func WithOversizedMGetPolicy(p OversizedMGetPolicy) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.oversizedPolicy = p
+	}
+}
+
+// WithGetterFailurePolicy sets up the policy handling the error of the getter in MGet(), including Get(),
+// MGetByFunc() and GetMap(). The default is GetterFailurePolicyPartial.
+func WithGetterFailurePolicy(p GetterFailurePolicy) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.getterPolicy = p
+	}
+}
+
+// WithTreatUnmarshalErrorAsMiss treats the values failed to unmarshal as cache-miss if enabled, which self-heals
+// the corrupted values and the ones of the old schema instead of failing until they expire. The value is removed
+// from the cache, then Get() and GetByFunc() reload it by the getter once, and Result.Get() returns the error of
+// ErrCacheMiss wrapping the unmarshal error.
+func WithTreatUnmarshalErrorAsMiss(enabled bool) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.unmarshalAsMiss = enabled
+	}
+}
+
+// WithKeyTransformer transforms the cache keys by the context right before calling the adapters, e.g. injecting
+// the tenant segment carried in the context, which isolates the tenants without separate cache instances.
+// The callbacks are still given the untransformed prefixes and keys, and the evictions carry them for OnEvict()
+// on other nodes, except for the keys deleted by DelPattern() or flushed by the write-behind, which are skipped.
+// Flush() and DelPattern() transform the key prefix of the prefix as well, so the transformer should keep it
+// at the front, e.g. prepending the tenant segment.
+func WithKeyTransformer(f func(ctx context.Context, cacheKey string) string) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.keyTransformer = f
+	}
+}
+
+// WithKeyVersion tags all cache keys with the version right after the package key, e.g. ca:v2:prefix:key,
+// which invalidates the cached values at once when the build or the schema changes. The keys of other versions
+// are left to expire by their TTL. The version is applied before the transformer of WithKeyTransformer().
+// Since the evictions are broadcasted with the versioned keys, the nodes running other versions don't evict theirs.
+func WithKeyVersion(v string) FactoryOptions {
+	return func(opts *factoryOptions) {
+		opts.keyVersion = v
+	}
+}
+
 func loadFactoryOptions(options ...FactoryOptions) *factoryOptions {
 	opts := &factoryOptions{}
 	for _, option := range options {
@@ -81,3 +399,28 @@ func loadFactoryOptions(options ...FactoryOptions) *factoryOptions {
 
 	return opts
 }
+
+// GetByFuncOptions is an alias for functional argument.
+type GetByFuncOptions func(opts *getByFuncOptions)
+
+// getByFuncOptions contains all options which will be applied when calling GetByFunc().
+type getByFuncOptions struct {
+	refillLocalOnly bool
+}
+
+// WithRefillLocalOnly refills the value reloaded by the getter into the local cache only, the shared cache is left untouched.
+// It's useful when the shared cache is populated by another writer, and nothing is refilled if the local cache isn't used.
+func WithRefillLocalOnly() GetByFuncOptions {
+	return func(opts *getByFuncOptions) {
+		opts.refillLocalOnly = true
+	}
+}
+
+func loadGetByFuncOptions(options ...GetByFuncOptions) *getByFuncOptions {
+	opts := &getByFuncOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	// ErrTypeNotRegistered means the concrete type or the type name isn't registered in the TypeRegistry
+	ErrTypeNotRegistered = errors.New("type not registered")
+)
+
+// TypeRegistry maps the names to the concrete types for NewPolymorphicMarshaler(). It's safe for concurrent use.
+type TypeRegistry struct {
+	mut    sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+// NewTypeRegistry generates the empty TypeRegistry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		byName: map[string]reflect.Type{},
+		byType: map[reflect.Type]string{},
+	}
+}
+
+// Register registers the concrete type of the value by the name, e.g. Register("user.created", UserCreated{}).
+// The pointer and non-pointer types are distinct, the values are unmarshaled as the registered one.
+// The name is stored along with the values, so it should stay stable across deployments.
+// It panics if the name is empty, or either the name or the type is registered already.
+func (r *TypeRegistry) Register(name string, value interface{}) {
+	if name == "" {
+		panic(errors.New("empty type name"))
+	}
+	if value == nil {
+		panic(errors.New("nil value"))
+	}
+
+	t := reflect.TypeOf(value)
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, ok := r.byName[name]; ok {
+		panic(errors.New("duplicated type name"))
+	}
+	if _, ok := r.byType[t]; ok {
+		panic(errors.New("duplicated type"))
+	}
+
+	r.byName[name] = t
+	r.byType[t] = name
+}
+
+func (r *TypeRegistry) nameOf(t reflect.Type) (string, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+
+	name, ok := r.byType[t]
+	return name, ok
+}
+
+func (r *TypeRegistry) typeOf(name string) (reflect.Type, bool) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+// polymorphicEnvelope is the JSON object storing the value along with the name of its concrete type.
+type polymorphicEnvelope struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewPolymorphicMarshaler returns the JSON codec preserving the concrete types of the values registered in the registry,
+// which suits the heterogeneous values behind the interfaces, e.g. events and commands. The name of the concrete type
+// is stored along with the JSON payload, and the unmarshal function instantiates the registered type by the name,
+// so the containers can be the pointers to the interfaces, e.g. *Event, as well as to the concrete types.
+// The unregistered types return ErrTypeNotRegistered. Like Marshal, nil is stored as the empty bytes.
+func NewPolymorphicMarshaler(registry *TypeRegistry) (MarshalFunc, UnmarshalFunc) {
+	if registry == nil {
+		panic(errors.New("nil type registry"))
+	}
+
+	marshal := func(value interface{}) ([]byte, error) {
+		if value == nil {
+			return nil, nil
+		}
+
+		t := reflect.TypeOf(value)
+		name, ok := registry.nameOf(t)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTypeNotRegistered, t)
+		}
+
+		payload, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(polymorphicEnvelope{Type: name, Value: payload})
+	}
+
+	unmarshal := func(b []byte, value interface{}) error {
+		if len(b) == 0 {
+			return nil
+		}
+
+		container := reflect.ValueOf(value)
+		if container.Kind() != reflect.Ptr || container.IsNil() {
+			return fmt.Errorf("invalid container: %T", value)
+		}
+
+		var env polymorphicEnvelope
+		if err := json.Unmarshal(b, &env); err != nil {
+			return err
+		}
+
+		t, ok := registry.typeOf(env.Type)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrTypeNotRegistered, env.Type)
+		}
+
+		elem := container.Elem()
+		if !t.AssignableTo(elem.Type()) {
+			return fmt.Errorf("type %s is not assignable to %s", t, elem.Type())
+		}
+
+		v := reflect.New(t)
+		if err := json.Unmarshal(env.Value, v.Interface()); err != nil {
+			return err
+		}
+		elem.Set(v.Elem())
+
+		return nil
+	}
+
+	return marshal, unmarshal
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type mockEvent interface {
+	Name() string
+}
+
+type mockCreatedEvent struct {
+	ID int64
+}
+
+func (e mockCreatedEvent) Name() string { return "created" }
+
+type mockRenamedEvent struct {
+	ID      int64
+	NewName string
+}
+
+func (e *mockRenamedEvent) Name() string { return "renamed" }
+
+type polymorphicSuite struct {
+	suite.Suite
+
+	registry *TypeRegistry
+}
+
+func (s *polymorphicSuite) SetupSuite() {}
+
+func (s *polymorphicSuite) TearDownSuite() {}
+
+func (s *polymorphicSuite) SetupTest() {
+	s.registry = NewTypeRegistry()
+	s.registry.Register("created", mockCreatedEvent{})
+	s.registry.Register("renamed", &mockRenamedEvent{})
+}
+
+func (s *polymorphicSuite) TearDownTest() {}
+
+func TestPolymorphicSuite(t *testing.T) {
+	suite.Run(t, new(polymorphicSuite))
+}
+
+func (s *polymorphicSuite) TestRegisterWithInvalidArgs() {
+	s.Require().PanicsWithError("empty type name", func() {
+		s.registry.Register("", mockCreatedEvent{})
+	})
+	s.Require().PanicsWithError("nil value", func() {
+		s.registry.Register("nil", nil)
+	})
+	s.Require().PanicsWithError("duplicated type name", func() {
+		s.registry.Register("created", mockRenamedEvent{})
+	})
+	s.Require().PanicsWithError("duplicated type", func() {
+		s.registry.Register("created-again", mockCreatedEvent{})
+	})
+	s.Require().PanicsWithError("nil type registry", func() {
+		NewPolymorphicMarshaler(nil)
+	})
+}
+
+func (s *polymorphicSuite) TestPolymorphicMarshaler() {
+	marshal, unmarshal := NewPolymorphicMarshaler(s.registry)
+
+	events := []mockEvent{mockCreatedEvent{ID: 1}, &mockRenamedEvent{ID: 1, NewName: "new"}}
+	for _, e := range events {
+		b, err := marshal(e)
+		s.Require().NoError(err)
+
+		// the concrete type is reconstructed behind the interface
+		var ret mockEvent
+		s.Require().NoError(unmarshal(b, &ret))
+		s.Require().Equal(e, ret)
+
+		var intf interface{}
+		s.Require().NoError(unmarshal(b, &intf))
+		s.Require().Equal(e, intf)
+	}
+
+	// the concrete containers work as well
+	b, err := marshal(mockCreatedEvent{ID: 2})
+	s.Require().NoError(err)
+	var created mockCreatedEvent
+	s.Require().NoError(unmarshal(b, &created))
+	s.Require().Equal(mockCreatedEvent{ID: 2}, created)
+
+	var renamed *mockRenamedEvent
+	s.Require().Error(unmarshal(b, &renamed))
+	s.Require().Error(unmarshal(b, nil))
+
+	// nil is stored as the empty bytes
+	b, err = marshal(nil)
+	s.Require().NoError(err)
+	s.Require().Empty(b)
+	s.Require().NoError(unmarshal(b, &created))
+}
+
+func (s *polymorphicSuite) TestPolymorphicMarshalerWithUnregisteredType() {
+	marshal, unmarshal := NewPolymorphicMarshaler(s.registry)
+
+	// the pointer type is distinct from the registered one
+	_, err := marshal(&mockCreatedEvent{ID: 1})
+	s.Require().True(errors.Is(err, ErrTypeNotRegistered))
+
+	_, unmarshalOther := NewPolymorphicMarshaler(NewTypeRegistry())
+	b, err := marshal(mockCreatedEvent{ID: 1})
+	s.Require().NoError(err)
+	var ret mockEvent
+	s.Require().True(errors.Is(unmarshalOther(b, &ret), ErrTypeNotRegistered))
+	s.Require().NoError(unmarshal(b, &ret))
+}
+
+func (s *polymorphicSuite) TestWithCache() {
+	marshal, unmarshal := NewPolymorphicMarshaler(s.registry)
+	f := NewFactory(nil, NewTinyLFU(10000))
+	defer f.Close()
+	defer f.ClearPrefix()
+
+	c := f.NewCache([]Setting{
+		{
+			Prefix: "polymorphic",
+			CacheAttributes: map[Type]Attribute{
+				LocalCacheType: {TTL: time.Hour},
+			},
+			MarshalFunc:   marshal,
+			UnmarshalFunc: unmarshal,
+		},
+	})
+
+	ctx := context.Background()
+	s.Require().NoError(c.MSet(ctx, "polymorphic", map[string]interface{}{
+		"e1": mockCreatedEvent{ID: 1},
+		"e2": &mockRenamedEvent{ID: 1, NewName: "new"},
+	}))
+
+	res, err := c.MGet(ctx, "polymorphic", "e1", "e2")
+	s.Require().NoError(err)
+	names := []string{}
+	for i := 0; i < res.Len(); i++ {
+		var e mockEvent
+		s.Require().NoError(res.Get(ctx, i, &e))
+		names = append(names, e.Name())
+	}
+	s.Require().Equal([]string{"created", "renamed"}, names)
+}
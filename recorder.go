@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecordOp stands for the operation of the Adapter.
+type RecordOp string
+
+const (
+	// RecordOpMGet stands for the operation of MGet.
+	RecordOpMGet RecordOp = "MGet"
+	// RecordOpMSet stands for the operation of MSet.
+	RecordOpMSet RecordOp = "MSet"
+	// RecordOpDel stands for the operation of Del.
+	RecordOpDel RecordOp = "Del"
+)
+
+// Record is an operation captured by the recording adapter.
+type Record struct {
+	// Op is the operation of the Adapter.
+	Op RecordOp
+	// Keys are the keys of the operation. For MSet, they are sorted.
+	Keys []string
+	// TTL is the TTL of MSet, it's always zero for other operations.
+	TTL time.Duration
+}
+
+// RecordLog captures the operations passing through the recording adapter in order.
+// It's safe for concurrent use.
+type RecordLog struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// Records returns a copy of the captured operations in order.
+func (l *RecordLog) Records() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := make([]Record, len(l.records))
+	copy(records, l.records)
+
+	return records
+}
+
+// Reset clears the captured operations.
+func (l *RecordLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = nil
+}
+
+func (l *RecordLog) add(op RecordOp, keys []string, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, Record{Op: op, Keys: keys, TTL: ttl})
+}
+
+// NewRecordingAdapter generates Adapter capturing all operations into the RecordLog before passing them
+// to the inner Adapter. It's designed for testing. Notice that the optional interfaces implemented by
+// the inner Adapter, e.g. Statser and Toucher, are not exposed.
+func NewRecordingAdapter(inner Adapter) (Adapter, *RecordLog) {
+	log := &RecordLog{}
+	return &recorder{inner: inner, log: log}, log
+}
+
+type recorder struct {
+	inner Adapter
+	log   *RecordLog
+}
+
+func (adp *recorder) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	adp.log.add(RecordOpMGet, copyKeys(keys), 0)
+	return adp.inner.MGet(ctx, keys)
+}
+
+func (adp *recorder) MSet(ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions) error {
+	keys := make([]string, 0, len(keyVals))
+	for k := range keyVals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	adp.log.add(RecordOpMSet, keys, ttl)
+	return adp.inner.MSet(ctx, keyVals, ttl, options...)
+}
+
+func (adp *recorder) Del(ctx context.Context, keys ...string) error {
+	adp.log.add(RecordOpDel, copyKeys(keys), 0)
+	return adp.inner.Del(ctx, keys...)
+}
+
+func copyKeys(keys []string) []string {
+	cp := make([]string, len(keys))
+	copy(cp, keys)
+
+	return cp
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockRecorderCTX = context.Background()
+)
+
+type recorderSuite struct {
+	suite.Suite
+
+	shared    Adapter
+	sharedLog *RecordLog
+	local     Adapter
+	localLog  *RecordLog
+	factory   Factory
+}
+
+func (s *recorderSuite) SetupSuite() {}
+
+func (s *recorderSuite) TearDownSuite() {}
+
+func (s *recorderSuite) SetupTest() {
+	s.shared, s.sharedLog = NewRecordingAdapter(NewTinyLFU(10000))
+	s.local, s.localLog = NewRecordingAdapter(NewTinyLFU(10000))
+	s.factory = NewFactory(s.shared, s.local)
+}
+
+func (s *recorderSuite) TearDownTest() {
+	// prevent registering twice
+	s.factory.ClearPrefix()
+
+	s.factory.Close()
+}
+
+func TestRecorderSuite(t *testing.T) {
+	suite.Run(t, new(recorderSuite))
+}
+
+func (s *recorderSuite) TestAdapter() {
+	s.Require().NoError(s.shared.MSet(mockRecorderCTX, map[string][]byte{"b": mockLfuBytes, "a": mockLfuBytes}, time.Hour))
+	vals, err := s.shared.MGet(mockRecorderCTX, []string{"a", "c"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: mockLfuBytes}, {}}, vals)
+	s.Require().NoError(s.shared.Del(mockRecorderCTX, "a"))
+
+	s.Require().Equal([]Record{
+		{Op: RecordOpMSet, Keys: []string{"a", "b"}, TTL: time.Hour},
+		{Op: RecordOpMGet, Keys: []string{"a", "c"}},
+		{Op: RecordOpDel, Keys: []string{"a"}},
+	}, s.sharedLog.Records())
+	s.Require().Empty(s.localLog.Records())
+
+	s.sharedLog.Reset()
+	s.Require().Empty(s.sharedLog.Records())
+}
+
+func (s *recorderSuite) TestGetByFuncAndDel() {
+	c := s.factory.NewCache([]Setting{
+		{
+			Prefix: "mixed",
+			CacheAttributes: map[Type]Attribute{
+				SharedCacheType: {TTL: time.Hour},
+				LocalCacheType:  {TTL: time.Minute},
+			},
+		},
+	})
+	cacheKey := getCacheKey("mixed", "key")
+
+	var ret string
+	s.Require().NoError(c.GetByFunc(mockRecorderCTX, "mixed", "key", &ret, func() (interface{}, error) {
+		return mockString, nil
+	}))
+	s.Require().Equal(mockString, ret)
+
+	// missed in both tiers, then refilled both tiers
+	s.Require().Equal([]Record{
+		{Op: RecordOpMGet, Keys: []string{cacheKey}},
+		{Op: RecordOpMSet, Keys: []string{cacheKey}, TTL: time.Hour},
+	}, s.sharedLog.Records())
+	s.Require().Equal([]Record{
+		{Op: RecordOpMGet, Keys: []string{cacheKey}},
+		{Op: RecordOpMSet, Keys: []string{cacheKey}, TTL: time.Minute},
+	}, s.localLog.Records())
+
+	s.sharedLog.Reset()
+	s.localLog.Reset()
+
+	s.Require().NoError(c.Del(mockRecorderCTX, "mixed", "key"))
+	s.Require().Equal([]Record{{Op: RecordOpDel, Keys: []string{cacheKey}}}, s.sharedLog.Records())
+	s.Require().Equal([]Record{{Op: RecordOpDel, Keys: []string{cacheKey}}}, s.localLog.Records())
+}
+
+func (s *recorderSuite) TestConcurrency() {
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.shared.MGet(mockRecorderCTX, []string{"key"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Require().Len(s.sharedLog.Records(), 1000)
+}
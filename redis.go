@@ -2,44 +2,309 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	defaultSubMinBackoff = 100 * time.Millisecond
+	defaultSubMaxBackoff = 10 * time.Second
+)
+
 // Redis support two interface: Adapter and Pubsub
 type Redis interface {
 	Adapter
 	Pubsub
+	// Ring returns the underlying ring, which runs the commands not covered by Adapter, e.g. SCAN,
+	// without another connection pool. The keys written by the caches are namespaced by the package key and
+	// the prefixes, see CacheKey(), so respect the namespace when reading or writing them directly.
+	// Notice that the direct writes neither broadcast the evictions nor invalidate the local caches.
+	Ring() *redis.Ring
 }
 
 // NewRedis generates Adapter with go-redis
-func NewRedis(ring *redis.Ring) Redis {
-	return &rds{
-		ring:     ring,
-		messChan: make(chan Message),
+func NewRedis(ring *redis.Ring, options ...RedisOptions) Redis {
+	o := loadRedisOptions(options...)
+	if o.mgetBatchSize < 0 {
+		panic(errors.New("invalid mget batch size"))
+	}
+	if o.mgetParallelism < 0 {
+		panic(errors.New("invalid mget parallelism"))
+	}
+	if o.subMinBackoff <= 0 || o.subMaxBackoff < o.subMinBackoff {
+		panic(errors.New("invalid subscription backoff"))
+	}
+	if o.maxValueBytes < 0 {
+		panic(errors.New("invalid max value bytes"))
+	}
+
+	r := &rds{
+		ring:            ring,
+		messChan:        make(chan Message),
+		closed:          make(chan struct{}),
+		mgetBatchSize:   o.mgetBatchSize,
+		mgetParallelism: o.mgetParallelism,
+		shardAddrs:      map[string]string{},
+		subMinBackoff:   o.subMinBackoff,
+		subMaxBackoff:   o.subMaxBackoff,
+		onSubError:      o.onSubError,
+		shardPolicy:     o.shardPolicy,
+		onShardError:    o.onShardError,
+		onConnError:     o.onConnError,
+		onReconnect:     o.onReconnect,
+		logger:          loggerOrNop(o.logger),
+		maxValueBytes:   o.maxValueBytes,
+		oversizedPolicy: o.oversizedPolicy,
+		onOversized:     o.onOversized,
+	}
+
+	// build the same consistent hash as the ring does, which is used to group keys by shards
+	if opt := ring.Options(); opt != nil && opt.NewConsistentHash != nil {
+		names := make([]string, 0, len(opt.Addrs))
+		for name, addr := range opt.Addrs {
+			names = append(names, name)
+			r.shardAddrs[name] = addr
+		}
+
+		r.shardHash = opt.NewConsistentHash(names)
+	}
+
+	// watch the connections of each shard, including the pings of the heartbeat
+	if r.onConnError != nil || r.onReconnect != nil {
+		_ = ring.ForEachShard(context.Background(), func(ctx context.Context, client *redis.Client) error {
+			client.AddHook(&connHook{r: r, addr: client.Options().Addr})
+			return nil
+		})
+	}
+
+	return r
+}
+
+// ShardFailurePolicy decides how MGet() handles the failures of some shards.
+type ShardFailurePolicy int32
+
+const (
+	// ShardFailurePolicyFail fails the whole MGet() if any shard fails. It's the default policy.
+	ShardFailurePolicyFail ShardFailurePolicy = iota
+	// ShardFailurePolicyMiss treats the keys on the failed shards as missing, so that the keys on the healthy
+	// shards are still served and only the affected keys are reloaded by the getter. The errors are passed to
+	// the callback specified by OnShardErrorFunc(). The context errors still fail the whole MGet().
+	ShardFailurePolicyMiss
+)
+
+// OversizedValuePolicy decides how MSet() handles the values exceeding the limit specified by WithMaxValueBytes().
+type OversizedValuePolicy int32
+
+const (
+	// OversizedValuePolicySkip skips the oversized values and sets up others, so that one giant value doesn't fail
+	// the whole batch. The skipped keys are deleted in the same pipeline, so that they're treated as missing afterwards
+	// instead of serving the previous values. It's the default policy.
+	OversizedValuePolicySkip OversizedValuePolicy = iota
+	// OversizedValuePolicyFail fails the whole MSet() with the error of ErrValueTooLarge before sending anything.
+	OversizedValuePolicyFail
+)
+
+// RedisOptions is an alias for functional argument.
+type RedisOptions func(opts *redisOptions)
+
+// redisOptions contains all options which will be applied when calling NewRedis().
+type redisOptions struct {
+	mgetBatchSize   int
+	mgetParallelism int
+	subMinBackoff   time.Duration
+	subMaxBackoff   time.Duration
+	onSubError      func(err error)
+	shardPolicy     ShardFailurePolicy
+	onShardError    func(err error)
+	onConnError     func(addr string, err error)
+	onReconnect     func(addr string)
+	logger          Logger
+	maxValueBytes   int
+	oversizedPolicy OversizedValuePolicy
+	onOversized     func(key string, size int)
+}
+
+// WithMGetBatchSize splits the keys of each shard in MGet() into batches with the specified size.
+// The default is zero, which means no splitting.
+func WithMGetBatchSize(size int) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.mgetBatchSize = size
+	}
+}
+
+// WithMGetParallelism limits the number of MGET commands issued concurrently across shards in MGet().
+// The default is zero, which means no limitation.
+func WithMGetParallelism(parallelism int) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.mgetParallelism = parallelism
+	}
+}
+
+// WithSubscriptionBackoff sets up the backoff between resubscribing when the subscription is closed unexpectedly.
+// The backoff starts from min and doubles on every failure up to max.
+// The default is from 100 milliseconds to 10 seconds.
+func WithSubscriptionBackoff(min, max time.Duration) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.subMinBackoff = min
+		opts.subMaxBackoff = max
+	}
+}
+
+// OnSubscriptionErrorFunc sets up the callback function on the subscription closed unexpectedly or failing to resubscribe.
+// Use errors.Is(err, ErrSubscriptionClosed) to tell the reconnection apart.
+func OnSubscriptionErrorFunc(f func(err error)) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.onSubError = f
+	}
+}
+
+// WithShardFailurePolicy sets up the policy handling the failures of some shards in MGet().
+func WithShardFailurePolicy(p ShardFailurePolicy) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.shardPolicy = p
+	}
+}
+
+// OnShardErrorFunc sets up the callback function on the shard errors tolerated by ShardFailurePolicyMiss.
+// It might be called concurrently since the shards are requested in parallel.
+func OnShardErrorFunc(f func(err error)) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.onShardError = f
+	}
+}
+
+// OnConnectionErrorFunc sets up the callback function on the shard turning unhealthy, i.e. the first connection
+// error after being healthy, rather than on every failed operation. The redis replies like redis.Nil and the
+// context errors are not connection errors. The shards marked down by the ring when calling NewRedis() are not watched.
+func OnConnectionErrorFunc(f func(addr string, err error)) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.onConnError = f
 	}
 }
 
+// OnReconnectFunc sets up the callback function on the shard turning healthy again, i.e. the first successful
+// command after the connection error reported by OnConnectionErrorFunc().
+func OnReconnectFunc(f func(addr string)) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.onReconnect = f
+	}
+}
+
+// WithMaxValueBytes limits the length of each value in MSet(), e.g. below the proto-max-bulk-len of redis,
+// which rejects the giant values in the middle of the pipeline with an opaque protocol error.
+// The oversized values are handled by the OversizedValuePolicy. The default is zero, which means no limitation.
+func WithMaxValueBytes(n int) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.maxValueBytes = n
+	}
+}
+
+// WithOversizedValuePolicy sets up the policy handling the values exceeding the limit specified by WithMaxValueBytes().
+func WithOversizedValuePolicy(p OversizedValuePolicy) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.oversizedPolicy = p
+	}
+}
+
+// OnOversizedValueFunc sets up the callback function on the key with the value exceeding the limit specified by
+// WithMaxValueBytes(), along with the length of the value. It's called regardless of the OversizedValuePolicy.
+func OnOversizedValueFunc(f func(key string, size int)) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.onOversized = f
+	}
+}
+
+// WithRedisLogger sets up the logger receiving the failures of the subscription and the resubscriptions.
+// The default discards all logs.
+func WithRedisLogger(l Logger) RedisOptions {
+	return func(opts *redisOptions) {
+		opts.logger = l
+	}
+}
+
+func loadRedisOptions(options ...RedisOptions) *redisOptions {
+	opts := &redisOptions{
+		subMinBackoff: defaultSubMinBackoff,
+		subMaxBackoff: defaultSubMaxBackoff,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
 type rds struct {
 	ring       *redis.Ring
 	subscriber *redis.PubSub
 
-	subOnce   sync.Once
-	closeOnce sync.Once
-	messChan  chan Message
-	subMut    sync.Mutex
+	mgetBatchSize   int
+	mgetParallelism int
+	shardHash       redis.ConsistentHash
+	shardAddrs      map[string]string
+
+	subOnce       sync.Once
+	closeOnce     sync.Once
+	messChan      chan Message
+	subMut        sync.Mutex
+	closed        chan struct{}
+	subMinBackoff time.Duration
+	subMaxBackoff time.Duration
+	onSubError    func(err error)
+
+	shardPolicy  ShardFailurePolicy
+	onShardError func(err error)
+	onConnError  func(addr string, err error)
+	onReconnect  func(addr string)
+	logger       Logger
+
+	maxValueBytes   int
+	oversizedPolicy OversizedValuePolicy
+	onOversized     func(key string, size int)
 }
 
 func (r *rds) MSet(
 	ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions,
 ) error {
-	if len(keyVals) == 0 {
+	keyVals, skipped, err := r.limitValues(keyVals)
+	if err != nil {
+		return err
+	}
+	if len(keyVals) == 0 && len(skipped) == 0 {
 		return nil
 	}
 
-	_, err := r.ring.WithContext(ctx).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+	o := loadMSetOptions(options...)
+
+	_, err = r.ring.WithContext(ctx).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		// delete the skipped keys one by one, which routes each of them to its own shard
+		for _, key := range skipped {
+			pipe.Del(ctx, key)
+		}
+		if len(keyVals) == 0 {
+			return nil
+		}
+
+		// the expiration decided by the options is set along with each key
+		if !o.expireAt.IsZero() {
+			for key, b := range keyVals {
+				pipe.Do(ctx, "set", key, b, "pxat", o.expireAt.UnixMilli())
+			}
+			return nil
+		}
+		if o.keepTTL {
+			for key, b := range keyVals {
+				pipe.SetArgs(ctx, key, b, redis.SetArgs{KeepTTL: true})
+			}
+			return nil
+		}
+
 		// set multiple pairs
 		pairSlice := make([]interface{}, len(keyVals)*2)
 		i := 0
@@ -54,7 +319,7 @@ func (r *rds) MSet(
 
 		// set expiration for each key
 		for key := range keyVals {
-			pipe.PExpire(ctx, key, ttl)
+			pipe.PExpire(ctx, key, o.ttlOf(key, ttl))
 		}
 		return nil
 	})
@@ -62,31 +327,538 @@ func (r *rds) MSet(
 	return err
 }
 
-func (r *rds) MGet(ctx context.Context, keys []string) ([]Value, error) {
-	vals, err := r.ring.WithContext(ctx).MGet(ctx, keys...).Result()
+// limitValues returns keyVals without the values exceeding the limit specified by WithMaxValueBytes() along with
+// the skipped keys, or the error of ErrValueTooLarge if OversizedValuePolicyFail is specified.
+func (r *rds) limitValues(keyVals map[string][]byte) (map[string][]byte, []string, error) {
+	if r.maxValueBytes == 0 {
+		return keyVals, nil, nil
+	}
+
+	var limited map[string][]byte
+	var skipped []string
+	for key, b := range keyVals {
+		if len(b) <= r.maxValueBytes {
+			continue
+		}
+
+		if r.onOversized != nil {
+			r.onOversized(key, len(b))
+		}
+		if r.oversizedPolicy == OversizedValuePolicyFail {
+			return nil, nil, fmt.Errorf("%w: key %q of %d bytes", ErrValueTooLarge, key, len(b))
+		}
+
+		// copy on the first oversized value, keyVals is owned by the caller
+		if limited == nil {
+			limited = make(map[string][]byte, len(keyVals))
+			for k, v := range keyVals {
+				limited[k] = v
+			}
+		}
+		delete(limited, key)
+		skipped = append(skipped, key)
+	}
+
+	if limited == nil {
+		return keyVals, nil, nil
+	}
+
+	return limited, skipped, nil
+}
+
+func (r *rds) Ring() *redis.Ring {
+	return r.ring
+}
+
+// Ping pings all shards of the ring, and reports the shards marked down by the heartbeat as well.
+func (r *rds) Ping(ctx context.Context) error {
+	err := r.ring.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+		if err := client.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("shard %s: %w", client.Options().Addr, err)
+		}
+
+		return nil
+	})
 	if err != nil {
+		return err
+	}
+
+	// the shards marked down are skipped by ForEachShard
+	if opt := r.ring.Options(); opt != nil && r.ring.Len() < len(opt.Addrs) {
+		return fmt.Errorf("%d of %d shards down", len(opt.Addrs)-r.ring.Len(), len(opt.Addrs))
+	}
+
+	return nil
+}
+
+// mgetTask stands for a batch of keys sent to the shard.
+type mgetTask struct {
+	// client is nil when the keys are routed by the ring
+	client *redis.Client
+	idxs   []int
+}
+
+func (r *rds) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	return r.mget(ctx, keys, false)
+}
+
+// MGetWithMeta fills in the remaining TTL by PTTL in the same pipeline as getting the keys.
+func (r *rds) MGetWithMeta(ctx context.Context, keys []string) ([]Value, error) {
+	return r.mget(ctx, keys, true)
+}
+
+func (r *rds) mget(ctx context.Context, keys []string, withTTL bool) ([]Value, error) {
+	values := make([]Value, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	tasks := r.splitTasks(r.groupByShard(ctx, keys))
+	if len(tasks) == 1 {
+		if err := r.mgetTask(ctx, tasks[0], keys, values, withTTL); err != nil {
+			return nil, err
+		}
+
+		return values, nil
+	}
+
+	parallelism := r.mgetParallelism
+	if parallelism == 0 {
+		parallelism = len(tasks)
+	}
+
+	sem := make(chan struct{}, parallelism)
+	errCh := make(chan error, 1)
+	wg := sync.WaitGroup{}
+	for _, task := range tasks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(task mgetTask) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// each task fills in values with its own indexes
+			if err := r.mgetTask(ctx, task, keys, values, withTTL); err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+			}
+		}(task)
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
 		return nil, err
+	default:
+		return values, nil
+	}
+}
+
+// groupByShard groups the key indexes by shards. When some shards are down, the ring rebalances keys
+// to others, then it returns a single task leaving the ring to route the keys.
+func (r *rds) groupByShard(ctx context.Context, keys []string) []mgetTask {
+	idxs := make([]int, len(keys))
+	for i := range keys {
+		idxs[i] = i
+	}
+	routedByRing := []mgetTask{{idxs: idxs}}
+
+	if r.shardHash == nil || r.ring.Len() != len(r.shardAddrs) {
+		return routedByRing
+	}
+
+	mut := sync.Mutex{}
+	clients := map[string]*redis.Client{}
+	_ = r.ring.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+		mut.Lock()
+		clients[client.Options().Addr] = client
+		mut.Unlock()
+		return nil
+	})
+
+	tasks := []mgetTask{}
+	taskIdx := map[*redis.Client]int{}
+	for i, key := range keys {
+		client, ok := clients[r.shardAddrs[r.shardHash.Get(hashtagKey(key))]]
+		if !ok {
+			return routedByRing
+		}
+
+		if _, ok := taskIdx[client]; !ok {
+			taskIdx[client] = len(tasks)
+			tasks = append(tasks, mgetTask{client: client})
+		}
+
+		tasks[taskIdx[client]].idxs = append(tasks[taskIdx[client]].idxs, i)
+	}
+
+	return tasks
+}
+
+// splitTasks splits tasks into batches if necessary.
+func (r *rds) splitTasks(tasks []mgetTask) []mgetTask {
+	if r.mgetBatchSize == 0 {
+		return tasks
+	}
+
+	batches := []mgetTask{}
+	for _, task := range tasks {
+		for start := 0; start < len(task.idxs); start += r.mgetBatchSize {
+			end := start + r.mgetBatchSize
+			if end > len(task.idxs) {
+				end = len(task.idxs)
+			}
+
+			batches = append(batches, mgetTask{client: task.client, idxs: task.idxs[start:end]})
+		}
+	}
+
+	return batches
+}
+
+func (r *rds) mgetTask(ctx context.Context, task mgetTask, keys []string, values []Value, withTTL bool) error {
+	taskKeys := make([]string, len(task.idxs))
+	for i, idx := range task.idxs {
+		taskKeys[i] = keys[idx]
+	}
+
+	if task.client == nil {
+		return r.pipelinedGet(ctx, task, taskKeys, values, withTTL)
+	}
+
+	var mgetCmd *redis.SliceCmd
+	ttlCmds := make([]*redis.DurationCmd, len(taskKeys))
+	if withTTL {
+		_, _ = task.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			mgetCmd = pipe.MGet(ctx, taskKeys...)
+			for i, key := range taskKeys {
+				ttlCmds[i] = pipe.PTTL(ctx, key)
+			}
+			return nil
+		})
+	} else {
+		mgetCmd = task.client.MGet(ctx, taskKeys...)
+	}
+
+	vals, err := mgetCmd.Result()
+	if err != nil {
+		// the values of the task are left missing if it's tolerated
+		return r.shardFailed(ctx, err)
 	}
 
-	values := make([]Value, len(vals))
 	for i, val := range vals {
 		if val == nil {
-			values[i] = Value{Valid: false, Bytes: nil}
+			values[task.idxs[i]] = Value{Valid: false, Bytes: nil}
 			continue
 		}
 
 		s, ok := val.(string)
 		if !ok {
-			values[i] = Value{Valid: false, Bytes: nil}
+			values[task.idxs[i]] = Value{Valid: false, Bytes: nil}
+			continue
+		}
+
+		values[task.idxs[i]] = Value{Valid: ok, Bytes: []byte(s), TTL: pttlOf(ttlCmds[i])}
+	}
+
+	return nil
+}
+
+// pipelinedGet gets keys by pipelined GET commands routed by the ring.
+func (r *rds) pipelinedGet(
+	ctx context.Context, task mgetTask, taskKeys []string, values []Value, withTTL bool,
+) error {
+	cmds := make([]*redis.StringCmd, len(taskKeys))
+	ttlCmds := make([]*redis.DurationCmd, len(taskKeys))
+	_, _ = r.ring.WithContext(ctx).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range taskKeys {
+			cmds[i] = pipe.Get(ctx, key)
+			if withTTL {
+				ttlCmds[i] = pipe.PTTL(ctx, key)
+			}
+		}
+		return nil
+	})
+
+	reported := false
+	for i, cmd := range cmds {
+		b, err := cmd.Bytes()
+		if _, ok := err.(redis.Error); ok {
+			// redis.Nil or the reply errors of the keys, e.g. WRONGTYPE of non-string keys, are missing like MGET
+			values[task.idxs[i]] = Value{Valid: false, Bytes: nil}
 			continue
+		} else if err != nil {
+			// the failed keys are likely on the same shard, the error is reported once
+			if !reported {
+				if err := r.shardFailed(ctx, err); err != nil {
+					return err
+				}
+				reported = true
+			}
+
+			values[task.idxs[i]] = Value{Valid: false, Bytes: nil}
+			continue
+		}
+
+		values[task.idxs[i]] = Value{Valid: true, Bytes: b, TTL: pttlOf(ttlCmds[i])}
+	}
+
+	return nil
+}
+
+// shardFailed returns the error of the shard unless it's tolerated by ShardFailurePolicyMiss.
+func (r *rds) shardFailed(ctx context.Context, err error) error {
+	if r.shardPolicy != ShardFailurePolicyMiss || ctx.Err() != nil {
+		return err
+	}
+
+	if r.onShardError != nil {
+		r.onShardError(err)
+	}
+
+	return nil
+}
+
+// pttlOf returns the remaining TTL replied by PTTL, or zero if it's not requested, failed,
+// or the key has no expiration.
+func pttlOf(cmd *redis.DurationCmd) time.Duration {
+	if cmd == nil {
+		return 0
+	}
+
+	ttl, err := cmd.Result()
+	if err != nil || ttl < 0 {
+		return 0
+	}
+
+	return ttl
+}
+
+// hashtagKey extracts the hash tag from the key as the ring does.
+// Ref: https://redis.io/docs/reference/cluster-spec/#hash-tags
+func hashtagKey(key string) string {
+	if s := strings.IndexByte(key, '{'); s > -1 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+e+1]
+		}
+	}
+
+	return key
+}
+
+// touchScript resets the TTL only if the remaining TTL is less than the threshold.
+const touchScript = `
+local pttl = redis.call('PTTL', KEYS[1])
+if pttl >= 0 and pttl < tonumber(ARGV[2]) then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 0
+`
+
+func (r *rds) Touch(ctx context.Context, keys []string, ttl time.Duration, threshold time.Duration) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := r.ring.WithContext(ctx).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Eval(ctx, touchScript, []string{key}, ttl.Milliseconds(), threshold.Milliseconds())
+		}
+		return nil
+	})
+
+	return err
+}
+
+const (
+	// clearScanCount is the hint of the number of keys scanned per iteration when clearing keys
+	clearScanCount = 1000
+)
+
+func (r *rds) Clear(ctx context.Context, keyPrefix string) error {
+	return r.scanDel(ctx, escapeGlob(keyPrefix)+"*", nil)
+}
+
+// DelPattern scans the keys matching the pattern on each shard, and deletes them in batches.
+func (r *rds) DelPattern(ctx context.Context, pattern string) ([]string, error) {
+	mut := sync.Mutex{}
+	deleted := []string{}
+	err := r.scanDel(ctx, pattern, func(keys []string) {
+		mut.Lock()
+		deleted = append(deleted, keys...)
+		mut.Unlock()
+	})
+
+	return deleted, err
+}
+
+// scanDel deletes the keys matching the pattern on each shard, the deleted keys of each batch
+// are passed to onDeleted if it's not nil.
+func (r *rds) scanDel(ctx context.Context, pattern string, onDeleted func(keys []string)) error {
+	return r.ring.ForEachShard(ctx, func(ctx context.Context, client *redis.Client) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(ctx, cursor, pattern, clearScanCount).Result()
+			if err != nil {
+				return err
+			}
+
+			if len(keys) != 0 {
+				if err := client.Del(ctx, keys...).Err(); err != nil {
+					return err
+				}
+
+				if onDeleted != nil {
+					onDeleted(keys)
+				}
+			}
+
+			if cursor = next; cursor == 0 {
+				return nil
+			}
+		}
+	})
+}
+
+// escapeGlob escapes the special characters of the glob-style pattern used by SCAN.
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// unlockScript deletes the key only if it's held by the token.
+const unlockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+func (r *rds) Lock(ctx context.Context, keys []string, token string, ttl time.Duration) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	cmds := make([]*redis.BoolCmd, len(keys))
+	if _, err := r.ring.WithContext(ctx).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.SetNX(ctx, key, token, ttl)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	locked := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		locked[i] = cmd.Val()
+	}
+
+	return locked, nil
+}
+
+func (r *rds) Unlock(ctx context.Context, keys []string, token string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := r.ring.WithContext(ctx).Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Eval(ctx, unlockScript, []string{key}, token)
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (r *rds) SetNX(
+	ctx context.Context, key string, b []byte, ttl time.Duration, options ...MSetOptions,
+) (bool, error) {
+	return r.ring.WithContext(ctx).SetNX(ctx, key, b, ttl).Result()
+}
+
+func (r *rds) SetXX(
+	ctx context.Context, key string, b []byte, ttl time.Duration, options ...MSetOptions,
+) (bool, error) {
+	return r.ring.WithContext(ctx).SetXX(ctx, key, b, ttl).Result()
+}
+
+// GetDel gets and deletes the key by GETDEL, which requires redis 6.2 or above.
+func (r *rds) GetDel(ctx context.Context, key string) (Value, error) {
+	b, err := r.ring.WithContext(ctx).GetDel(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Value{Valid: false, Bytes: nil}, nil
+	}
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{Valid: true, Bytes: b}, nil
+}
+
+// RPush appends the values by RPUSH, and trims and expires the list by LTRIM and PEXPIRE in the same transaction.
+func (r *rds) RPush(ctx context.Context, key string, values [][]byte, maxLen int, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(values))
+	for i, b := range values {
+		args[i] = b
+	}
+
+	_, err := r.ring.WithContext(ctx).TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, args...)
+		if maxLen > 0 {
+			pipe.LTrim(ctx, key, int64(-maxLen), -1)
 		}
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		}
+
+		return nil
+	})
+
+	return listError(err)
+}
 
-		values[i] = Value{Valid: ok, Bytes: []byte(s)}
+// LRange returns the values by LRANGE.
+func (r *rds) LRange(ctx context.Context, key string, start, stop int) ([][]byte, error) {
+	strs, err := r.ring.WithContext(ctx).LRange(ctx, key, int64(start), int64(stop)).Result()
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	values := make([][]byte, len(strs))
+	for i, str := range strs {
+		values[i] = []byte(str)
 	}
 
 	return values, nil
 }
 
+// listError converts the WRONGTYPE reply into ErrNotList.
+func listError(err error) error {
+	if err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		return ErrNotList
+	}
+
+	return err
+}
+
 func (r *rds) Del(ctx context.Context, keys ...string) error {
 	_, err := r.ring.WithContext(ctx).Del(ctx, keys...).Result()
 
@@ -112,29 +884,93 @@ func (r *rds) Pub(ctx context.Context, topic string, message []byte) error {
 
 func (r *rds) Sub(ctx context.Context, topic ...string) <-chan Message {
 	r.subOnce.Do(func() {
-		subscriber := r.ring.Subscribe(ctx, topic...)
-		r.subMut.Lock()
-		r.subscriber = subscriber
-		r.subMut.Unlock()
+		subscriber, err := r.subscribe(ctx, topic...)
 
 		go func() {
-			for mess := range subscriber.Channel() {
-				r.messChan <- &rdsMessage{
-					topic:   mess.Channel,
-					content: mess.Payload,
+			defer close(r.messChan)
+
+			backoff := r.subMinBackoff
+			for {
+				if err == nil {
+					for mess := range subscriber.Channel() {
+						r.messChan <- &rdsMessage{
+							topic:   mess.Channel,
+							content: mess.Payload,
+						}
+					}
+
+					err = ErrSubscriptionClosed
 				}
-			}
 
-			close(r.messChan)
+				// closed by Close()
+				if r.isClosed() {
+					return
+				}
+
+				r.subError(fmt.Errorf("resubscribing in %v: %w", backoff, err))
+				select {
+				case <-r.closed:
+					return
+				case <-time.After(backoff):
+				}
+
+				if subscriber, err = r.subscribe(ctx, topic...); err != nil {
+					if backoff *= 2; backoff > r.subMaxBackoff {
+						backoff = r.subMaxBackoff
+					}
+				} else {
+					r.logger.Debug("redis: resubscribed", "topics", topic)
+					backoff = r.subMinBackoff
+				}
+			}
 		}()
 	})
 
 	return r.messChan
 }
 
+// subscribe subscribes the topics unless Close() was called.
+func (r *rds) subscribe(ctx context.Context, topic ...string) (subscriber *redis.PubSub, err error) {
+	r.subMut.Lock()
+	defer r.subMut.Unlock()
+
+	if r.isClosed() {
+		return nil, errors.New("redis: subscriber closed")
+	}
+
+	// ring panics when all shards are down
+	defer func() {
+		if rec := recover(); rec != nil {
+			subscriber, err = nil, fmt.Errorf("redis: %v", rec)
+		}
+	}()
+
+	subscriber = r.ring.Subscribe(ctx, topic...)
+	r.subscriber = subscriber
+
+	return subscriber, nil
+}
+
+func (r *rds) subError(err error) {
+	r.logger.Warn("redis: subscription failed", "err", err)
+	if r.onSubError != nil {
+		r.onSubError(err)
+	}
+}
+
+func (r *rds) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 func (r *rds) Close() {
 	r.closeOnce.Do(func() {
 		r.subMut.Lock()
+		close(r.closed)
 		subscriber := r.subscriber
 		r.subMut.Unlock()
 
@@ -143,3 +979,71 @@ func (r *rds) Close() {
 		}
 	})
 }
+
+// connHook is the go-redis hook tracking the connection state of the shard by the results of the commands.
+type connHook struct {
+	r    *rds
+	addr string
+	// down is 1 after the connection error until the next successful command
+	down int32
+}
+
+func (h *connHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *connHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.observe(cmd.Err())
+	return nil
+}
+
+func (h *connHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *connHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if isConnError(cmd.Err()) {
+			h.observe(cmd.Err())
+			return nil
+		}
+	}
+
+	h.observe(nil)
+	return nil
+}
+
+// observe reports the transitions between healthy and unhealthy, the hook stays after Close() but does nothing.
+func (h *connHook) observe(err error) {
+	if h.r.isClosed() {
+		return
+	}
+
+	if isConnError(err) {
+		if atomic.CompareAndSwapInt32(&h.down, 0, 1) && h.r.onConnError != nil {
+			h.r.onConnError(h.addr, err)
+		}
+		return
+	}
+
+	if err == nil || err == redis.Nil || isRedisReply(err) {
+		if atomic.CompareAndSwapInt32(&h.down, 1, 0) && h.r.onReconnect != nil {
+			h.r.onReconnect(h.addr)
+		}
+	}
+}
+
+// isConnError reports whether the error comes from the connection rather than the redis replies or the context.
+func isConnError(err error) bool {
+	if err == nil || err == redis.Nil || isRedisReply(err) {
+		return false
+	}
+
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// isRedisReply reports whether the error is replied by redis, e.g. WRONGTYPE, which means the connection works.
+func isRedisReply(err error) bool {
+	var replyErr redis.Error
+	return errors.As(err, &replyErr)
+}
@@ -2,8 +2,11 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,7 +22,7 @@ const (
 var (
 	mockRdsCTX     = context.Background()
 	mockRdsBytes   = []byte(mockRdsString)
-	mockEvictTopic = EventTypeEvict.Topic()
+	mockEvictTopic = EventTypeEvict.Topic("")
 )
 
 type redisSuite struct {
@@ -114,6 +117,258 @@ func (s *redisSuite) TestMGet() {
 	}
 }
 
+func (s *redisSuite) TestMGetInBatches() {
+	r := NewRedis(s.ring, WithMGetBatchSize(2), WithMGetParallelism(2)).(*rds)
+	keys := []string{}
+	expResult := []Value{}
+	for i := 0; i < 7; i++ {
+		key := "batch-" + strconv.Itoa(i)
+		keys = append(keys, key)
+
+		// leave odd keys missing
+		if i%2 == 1 {
+			expResult = append(expResult, Value{Valid: false, Bytes: nil})
+			continue
+		}
+
+		s.Require().NoError(s.ring.Set(mockRdsCTX, key, key, time.Hour).Err())
+		expResult = append(expResult, Value{Valid: true, Bytes: []byte(key)})
+	}
+
+	values, err := r.MGet(mockRdsCTX, keys)
+	s.Require().NoError(err)
+	s.Require().Equal(expResult, values)
+
+	values, err = r.MGet(mockRdsCTX, []string{})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{}, values)
+}
+
+func (s *redisSuite) TestMGetAcrossShards() {
+	// two shards of distinct addresses sharing the same server
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{
+			"server1": ":6379",
+			"server2": "127.0.0.1:6379",
+		},
+	})
+	defer ring.Close()
+
+	r := NewRedis(ring, WithMGetBatchSize(3), WithMGetParallelism(1)).(*rds)
+
+	keys := []string{}
+	expResult := []Value{}
+	for i := 0; i < 30; i++ {
+		key := "{tag-" + strconv.Itoa(i%10) + "}-" + strconv.Itoa(i)
+		keys = append(keys, key)
+
+		s.Require().NoError(s.ring.Set(mockRdsCTX, key, key, time.Hour).Err())
+		expResult = append(expResult, Value{Valid: true, Bytes: []byte(key)})
+	}
+	keys = append(keys, "not-existed")
+	expResult = append(expResult, Value{Valid: false, Bytes: nil})
+	s.Require().Len(r.groupByShard(mockRdsCTX, keys), 2) // fan out to both clients
+
+	values, err := r.MGet(mockRdsCTX, keys)
+	s.Require().NoError(err)
+	s.Require().Equal(expResult, values)
+}
+
+func (s *redisSuite) TestMGetWithNonStringKeys() {
+	s.Require().NoError(s.ring.RPush(mockRdsCTX, "non-string", "v").Err())
+	s.Require().NoError(s.ring.Set(mockRdsCTX, "string", mockRdsBytes, time.Hour).Err())
+	keys := []string{"non-string", "string"}
+	expResult := []Value{{Valid: false, Bytes: nil}, {Valid: true, Bytes: mockRdsBytes}}
+
+	// routed by the ring
+	values, err := s.rds.MGet(mockRdsCTX, keys)
+	s.Require().NoError(err)
+	s.Require().Equal(expResult, values)
+
+	// grouped by shards
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{"server1": ":6379"},
+	})
+	defer ring.Close()
+	values, err = NewRedis(ring).MGet(mockRdsCTX, keys)
+	s.Require().NoError(err)
+	s.Require().Equal(expResult, values)
+}
+
+func (s *redisSuite) TestMGetWithMeta() {
+	s.Require().NoError(s.ring.Set(mockRdsCTX, "meta-expiring", mockRdsBytes, time.Hour).Err())
+	s.Require().NoError(s.ring.Set(mockRdsCTX, "meta-persistent", mockRdsBytes, 0).Err())
+	keys := []string{"meta-expiring", "meta-persistent", "not-existed"}
+
+	assertMeta := func(r Redis) {
+		values, err := r.(MetaGetter).MGetWithMeta(mockRdsCTX, keys)
+		s.Require().NoError(err)
+		s.Require().Len(values, 3)
+		s.Require().True(values[0].Valid)
+		s.Require().Equal(mockRdsBytes, values[0].Bytes)
+		s.Require().True(values[0].TTL > 0 && values[0].TTL <= time.Hour)
+		s.Require().Equal(Value{Valid: true, Bytes: mockRdsBytes}, values[1])
+		s.Require().Equal(Value{Valid: false, Bytes: nil}, values[2])
+	}
+
+	// routed by the ring
+	assertMeta(s.rds)
+
+	// grouped by shards
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{"server1": ":6379"},
+	})
+	defer ring.Close()
+	assertMeta(NewRedis(ring))
+}
+
+func (s *redisSuite) TestHashtagKey() {
+	s.Require().Equal("key", hashtagKey("key"))
+	s.Require().Equal("tag", hashtagKey("prefix:{tag}:key"))
+	s.Require().Equal("{}key", hashtagKey("{}key"))
+}
+
+func (s *redisSuite) TestPing() {
+	s.Require().NoError(s.rds.Ping(mockRdsCTX))
+
+	// server2 is unreachable
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{
+			"server1": ":6379",
+			"server2": ":6390",
+		},
+		MaxRetries:         -1,
+		HeartbeatFrequency: time.Hour,
+	})
+	defer ring.Close()
+	err := NewRedis(ring).(*rds).Ping(mockRdsCTX)
+	s.Require().Error(err)
+	s.Require().Contains(err.Error(), "shard :6390")
+}
+
+func (s *redisSuite) TestMGetWithShardFailure() {
+	// server2 is down
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{
+			"server1": ":6379",
+			"server2": ":6390",
+		},
+		MaxRetries: -1,
+		// keep server2 in the ring, so that the keys are grouped by shards
+		HeartbeatFrequency: time.Hour,
+	})
+	defer ring.Close()
+
+	r := NewRedis(ring).(*rds)
+	keys := []string{}
+	expResult := []Value{}
+	for i := 0; i < 10; i++ {
+		key := "shard-" + strconv.Itoa(i)
+		keys = append(keys, key)
+
+		if r.shardHash.Get(key) == "server2" {
+			expResult = append(expResult, Value{Valid: false, Bytes: nil})
+			continue
+		}
+
+		s.Require().NoError(s.ring.Set(mockRdsCTX, key, key, time.Hour).Err())
+		expResult = append(expResult, Value{Valid: true, Bytes: []byte(key)})
+	}
+	s.Require().Contains(expResult, Value{Valid: false, Bytes: nil})
+
+	// fail the whole MGet by default
+	_, err := r.MGet(mockRdsCTX, keys)
+	s.Require().Error(err)
+
+	// only the keys on the failed shard are missing
+	shardErrs := []error{}
+	r = NewRedis(ring, WithShardFailurePolicy(ShardFailurePolicyMiss), OnShardErrorFunc(func(err error) {
+		shardErrs = append(shardErrs, err)
+	})).(*rds)
+	values, err := r.MGet(mockRdsCTX, keys)
+	s.Require().NoError(err)
+	s.Require().Equal(expResult, values)
+	s.Require().Len(shardErrs, 1)
+
+	// the context errors still fail the whole MGet
+	ctx, cancel := context.WithCancel(mockRdsCTX)
+	cancel()
+	_, err = r.MGet(ctx, keys)
+	s.Require().ErrorIs(err, context.Canceled)
+}
+
+func (s *redisSuite) TestNewRedisWithInvalidOptions() {
+	s.Require().PanicsWithError("invalid mget batch size", func() {
+		NewRedis(s.ring, WithMGetBatchSize(-1))
+	})
+	s.Require().PanicsWithError("invalid mget parallelism", func() {
+		NewRedis(s.ring, WithMGetParallelism(-1))
+	})
+	s.Require().PanicsWithError("invalid subscription backoff", func() {
+		NewRedis(s.ring, WithSubscriptionBackoff(0, time.Second))
+	})
+	s.Require().PanicsWithError("invalid subscription backoff", func() {
+		NewRedis(s.ring, WithSubscriptionBackoff(time.Second, time.Millisecond))
+	})
+	s.Require().PanicsWithError("invalid max value bytes", func() {
+		NewRedis(s.ring, WithMaxValueBytes(-1))
+	})
+}
+
+func (s *redisSuite) TestConnectionCallbacks() {
+	refused := int32(1)
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs:              map[string]string{"server1": ":6379"},
+		HeartbeatFrequency: time.Hour,
+		MaxRetries:         -1,
+		Dialer: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if atomic.LoadInt32(&refused) == 1 {
+				return nil, errors.New("connection refused")
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	})
+	defer ring.Close()
+
+	connErrs := []string{}
+	reconnects := []string{}
+	r := NewRedis(ring,
+		OnConnectionErrorFunc(func(addr string, err error) {
+			connErrs = append(connErrs, addr+": "+err.Error())
+		}),
+		OnReconnectFunc(func(addr string) {
+			reconnects = append(reconnects, addr)
+		}),
+	)
+	defer r.Close()
+
+	// reported once until healthy again
+	for i := 0; i < 3; i++ {
+		_, err := r.MGet(mockRdsCTX, []string{"conn-key"})
+		s.Require().Error(err)
+		s.Require().Error(r.MSet(mockRdsCTX, map[string][]byte{"conn-key": mockRdsBytes}, time.Hour))
+	}
+	s.Require().Equal([]string{":6379: connection refused"}, connErrs)
+	s.Require().Empty(reconnects)
+
+	// redis.Nil is not the connection error, the pool of go-redis redials in the background
+	atomic.StoreInt32(&refused, 0)
+	s.Require().Eventually(func() bool {
+		_, err := r.MGet(mockRdsCTX, []string{"conn-key"})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	s.Require().NoError(r.MSet(mockRdsCTX, map[string][]byte{"conn-key": mockRdsBytes}, time.Hour))
+	s.Require().Equal([]string{":6379"}, reconnects)
+	s.Require().Len(connErrs, 1)
+
+	// the context errors are not the connection errors either
+	ctx, cancel := context.WithCancel(mockRdsCTX)
+	cancel()
+	_, err := r.MGet(ctx, []string{"conn-key"})
+	s.Require().Error(err)
+	s.Require().Len(connErrs, 1)
+}
+
 func (s *redisSuite) TestMSet() {
 	tests := []struct {
 		Desc      string
@@ -191,6 +446,116 @@ func (s *redisSuite) TestMSet() {
 	}
 }
 
+func (s *redisSuite) TestMSetWithPerKeyTTL() {
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{
+		"per-key-short": mockRdsBytes,
+		"per-key-batch": mockRdsBytes,
+	}, time.Hour, WithPerKeyTTL(map[string]time.Duration{"per-key-short": time.Minute})))
+
+	ttl, err := s.ring.PTTL(mockRdsCTX, "per-key-short").Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl > 0 && ttl <= time.Minute)
+
+	ttl, err = s.ring.PTTL(mockRdsCTX, "per-key-batch").Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl > time.Minute && ttl <= time.Hour)
+}
+
+func (s *redisSuite) TestMSetWithMaxValueBytes() {
+	tests := []struct {
+		Desc     string
+		Policy   OversizedValuePolicy
+		ExpError bool
+		ExpVals  []Value
+	}{
+		{
+			Desc:     "skip the oversized values",
+			Policy:   OversizedValuePolicySkip,
+			ExpError: false,
+			ExpVals:  []Value{{Valid: true, Bytes: []byte("small")}, {}},
+		},
+		{
+			Desc:     "fail the whole batch",
+			Policy:   OversizedValuePolicyFail,
+			ExpError: true,
+			ExpVals:  []Value{{}, {}},
+		},
+	}
+
+	for _, t := range tests {
+		oversized := map[string]int{}
+		r := NewRedis(s.ring,
+			WithMaxValueBytes(5),
+			WithOversizedValuePolicy(t.Policy),
+			OnOversizedValueFunc(func(key string, size int) { oversized[key] = size }),
+		)
+
+		keyVals := map[string][]byte{"small": []byte("small"), "large": []byte("too large")}
+		err := r.MSet(mockRdsCTX, keyVals, time.Hour)
+		s.Require().Equal(t.ExpError, err != nil, t.Desc)
+		if t.ExpError {
+			s.Require().ErrorIs(err, ErrValueTooLarge, t.Desc)
+		}
+		s.Require().Equal(map[string]int{"large": len("too large")}, oversized, t.Desc)
+		s.Require().Len(keyVals, 2, t.Desc) // owned by the caller
+
+		vals, err := r.MGet(mockRdsCTX, []string{"small", "large"})
+		s.Require().NoError(err, t.Desc)
+		s.Require().Equal(t.ExpVals, vals, t.Desc)
+
+		s.Require().NoError(s.ring.FlushAll(mockRdsCTX).Err())
+	}
+}
+
+func (s *redisSuite) TestMSetWithMaxValueBytesOverwriting() {
+	r := NewRedis(s.ring, WithMaxValueBytes(5))
+	s.Require().NoError(r.MSet(mockRdsCTX, map[string][]byte{"key": []byte("old")}, time.Hour))
+
+	// the previous value isn't served after the oversized one is skipped
+	s.Require().NoError(r.MSet(mockRdsCTX, map[string][]byte{"key": []byte("too large")}, time.Hour))
+	vals, err := r.MGet(mockRdsCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+
+	// along with other keys
+	s.Require().NoError(r.MSet(mockRdsCTX, map[string][]byte{"key": []byte("old")}, time.Hour))
+	s.Require().NoError(r.MSet(mockRdsCTX, map[string][]byte{"key": []byte("too large"), "other": []byte("new")}, time.Hour))
+	vals, err = r.MGet(mockRdsCTX, []string{"key", "other"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte("new")}}, vals)
+}
+
+func (s *redisSuite) TestMSetWithKeepTTL() {
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{"keep-ttl": []byte("v1")}, time.Minute))
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{
+		"keep-ttl":     []byte("v2"),
+		"keep-ttl-new": []byte("v2"),
+	}, time.Hour, WithKeepTTL()))
+
+	vals, err := s.rds.MGet(mockRdsCTX, []string{"keep-ttl", "keep-ttl-new"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v2")}, {Valid: true, Bytes: []byte("v2")}}, vals)
+
+	// the existing TTL is kept, and the new key never expires
+	ttl, err := s.ring.PTTL(mockRdsCTX, "keep-ttl").Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl > 0 && ttl <= time.Minute)
+
+	ttl, err = s.ring.PTTL(mockRdsCTX, "keep-ttl-new").Result()
+	s.Require().NoError(err)
+	s.Require().Equal(time.Duration(-1), ttl)
+}
+
+func (s *redisSuite) TestMSetWithExpireAt() {
+	expireAt := time.Now().Add(time.Minute)
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{"expire-at": mockRdsBytes}, time.Hour,
+		WithPerKeyTTL(map[string]time.Duration{"expire-at": time.Hour}), WithKeepTTL(), WithExpireAt(expireAt)))
+
+	ttl, err := s.ring.PTTL(mockRdsCTX, "expire-at").Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl > 0 && ttl <= time.Minute)
+}
+
 func (s *redisSuite) TestDel() {
 	tests := []struct {
 		Desc      string
@@ -241,6 +606,158 @@ func (s *redisSuite) TestDel() {
 	}
 }
 
+func (s *redisSuite) TestTouch() {
+	s.Require().NoError(s.ring.Set(mockRdsCTX, "touch-key", mockRdsBytes, time.Hour).Err())
+
+	// remaining TTL is larger than the threshold, nothing changed
+	s.Require().NoError(s.rds.Touch(mockRdsCTX, []string{"touch-key", "not-existed"}, 2*time.Hour, time.Minute))
+	ttl, err := s.ring.PTTL(mockRdsCTX, "touch-key").Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl <= time.Hour)
+
+	// refresh the TTL
+	s.Require().NoError(s.rds.Touch(mockRdsCTX, []string{"touch-key"}, 2*time.Hour, 2*time.Hour))
+	ttl, err = s.ring.PTTL(mockRdsCTX, "touch-key").Result()
+	s.Require().NoError(err)
+	s.Require().True(ttl > time.Hour)
+
+	// not existed key is not created
+	_, err = s.ring.Get(mockRdsCTX, "not-existed").Result()
+	s.Require().Equal(redis.Nil, err)
+}
+
+func (s *redisSuite) TestLockAndUnlock() {
+	locked, err := s.rds.Lock(mockRdsCTX, []string{"lock-a", "lock-b"}, "token", time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal([]bool{true, true}, locked)
+
+	// held by others
+	locked, err = s.rds.Lock(mockRdsCTX, []string{"lock-a", "lock-c"}, "another-token", time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal([]bool{false, true}, locked)
+
+	// not released by others
+	s.Require().NoError(s.rds.Unlock(mockRdsCTX, []string{"lock-a"}, "another-token"))
+	token, err := s.ring.Get(mockRdsCTX, "lock-a").Result()
+	s.Require().NoError(err)
+	s.Require().Equal("token", token)
+
+	s.Require().NoError(s.rds.Unlock(mockRdsCTX, []string{"lock-a", "lock-b"}, "token"))
+	s.Require().Equal(int64(0), s.ring.Exists(mockRdsCTX, "lock-a", "lock-b").Val())
+
+	// expired
+	locked, err = s.rds.Lock(mockRdsCTX, []string{"lock-d"}, "token", 50*time.Millisecond)
+	s.Require().NoError(err)
+	s.Require().Equal([]bool{true}, locked)
+	time.Sleep(100 * time.Millisecond)
+	locked, err = s.rds.Lock(mockRdsCTX, []string{"lock-d"}, "another-token", time.Hour)
+	s.Require().NoError(err)
+	s.Require().Equal([]bool{true}, locked)
+}
+
+func (s *redisSuite) TestSetNXAndSetXX() {
+	// not existed yet
+	set, err := s.rds.SetXX(mockRdsCTX, "cond-key", []byte("v1"), time.Hour)
+	s.Require().NoError(err)
+	s.Require().False(set)
+
+	set, err = s.rds.SetNX(mockRdsCTX, "cond-key", []byte("v1"), time.Hour)
+	s.Require().NoError(err)
+	s.Require().True(set)
+
+	// existed already
+	set, err = s.rds.SetNX(mockRdsCTX, "cond-key", []byte("v2"), time.Hour)
+	s.Require().NoError(err)
+	s.Require().False(set)
+	s.Require().Equal("v1", s.ring.Get(mockRdsCTX, "cond-key").Val())
+
+	set, err = s.rds.SetXX(mockRdsCTX, "cond-key", []byte("v2"), time.Hour)
+	s.Require().NoError(err)
+	s.Require().True(set)
+	s.Require().Equal("v2", s.ring.Get(mockRdsCTX, "cond-key").Val())
+	s.Require().True(s.ring.TTL(mockRdsCTX, "cond-key").Val() > 0)
+}
+
+func (s *redisSuite) TestGetDel() {
+	s.Require().NoError(s.ring.Set(mockRdsCTX, "getdel-key", "v1", time.Hour).Err())
+
+	val, err := s.rds.GetDel(mockRdsCTX, "getdel-key")
+	s.Require().NoError(err)
+	s.Require().Equal(Value{Valid: true, Bytes: []byte("v1")}, val)
+	s.Require().Equal(int64(0), s.ring.Exists(mockRdsCTX, "getdel-key").Val())
+
+	// taken already
+	val, err = s.rds.GetDel(mockRdsCTX, "getdel-key")
+	s.Require().NoError(err)
+	s.Require().Equal(Value{Valid: false, Bytes: nil}, val)
+}
+
+func (s *redisSuite) TestRPushAndLRange() {
+	s.Require().NoError(s.rds.RPush(mockRdsCTX, "list-key", [][]byte{[]byte("v1"), []byte("v2")}, 3, time.Hour))
+	s.Require().NoError(s.rds.RPush(mockRdsCTX, "list-key", [][]byte{[]byte("v3"), []byte("v4")}, 3, time.Hour))
+	s.Require().Greater(int64(s.ring.PTTL(mockRdsCTX, "list-key").Val()), int64(0))
+
+	// only the latest ones are kept
+	vals, err := s.rds.LRange(mockRdsCTX, "list-key", 0, -1)
+	s.Require().NoError(err)
+	s.Require().Equal([][]byte{[]byte("v2"), []byte("v3"), []byte("v4")}, vals)
+
+	vals, err = s.rds.LRange(mockRdsCTX, "list-key", -2, 10)
+	s.Require().NoError(err)
+	s.Require().Equal([][]byte{[]byte("v3"), []byte("v4")}, vals)
+
+	vals, err = s.rds.LRange(mockRdsCTX, "not-existed", 0, -1)
+	s.Require().NoError(err)
+	s.Require().Empty(vals)
+
+	// the keys holding strings aren't lists
+	s.Require().NoError(s.ring.Set(mockRdsCTX, "bytes-key", "v1", time.Hour).Err())
+	s.Require().Equal(ErrNotList, s.rds.RPush(mockRdsCTX, "bytes-key", [][]byte{[]byte("v2")}, 0, time.Hour))
+	_, err = s.rds.LRange(mockRdsCTX, "bytes-key", 0, -1)
+	s.Require().Equal(ErrNotList, err)
+}
+
+func (s *redisSuite) TestClear() {
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{
+		"ca:pfx:key1":    mockRdsBytes,
+		"ca:pfx:key2":    mockRdsBytes,
+		"ca:pfx2:key1":   mockRdsBytes,
+		"ca:pf*:key1":    mockRdsBytes,
+		"other:pfx:key1": mockRdsBytes,
+	}, time.Hour))
+
+	s.Require().NoError(s.rds.Clear(mockRdsCTX, "ca:pfx:"))
+	s.Require().Equal(int64(0), s.ring.Exists(mockRdsCTX, "ca:pfx:key1", "ca:pfx:key2").Val())
+	s.Require().Equal(int64(3), s.ring.Exists(mockRdsCTX, "ca:pfx2:key1", "ca:pf*:key1", "other:pfx:key1").Val())
+
+	// special characters are not treated as the pattern
+	s.Require().NoError(s.rds.Clear(mockRdsCTX, "ca:pf*:"))
+	s.Require().Equal(int64(0), s.ring.Exists(mockRdsCTX, "ca:pf*:key1").Val())
+	s.Require().Equal(int64(2), s.ring.Exists(mockRdsCTX, "ca:pfx2:key1", "other:pfx:key1").Val())
+}
+
+func (s *redisSuite) TestDelPattern() {
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{
+		"ca:pfx:shoes:1": mockRdsBytes,
+		"ca:pfx:shoes:2": mockRdsBytes,
+		"ca:pfx:hats:1":  mockRdsBytes,
+	}, time.Hour))
+
+	keys, err := s.rds.DelPattern(mockRdsCTX, "ca:pfx:shoes:*")
+	s.Require().NoError(err)
+	s.Require().ElementsMatch([]string{"ca:pfx:shoes:1", "ca:pfx:shoes:2"}, keys)
+	s.Require().Equal(int64(1), s.ring.Exists(mockRdsCTX, "ca:pfx:shoes:1", "ca:pfx:shoes:2", "ca:pfx:hats:1").Val())
+
+	keys, err = s.rds.DelPattern(mockRdsCTX, "ca:pfx:not-existed:*")
+	s.Require().NoError(err)
+	s.Require().Empty(keys)
+}
+
+func (s *redisSuite) TestEscapeGlob() {
+	s.Require().Equal("ca:pfx:", escapeGlob("ca:pfx:"))
+	s.Require().Equal(`ca:\*\?\[x\]\\:`, escapeGlob(`ca:*?[x]\:`))
+}
+
 func (s *redisSuite) TestPub() {
 	sub := s.rds.ring.Subscribe(mockRdsCTX, mockEvictTopic)
 	pause := make(chan struct{})
@@ -288,3 +805,103 @@ func (s *redisSuite) TestSub() {
 	s.rds.Close()
 	wg.Wait()
 }
+
+func (s *redisSuite) TestSubWithReconnection() {
+	errs := make(chan error, 10)
+	logger := newMockLogger()
+	r := NewRedis(s.ring,
+		WithSubscriptionBackoff(10*time.Millisecond, 50*time.Millisecond),
+		OnSubscriptionErrorFunc(func(err error) { errs <- err }),
+		WithRedisLogger(logger),
+	).(*rds)
+
+	messChan := r.Sub(mockRdsCTX, mockEvictTopic)
+	// keep publishing until the subscription takes effect
+	received := func() bool {
+		s.Require().NoError(s.ring.Publish(mockRdsCTX, mockEvictTopic, []byte(mockRdsPayload)).Err())
+		select {
+		case mess := <-messChan:
+			return s.Equal([]byte(mockRdsPayload), mess.Content())
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}
+	s.Require().Eventually(received, time.Second, 10*time.Millisecond)
+
+	// simulate the dropped subscription
+	r.subMut.Lock()
+	dropped := r.subscriber
+	r.subMut.Unlock()
+	s.Require().NoError(dropped.Close())
+
+	err := <-errs
+	s.Require().ErrorIs(err, ErrSubscriptionClosed)
+
+	// messages are received again after resubscribing
+	s.Require().Eventually(received, time.Second, 10*time.Millisecond)
+	s.Require().Equal([]string{"redis: subscription failed"}, logger.messages("warn"))
+	s.Require().Equal([]string{"redis: resubscribed"}, logger.messages("debug"))
+
+	// no more resubscribing after closing
+	r.Close()
+	for range messChan {
+		// drain the messages published before closing
+	}
+	s.Require().Empty(errs)
+}
+
+func BenchmarkRedisMGet10k(b *testing.B) {
+	// two shards sharing the same server, which makes the ring issue commands concurrently
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{
+			"server1": ":6379",
+			"server2": ":6379",
+		},
+	})
+	defer ring.Close()
+
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "bench-" + strconv.Itoa(i)
+		if err := ring.Set(mockRdsCTX, keys[i], mockRdsBytes, time.Hour).Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	benchmarks := []struct {
+		Name    string
+		Options []RedisOptions
+	}{
+		{Name: "single batch"},
+		{Name: "batch 1000 parallelism 4", Options: []RedisOptions{WithMGetBatchSize(1000), WithMGetParallelism(4)}},
+	}
+
+	b.Run("ring MGET", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ring.MGet(mockRdsCTX, keys...).Result(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, bm := range benchmarks {
+		r := NewRedis(ring, bm.Options...)
+		b.Run(bm.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := r.MGet(mockRdsCTX, keys); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func (s *redisSuite) TestRing() {
+	s.Require().Same(s.ring, s.rds.Ring())
+
+	// the commands not covered by Adapter work on the same keys
+	s.Require().NoError(s.rds.MSet(mockRdsCTX, map[string][]byte{"ring-key": mockRdsBytes}, time.Hour))
+	n, err := s.rds.Ring().Exists(mockRdsCTX, "ring-key").Result()
+	s.Require().NoError(err)
+	s.Require().Equal(int64(1), n)
+}
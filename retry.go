@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 10 * time.Millisecond
+	defaultRetryMaxBackoff  = time.Second
+)
+
+// retryableRedisErrors are the prefixes of the transient errors replied by redis, e.g. during the failover.
+var retryableRedisErrors = []string{"LOADING ", "READONLY ", "TRYAGAIN ", "CLUSTERDOWN ", "MASTERDOWN "}
+
+// RetryPolicy specifies how the retrying adapter retries the failed operations.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one. The default is 3.
+	MaxAttempts int
+	// MinBackoff is the backoff before the first retry, which is doubled for each retry. The default is 10 milliseconds.
+	MinBackoff time.Duration
+	// MaxBackoff caps the backoff. The default is 1 second.
+	MaxBackoff time.Duration
+	// Retryable decides whether the error is retried. The default is IsRetryableError.
+	Retryable func(err error) bool
+}
+
+// IsRetryableError reports whether the error is transient, e.g. the connection resets, the network timeouts and
+// the redis replies of LOADING, READONLY, TRYAGAIN, CLUSTERDOWN and MASTERDOWN. The context errors are not retried.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	for _, prefix := range retryableRedisErrors {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewRetryingAdapter generates Adapter retrying the operations of the inner Adapter on the retryable errors
+// with the exponential backoff, and it stops retrying once the context is done.
+// All operations are safe to retry, MGet is read-only, and MSet and Del are idempotent.
+// Notice that the optional interfaces implemented by the inner Adapter, e.g. Statser and Toucher, are not exposed.
+func NewRetryingAdapter(inner Adapter, policy RetryPolicy) Adapter {
+	if policy.MaxAttempts < 0 || policy.MinBackoff < 0 || policy.MaxBackoff < 0 {
+		panic(errors.New("invalid retry policy"))
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.MinBackoff == 0 {
+		policy.MinBackoff = defaultRetryMinBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.MinBackoff > policy.MaxBackoff {
+		panic(errors.New("invalid retry policy"))
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsRetryableError
+	}
+
+	return &retrier{inner: inner, policy: policy}
+}
+
+type retrier struct {
+	inner  Adapter
+	policy RetryPolicy
+}
+
+func (adp *retrier) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	var vals []Value
+	err := adp.retry(ctx, func() error {
+		var err error
+		vals, err = adp.inner.MGet(ctx, keys)
+		return err
+	})
+
+	return vals, err
+}
+
+func (adp *retrier) MSet(
+	ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions,
+) error {
+	return adp.retry(ctx, func() error {
+		return adp.inner.MSet(ctx, keyVals, ttl, options...)
+	})
+}
+
+func (adp *retrier) Del(ctx context.Context, keys ...string) error {
+	return adp.retry(ctx, func() error {
+		return adp.inner.Del(ctx, keys...)
+	})
+}
+
+// retry executes the operation until it succeeds, the error isn't retryable, or the attempts run out.
+// The last error is returned.
+func (adp *retrier) retry(ctx context.Context, op func() error) error {
+	backoff := adp.policy.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= adp.policy.MaxAttempts || !adp.policy.Retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > adp.policy.MaxBackoff {
+			backoff = adp.policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockRetryCTX = context.Background()
+)
+
+// flakyAdapter fails the operations with the errors in order before passing them to the inner Adapter.
+type flakyAdapter struct {
+	Adapter
+	errs     []error
+	attempts int
+}
+
+func (adp *flakyAdapter) fail() error {
+	adp.attempts++
+	if len(adp.errs) == 0 {
+		return nil
+	}
+
+	err := adp.errs[0]
+	adp.errs = adp.errs[1:]
+	return err
+}
+
+func (adp *flakyAdapter) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	if err := adp.fail(); err != nil {
+		return nil, err
+	}
+
+	return adp.Adapter.MGet(ctx, keys)
+}
+
+func (adp *flakyAdapter) MSet(ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions) error {
+	if err := adp.fail(); err != nil {
+		return err
+	}
+
+	return adp.Adapter.MSet(ctx, keyVals, ttl, options...)
+}
+
+func (adp *flakyAdapter) Del(ctx context.Context, keys ...string) error {
+	if err := adp.fail(); err != nil {
+		return err
+	}
+
+	return adp.Adapter.Del(ctx, keys...)
+}
+
+type retrySuite struct {
+	suite.Suite
+
+	flaky *flakyAdapter
+}
+
+func (s *retrySuite) SetupSuite() {}
+
+func (s *retrySuite) TearDownSuite() {}
+
+func (s *retrySuite) SetupTest() {
+	s.flaky = &flakyAdapter{Adapter: NewTinyLFU(10000)}
+}
+
+func (s *retrySuite) TearDownTest() {}
+
+func TestRetrySuite(t *testing.T) {
+	suite.Run(t, new(retrySuite))
+}
+
+func (s *retrySuite) TestRetry() {
+	adp := NewRetryingAdapter(s.flaky, RetryPolicy{MinBackoff: time.Millisecond})
+
+	s.flaky.errs = []error{io.EOF, errors.New("LOADING Redis is loading the dataset in memory")}
+	s.Require().NoError(adp.MSet(mockRetryCTX, map[string][]byte{"key": mockLfuBytes}, time.Hour))
+	s.Require().Equal(3, s.flaky.attempts)
+
+	s.flaky.attempts = 0
+	s.flaky.errs = []error{syscall.ECONNRESET}
+	vals, err := adp.MGet(mockRetryCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: mockLfuBytes}}, vals)
+	s.Require().Equal(2, s.flaky.attempts)
+
+	// run out of attempts
+	s.flaky.attempts = 0
+	s.flaky.errs = []error{io.EOF, io.EOF, fmt.Errorf("wrapped: %w", io.EOF), nil}
+	s.Require().ErrorIs(adp.Del(mockRetryCTX, "key"), io.EOF)
+	s.Require().Equal(3, s.flaky.attempts)
+
+	// not retryable
+	s.flaky.attempts = 0
+	s.flaky.errs = []error{errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")}
+	s.Require().Error(adp.Del(mockRetryCTX, "key"))
+	s.Require().Equal(1, s.flaky.attempts)
+}
+
+func (s *retrySuite) TestRetryWithCustomRetryable() {
+	errCustom := errors.New("custom")
+	adp := NewRetryingAdapter(s.flaky, RetryPolicy{
+		MaxAttempts: 5,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		Retryable: func(err error) bool {
+			return errors.Is(err, errCustom)
+		},
+	})
+
+	s.flaky.errs = []error{errCustom, errCustom, errCustom, errCustom}
+	s.Require().NoError(adp.Del(mockRetryCTX, "key"))
+	s.Require().Equal(5, s.flaky.attempts)
+}
+
+func (s *retrySuite) TestRetryWithContextDone() {
+	adp := NewRetryingAdapter(s.flaky, RetryPolicy{MaxAttempts: 10, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(mockRetryCTX, 10*time.Millisecond)
+	defer cancel()
+	s.flaky.errs = []error{io.EOF, io.EOF}
+	s.Require().ErrorIs(adp.Del(ctx, "key"), io.EOF)
+	s.Require().Equal(1, s.flaky.attempts)
+}
+
+func (s *retrySuite) TestIsRetryableError() {
+	s.Require().False(IsRetryableError(nil))
+	s.Require().False(IsRetryableError(context.Canceled))
+	s.Require().False(IsRetryableError(context.DeadlineExceeded))
+	s.Require().False(IsRetryableError(errors.New("ERR unknown command")))
+	s.Require().True(IsRetryableError(io.ErrUnexpectedEOF))
+	s.Require().True(IsRetryableError(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+	s.Require().True(IsRetryableError(errors.New("READONLY You can't write against a read only replica.")))
+}
+
+func (s *retrySuite) TestNewRetryingAdapterWithInvalidPolicy() {
+	s.Require().PanicsWithError("invalid retry policy", func() {
+		NewRetryingAdapter(s.flaky, RetryPolicy{MaxAttempts: -1})
+	})
+	s.Require().PanicsWithError("invalid retry policy", func() {
+		NewRetryingAdapter(s.flaky, RetryPolicy{MinBackoff: time.Second, MaxBackoff: time.Millisecond})
+	})
+}
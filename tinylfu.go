@@ -1,9 +1,17 @@
 package cache
 
 import (
+	"bytes"
+	"container/list"
 	"context"
 	"errors"
+	"fmt"
+	"hash/maphash"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vmihailenco/go-tinylfu"
@@ -16,11 +24,51 @@ const (
 )
 
 type tinyLFU struct {
+	// counters are placed first to keep 64-bit alignment for atomic operations
+	hits      uint64
+	misses    uint64
+	sets      uint64
+	evictions uint64
+
 	lfu *tinylfu.T
 	// tinyLFU is not thread-safe, it needs a lock
 	mut    sync.Mutex
 	rand   *rand.Rand
 	offset time.Duration
+	clock  Clock
+	// entries tracks the keys set by MSet(), which is used to refresh the TTL
+	entries map[string]*lfuEntry
+	// touching suppresses the eviction callbacks when refreshing the TTL
+	touching bool
+	// replacing suppresses counting the evictions when overwriting the keys
+	replacing bool
+	// maxBytes is the budget of the stored bytes, 0 means unlimited
+	maxBytes int
+	// bytes is the total length of the values set by MSet()
+	bytes int
+	// order lists the keys set by MSet() from the oldest, which are evicted first when exceeding maxBytes
+	order *list.List
+	// contents stores the unique values by their hash when deduplicating, nil means disabled
+	contents map[uint64]*lfuContent
+	seed     maphash.Seed
+}
+
+type lfuEntry struct {
+	expireAt time.Time
+	// size is the length of the value, or the total length of the list
+	size    int
+	onEvict func()
+	// elem is the element of the key in the order
+	elem *list.Element
+	// content is the shared value of the key when deduplicating
+	content *lfuContent
+}
+
+// lfuContent is the value shared by the keys, which is released when no keys refer to it.
+type lfuContent struct {
+	hash uint64
+	b    []byte
+	refs int
 }
 
 // NewTinyLFU generates Adapter with tinylfu
@@ -36,12 +84,28 @@ func NewTinyLFU(size int, options ...TinyLFUOptions) Adapter {
 	if o.offset != defaultOffset && o.offset < 0 {
 		panic(errors.New("invalid offset"))
 	}
+	if o.clock == nil {
+		o.clock = systemClock{}
+	}
+	if o.maxBytes < 0 {
+		panic(errors.New("invalid max bytes"))
+	}
 
-	return &tinyLFU{
-		lfu:    tinylfu.New(size, samples),
-		rand:   rand.New(rand.NewSource(uint64(time.Now().UnixNano()))),
-		offset: o.offset,
+	lfu := &tinyLFU{
+		lfu:      tinylfu.New(size, samples),
+		rand:     rand.New(rand.NewSource(uint64(time.Now().UnixNano()))),
+		offset:   o.offset,
+		clock:    o.clock,
+		maxBytes: o.maxBytes,
+		entries:  map[string]*lfuEntry{},
+		order:    list.New(),
+	}
+	if o.dedup {
+		lfu.contents = map[uint64]*lfuContent{}
+		lfu.seed = maphash.MakeSeed()
 	}
+
+	return lfu
 }
 
 // TinyLFUOptions is an alias for functional argument.
@@ -49,7 +113,10 @@ type TinyLFUOptions func(opts *tinyLFUOptions)
 
 // tinyLFUOptions contains all options which will be applied when calling New().
 type tinyLFUOptions struct {
-	offset time.Duration
+	offset   time.Duration
+	clock    Clock
+	maxBytes int
+	dedup    bool
 }
 
 // WithOffset sets up the offset which is used to randomize TTL preventing
@@ -60,6 +127,33 @@ func WithOffset(offset time.Duration) TinyLFUOptions {
 	}
 }
 
+// WithClock sets up the clock deciding the expiration of keys, and the default is the system clock.
+// It makes the expiration controllable in tests, e.g. by cachetest.ManualClock.
+// Notice that tinylfu expires keys by the system clock as well, so the clock must not lag behind it.
+func WithClock(clock Clock) TinyLFUOptions {
+	return func(opts *tinyLFUOptions) {
+		opts.clock = clock
+	}
+}
+
+// WithMaxBytes caps the total length of the stored values, which gives a hard memory ceiling beside the number of keys.
+// The oldest keys are evicted until the new value fits, and the values larger than the budget are not stored.
+// The evictions trigger the cost eviction callbacks as usual.
+func WithMaxBytes(n int) TinyLFUOptions {
+	return func(opts *tinyLFUOptions) {
+		opts.maxBytes = n
+	}
+}
+
+// WithDedup stores each unique value once, and the keys with the identical values share it,
+// which saves the memory when many keys map to the same large value. The shared value is released
+// when no keys refer to it. Notice that WithMaxBytes() still counts the length of the value for each key.
+func WithDedup() TinyLFUOptions {
+	return func(opts *tinyLFUOptions) {
+		opts.dedup = true
+	}
+}
+
 func loadtinyLFUOptions(options ...TinyLFUOptions) *tinyLFUOptions {
 	opts := &tinyLFUOptions{offset: defaultOffset}
 	for _, option := range options {
@@ -78,7 +172,50 @@ func (lfu *tinyLFU) MSet(
 
 	// load options
 	o := loadMSetOptions(options...)
-	// offset is used to adjust the ttl preventing expiring at the same time
+
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	for key, b := range keyVals {
+		lfu.set(key, b, o.ttlOf(key, ttl), o)
+	}
+
+	return nil
+}
+
+// SetNX sets the key only if it doesn't exist. The existence check and setting are atomic under the lock.
+func (lfu *tinyLFU) SetNX(
+	ctx context.Context, key string, b []byte, ttl time.Duration, options ...MSetOptions,
+) (bool, error) {
+	return lfu.setIf(key, b, ttl, false, options...), nil
+}
+
+// SetXX sets the key only if it exists. The existence check and setting are atomic under the lock.
+func (lfu *tinyLFU) SetXX(
+	ctx context.Context, key string, b []byte, ttl time.Duration, options ...MSetOptions,
+) (bool, error) {
+	return lfu.setIf(key, b, ttl, true, options...), nil
+}
+
+// setIf sets the key only if its existence equals to the expected one.
+func (lfu *tinyLFU) setIf(key string, b []byte, ttl time.Duration, exist bool, options ...MSetOptions) bool {
+	o := loadMSetOptions(options...)
+
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	if _, ok := lfu.get(key, lfu.clock.Now()); ok != exist {
+		return false
+	}
+
+	lfu.set(key, b, ttl, o)
+
+	return true
+}
+
+// jitter returns the random offset added to the TTL, which prevents the keys from expiring at the same time.
+// It must be called with the lock held.
+func (lfu *tinyLFU) jitter(ttl time.Duration) time.Duration {
 	offset := lfu.offset
 	if offset == defaultOffset {
 		offset = ttl / 10
@@ -87,52 +224,207 @@ func (lfu *tinyLFU) MSet(
 		}
 	}
 
-	lfu.mut.Lock()
-	defer lfu.mut.Unlock()
+	if offset <= 0 {
+		return 0
+	}
 
-	for key, b := range keyVals {
-		t := ttl
-		if offset > 0 {
-			t += time.Duration(lfu.rand.Int63n(int64(offset)))
+	return time.Duration(lfu.rand.Int63n(int64(offset)))
+}
+
+// set sets the key with the randomized TTL unless it's disabled by the option, and the callbacks.
+// It must be called with the lock held.
+func (lfu *tinyLFU) set(key string, b []byte, ttl time.Duration, o *msetOptions) {
+	lfu.setValue(key, b, len(b), ttl, o)
+}
+
+// setValue is similar to set, but the value is either []byte or the list of [][]byte, whose size is the total
+// length of the bytes. The cost function and deduplicating apply to []byte only. It must be called with the lock held.
+func (lfu *tinyLFU) setValue(key string, value interface{}, size int, ttl time.Duration, o *msetOptions) {
+	t := ttl
+	if !o.noOffset {
+		t += lfu.jitter(ttl)
+	}
+
+	// remove the overwritten value first, otherwise it lingers in tinylfu
+	if _, ok := lfu.entries[key]; ok {
+		lfu.replacing = true
+		lfu.lfu.Del(key)
+		lfu.replacing = false
+	}
+
+	if lfu.maxBytes > 0 {
+		if size > lfu.maxBytes {
+			return
 		}
+		lfu.evictOldest(size)
+	}
+
+	b, isBytes := value.([]byte)
+	cost := size
+	if o.costFunc != nil && isBytes {
+		cost = o.costFunc(key, b)
+	}
+	if o.onCostAdd != nil {
+		o.onCostAdd(key, cost)
+	}
 
-		cost := len(b)
-		if o.onCostAdd != nil {
-			o.onCostAdd(key, cost)
+	entry := &lfuEntry{expireAt: lfu.clock.Now().Add(t), size: size}
+	if !o.expireAt.IsZero() {
+		entry.expireAt = o.expireAt
+	}
+	if lfu.contents != nil && isBytes {
+		b, entry.content = lfu.intern(b)
+		value = b
+	}
+	entry.onEvict = func() {
+		if lfu.touching {
+			return
 		}
 
-		lfu.lfu.Set(&tinylfu.Item{
-			Key:      key,
-			Value:    b,
-			ExpireAt: time.Now().Add(t),
-			OnEvict: func() {
-				if o.onCostEvict != nil {
-					o.onCostEvict(key, cost)
-				}
-			},
-		})
+		if lfu.entries[key] == entry {
+			delete(lfu.entries, key)
+		}
+		lfu.release(entry)
+		if entry.elem != nil {
+			lfu.order.Remove(entry.elem)
+			entry.elem = nil
+			lfu.bytes -= size
+		}
+
+		if !lfu.replacing {
+			atomic.AddUint64(&lfu.evictions, 1)
+		}
+		if o.onCostEvict != nil {
+			o.onCostEvict(key, cost)
+		}
 	}
+	entry.elem = lfu.order.PushBack(key)
+	lfu.bytes += size
+	lfu.entries[key] = entry
 
-	return nil
+	lfu.lfu.Set(&tinylfu.Item{
+		Key:      key,
+		Value:    value,
+		ExpireAt: entry.expireAt,
+		OnEvict:  entry.onEvict,
+	})
+	atomic.AddUint64(&lfu.sets, 1)
+}
+
+// intern returns the shared value identical to b, or stores b as the shared one.
+// The content is nil if another value with the same hash is stored, then b is not shared.
+// It must be called with the lock held.
+func (lfu *tinyLFU) intern(b []byte) ([]byte, *lfuContent) {
+	h := maphash.Hash{}
+	h.SetSeed(lfu.seed)
+	h.Write(b)
+	hash := h.Sum64()
+
+	if content, ok := lfu.contents[hash]; ok {
+		if !bytes.Equal(content.b, b) {
+			return b, nil
+		}
+
+		content.refs++
+		return content.b, content
+	}
+
+	content := &lfuContent{hash: hash, b: b, refs: 1}
+	lfu.contents[hash] = content
+
+	return b, content
+}
+
+// release drops the reference of the entry to the shared value. It must be called with the lock held.
+func (lfu *tinyLFU) release(entry *lfuEntry) {
+	content := entry.content
+	if content == nil {
+		return
+	}
+
+	entry.content = nil
+	if content.refs--; content.refs == 0 {
+		delete(lfu.contents, content.hash)
+	}
+}
+
+// evictOldest evicts the oldest keys until n more bytes fit in the budget. It must be called with the lock held.
+func (lfu *tinyLFU) evictOldest(n int) {
+	for lfu.bytes+n > lfu.maxBytes {
+		front := lfu.order.Front()
+		if front == nil {
+			return
+		}
+
+		key := front.Value.(string)
+		entry, ok := lfu.entries[key]
+		if !ok {
+			lfu.order.Remove(front)
+			continue
+		}
+
+		lfu.lfu.Del(key)
+		// the key is gone from tinylfu without the callback, release it anyway
+		if entry.elem != nil {
+			entry.onEvict()
+		}
+	}
 }
 
 func (lfu *tinyLFU) MGet(ctx context.Context, keys []string) ([]Value, error) {
+	return lfu.mget(keys, false), nil
+}
+
+// MGetWithMeta fills in the remaining TTL by the ExpireAt of the keys set by MSet().
+func (lfu *tinyLFU) MGetWithMeta(ctx context.Context, keys []string) ([]Value, error) {
+	return lfu.mget(keys, true), nil
+}
+
+func (lfu *tinyLFU) mget(keys []string, withTTL bool) []Value {
+	now := lfu.clock.Now()
+
 	lfu.mut.Lock()
 	defer lfu.mut.Unlock()
 
 	vals := make([]Value, len(keys))
 	for i, key := range keys {
-		val, ok := lfu.lfu.Get(key)
+		val, ok := lfu.get(key, now)
 		if !ok {
+			atomic.AddUint64(&lfu.misses, 1)
 			vals[i] = Value{Valid: false, Bytes: nil}
 			continue
 		}
 
 		b, ok := val.([]byte)
+		if ok {
+			atomic.AddUint64(&lfu.hits, 1)
+		} else {
+			atomic.AddUint64(&lfu.misses, 1)
+		}
 		vals[i] = Value{Valid: ok, Bytes: b}
+
+		if entry, exist := lfu.entries[key]; ok && withTTL && exist && entry.expireAt.After(now) {
+			vals[i].TTL = entry.expireAt.Sub(now)
+		}
+	}
+
+	return vals
+}
+
+// get gets the key, and deletes it if it's expired by the clock, which may run ahead of the system clock of tinylfu.
+// It must be called with the lock held.
+func (lfu *tinyLFU) get(key string, now time.Time) (interface{}, bool) {
+	val, ok := lfu.lfu.Get(key)
+	if !ok {
+		return nil, false
 	}
 
-	return vals, nil
+	if entry, exist := lfu.entries[key]; exist && !entry.expireAt.After(now) {
+		lfu.lfu.Del(key)
+		return nil, false
+	}
+
+	return val, true
 }
 
 func (lfu *tinyLFU) Del(ctx context.Context, keys ...string) error {
@@ -145,3 +437,286 @@ func (lfu *tinyLFU) Del(ctx context.Context, keys ...string) error {
 
 	return nil
 }
+
+// GetDel gets and deletes the key under the lock, so that the value is returned only once.
+func (lfu *tinyLFU) GetDel(ctx context.Context, key string) (Value, error) {
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	val, ok := lfu.get(key, lfu.clock.Now())
+	if !ok {
+		atomic.AddUint64(&lfu.misses, 1)
+		return Value{Valid: false, Bytes: nil}, nil
+	}
+	lfu.lfu.Del(key)
+
+	b, ok := val.([]byte)
+	if !ok {
+		atomic.AddUint64(&lfu.misses, 1)
+		return Value{Valid: false, Bytes: nil}, nil
+	}
+
+	atomic.AddUint64(&lfu.hits, 1)
+	return Value{Valid: true, Bytes: b}, nil
+}
+
+// RPush appends the values to the list under the lock by replacing the list with the new one,
+// so that the lists returned by LRange() are never modified.
+func (lfu *tinyLFU) RPush(ctx context.Context, key string, values [][]byte, maxLen int, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	l := [][]byte{}
+	if val, ok := lfu.get(key, lfu.clock.Now()); ok {
+		old, isList := val.([][]byte)
+		if !isList {
+			return ErrNotList
+		}
+		l = append(l, old...)
+	}
+	l = append(l, values...)
+	if maxLen > 0 && len(l) > maxLen {
+		l = l[len(l)-maxLen:]
+	}
+
+	size := 0
+	for _, b := range l {
+		size += len(b)
+	}
+	lfu.setValue(key, l, size, ttl, loadMSetOptions())
+
+	return nil
+}
+
+// LRange returns the values of the list as LRANGE of redis does.
+func (lfu *tinyLFU) LRange(ctx context.Context, key string, start, stop int) ([][]byte, error) {
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	val, ok := lfu.get(key, lfu.clock.Now())
+	if !ok {
+		atomic.AddUint64(&lfu.misses, 1)
+		return [][]byte{}, nil
+	}
+
+	l, isList := val.([][]byte)
+	if !isList {
+		return nil, ErrNotList
+	}
+	atomic.AddUint64(&lfu.hits, 1)
+
+	// the negative indexes count from the end, and the out of range ones are clamped
+	if start < 0 {
+		start += len(l)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop += len(l)
+	}
+	if stop >= len(l) {
+		stop = len(l) - 1
+	}
+	if start > stop {
+		return [][]byte{}, nil
+	}
+
+	return append([][]byte{}, l[start:stop+1]...), nil
+}
+
+// Clear deletes the keys set by MSet() starting with the key prefix.
+func (lfu *tinyLFU) Clear(ctx context.Context, keyPrefix string) error {
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	keys := []string{}
+	for key := range lfu.entries {
+		if strings.HasPrefix(key, keyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		lfu.lfu.Del(key)
+		// the entry is removed by the eviction callback, unless the item is gone already
+		if entry, ok := lfu.entries[key]; ok {
+			lfu.release(entry)
+			delete(lfu.entries, key)
+		}
+	}
+
+	return nil
+}
+
+// DelPattern deletes the keys set by MSet() matching the pattern.
+func (lfu *tinyLFU) DelPattern(ctx context.Context, pattern string) ([]string, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	keys := []string{}
+	for key := range lfu.entries {
+		if re.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		lfu.lfu.Del(key)
+		// the entry is removed by the eviction callback, unless the item is gone already
+		if entry, ok := lfu.entries[key]; ok {
+			lfu.release(entry)
+			delete(lfu.entries, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// globRegexp compiles the glob-style pattern of redis into the regular expression matching the whole key.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("invalid pattern: %q", pattern)
+			}
+
+			sb.WriteString("[")
+			for j := i + 1; j < end; j++ {
+				switch {
+				case j == i+1 && runes[j] == '^':
+					sb.WriteString("^")
+				case runes[j] == '\\':
+					j++
+					sb.WriteString(regexp.QuoteMeta(string(runes[j])))
+				case runes[j] == '-':
+					sb.WriteString("-")
+				default:
+					sb.WriteString(regexp.QuoteMeta(string(runes[j])))
+				}
+			}
+			sb.WriteString("]")
+			i = end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+
+	return regexp.Compile("(?s)" + sb.String())
+}
+
+// Touch re-sets the keys with the new ExpireAt if their remaining TTL is less than the threshold.
+// It doesn't trigger any cost callbacks since the values are not changed.
+func (lfu *tinyLFU) Touch(ctx context.Context, keys []string, ttl time.Duration, threshold time.Duration) error {
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	now := lfu.clock.Now()
+	for _, key := range keys {
+		entry, ok := lfu.entries[key]
+		if !ok || entry.expireAt.Sub(now) >= threshold {
+			continue
+		}
+
+		val, ok := lfu.get(key, now)
+		if !ok {
+			continue
+		}
+
+		// remove the old item silently, then set it again with the same callbacks
+		lfu.touching = true
+		lfu.lfu.Del(key)
+		lfu.touching = false
+
+		entry.expireAt = now.Add(ttl + lfu.jitter(ttl))
+		lfu.lfu.Set(&tinylfu.Item{
+			Key:      key,
+			Value:    val,
+			ExpireAt: entry.expireAt,
+			OnEvict:  entry.onEvict,
+		})
+	}
+
+	return nil
+}
+
+// Size counts the keys set by MSet() or RPush() starting with the key prefix, excluding the expired ones.
+// The length of the values is counted per key, even if they're shared by WithDedup().
+func (lfu *tinyLFU) Size(keyPrefix string) (int, int) {
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	now := lfu.clock.Now()
+	entries, bytes := 0, 0
+	for key, entry := range lfu.entries {
+		if !strings.HasPrefix(key, keyPrefix) || !entry.expireAt.After(now) {
+			continue
+		}
+
+		entries++
+		bytes += entry.size
+	}
+
+	return entries, bytes
+}
+
+// Keys lists the keys set by MSet() or RPush() starting with the key prefix in the sorted order,
+// excluding the expired ones.
+func (lfu *tinyLFU) Keys(keyPrefix string) []string {
+	lfu.mut.Lock()
+	defer lfu.mut.Unlock()
+
+	now := lfu.clock.Now()
+	keys := []string{}
+	for key, entry := range lfu.entries {
+		if !strings.HasPrefix(key, keyPrefix) || !entry.expireAt.After(now) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Stats returns the statistics of tinyLFU. It's safe to call without blocking other operations.
+func (lfu *tinyLFU) Stats() Stats {
+	return Stats{
+		Hits:      atomic.LoadUint64(&lfu.hits),
+		Misses:    atomic.LoadUint64(&lfu.misses),
+		Sets:      atomic.LoadUint64(&lfu.sets),
+		Evictions: atomic.LoadUint64(&lfu.evictions),
+	}
+}
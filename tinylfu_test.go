@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,10 +19,32 @@ var (
 	mockLfuBytes = []byte(mockLfuString)
 )
 
+// manualClock is the clock advanced manually like cachetest.ManualClock, which can't be imported by the internal
+// tests since cachetest depends on this package.
+type manualClock struct {
+	mut sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
 type tinyLFUSuite struct {
 	suite.Suite
 
-	lfu *tinyLFU
+	lfu   *tinyLFU
+	clock *manualClock
 }
 
 func (s *tinyLFUSuite) SetupSuite() {}
@@ -29,7 +52,8 @@ func (s *tinyLFUSuite) SetupSuite() {}
 func (s *tinyLFUSuite) TearDownSuite() {}
 
 func (s *tinyLFUSuite) SetupTest() {
-	s.lfu = NewTinyLFU(10000).(*tinyLFU)
+	s.clock = &manualClock{now: time.Now()}
+	s.lfu = NewTinyLFU(10000, WithClock(s.clock)).(*tinyLFU)
 }
 
 func (s *tinyLFUSuite) TearDownTest() {}
@@ -161,12 +185,19 @@ func (s *tinyLFUSuite) TestMSet() {
 			TTL:      50 * time.Millisecond,
 			ExpError: nil,
 			CheckFunc: func(desc string) {
-				// wait until it expired
-				time.Sleep(time.Millisecond * 300)
+				vals, err := s.lfu.MGet(mockLfuCTX, []string{"normal-set-expired"})
+				s.Require().NoError(err, desc)
+				s.Require().Equal([]Value{{Valid: true, Bytes: mockLfuBytes}}, vals, desc)
+
+				// expired including the offset
+				s.clock.Advance(time.Second)
 
-				b, exist := s.lfu.lfu.Get("normal-set-expired")
+				vals, err = s.lfu.MGet(mockLfuCTX, []string{"normal-set-expired"})
+				s.Require().NoError(err, desc)
+				s.Require().Equal([]Value{{Valid: false, Bytes: nil}}, vals, desc)
+
+				_, exist := s.lfu.lfu.Get("normal-set-expired")
 				s.Require().False(exist, desc)
-				s.Require().Equal(nil, b, desc)
 			},
 		},
 	}
@@ -235,3 +266,380 @@ func (s *tinyLFUSuite) TestDel() {
 		s.TearDownTest()
 	}
 }
+
+func (s *tinyLFUSuite) TestMSetWithCostFunc() {
+	costAdd := 0
+	costEvict := 0
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"cost-key": mockLfuBytes}, time.Hour,
+		WithOnCostAddFunc(func(key string, cost int) { costAdd += cost }),
+		WithOnCostEvictFunc(func(key string, cost int) { costEvict += cost }),
+		WithCostFunc(func(key string, b []byte) int {
+			s.Require().Equal("cost-key", key)
+			s.Require().Equal(mockLfuBytes, b)
+			return 3 * len(b)
+		}),
+	))
+	s.Require().Equal(3*len(mockLfuBytes), costAdd)
+
+	s.Require().NoError(s.lfu.Del(mockLfuCTX, "cost-key"))
+	s.Require().Equal(3*len(mockLfuBytes), costEvict)
+}
+
+func (s *tinyLFUSuite) TestClear() {
+	costEvict := 0
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{
+		"ca:pfx:key1":  mockLfuBytes,
+		"ca:pfx:key2":  mockLfuBytes,
+		"ca:pfx2:key1": mockLfuBytes,
+	}, time.Hour, WithOnCostEvictFunc(func(key string, cost int) { costEvict += cost })))
+
+	s.Require().NoError(s.lfu.Clear(mockLfuCTX, "ca:pfx:"))
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"ca:pfx:key1", "ca:pfx:key2", "ca:pfx2:key1"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {}, {Valid: true, Bytes: mockLfuBytes}}, vals)
+	s.Require().Equal(2*len(mockLfuBytes), costEvict)
+	s.Require().Len(s.lfu.entries, 1)
+}
+
+func (s *tinyLFUSuite) TestDelPattern() {
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{
+		"ca:pfx:shoes:1": mockLfuBytes,
+		"ca:pfx:shoes:2": mockLfuBytes,
+		"ca:pfx:hats:1":  mockLfuBytes,
+	}, time.Hour))
+
+	keys, err := s.lfu.DelPattern(mockLfuCTX, "ca:pfx:shoes:*")
+	s.Require().NoError(err)
+	s.Require().ElementsMatch([]string{"ca:pfx:shoes:1", "ca:pfx:shoes:2"}, keys)
+
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"ca:pfx:shoes:1", "ca:pfx:shoes:2", "ca:pfx:hats:1"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {}, {Valid: true, Bytes: mockLfuBytes}}, vals)
+
+	_, err = s.lfu.DelPattern(mockLfuCTX, "ca:pfx:[unclosed")
+	s.Require().Error(err)
+}
+
+func (s *tinyLFUSuite) TestGlobRegexp() {
+	tests := []struct {
+		Pattern string
+		Matched []string
+		Missed  []string
+	}{
+		{Pattern: "h?llo", Matched: []string{"hello", "hallo"}, Missed: []string{"hllo", "heello"}},
+		{Pattern: "h*llo", Matched: []string{"hllo", "heeeello"}, Missed: []string{"hell"}},
+		{Pattern: "h[ae]llo", Matched: []string{"hello", "hallo"}, Missed: []string{"hillo"}},
+		{Pattern: "h[^e]llo", Matched: []string{"hallo"}, Missed: []string{"hello"}},
+		{Pattern: "h[a-b]llo", Matched: []string{"hallo", "hbllo"}, Missed: []string{"hcllo"}},
+		{Pattern: `h\*llo`, Matched: []string{"h*llo"}, Missed: []string{"hello"}},
+		{Pattern: "a.b", Matched: []string{"a.b"}, Missed: []string{"axb"}},
+	}
+
+	for _, t := range tests {
+		re, err := globRegexp(t.Pattern)
+		s.Require().NoError(err, t.Pattern)
+
+		for _, m := range t.Matched {
+			s.Require().True(re.MatchString(m), t.Pattern+" "+m)
+		}
+		for _, m := range t.Missed {
+			s.Require().False(re.MatchString(m), t.Pattern+" "+m)
+		}
+	}
+}
+
+func (s *tinyLFUSuite) TestSetNXAndSetXX() {
+	added := 0
+	costAdd := WithOnCostAddFunc(func(key string, cost int) { added++ })
+
+	// not existed yet
+	set, err := s.lfu.SetXX(mockLfuCTX, "cond-key", []byte("v1"), time.Hour, costAdd)
+	s.Require().NoError(err)
+	s.Require().False(set)
+
+	set, err = s.lfu.SetNX(mockLfuCTX, "cond-key", []byte("v1"), time.Hour, costAdd)
+	s.Require().NoError(err)
+	s.Require().True(set)
+
+	// existed already
+	set, err = s.lfu.SetNX(mockLfuCTX, "cond-key", []byte("v2"), time.Hour, costAdd)
+	s.Require().NoError(err)
+	s.Require().False(set)
+
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"cond-key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v1")}}, vals)
+
+	set, err = s.lfu.SetXX(mockLfuCTX, "cond-key", []byte("v2"), time.Hour, costAdd)
+	s.Require().NoError(err)
+	s.Require().True(set)
+
+	vals, err = s.lfu.MGet(mockLfuCTX, []string{"cond-key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v2")}}, vals)
+	s.Require().Equal(2, added)
+}
+
+func (s *tinyLFUSuite) TestGetDel() {
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"getdel-key": []byte("v1")}, time.Hour))
+
+	val, err := s.lfu.GetDel(mockLfuCTX, "getdel-key")
+	s.Require().NoError(err)
+	s.Require().Equal(Value{Valid: true, Bytes: []byte("v1")}, val)
+
+	// taken already
+	val, err = s.lfu.GetDel(mockLfuCTX, "getdel-key")
+	s.Require().NoError(err)
+	s.Require().Equal(Value{Valid: false, Bytes: nil}, val)
+
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"getdel-key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+}
+
+func (s *tinyLFUSuite) TestRPushAndLRange() {
+	s.Require().NoError(s.lfu.RPush(mockLfuCTX, "list-key", [][]byte{[]byte("v1"), []byte("v2")}, 3, time.Hour))
+	s.Require().NoError(s.lfu.RPush(mockLfuCTX, "list-key", [][]byte{[]byte("v3"), []byte("v4")}, 3, time.Hour))
+
+	// only the latest ones are kept
+	vals, err := s.lfu.LRange(mockLfuCTX, "list-key", 0, -1)
+	s.Require().NoError(err)
+	s.Require().Equal([][]byte{[]byte("v2"), []byte("v3"), []byte("v4")}, vals)
+
+	vals, err = s.lfu.LRange(mockLfuCTX, "list-key", -2, 10)
+	s.Require().NoError(err)
+	s.Require().Equal([][]byte{[]byte("v3"), []byte("v4")}, vals)
+
+	vals, err = s.lfu.LRange(mockLfuCTX, "list-key", 2, 1)
+	s.Require().NoError(err)
+	s.Require().Empty(vals)
+
+	vals, err = s.lfu.LRange(mockLfuCTX, "not-existed", 0, -1)
+	s.Require().NoError(err)
+	s.Require().Empty(vals)
+
+	// the list is invisible to MGet
+	mVals, err := s.lfu.MGet(mockLfuCTX, []string{"list-key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, mVals)
+
+	// the keys holding bytes aren't lists
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"bytes-key": []byte("v1")}, time.Hour))
+	s.Require().Equal(ErrNotList, s.lfu.RPush(mockLfuCTX, "bytes-key", [][]byte{[]byte("v2")}, 0, time.Hour))
+	_, err = s.lfu.LRange(mockLfuCTX, "bytes-key", 0, -1)
+	s.Require().Equal(ErrNotList, err)
+}
+
+func (s *tinyLFUSuite) TestMSetWithMaxBytes() {
+	lfu := NewTinyLFU(10000, WithMaxBytes(10)).(*tinyLFU)
+
+	evicted := map[string]int{}
+	costEvict := WithOnCostEvictFunc(func(key string, cost int) { evicted[key] += cost })
+
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key1": []byte("1234")}, time.Hour, costEvict))
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key2": []byte("1234")}, time.Hour, costEvict))
+	s.Require().Equal(8, lfu.bytes)
+
+	// overwriting releases the previous value without counting the eviction
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key2": []byte("12345")}, time.Hour, costEvict))
+	s.Require().Equal(9, lfu.bytes)
+	s.Require().Equal(map[string]int{"key2": 4}, evicted)
+	s.Require().Equal(uint64(0), lfu.Stats().Evictions)
+
+	// the oldest key is evicted to fit in
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key3": []byte("123")}, time.Hour, costEvict))
+	s.Require().Equal(8, lfu.bytes)
+	s.Require().Equal(map[string]int{"key1": 4, "key2": 4}, evicted)
+	s.Require().Equal(uint64(1), lfu.Stats().Evictions)
+
+	vals, err := lfu.MGet(mockLfuCTX, []string{"key1", "key2", "key3"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{
+		{},
+		{Valid: true, Bytes: []byte("12345")},
+		{Valid: true, Bytes: []byte("123")},
+	}, vals)
+
+	// larger than the budget
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key4": []byte("12345678901")}, time.Hour, costEvict))
+	vals, err = lfu.MGet(mockLfuCTX, []string{"key4"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}}, vals)
+	s.Require().Equal(8, lfu.bytes)
+
+	// deleting releases the bytes
+	s.Require().NoError(lfu.Del(mockLfuCTX, "key2", "key3"))
+	s.Require().Equal(0, lfu.bytes)
+	s.Require().Equal(0, lfu.order.Len())
+
+	s.Require().Panics(func() { NewTinyLFU(10000, WithMaxBytes(-1)) })
+}
+
+func (s *tinyLFUSuite) TestMGetWithMeta() {
+	lfu := NewTinyLFU(10000, WithOffset(0)).(*tinyLFU)
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"meta-key": mockLfuBytes}, time.Hour))
+
+	vals, err := lfu.MGetWithMeta(mockLfuCTX, []string{"meta-key", "not-existed"})
+	s.Require().NoError(err)
+	s.Require().Len(vals, 2)
+	s.Require().True(vals[0].Valid)
+	s.Require().Equal(mockLfuBytes, vals[0].Bytes)
+	s.Require().True(vals[0].TTL > 0 && vals[0].TTL <= time.Hour)
+	s.Require().Equal(Value{}, vals[1])
+
+	// MGet leaves the TTL zero
+	vals, err = lfu.MGet(mockLfuCTX, []string{"meta-key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: mockLfuBytes}}, vals)
+}
+
+func (s *tinyLFUSuite) TestMSetWithDedup() {
+	lfu := NewTinyLFU(10000, WithDedup()).(*tinyLFU)
+
+	// the identical values are stored once
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key1": []byte("shared"), "key2": []byte("shared")}, time.Hour))
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key3": []byte("shared"), "key4": []byte("unique")}, time.Hour))
+	s.Require().Len(lfu.contents, 2)
+
+	vals, err := lfu.MGet(mockLfuCTX, []string{"key1", "key2", "key3", "key4"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{
+		{Valid: true, Bytes: []byte("shared")},
+		{Valid: true, Bytes: []byte("shared")},
+		{Valid: true, Bytes: []byte("shared")},
+		{Valid: true, Bytes: []byte("unique")},
+	}, vals)
+	s.Require().True(&vals[0].Bytes[0] == &vals[1].Bytes[0])
+	s.Require().True(&vals[0].Bytes[0] == &vals[2].Bytes[0])
+
+	// overwriting and deleting release the references
+	s.Require().NoError(lfu.MSet(mockLfuCTX, map[string][]byte{"key1": []byte("unique")}, time.Hour))
+	s.Require().NoError(lfu.Del(mockLfuCTX, "key2"))
+	s.Require().Len(lfu.contents, 2)
+
+	s.Require().NoError(lfu.Del(mockLfuCTX, "key3"))
+	s.Require().Len(lfu.contents, 1)
+
+	s.Require().NoError(lfu.Clear(mockLfuCTX, "key"))
+	s.Require().Empty(lfu.contents)
+
+	// the values are not shared without the option
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"key1": []byte("shared"), "key2": []byte("shared")}, time.Hour))
+	vals, err = s.lfu.MGet(mockLfuCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().False(&vals[0].Bytes[0] == &vals[1].Bytes[0])
+	s.Require().Nil(s.lfu.contents)
+}
+
+func (s *tinyLFUSuite) TestMSetWithNoOffset() {
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"precise-key": mockLfuBytes}, time.Hour, WithNoOffset()))
+	s.Require().Equal(s.clock.Now().Add(time.Hour), s.lfu.entries["precise-key"].expireAt)
+}
+
+func (s *tinyLFUSuite) TestMSetWithPerKeyTTL() {
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{
+		"per-key-short": mockLfuBytes,
+		"per-key-batch": mockLfuBytes,
+	}, time.Hour, WithNoOffset(), WithPerKeyTTL(map[string]time.Duration{"per-key-short": time.Minute})))
+	s.Require().Equal(s.clock.Now().Add(time.Minute), s.lfu.entries["per-key-short"].expireAt)
+	s.Require().Equal(s.clock.Now().Add(time.Hour), s.lfu.entries["per-key-batch"].expireAt)
+
+	s.clock.Advance(2 * time.Minute)
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"per-key-short", "per-key-batch"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: mockLfuBytes}}, vals)
+}
+
+func (s *tinyLFUSuite) TestMSetWithExpireAt() {
+	expireAt := s.clock.Now().Add(time.Minute)
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"expire-at": mockLfuBytes}, time.Hour, WithExpireAt(expireAt)))
+	s.Require().Equal(expireAt, s.lfu.entries["expire-at"].expireAt)
+
+	// keeping TTL is a no-op
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"keep-ttl": mockLfuBytes}, time.Hour, WithNoOffset(), WithKeepTTL()))
+	s.Require().Equal(s.clock.Now().Add(time.Hour), s.lfu.entries["keep-ttl"].expireAt)
+
+	s.clock.Advance(2 * time.Minute)
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"expire-at", "keep-ttl"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: mockLfuBytes}}, vals)
+}
+
+func (s *tinyLFUSuite) TestStats() {
+	s.Require().Equal(Stats{}, s.lfu.Stats())
+
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"stats-key": mockLfuBytes}, time.Hour))
+	s.Require().Equal(Stats{Sets: 1}, s.lfu.Stats())
+
+	_, err := s.lfu.MGet(mockLfuCTX, []string{"stats-key", "not-existed"})
+	s.Require().NoError(err)
+	s.Require().Equal(Stats{Hits: 1, Misses: 1, Sets: 1}, s.lfu.Stats())
+
+	s.Require().NoError(s.lfu.Del(mockLfuCTX, "stats-key"))
+	s.Require().Equal(Stats{Hits: 1, Misses: 1, Sets: 1, Evictions: 1}, s.lfu.Stats())
+}
+
+func (s *tinyLFUSuite) TestSize() {
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"ca:a:key1": []byte("1234"), "ca:a:key2": []byte("12")}, time.Hour))
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"ca:b:key1": []byte("123")}, time.Minute, WithNoOffset()))
+	s.Require().NoError(s.lfu.RPush(mockLfuCTX, "ca:b:list", [][]byte{[]byte("1"), []byte("23")}, 0, time.Hour))
+
+	entries, bytes := s.lfu.Size("ca:a:")
+	s.Require().Equal(2, entries)
+	s.Require().Equal(6, bytes)
+
+	entries, bytes = s.lfu.Size("")
+	s.Require().Equal(4, entries)
+	s.Require().Equal(12, bytes)
+
+	// the deleted and expired ones are excluded
+	s.Require().NoError(s.lfu.Del(mockLfuCTX, "ca:a:key1"))
+	s.clock.Advance(time.Minute)
+	entries, bytes = s.lfu.Size("")
+	s.Require().Equal(2, entries)
+	s.Require().Equal(5, bytes)
+}
+
+func (s *tinyLFUSuite) TestKeys() {
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"ca:a:key2": []byte("1"), "ca:a:key1": []byte("2")}, time.Hour))
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"ca:b:key1": []byte("3")}, time.Minute, WithNoOffset()))
+	s.Require().NoError(s.lfu.RPush(mockLfuCTX, "ca:b:list", [][]byte{[]byte("1")}, 0, time.Hour))
+
+	s.Require().Equal([]string{"ca:a:key1", "ca:a:key2"}, s.lfu.Keys("ca:a:"))
+	s.Require().Equal([]string{"ca:a:key1", "ca:a:key2", "ca:b:key1", "ca:b:list"}, s.lfu.Keys(""))
+
+	// the deleted and expired ones are excluded
+	s.Require().NoError(s.lfu.Del(mockLfuCTX, "ca:a:key1"))
+	s.clock.Advance(time.Minute)
+	s.Require().Equal([]string{"ca:a:key2", "ca:b:list"}, s.lfu.Keys(""))
+	s.Require().Empty(s.lfu.Keys("ca:c:"))
+}
+
+func (s *tinyLFUSuite) TestTouch() {
+	costEvict := 0
+	s.Require().NoError(s.lfu.MSet(mockLfuCTX, map[string][]byte{"touch-key": mockLfuBytes}, time.Hour,
+		WithOnCostEvictFunc(func(key string, cost int) { costEvict += cost }),
+	))
+	expireAt := s.lfu.entries["touch-key"].expireAt
+
+	// remaining TTL is larger than the threshold, nothing changed
+	s.Require().NoError(s.lfu.Touch(mockLfuCTX, []string{"touch-key", "not-existed"}, 2*time.Hour, time.Minute))
+	s.Require().Equal(expireAt, s.lfu.entries["touch-key"].expireAt)
+
+	// refresh the TTL silently, along with the offset
+	s.Require().NoError(s.lfu.Touch(mockLfuCTX, []string{"touch-key"}, 2*time.Hour, 2*time.Hour))
+	s.Require().True(s.lfu.entries["touch-key"].expireAt.After(expireAt))
+	s.Require().False(s.lfu.entries["touch-key"].expireAt.Before(s.clock.Now().Add(2 * time.Hour)))
+	s.Require().True(s.lfu.entries["touch-key"].expireAt.Before(s.clock.Now().Add(2*time.Hour + maxOffset)))
+	s.Require().Equal(0, costEvict)
+	s.Require().Equal(uint64(0), s.lfu.Stats().Evictions)
+
+	vals, err := s.lfu.MGet(mockLfuCTX, []string{"touch-key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: mockLfuBytes}}, vals)
+
+	// eviction callbacks are kept after touching
+	s.Require().NoError(s.lfu.Del(mockLfuCTX, "touch-key"))
+	s.Require().Equal(len(mockLfuBytes), costEvict)
+	s.Require().NotContains(s.lfu.entries, "touch-key")
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// minTouchSweep is the number of touched keys triggering the first sweep of the outdated ones
+	minTouchSweep = 64
+)
+
+// touchDebouncer remembers when the keys are touched in the shared cache, so that the hits within the interval
+// don't send the touches again. The TTL reset by a touch lasts at least the interval, so skipping them is lossless.
+type touchDebouncer struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mut     sync.Mutex
+	touched map[string]time.Time
+	// nextSweep is the number of touched keys triggering the next sweep of the outdated ones
+	nextSweep int
+}
+
+func newTouchDebouncer(interval time.Duration) *touchDebouncer {
+	return &touchDebouncer{
+		interval:  interval,
+		now:       time.Now,
+		touched:   map[string]time.Time{},
+		nextSweep: minTouchSweep,
+	}
+}
+
+// due returns the keys not touched within the interval, and records them as touched now.
+func (d *touchDebouncer) due(keys []string) []string {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	now := d.now()
+	dueKeys := []string{}
+	for _, key := range keys {
+		if at, ok := d.touched[key]; ok && now.Sub(at) < d.interval {
+			continue
+		}
+
+		d.touched[key] = now
+		dueKeys = append(dueKeys, key)
+	}
+
+	// the keys never hit again are removed by sweeping, which bounds the memory
+	if len(d.touched) < d.nextSweep {
+		return dueKeys
+	}
+	for key, at := range d.touched {
+		if now.Sub(at) >= d.interval {
+			delete(d.touched, key)
+		}
+	}
+	d.nextSweep = 2 * len(d.touched)
+	if d.nextSweep < minTouchSweep {
+		d.nextSweep = minTouchSweep
+	}
+
+	return dueKeys
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type touchSuite struct {
+	suite.Suite
+
+	now time.Time
+}
+
+func (s *touchSuite) SetupSuite() {}
+
+func (s *touchSuite) TearDownSuite() {}
+
+func (s *touchSuite) SetupTest() {
+	s.now = time.Date(2022, 11, 23, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *touchSuite) TearDownTest() {}
+
+func TestTouchSuite(t *testing.T) {
+	suite.Run(t, new(touchSuite))
+}
+
+func (s *touchSuite) newDebouncer(interval time.Duration) *touchDebouncer {
+	d := newTouchDebouncer(interval)
+	d.now = func() time.Time { return s.now }
+	return d
+}
+
+func (s *touchSuite) TestDue() {
+	d := s.newDebouncer(time.Second)
+
+	s.Require().Equal([]string{"key1", "key2"}, d.due([]string{"key1", "key2"}))
+	s.Require().Empty(d.due([]string{"key1", "key2"}))
+
+	s.now = s.now.Add(500 * time.Millisecond)
+	s.Require().Equal([]string{"key3"}, d.due([]string{"key1", "key3"}))
+
+	// the interval passed
+	s.now = s.now.Add(500 * time.Millisecond)
+	s.Require().Equal([]string{"key1", "key2"}, d.due([]string{"key1", "key2", "key3"}))
+}
+
+func (s *touchSuite) TestSweep() {
+	d := s.newDebouncer(time.Second)
+
+	for i := 0; i < minTouchSweep-1; i++ {
+		d.due([]string{"old-" + strconv.Itoa(i)})
+	}
+	s.now = s.now.Add(time.Second)
+
+	// the outdated keys are swept once the threshold is reached
+	s.Require().Equal([]string{"new"}, d.due([]string{"new"}))
+	s.Require().Len(d.touched, 1)
+	s.Require().Equal(minTouchSweep, d.nextSweep)
+}
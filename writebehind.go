@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWriteBehindBufferSize = 1000
+	// defaultWriteBehindTimeout bounds each flushing if the operation timeout of the factory is not specified
+	defaultWriteBehindTimeout = 10 * time.Second
+)
+
+// writeBehind buffers the writes to the shared cache, and flushes them in batches by the background goroutine.
+// Only the latest value of each key is kept, so writes to the same key are debounced.
+type writeBehind struct {
+	shared   Adapter
+	ttl      time.Duration
+	interval time.Duration
+	size     int
+	// timeout bounds each flushing in the background, so that closing never hangs on the stalled shared cache
+	timeout time.Duration
+	// onFlushed is triggered with the keys written into the shared cache
+	onFlushed func(ctx context.Context, keys []string)
+	// onFailed is triggered with the error of flushing, and the number of the writes dropped for the full buffer
+	onFailed func(ctx context.Context, err error, dropped int)
+
+	mut     sync.Mutex
+	pending map[string][]byte
+	// inflight is the batch being written into the shared cache, which is readable until the writing completes
+	inflight map[string][]byte
+	// flushMut serializes flushing and dropping, which prevents the dropped keys written by the flushing in-flight
+	flushMut sync.Mutex
+
+	flushChan chan struct{}
+	closeChan chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func newWriteBehind(
+	shared Adapter, ttl, interval, timeout time.Duration, size int,
+	onFlushed func(ctx context.Context, keys []string), onFailed func(ctx context.Context, err error, dropped int),
+) *writeBehind {
+	wb := &writeBehind{
+		shared:    shared,
+		ttl:       ttl,
+		interval:  interval,
+		timeout:   timeout,
+		size:      size,
+		onFlushed: onFlushed,
+		onFailed:  onFailed,
+		pending:   map[string][]byte{},
+		flushChan: make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+	}
+
+	wb.wg.Add(1)
+	go wb.run()
+
+	return wb
+}
+
+func (wb *writeBehind) run() {
+	defer wb.wg.Done()
+
+	ticker := time.NewTicker(wb.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wb.closeChan:
+			// flush the pending writes before leaving
+			wb.flushWithTimeout()
+			return
+		case <-ticker.C:
+		case <-wb.flushChan:
+		}
+
+		wb.flushWithTimeout()
+	}
+}
+
+// flushWithTimeout flushes the pending writes bounded by the timeout, the failure is reported by onFailed.
+func (wb *writeBehind) flushWithTimeout() {
+	ctx, cancel := context.WithTimeout(context.Background(), wb.timeout)
+	defer cancel()
+
+	wb.flush(ctx)
+}
+
+// add buffers the writes, and triggers flushing immediately when the buffer is full.
+func (wb *writeBehind) add(keyBytes map[string][]byte) {
+	wb.mut.Lock()
+	for k, b := range keyBytes {
+		wb.pending[k] = b
+	}
+	full := len(wb.pending) >= wb.size
+	wb.mut.Unlock()
+
+	if full {
+		select {
+		case wb.flushChan <- struct{}{}:
+		default:
+			// flushing is triggered already
+		}
+	}
+}
+
+// get returns the pending writes of the keys including the ones being flushed, which supports reading your writes
+// before flushing completes.
+func (wb *writeBehind) get(keys []string) []Value {
+	wb.mut.Lock()
+	defer wb.mut.Unlock()
+
+	vals := make([]Value, len(keys))
+	for i, k := range keys {
+		if b, ok := wb.pending[k]; ok {
+			vals[i] = Value{Valid: true, Bytes: b}
+		} else if b, ok := wb.inflight[k]; ok {
+			vals[i] = Value{Valid: true, Bytes: b}
+		}
+	}
+
+	return vals
+}
+
+// drop discards the pending writes of the keys, e.g. the keys are deleted.
+func (wb *writeBehind) drop(keys ...string) {
+	wb.flushMut.Lock()
+	defer wb.flushMut.Unlock()
+
+	wb.mut.Lock()
+	defer wb.mut.Unlock()
+
+	for _, k := range keys {
+		delete(wb.pending, k)
+	}
+}
+
+// dropAll discards all pending writes, e.g. the prefix is flushed.
+func (wb *writeBehind) dropAll() {
+	wb.flushMut.Lock()
+	defer wb.flushMut.Unlock()
+
+	wb.mut.Lock()
+	defer wb.mut.Unlock()
+
+	wb.pending = map[string][]byte{}
+}
+
+func (wb *writeBehind) flush(ctx context.Context) error {
+	wb.flushMut.Lock()
+	defer wb.flushMut.Unlock()
+
+	wb.mut.Lock()
+	pending := wb.pending
+	wb.pending = map[string][]byte{}
+	wb.inflight = pending
+	wb.mut.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := wb.shared.MSet(ctx, pending, wb.ttl)
+	if err != nil {
+		// put them back for the next round unless newer values are written,
+		// and drop the ones beyond the buffer size, which bounds the memory while the shared cache is down
+		dropped := 0
+		wb.mut.Lock()
+		wb.inflight = nil
+		for k, b := range pending {
+			if _, ok := wb.pending[k]; ok {
+				continue
+			}
+			if len(wb.pending) >= wb.size {
+				dropped++
+				continue
+			}
+
+			wb.pending[k] = b
+		}
+		wb.mut.Unlock()
+
+		if wb.onFailed != nil {
+			wb.onFailed(ctx, err, dropped)
+		}
+
+		return err
+	}
+
+	wb.mut.Lock()
+	wb.inflight = nil
+	wb.mut.Unlock()
+
+	if wb.onFlushed != nil {
+		keys := make([]string, 0, len(pending))
+		for k := range pending {
+			keys = append(keys, k)
+		}
+
+		wb.onFlushed(ctx, keys)
+	}
+
+	return nil
+}
+
+// close stops the background goroutine after flushing the pending writes.
+func (wb *writeBehind) close() {
+	wb.closeOnce.Do(func() {
+		close(wb.closeChan)
+		wb.wg.Wait()
+	})
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	mockWBCTX = context.Background()
+)
+
+type failingAdapter struct {
+	Adapter
+	mut  sync.Mutex
+	fail bool
+}
+
+func (adp *failingAdapter) MSet(ctx context.Context, keyVals map[string][]byte, ttl time.Duration, options ...MSetOptions) error {
+	adp.mut.Lock()
+	defer adp.mut.Unlock()
+
+	if adp.fail {
+		return errors.New("failed to set")
+	}
+
+	return adp.Adapter.MSet(ctx, keyVals, ttl, options...)
+}
+
+type writeBehindSuite struct {
+	suite.Suite
+
+	shared    Adapter
+	sharedLog *RecordLog
+}
+
+func (s *writeBehindSuite) SetupSuite() {}
+
+func (s *writeBehindSuite) TearDownSuite() {}
+
+func (s *writeBehindSuite) SetupTest() {
+	s.shared, s.sharedLog = NewRecordingAdapter(NewTinyLFU(10000))
+}
+
+func (s *writeBehindSuite) TearDownTest() {}
+
+func TestWriteBehindSuite(t *testing.T) {
+	suite.Run(t, new(writeBehindSuite))
+}
+
+func (s *writeBehindSuite) TestFlushByInterval() {
+	flushed := make(chan []string, 1)
+	wb := newWriteBehind(s.shared, time.Hour, 50*time.Millisecond, time.Second, 100, func(ctx context.Context, keys []string) {
+		flushed <- keys
+	}, nil)
+	defer wb.close()
+
+	// debounced per key
+	wb.add(map[string][]byte{"key": []byte("v1")})
+	wb.add(map[string][]byte{"key": []byte("v2")})
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v2")}, {}}, wb.get([]string{"key", "not-existed"}))
+	s.Require().Empty(s.sharedLog.Records())
+
+	s.Require().Equal([]string{"key"}, <-flushed)
+	s.Require().Equal([]Record{{Op: RecordOpMSet, Keys: []string{"key"}, TTL: time.Hour}}, s.sharedLog.Records())
+	s.Require().Equal([]Value{{}}, wb.get([]string{"key"}))
+
+	vals, err := s.shared.MGet(mockWBCTX, []string{"key"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v2")}}, vals)
+}
+
+func (s *writeBehindSuite) TestFlushByBufferSize() {
+	flushed := make(chan []string, 1)
+	wb := newWriteBehind(s.shared, time.Hour, time.Hour, time.Second, 2, func(ctx context.Context, keys []string) {
+		flushed <- keys
+	}, nil)
+	defer wb.close()
+
+	wb.add(map[string][]byte{"key1": []byte("v1")})
+	wb.add(map[string][]byte{"key2": []byte("v2")})
+
+	select {
+	case keys := <-flushed:
+		s.Require().ElementsMatch([]string{"key1", "key2"}, keys)
+	case <-time.After(time.Second):
+		s.Fail("not flushed when the buffer is full")
+	}
+}
+
+func (s *writeBehindSuite) TestDrop() {
+	wb := newWriteBehind(s.shared, time.Hour, time.Hour, time.Second, 100, nil, nil)
+
+	wb.add(map[string][]byte{"key1": []byte("v1"), "key2": []byte("v2"), "key3": []byte("v3")})
+	wb.drop("key1")
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte("v2")}}, wb.get([]string{"key1", "key2"}))
+
+	wb.dropAll()
+	s.Require().Equal([]Value{{}, {}}, wb.get([]string{"key2", "key3"}))
+
+	wb.close()
+	s.Require().Empty(s.sharedLog.Records())
+}
+
+func (s *writeBehindSuite) TestFlushOnClose() {
+	wb := newWriteBehind(s.shared, time.Hour, time.Hour, time.Second, 100, nil, nil)
+
+	wb.add(map[string][]byte{"key": []byte("v1")})
+	wb.close()
+	s.Require().Equal([]Record{{Op: RecordOpMSet, Keys: []string{"key"}, TTL: time.Hour}}, s.sharedLog.Records())
+
+	// closing twice is fine
+	wb.close()
+}
+
+func (s *writeBehindSuite) TestFlushWithError() {
+	shared := &failingAdapter{Adapter: s.shared, fail: true}
+	wb := newWriteBehind(shared, time.Hour, time.Hour, time.Second, 100, nil, nil)
+	defer wb.close()
+
+	wb.add(map[string][]byte{"key1": []byte("v1"), "key2": []byte("v1")})
+	s.Require().Error(wb.flush(mockWBCTX))
+
+	// kept for the next round unless newer values are written
+	wb.add(map[string][]byte{"key2": []byte("v2")})
+	s.Require().Equal(
+		[]Value{{Valid: true, Bytes: []byte("v1")}, {Valid: true, Bytes: []byte("v2")}},
+		wb.get([]string{"key1", "key2"}),
+	)
+
+	shared.mut.Lock()
+	shared.fail = false
+	shared.mut.Unlock()
+	s.Require().NoError(wb.flush(mockWBCTX))
+
+	vals, err := s.shared.MGet(mockWBCTX, []string{"key1", "key2"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v1")}, {Valid: true, Bytes: []byte("v2")}}, vals)
+}
+
+func (s *writeBehindSuite) TestFlushWithErrorOverBufferSize() {
+	shared := &blockingAdapter{Adapter: s.shared, release: make(chan error)}
+	failed := make(chan int, 1)
+	wb := newWriteBehind(shared, time.Hour, time.Hour, time.Second, 2, nil, func(ctx context.Context, err error, dropped int) {
+		failed <- dropped
+	})
+
+	wb.add(map[string][]byte{"key1": []byte("v1")})
+	flushErr := make(chan error, 1)
+	go func() {
+		flushErr <- wb.flush(mockWBCTX)
+	}()
+	s.Require().Eventually(func() bool {
+		wb.mut.Lock()
+		defer wb.mut.Unlock()
+		return wb.inflight != nil
+	}, time.Second, time.Millisecond)
+
+	// the write in-flight is still readable
+	s.Require().Equal([]Value{{Valid: true, Bytes: []byte("v1")}}, wb.get([]string{"key1"}))
+
+	// the buffer is full of newer writes while flushing, so the failed write is dropped and reported
+	wb.add(map[string][]byte{"key2": []byte("v2"), "key3": []byte("v3")})
+	shared.release <- errors.New("failed to set")
+	s.Require().Error(<-flushErr)
+	s.Require().Equal(1, <-failed)
+	s.Require().Equal([]Value{{}}, wb.get([]string{"key1"}))
+
+	close(shared.release)
+	wb.close()
+
+	vals, err := s.shared.MGet(mockWBCTX, []string{"key1", "key2", "key3"})
+	s.Require().NoError(err)
+	s.Require().Equal([]Value{{}, {Valid: true, Bytes: []byte("v2")}, {Valid: true, Bytes: []byte("v3")}}, vals)
+}
+
+func (s *writeBehindSuite) TestFlushWithTimeout() {
+	failed := make(chan error, 1)
+	wb := newWriteBehind(&slowAdapter{Adapter: s.shared}, time.Hour, time.Hour, 50*time.Millisecond, 100, nil,
+		func(ctx context.Context, err error, dropped int) {
+			failed <- err
+		},
+	)
+
+	// closing isn't blocked by the stalled shared cache
+	wb.add(map[string][]byte{"key": []byte("v1")})
+	closed := make(chan struct{})
+	go func() {
+		wb.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		s.Fail("flushing not bounded by the timeout")
+	}
+	s.Require().ErrorIs(<-failed, context.DeadlineExceeded)
+}